@@ -0,0 +1,608 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"repram/internal/gossip"
+	"repram/internal/logging"
+	"repram/internal/node"
+	"repram/internal/webhook"
+)
+
+// minClusterSecretLength is the shortest REPRAM_CLUSTER_SECRET accepted.
+// HMAC-SHA256 with a handful of characters is trivially brute-forced.
+// Admin tokens, webhook secrets and audit salts get the same minimum.
+const minClusterSecretLength = 16
+
+// maxStorageMBLimit caps REPRAM_MAX_STORAGE_MB at 1 TiB. Anything larger is
+// almost certainly a units mistake (bytes or KB entered instead of MB).
+const maxStorageMBLimit = 1024 * 1024
+
+// maxGossipMBLimit caps REPRAM_MAX_GOSSIP_MB. A single gossip message is
+// buffered in memory; the cap keeps a peer from making us allocate gigabytes.
+const maxGossipMBLimit = 1024
+
+// maxKeyLengthLimit caps REPRAM_MAX_KEY_LENGTH. Keys travel in URLs and in
+// every gossip message; proxies commonly reject URLs beyond ~8 KB.
+const maxKeyLengthLimit = 4096
+
+// maxRequestTimeout caps REPRAM_REQUEST_TIMEOUTS at an hour. A request
+// held longer is a connection leak, not a slow link.
+const maxRequestTimeout = 3600
+
+// maxTTLJitterPct caps REPRAM_TTL_JITTER_PCT. Past half, a value could
+// vanish well before a writer that set its TTL has any reason to expect.
+const maxTTLJitterPct = 50
+
+// Config holds the node configuration read from REPRAM_* environment variables.
+type Config struct {
+	NodeID             string
+	Address            string
+	HTTPPort           int
+	GossipPort         int
+	InternalPort       int    // gossip and bootstrap endpoints' own port (0 = on HTTPPort)
+	InternalBind       string // interface address for InternalPort (empty = all)
+	ReplicationFactor  int
+	MaxReplication     int            // most nodes one write may be stored on
+	NamespaceReplicas  map[string]int // key namespace → nodes its writes are stored on
+	MinTTL             int            // seconds
+	MaxTTL             int            // seconds
+	DefaultTTL         int            // seconds, for writes that don't set one
+	NamespaceTTLs      map[string]int // key namespace → default TTL in seconds
+	TTLJitterPct       int            // percent by which write TTLs are randomly shortened (0 = off)
+	RateLimit          int            // requests per second per IP
+	TokenRateLimits    map[string]int // API token → requests per second (replaces the per-IP limit)
+	NamespaceRateLimit int            // requests per second per key namespace (0 = off)
+	ClusterRateLimit   int            // requests per second per IP across the cluster (0 = off)
+	WriteByteLimit     int            // bytes written per second per client (0 = off)
+	MaxStorageMB       int            // 0 = unlimited
+	MaxGossipMB        int            // body limit for gossip and bootstrap requests
+	GossipConcurrency  int            // peers a broadcast sends to in parallel
+	GossipAttempts     int            // tries per gossip send of an idempotent message
+	MaxValueBytes      int            // largest single value the store accepts (0 = unlimited)
+	MemoryHighWaterMB  int            // heap size at which writes start being shed (0 = off)
+	MaxInflight        map[string]int // endpoint class → requests served at once (absent = unlimited)
+	RequestTimeouts    map[string]int // endpoint class → seconds a request may take (absent = node.DefaultTimeouts)
+	WriteTimeout       int            // seconds
+	WriteResend        bool           // resend PUTs to silent replicas halfway through WriteTimeout
+	CacheMaxAge        int            // longest Cache-Control max-age on GET, seconds (0 = no-cache)
+	UI                 bool           // serve the operator dashboard at /ui/
+	AdminToken         string         // bearer token for /v1/admin/ endpoints ("" = disabled)
+	ReadOnly           bool           // refuse client writes; replicated writes are still stored
+	AuditFile          string         // append a hashed record of each client write here ("" = off)
+	AuditMaxMB         int            // rotate AuditFile at this size
+	AuditWebhook       string         // also POST each audit record here ("" = off)
+	AuditSalt          string         // HMAC key for audit hashes ("" = random per start)
+	ClusterSecret      string
+	TrustProxy         bool
+	DialBack           bool   // connect to joining nodes before adding them
+	PeerRateLimit      bool   // keep gossip and bootstrap under the per-IP rate limit
+	Enclave            string // empty = "default"
+	Zone               string // failure domain replicas spread across (empty = none)
+	Network            string
+	PeerReputation     bool     // signed node registry and peer reputation (public networks)
+	NodeKeyFile        string   // Ed25519 key signing this node's announcements
+	Peers              []string // HTTP addresses (host:httpPort)
+	BootstrapRefresh   int      // seconds between DNS bootstrap re-resolutions (0 = resolve once)
+	PeerCacheFile      string   // known peers saved for the next start (empty = off)
+	LogLevel           logging.Level
+	PolicyFile         string   // request allow/deny rules (empty = allow all)
+	CORSOrigins        []string // browser origins allowed to call the API ("*" = any)
+	MaxKeyLength       int      // bytes
+	ReservedPrefixes   []string // key prefixes clients may not read or write
+	Webhooks           []string // prefix=url callbacks on key creation and expiry
+	WebhookSecret      string   // signs webhook bodies (empty = unsigned)
+	PeerAllowlist      []string // node IDs, IPs, or CIDRs; only these may gossip (empty = any)
+	PeerBlocklist      []string // node IDs, IPs, or CIDRs that may not gossip
+
+	// TLS termination for the HTTP port (all empty = plain HTTP)
+	TLSCert          string   // PEM certificate file
+	TLSKey           string   // PEM private key file
+	TLSAutocertHosts []string // hostnames to obtain Let's Encrypt certificates for
+	TLSAutocertDir   string   // autocert certificate cache directory
+	TLSRedirectPort  int      // plain HTTP port redirecting to HTTPS (0 = disabled)
+	TLSPeerPins      []string // SPKI or certificate pins peers' certificates must match (empty = system roots)
+}
+
+// PeerFilter builds the gossip peer filter from the allow and block lists,
+// or returns nil when both are empty. The lists are checked by Validate.
+func (c *Config) PeerFilter() *gossip.PeerFilter {
+	if len(c.PeerAllowlist) == 0 && len(c.PeerBlocklist) == 0 {
+		return nil
+	}
+	allow, _ := gossip.ParsePeerList(c.PeerAllowlist)
+	block, _ := gossip.ParsePeerList(c.PeerBlocklist)
+	return &gossip.PeerFilter{Allow: allow, Block: block}
+}
+
+// PeerPins parses the peer certificate pins, or returns nil when there are
+// none. The pins are checked by Validate.
+func (c *Config) PeerPins() *gossip.PeerPins {
+	pins, _ := gossip.ParsePeerPins(c.TLSPeerPins)
+	return pins
+}
+
+// Timeouts returns the per-class request timeouts that were set.
+func (c *Config) Timeouts() map[string]time.Duration {
+	if len(c.RequestTimeouts) == 0 {
+		return nil
+	}
+	timeouts := make(map[string]time.Duration, len(c.RequestTimeouts))
+	for class, secs := range c.RequestTimeouts {
+		timeouts[class] = time.Duration(secs) * time.Second
+	}
+	return timeouts
+}
+
+// TLSEnabled reports whether the HTTP port should be served with TLS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCert != "" || c.TLSKey != "" || len(c.TLSAutocertHosts) > 0
+}
+
+// loadConfig reads the configuration from the environment and validates it.
+// If REPRAM_ENV_FILE names a file of KEY=VALUE lines, its values override the
+// process environment; that file is what SIGHUP re-reads, since a running
+// process cannot see changes to its own environment.
+// All problems are reported together so an operator can fix them in one pass.
+func loadConfig() (*Config, error) {
+	env := envReader{lookup: os.Getenv}
+	if path := os.Getenv("REPRAM_ENV_FILE"); path != "" {
+		fileVars, err := readEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		env.lookup = func(key string) string {
+			if v, ok := fileVars[key]; ok {
+				return v
+			}
+			return os.Getenv(key)
+		}
+	}
+
+	// Configuration: one name per setting, no aliases
+	cfg := &Config{
+		NodeID:             env.String("REPRAM_NODE_ID"),
+		Address:            env.String("REPRAM_ADDRESS"),
+		HTTPPort:           env.Int("REPRAM_HTTP_PORT", 8080),
+		GossipPort:         env.Int("REPRAM_GOSSIP_PORT", 9090),
+		InternalPort:       env.Int("REPRAM_INTERNAL_PORT", 0),
+		InternalBind:       env.String("REPRAM_INTERNAL_BIND"),
+		ReplicationFactor:  env.Int("REPRAM_REPLICATION", 3),
+		MaxReplication:     env.Int("REPRAM_MAX_REPLICATION", 5),
+		NamespaceReplicas:  env.NamedInts("REPRAM_NAMESPACE_REPLICATION", "namespace=N"),
+		MinTTL:             env.Int("REPRAM_MIN_TTL", 300),
+		MaxTTL:             env.Int("REPRAM_MAX_TTL", 86400),
+		DefaultTTL:         env.TTL("REPRAM_DEFAULT_TTL", 3600),
+		NamespaceTTLs:      env.NamedTTLs("REPRAM_NAMESPACE_TTL", "namespace=ttl"),
+		TTLJitterPct:       env.Int("REPRAM_TTL_JITTER_PCT", 0),
+		RateLimit:          env.Int("REPRAM_RATE_LIMIT", 100),
+		TokenRateLimits:    env.NamedInts("REPRAM_RATE_LIMIT_TOKENS", "token=rate"),
+		NamespaceRateLimit: env.Int("REPRAM_RATE_LIMIT_NAMESPACE", 0),
+		ClusterRateLimit:   env.Int("REPRAM_RATE_LIMIT_CLUSTER", 0),
+		WriteByteLimit:     env.Int("REPRAM_RATE_LIMIT_BYTES", 0),
+		MaxStorageMB:       env.Int("REPRAM_MAX_STORAGE_MB", 0),
+		MaxGossipMB:        env.Int("REPRAM_MAX_GOSSIP_MB", node.DefaultMaxGossipSize>>20),
+		GossipConcurrency:  env.Int("REPRAM_GOSSIP_CONCURRENCY", gossip.DefaultSendConcurrency),
+		GossipAttempts:     env.Int("REPRAM_GOSSIP_ATTEMPTS", gossip.DefaultRetryPolicy.Attempts),
+		MaxValueBytes:      env.Int("REPRAM_MAX_VALUE_BYTES", 0),
+		MemoryHighWaterMB:  env.Int("REPRAM_MEMORY_HIGH_WATER_MB", 0),
+		MaxInflight:        env.NamedInts("REPRAM_MAX_INFLIGHT", "class=N"),
+		RequestTimeouts:    env.NamedInts("REPRAM_REQUEST_TIMEOUTS", "class=seconds"),
+		WriteTimeout:       env.Int("REPRAM_WRITE_TIMEOUT", 5),
+		WriteResend:        !strings.EqualFold(env.String("REPRAM_WRITE_RESEND"), "false"),
+		CacheMaxAge:        env.Int("REPRAM_CACHE_MAX_AGE", 60),
+		ClusterSecret:      env.String("REPRAM_CLUSTER_SECRET"),
+		TrustProxy:         strings.EqualFold(env.String("REPRAM_TRUST_PROXY"), "true"),
+		DialBack:           strings.EqualFold(env.String("REPRAM_BOOTSTRAP_DIAL_BACK"), "true"),
+		PeerRateLimit:      strings.EqualFold(env.String("REPRAM_PEER_RATE_LIMIT"), "true"),
+		UI:                 strings.EqualFold(env.String("REPRAM_UI"), "true"),
+		AdminToken:         env.String("REPRAM_ADMIN_TOKEN"),
+		ReadOnly:           strings.EqualFold(env.String("REPRAM_READ_ONLY"), "true"),
+		AuditFile:          env.String("REPRAM_AUDIT_FILE"),
+		AuditMaxMB:         env.Int("REPRAM_AUDIT_MAX_MB", 100),
+		AuditWebhook:       env.String("REPRAM_AUDIT_WEBHOOK"),
+		AuditSalt:          env.String("REPRAM_AUDIT_SALT"),
+		Enclave:            env.String("REPRAM_ENCLAVE"),
+		Zone:               env.String("REPRAM_ZONE"),
+		Network:            env.String("REPRAM_NETWORK"),
+		PeerReputation:     strings.EqualFold(env.String("REPRAM_PEER_REPUTATION"), "true"),
+		NodeKeyFile:        env.String("REPRAM_NODE_KEY_FILE"),
+		BootstrapRefresh:   env.Int("REPRAM_BOOTSTRAP_REFRESH", 300),
+		PeerCacheFile:      env.String("REPRAM_PEER_CACHE_FILE"),
+		LogLevel:           env.LogLevel("REPRAM_LOG_LEVEL"),
+		PolicyFile:         env.String("REPRAM_POLICY_FILE"),
+		MaxKeyLength:       env.Int("REPRAM_MAX_KEY_LENGTH", node.DefaultMaxKeyLength),
+		ReservedPrefixes:   env.List("REPRAM_RESERVED_KEY_PREFIXES"),
+		Webhooks:           env.List("REPRAM_WEBHOOKS"),
+		WebhookSecret:      env.String("REPRAM_WEBHOOK_SECRET"),
+		PeerAllowlist:      env.List("REPRAM_PEER_ALLOWLIST"),
+		PeerBlocklist:      env.List("REPRAM_PEER_BLOCKLIST"),
+		TLSCert:            env.String("REPRAM_TLS_CERT"),
+		TLSKey:             env.String("REPRAM_TLS_KEY"),
+		TLSAutocertHosts:   env.List("REPRAM_TLS_AUTOCERT_HOSTS"),
+		TLSAutocertDir:     env.String("REPRAM_TLS_AUTOCERT_DIR"),
+		TLSRedirectPort:    env.Int("REPRAM_TLS_REDIRECT_PORT", 0),
+		TLSPeerPins:        env.List("REPRAM_TLS_PEER_PINS"),
+	}
+
+	// Generate a unique node ID
+	if cfg.NodeID == "" {
+		cfg.NodeID = fmt.Sprintf("node-%d", time.Now().UnixNano())
+	}
+	if cfg.Address == "" {
+		cfg.Address = "localhost"
+	}
+	if cfg.Network == "" {
+		cfg.Network = "public"
+	}
+	if cfg.TLSAutocertDir == "" {
+		cfg.TLSAutocertDir = "autocert-cache"
+	}
+	// Only an explicit REPRAM_DEFAULT_TTL must lie in the TTL range; the
+	// built-in hour is clamped into it, as writes were before the setting.
+	if env.String("REPRAM_DEFAULT_TTL") == "" {
+		cfg.DefaultTTL = min(max(cfg.DefaultTTL, cfg.MinTTL), cfg.MaxTTL)
+	}
+
+	// REPRAM is permissionless: any origin may call the API unless the
+	// operator lists specific ones.
+	cfg.CORSOrigins = env.List("REPRAM_CORS_ORIGINS")
+	if len(cfg.CORSOrigins) == 0 {
+		cfg.CORSOrigins = []string{"*"}
+	}
+
+	// REPRAM_PEERS are HTTP addresses (host:httpPort) since the bootstrap
+	// handshake is an HTTP POST to /v1/bootstrap. Example: "node2:8080,node3:8080"
+	cfg.Peers = env.List("REPRAM_PEERS")
+
+	if err := cfg.Validate(); err != nil {
+		env.errs = append(env.errs, err)
+	}
+	return cfg, errors.Join(env.errs...)
+}
+
+// Validate checks the configuration for values that would start a node in a
+// broken or surprising state. It returns every problem found, not just the first.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.HTTPPort < 1 || c.HTTPPort > 65535 {
+		fail("REPRAM_HTTP_PORT=%d is out of range (1-65535)", c.HTTPPort)
+	}
+	if c.GossipPort < 1 || c.GossipPort > 65535 {
+		fail("REPRAM_GOSSIP_PORT=%d is out of range (1-65535)", c.GossipPort)
+	}
+	if len(c.Zone) > 128 {
+		fail("REPRAM_ZONE is %d bytes; peers refuse zones longer than 128", len(c.Zone))
+	}
+	if c.HTTPPort == c.GossipPort {
+		fail("REPRAM_HTTP_PORT and REPRAM_GOSSIP_PORT are both %d; give them different ports", c.HTTPPort)
+	}
+	if c.InternalPort != 0 {
+		if c.InternalPort < 1 || c.InternalPort > 65535 {
+			fail("REPRAM_INTERNAL_PORT=%d is out of range (1-65535)", c.InternalPort)
+		}
+		if c.InternalPort == c.HTTPPort || c.InternalPort == c.GossipPort {
+			fail("REPRAM_INTERNAL_PORT=%d collides with the HTTP or gossip port", c.InternalPort)
+		}
+	}
+	if c.InternalBind != "" {
+		if c.InternalPort == 0 {
+			fail("REPRAM_INTERNAL_BIND is set but REPRAM_INTERNAL_PORT is not")
+		}
+		if net.ParseIP(c.InternalBind) == nil {
+			fail("REPRAM_INTERNAL_BIND=%q is not an IP address", c.InternalBind)
+		}
+	}
+	if c.ReplicationFactor < 1 {
+		fail("REPRAM_REPLICATION=%d must be at least 1", c.ReplicationFactor)
+	}
+	if c.MaxReplication < 1 {
+		fail("REPRAM_MAX_REPLICATION=%d must be at least 1", c.MaxReplication)
+	}
+	for ns, n := range c.NamespaceReplicas {
+		if n < 1 || n > c.MaxReplication {
+			fail("REPRAM_NAMESPACE_REPLICATION: %s=%d is out of range (1-%d, REPRAM_MAX_REPLICATION)", ns, n, c.MaxReplication)
+		}
+	}
+	if c.MinTTL < 1 {
+		fail("REPRAM_MIN_TTL=%d must be at least 1 second", c.MinTTL)
+	}
+	if c.MinTTL > c.MaxTTL {
+		fail("REPRAM_MIN_TTL=%d is greater than REPRAM_MAX_TTL=%d; every write would be clamped to an inconsistent TTL", c.MinTTL, c.MaxTTL)
+	}
+	if c.DefaultTTL < c.MinTTL || c.DefaultTTL > c.MaxTTL {
+		fail("REPRAM_DEFAULT_TTL=%d is out of range (%d-%d, REPRAM_MIN_TTL to REPRAM_MAX_TTL)", c.DefaultTTL, c.MinTTL, c.MaxTTL)
+	}
+	if c.TTLJitterPct < 0 || c.TTLJitterPct > maxTTLJitterPct {
+		fail("REPRAM_TTL_JITTER_PCT=%d is out of range (0-%d)", c.TTLJitterPct, maxTTLJitterPct)
+	}
+	for ns, ttl := range c.NamespaceTTLs {
+		if ttl < c.MinTTL || ttl > c.MaxTTL {
+			fail("REPRAM_NAMESPACE_TTL: %s=%d is out of range (%d-%d, REPRAM_MIN_TTL to REPRAM_MAX_TTL)", ns, ttl, c.MinTTL, c.MaxTTL)
+		}
+	}
+	if c.RateLimit < 1 {
+		fail("REPRAM_RATE_LIMIT=%d must be at least 1 request per second", c.RateLimit)
+	}
+	for token, rate := range c.TokenRateLimits {
+		if rate < 1 {
+			// Name the token by hash: config errors end up in logs
+			fail("REPRAM_RATE_LIMIT_TOKENS: rate for token sha256:%x must be at least 1 request per second", sha256.Sum256([]byte(token)))
+		}
+	}
+	if c.NamespaceRateLimit < 0 {
+		fail("REPRAM_RATE_LIMIT_NAMESPACE=%d must be 0 (off) or a positive rate", c.NamespaceRateLimit)
+	}
+	if c.ClusterRateLimit < 0 {
+		fail("REPRAM_RATE_LIMIT_CLUSTER=%d must be 0 (off) or a positive rate", c.ClusterRateLimit)
+	}
+	if c.WriteByteLimit < 0 {
+		fail("REPRAM_RATE_LIMIT_BYTES=%d must be 0 (off) or a positive number of bytes per second", c.WriteByteLimit)
+	}
+	if c.WriteTimeout < 1 {
+		fail("REPRAM_WRITE_TIMEOUT=%d must be at least 1 second", c.WriteTimeout)
+	}
+	if c.CacheMaxAge < 0 {
+		fail("REPRAM_CACHE_MAX_AGE=%d must be 0 (no caching) or a positive number of seconds", c.CacheMaxAge)
+	}
+	if c.MaxStorageMB < 0 {
+		fail("REPRAM_MAX_STORAGE_MB=%d must be 0 (unlimited) or a positive size in MB", c.MaxStorageMB)
+	} else if c.MaxStorageMB > maxStorageMBLimit {
+		fail("REPRAM_MAX_STORAGE_MB=%d exceeds %d (1 TiB); the value is in megabytes, not bytes", c.MaxStorageMB, maxStorageMBLimit)
+	}
+	if c.MaxGossipMB < 1 || c.MaxGossipMB > maxGossipMBLimit {
+		fail("REPRAM_MAX_GOSSIP_MB=%d is out of range (1-%d MB)", c.MaxGossipMB, maxGossipMBLimit)
+	}
+	if c.BootstrapRefresh < 0 {
+		fail("REPRAM_BOOTSTRAP_REFRESH=%d must be 0 (resolve once) or a positive interval in seconds", c.BootstrapRefresh)
+	}
+	if c.GossipConcurrency < 1 {
+		fail("REPRAM_GOSSIP_CONCURRENCY=%d must be at least 1", c.GossipConcurrency)
+	}
+	if c.GossipAttempts < 1 || c.GossipAttempts > 10 {
+		fail("REPRAM_GOSSIP_ATTEMPTS=%d is out of range (1-10)", c.GossipAttempts)
+	}
+	if c.MaxValueBytes < 0 {
+		fail("REPRAM_MAX_VALUE_BYTES=%d must be 0 (unlimited) or a positive size in bytes", c.MaxValueBytes)
+	}
+	if c.MemoryHighWaterMB < 0 {
+		fail("REPRAM_MEMORY_HIGH_WATER_MB=%d must be 0 (off) or a positive size in MB", c.MemoryHighWaterMB)
+	} else if c.MemoryHighWaterMB > maxStorageMBLimit {
+		fail("REPRAM_MEMORY_HIGH_WATER_MB=%d exceeds %d (1 TiB); the value is in megabytes, not bytes", c.MemoryHighWaterMB, maxStorageMBLimit)
+	}
+	for class, n := range c.MaxInflight {
+		if !slices.Contains(node.Classes, class) {
+			fail("REPRAM_MAX_INFLIGHT: unknown endpoint class %q (want %s)", class, strings.Join(node.Classes, ", "))
+		} else if n < 1 {
+			fail("REPRAM_MAX_INFLIGHT: %s=%d must be at least 1", class, n)
+		}
+	}
+	for class, secs := range c.RequestTimeouts {
+		if !slices.Contains(node.Classes, class) {
+			fail("REPRAM_REQUEST_TIMEOUTS: unknown endpoint class %q (want %s)", class, strings.Join(node.Classes, ", "))
+		} else if secs < 1 || secs > maxRequestTimeout {
+			fail("REPRAM_REQUEST_TIMEOUTS: %s=%d is out of range (1-%d seconds)", class, secs, maxRequestTimeout)
+		}
+	}
+	if secs, ok := c.RequestTimeouts[node.ClassWrite]; ok && secs <= c.WriteTimeout {
+		fail("REPRAM_REQUEST_TIMEOUTS: write=%d must be longer than REPRAM_WRITE_TIMEOUT=%d, or writes time out before they can answer 202", secs, c.WriteTimeout)
+	}
+	if c.ClusterSecret != "" && len(c.ClusterSecret) < minClusterSecretLength {
+		fail("REPRAM_CLUSTER_SECRET is %d characters; use at least %d, or leave it empty for open mode", len(c.ClusterSecret), minClusterSecretLength)
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < minClusterSecretLength {
+		fail("REPRAM_ADMIN_TOKEN is %d characters; use at least %d, or leave it empty to disable the admin endpoints", len(c.AdminToken), minClusterSecretLength)
+	}
+	if c.Network != "public" && c.Network != "private" {
+		fail("REPRAM_NETWORK=%q must be \"public\" or \"private\"", c.Network)
+	}
+	if c.PeerReputation && c.Network != "public" {
+		fail("REPRAM_PEER_REPUTATION is only for REPRAM_NETWORK=public")
+	}
+	if c.MaxKeyLength < 1 || c.MaxKeyLength > maxKeyLengthLimit {
+		fail("REPRAM_MAX_KEY_LENGTH=%d is out of range (1-%d bytes)", c.MaxKeyLength, maxKeyLengthLimit)
+	}
+	if _, err := node.ParseCORSOrigins(c.CORSOrigins); err != nil {
+		fail("REPRAM_CORS_ORIGINS: %v", err)
+	}
+	if _, err := webhook.ParseHooks(c.Webhooks); err != nil {
+		fail("REPRAM_WEBHOOKS: %v", err)
+	}
+	if c.WebhookSecret != "" && len(c.WebhookSecret) < minClusterSecretLength {
+		fail("REPRAM_WEBHOOK_SECRET is %d characters; use at least %d, or leave it empty for unsigned callbacks", len(c.WebhookSecret), minClusterSecretLength)
+	}
+	if c.AuditFile != "" && c.AuditMaxMB < 1 {
+		fail("REPRAM_AUDIT_MAX_MB=%d must be at least 1", c.AuditMaxMB)
+	}
+	if c.AuditWebhook != "" {
+		if err := webhook.CheckURL(c.AuditWebhook); err != nil {
+			fail("REPRAM_AUDIT_WEBHOOK: %v", err)
+		}
+	}
+	if c.AuditSalt != "" && len(c.AuditSalt) < minClusterSecretLength {
+		fail("REPRAM_AUDIT_SALT is %d characters; use at least %d, or leave it empty for a random salt per start", len(c.AuditSalt), minClusterSecretLength)
+	}
+	if _, err := gossip.ParsePeerList(c.PeerAllowlist); err != nil {
+		fail("REPRAM_PEER_ALLOWLIST: %v", err)
+	}
+	if _, err := gossip.ParsePeerList(c.PeerBlocklist); err != nil {
+		fail("REPRAM_PEER_BLOCKLIST: %v", err)
+	}
+	if _, err := gossip.ParsePeerPins(c.TLSPeerPins); err != nil {
+		fail("REPRAM_TLS_PEER_PINS: %v", err)
+	} else if len(c.TLSPeerPins) > 0 && !c.TLSEnabled() {
+		fail("REPRAM_TLS_PEER_PINS is set but TLS is not enabled; peers only gossip over HTTPS when this node serves it")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		fail("REPRAM_TLS_CERT and REPRAM_TLS_KEY must be set together")
+	}
+	if c.TLSCert != "" && len(c.TLSAutocertHosts) > 0 {
+		fail("REPRAM_TLS_CERT and REPRAM_TLS_AUTOCERT_HOSTS are mutually exclusive; use certificate files or autocert, not both")
+	}
+	if c.TLSRedirectPort != 0 {
+		if !c.TLSEnabled() {
+			fail("REPRAM_TLS_REDIRECT_PORT is set but TLS is not enabled")
+		}
+		if c.TLSRedirectPort < 1 || c.TLSRedirectPort > 65535 {
+			fail("REPRAM_TLS_REDIRECT_PORT=%d is out of range (1-65535)", c.TLSRedirectPort)
+		}
+		if c.TLSRedirectPort == c.HTTPPort || c.TLSRedirectPort == c.GossipPort || c.TLSRedirectPort == c.InternalPort {
+			fail("REPRAM_TLS_REDIRECT_PORT=%d collides with the HTTP, gossip or internal port", c.TLSRedirectPort)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// envReader reads typed environment variables, collecting parse errors
+// instead of silently falling back to defaults.
+type envReader struct {
+	lookup func(string) string
+	errs   []error
+}
+
+// String reads an environment variable as-is (empty when unset).
+func (e *envReader) String(key string) string {
+	return e.lookup(key)
+}
+
+// Int reads an environment variable as int with a default fallback when unset.
+func (e *envReader) Int(key string, defaultVal int) int {
+	v := e.lookup(key)
+	if v == "" {
+		return defaultVal
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s=%q is not an integer", key, v))
+		return defaultVal
+	}
+	return n
+}
+
+// List reads a comma-separated environment variable, trimming whitespace
+// and dropping empty items.
+func (e *envReader) List(key string) []string {
+	var items []string
+	for _, item := range strings.Split(e.lookup(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// TTL reads an environment variable as a TTL in seconds, given as whole
+// seconds or as a duration such as "15m" or "1d" (see node.ParseTTL), with
+// a default fallback when unset.
+func (e *envReader) TTL(key string, defaultVal int) int {
+	v := strings.TrimSpace(e.lookup(key))
+	if v == "" {
+		return defaultVal
+	}
+	secs, err := ttlSeconds(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+		return defaultVal
+	}
+	return secs
+}
+
+// NamedInts reads a comma-separated list of name=integer pairs, e.g.
+// "tokenA=500,tokenB=1000". form is the pair as documented, such as
+// "token=rate", for the error an invalid entry gets.
+func (e *envReader) NamedInts(key, form string) map[string]int {
+	return e.named(key, form, strconv.Atoi)
+}
+
+// NamedTTLs reads a comma-separated list of name=TTL pairs, each TTL as
+// TTL takes it, e.g. "session=15m,chat=1d". Values are in seconds.
+func (e *envReader) NamedTTLs(key, form string) map[string]int {
+	return e.named(key, form, ttlSeconds)
+}
+
+func (e *envReader) named(key, form string, parse func(string) (int, error)) map[string]int {
+	items := e.List(key)
+	if len(items) == 0 {
+		return nil
+	}
+	values := make(map[string]int, len(items))
+	for _, item := range items {
+		name, valueStr, ok := strings.Cut(item, "=")
+		value, err := parse(strings.TrimSpace(valueStr))
+		name = strings.TrimSpace(name)
+		if !ok || err != nil || name == "" {
+			e.errs = append(e.errs, fmt.Errorf("%s: expected %s pairs, got an invalid entry", key, form))
+			continue
+		}
+		values[name] = value
+	}
+	return values
+}
+
+// ttlSeconds parses s with node.ParseTTL, the parser X-TTL and ?ttl= go
+// through, and returns whole seconds.
+func ttlSeconds(s string) (int, error) {
+	ttl, err := node.ParseTTL(s)
+	if err != nil {
+		return 0, err
+	}
+	return int(ttl / time.Second), nil
+}
+
+// LogLevel reads an environment variable as a log level (default: info).
+func (e *envReader) LogLevel(key string) logging.Level {
+	level, err := logging.ParseLevel(e.lookup(key))
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+	}
+	return level
+}
+
+// readEnvFile parses a file of KEY=VALUE lines. Blank lines and lines
+// starting with # are ignored; values may be wrapped in single or double quotes.
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("REPRAM_ENV_FILE: %w", err)
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("REPRAM_ENV_FILE %s:%d: expected KEY=VALUE", path, lineNum)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("REPRAM_ENV_FILE %s: %w", path, err)
+	}
+	return vars, nil
+}
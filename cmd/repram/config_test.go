@@ -0,0 +1,260 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// validConfig returns a configuration that passes Validate, for tests to mutate.
+func validConfig() *Config {
+	return &Config{
+		NodeID:            "test-node",
+		Address:           "localhost",
+		HTTPPort:          8080,
+		GossipPort:        9090,
+		ReplicationFactor: 3,
+		MaxReplication:    5,
+		MinTTL:            300,
+		MaxTTL:            86400,
+		DefaultTTL:        3600,
+		RateLimit:         100,
+		MaxStorageMB:      0,
+		WriteTimeout:      5,
+		Network:           "public",
+		MaxKeyLength:      512,
+		MaxGossipMB:       16,
+		GossipConcurrency: 8,
+		GossipAttempts:    3,
+	}
+}
+
+func TestValidConfigPasses(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("expected valid config, got: %v", err)
+	}
+}
+
+func TestValidateRejectsBadValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr string
+	}{
+		{"min TTL above max", func(c *Config) { c.MinTTL = 3000000 }, "REPRAM_MIN_TTL=3000000 is greater than REPRAM_MAX_TTL=86400"},
+		{"zero min TTL", func(c *Config) { c.MinTTL = 0 }, "REPRAM_MIN_TTL=0"},
+		{"zero replication", func(c *Config) { c.ReplicationFactor = 0 }, "REPRAM_REPLICATION=0"},
+		{"zero max replication", func(c *Config) { c.MaxReplication = 0 }, "REPRAM_MAX_REPLICATION=0"},
+		{"namespace replication above cap", func(c *Config) { c.NamespaceReplicas = map[string]int{"session": 7} }, "REPRAM_NAMESPACE_REPLICATION: session=7"},
+		{"port collision", func(c *Config) { c.GossipPort = 8080 }, "both 8080"},
+		{"http port out of range", func(c *Config) { c.HTTPPort = 70000 }, "REPRAM_HTTP_PORT=70000"},
+		{"gossip port out of range", func(c *Config) { c.GossipPort = 0 }, "REPRAM_GOSSIP_PORT=0"},
+		{"internal port collision", func(c *Config) { c.InternalPort = 8080 }, "REPRAM_INTERNAL_PORT=8080 collides"},
+		{"internal bind without port", func(c *Config) { c.InternalBind = "10.0.0.5" }, "REPRAM_INTERNAL_PORT is not"},
+		{"internal bind not an IP", func(c *Config) { c.InternalPort = 7070; c.InternalBind = "eth0" }, `REPRAM_INTERNAL_BIND="eth0"`},
+		{"short secret", func(c *Config) { c.ClusterSecret = "hunter2" }, "REPRAM_CLUSTER_SECRET is 7 characters"},
+		{"negative storage", func(c *Config) { c.MaxStorageMB = -1 }, "REPRAM_MAX_STORAGE_MB=-1"},
+		{"storage in bytes", func(c *Config) { c.MaxStorageMB = 512 * 1024 * 1024 }, "megabytes, not bytes"},
+		{"zero rate limit", func(c *Config) { c.RateLimit = 0 }, "REPRAM_RATE_LIMIT=0"},
+		{"zero write timeout", func(c *Config) { c.WriteTimeout = 0 }, "REPRAM_WRITE_TIMEOUT=0"},
+		{"unknown network", func(c *Config) { c.Network = "pubic" }, `REPRAM_NETWORK="pubic"`},
+		{"reputation on a private network", func(c *Config) { c.Network, c.PeerReputation = "private", true }, "REPRAM_PEER_REPUTATION is only for REPRAM_NETWORK=public"},
+		{"zero token rate", func(c *Config) { c.TokenRateLimits = map[string]int{"secret-token": 0} }, "REPRAM_RATE_LIMIT_TOKENS: rate for token sha256:930bbdc51b6aed5c2a5678fd6e28dee7a05e8a4b643cfc0b4427c3efb86c0d94"},
+		{"negative namespace rate", func(c *Config) { c.NamespaceRateLimit = -1 }, "REPRAM_RATE_LIMIT_NAMESPACE=-1"},
+		{"CORS origin without scheme", func(c *Config) { c.CORSOrigins = []string{"app.example.com"} }, `REPRAM_CORS_ORIGINS: origin "app.example.com"`},
+		{"CORS wildcard mid-host", func(c *Config) { c.CORSOrigins = []string{"https://app.*.com"} }, "leftmost label"},
+		{"zero key length", func(c *Config) { c.MaxKeyLength = 0 }, "REPRAM_MAX_KEY_LENGTH=0"},
+		{"huge key length", func(c *Config) { c.MaxKeyLength = 1 << 20 }, "REPRAM_MAX_KEY_LENGTH=1048576"},
+		{"negative cluster rate", func(c *Config) { c.ClusterRateLimit = -1 }, "REPRAM_RATE_LIMIT_CLUSTER=-1"},
+		{"webhook without prefix separator", func(c *Config) { c.Webhooks = []string{"https://example.com/hook"} }, "REPRAM_WEBHOOKS:"},
+		{"short admin token", func(c *Config) { c.AdminToken = "hunter2" }, "REPRAM_ADMIN_TOKEN is 7 characters"},
+		{"audit file without rotation size", func(c *Config) { c.AuditFile, c.AuditMaxMB = "audit.log", 0 }, "REPRAM_AUDIT_MAX_MB=0 must be at least 1"},
+		{"bad audit webhook", func(c *Config) { c.AuditWebhook = "ftp://example.com" }, "REPRAM_AUDIT_WEBHOOK"},
+		{"short audit salt", func(c *Config) { c.AuditSalt = "pepper" }, "REPRAM_AUDIT_SALT is 6 characters"},
+		{"short webhook secret", func(c *Config) { c.WebhookSecret = "hunter2" }, "REPRAM_WEBHOOK_SECRET is 7 characters"},
+		{"negative bootstrap refresh", func(c *Config) { c.BootstrapRefresh = -1 }, "REPRAM_BOOTSTRAP_REFRESH=-1"},
+		{"zero gossip concurrency", func(c *Config) { c.GossipConcurrency = 0 }, "REPRAM_GOSSIP_CONCURRENCY=0"},
+		{"zero gossip attempts", func(c *Config) { c.GossipAttempts = 0 }, "REPRAM_GOSSIP_ATTEMPTS=0"},
+		{"negative value size", func(c *Config) { c.MaxValueBytes = -1 }, "REPRAM_MAX_VALUE_BYTES=-1"},
+		{"negative memory high-water", func(c *Config) { c.MemoryHighWaterMB = -1 }, "REPRAM_MEMORY_HIGH_WATER_MB=-1"},
+		{"unknown in-flight class", func(c *Config) { c.MaxInflight = map[string]int{"writes": 100} }, `REPRAM_MAX_INFLIGHT: unknown endpoint class "writes"`},
+		{"zero in-flight limit", func(c *Config) { c.MaxInflight = map[string]int{"read": 0} }, "REPRAM_MAX_INFLIGHT: read=0"},
+		{"unknown timeout class", func(c *Config) { c.RequestTimeouts = map[string]int{"peer": 30} }, `REPRAM_REQUEST_TIMEOUTS: unknown endpoint class "peer"`},
+		{"zero timeout", func(c *Config) { c.RequestTimeouts = map[string]int{"read": 0} }, "REPRAM_REQUEST_TIMEOUTS: read=0 is out of range"},
+		{"write timeout within quorum wait", func(c *Config) { c.RequestTimeouts = map[string]int{"write": c.WriteTimeout} }, "must be longer than REPRAM_WRITE_TIMEOUT"},
+		{"default TTL below minimum", func(c *Config) { c.DefaultTTL = 60 }, "REPRAM_DEFAULT_TTL=60 is out of range (300-86400"},
+		{"namespace TTL above maximum", func(c *Config) { c.NamespaceTTLs = map[string]int{"chat": 100000} }, "REPRAM_NAMESPACE_TTL: chat=100000 is out of range"},
+		{"TTL jitter too wide", func(c *Config) { c.TTLJitterPct = 60 }, "REPRAM_TTL_JITTER_PCT=60 is out of range (0-50)"},
+		{"negative cache max-age", func(c *Config) { c.CacheMaxAge = -1 }, "REPRAM_CACHE_MAX_AGE=-1"},
+		{"zero gossip size", func(c *Config) { c.MaxGossipMB = 0 }, "REPRAM_MAX_GOSSIP_MB=0"},
+		{"bad peer pin", func(c *Config) { c.TLSCert, c.TLSKey, c.TLSPeerPins = "c.pem", "k.pem", []string{"sha256/short"} }, `REPRAM_TLS_PEER_PINS: "sha256/short"`},
+		{"peer pins without TLS", func(c *Config) { c.TLSPeerPins = []string{strings.Repeat("ab", 32)} }, "REPRAM_TLS_PEER_PINS is set but TLS is not enabled"},
+		{"bad peer allowlist CIDR", func(c *Config) { c.PeerAllowlist = []string{"10.0.0.0/33"} }, `REPRAM_PEER_ALLOWLIST: "10.0.0.0/33"`},
+		{"bad peer blocklist CIDR", func(c *Config) { c.PeerBlocklist = []string{"node/1"} }, "REPRAM_PEER_BLOCKLIST:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.mutate(c)
+			err := c.Validate()
+			if err == nil {
+				t.Fatal("expected validation error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDoesNotEchoTokens(t *testing.T) {
+	c := validConfig()
+	c.TokenRateLimits = map[string]int{"secret-token": 0}
+
+	if err := c.Validate(); err == nil || strings.Contains(err.Error(), "secr") {
+		t.Errorf("expected an error that names the token by hash, got: %v", err)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	c := validConfig()
+	c.MinTTL = 100000
+	c.ReplicationFactor = 0
+	c.ClusterSecret = "short"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+	for _, want := range []string{"REPRAM_MIN_TTL", "REPRAM_REPLICATION", "REPRAM_CLUSTER_SECRET"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestValidateAcceptsLongSecret(t *testing.T) {
+	c := validConfig()
+	c.ClusterSecret = "live-test-secret-42"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("expected valid config, got: %v", err)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Setenv("REPRAM_NODE_ID", "env-node")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("defaults should be valid, got: %v", err)
+	}
+	if cfg.NodeID != "env-node" {
+		t.Errorf("NodeID = %q, want env-node", cfg.NodeID)
+	}
+	if cfg.HTTPPort != 8080 || cfg.GossipPort != 9090 {
+		t.Errorf("ports = %d/%d, want 8080/9090", cfg.HTTPPort, cfg.GossipPort)
+	}
+	if cfg.Network != "public" {
+		t.Errorf("Network = %q, want public", cfg.Network)
+	}
+	// Existing clusters upgrade onto the public default, so reputation and
+	// demotion must be asked for
+	if cfg.PeerReputation {
+		t.Error("PeerReputation is on by default, want off unless REPRAM_PEER_REPUTATION=true")
+	}
+}
+
+func TestLoadConfigClampsUnsetDefaultTTL(t *testing.T) {
+	t.Setenv("REPRAM_MAX_TTL", "600")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("an unset REPRAM_DEFAULT_TTL should not fail, got: %v", err)
+	}
+	if cfg.DefaultTTL != 600 {
+		t.Errorf("DefaultTTL = %d, want 600 (clamped to REPRAM_MAX_TTL)", cfg.DefaultTTL)
+	}
+
+	t.Setenv("REPRAM_DEFAULT_TTL", "3600")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "REPRAM_DEFAULT_TTL=3600 is out of range") {
+		t.Errorf("an explicit out-of-range REPRAM_DEFAULT_TTL should fail, got: %v", err)
+	}
+}
+
+func TestLoadConfigTakesTTLDurations(t *testing.T) {
+	t.Setenv("REPRAM_DEFAULT_TTL", "15m")
+	t.Setenv("REPRAM_NAMESPACE_TTL", "session=600,chat=1d")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("duration TTLs should be valid, got: %v", err)
+	}
+	if cfg.DefaultTTL != 900 {
+		t.Errorf("DefaultTTL = %d, want 900", cfg.DefaultTTL)
+	}
+	if cfg.NamespaceTTLs["session"] != 600 || cfg.NamespaceTTLs["chat"] != 86400 {
+		t.Errorf("NamespaceTTLs = %v, want map[chat:86400 session:600]", cfg.NamespaceTTLs)
+	}
+
+	t.Setenv("REPRAM_DEFAULT_TTL", "1w")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "REPRAM_DEFAULT_TTL: TTL \"1w\"") {
+		t.Errorf("expected an invalid REPRAM_DEFAULT_TTL error, got: %v", err)
+	}
+}
+
+func TestLoadConfigRejectsNonInteger(t *testing.T) {
+	t.Setenv("REPRAM_MAX_TTL", "24h")
+
+	_, err := loadConfig()
+	if err == nil {
+		t.Fatal("expected error for non-integer REPRAM_MAX_TTL")
+	}
+	if !strings.Contains(err.Error(), `REPRAM_MAX_TTL="24h" is not an integer`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadConfigParsesPeers(t *testing.T) {
+	t.Setenv("REPRAM_PEERS", " node2:8080, node3:8080,")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Peers) != 2 || cfg.Peers[0] != "node2:8080" || cfg.Peers[1] != "node3:8080" {
+		t.Errorf("Peers = %v, want [node2:8080 node3:8080]", cfg.Peers)
+	}
+}
+
+func TestLoadConfigParsesTokenRates(t *testing.T) {
+	t.Setenv("REPRAM_RATE_LIMIT_TOKENS", "team-a=500, team-b=1000")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.TokenRateLimits) != 2 || cfg.TokenRateLimits["team-a"] != 500 || cfg.TokenRateLimits["team-b"] != 1000 {
+		t.Errorf("TokenRateLimits = %v, want map[team-a:500 team-b:1000]", cfg.TokenRateLimits)
+	}
+}
+
+func TestLoadConfigRejectsMalformedTokenRates(t *testing.T) {
+	t.Setenv("REPRAM_RATE_LIMIT_TOKENS", "team-a=500,team-b")
+
+	_, err := loadConfig()
+	if err == nil || !strings.Contains(err.Error(), "REPRAM_RATE_LIMIT_TOKENS: expected token=rate pairs") {
+		t.Fatalf("expected malformed token rate error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "team-a") {
+		t.Errorf("error should not echo tokens: %v", err)
+	}
+}
+
+func TestLoadConfigNamesValueInPairErrors(t *testing.T) {
+	t.Setenv("REPRAM_REQUEST_TIMEOUTS", "write=slow")
+
+	_, err := loadConfig()
+	if err == nil || !strings.Contains(err.Error(), "REPRAM_REQUEST_TIMEOUTS: expected class=seconds pairs") {
+		t.Fatalf("expected malformed timeout error, got: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"repram/internal/logging"
+)
+
+// bootstrapHostname is resolved for seed nodes on the public network when
+// REPRAM_PEERS is empty.
+const bootstrapHostname = "bootstrap.repram.network"
+
+// dnsResolver is the subset of *net.Resolver used for bootstrap discovery.
+type dnsResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// bootstrapHint is one seed from a TXT record.
+type bootstrapHint struct {
+	addr    string // host:port
+	enclave string // empty = any
+}
+
+// parseBootstrapTXT reads a TXT record of space-separated key=value pairs:
+//
+//	repram addr=seed1.example.net:8080 enclave=eu
+//
+// Records not starting with "repram", or without addr, are ignored so the
+// name can carry unrelated TXT records too. A missing port in addr takes
+// defaultPort.
+func parseBootstrapTXT(record string, defaultPort int) (bootstrapHint, bool) {
+	fields := strings.Fields(record)
+	if len(fields) == 0 || fields[0] != "repram" {
+		return bootstrapHint{}, false
+	}
+	var hint bootstrapHint
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "addr":
+			hint.addr = value
+		case "enclave":
+			hint.enclave = value
+		}
+	}
+	if hint.addr == "" {
+		return bootstrapHint{}, false
+	}
+	if _, _, err := net.SplitHostPort(hint.addr); err != nil {
+		hint.addr = net.JoinHostPort(hint.addr, fmt.Sprint(defaultPort))
+	}
+	return hint, true
+}
+
+// parsePinTXT returns the peer certificate pins in a TXT record, given as
+// pin= pairs alongside or instead of addr:
+//
+//	repram pin=sha256/jZ0nG0k8gJ5ZbUtGjTWLqZ6oV9Ak0Lh2uXcm7S3n5EY=
+func parsePinTXT(record string) []string {
+	fields := strings.Fields(record)
+	if len(fields) == 0 || fields[0] != "repram" {
+		return nil
+	}
+	var pins []string
+	for _, field := range fields[1:] {
+		if pin, ok := strings.CutPrefix(field, "pin="); ok && pin != "" {
+			pins = append(pins, pin)
+		}
+	}
+	return pins
+}
+
+// resolvePeerPinsDNS collects the peer certificate pins published in TXT
+// records under hostname. Returns nil if there are none.
+func resolvePeerPinsDNS(ctx context.Context, r dnsResolver, hostname string) []string {
+	records, err := r.LookupTXT(ctx, hostname)
+	if err != nil {
+		return nil
+	}
+	var pins []string
+	for _, record := range records {
+		pins = append(pins, parsePinTXT(record)...)
+	}
+	return pins
+}
+
+// resolveBootstrapDNS finds seed nodes under hostname. TXT hints are
+// preferred, with seeds in this node's enclave first; then SRV records;
+// then A/AAAA records with defaultPort. Returns nil if nothing resolves.
+func resolveBootstrapDNS(ctx context.Context, r dnsResolver, hostname string, defaultPort int, enclave string) []string {
+	if records, err := r.LookupTXT(ctx, hostname); err == nil {
+		var local, other []string
+		for _, record := range records {
+			hint, ok := parseBootstrapTXT(record, defaultPort)
+			switch {
+			case !ok:
+			case hint.enclave == "" || hint.enclave == enclave:
+				local = append(local, hint.addr)
+			default:
+				other = append(other, hint.addr)
+			}
+		}
+		if peers := append(local, other...); len(peers) > 0 {
+			logging.Info("Resolved %d bootstrap peers via TXT (%d in enclave %s)", len(peers), len(local), enclave)
+			return peers
+		}
+	}
+
+	// Then SRV records for port flexibility
+	_, srvRecords, err := r.LookupSRV(ctx, "gossip", "tcp", hostname)
+	if err == nil && len(srvRecords) > 0 {
+		var peers []string
+		for _, srv := range srvRecords {
+			peers = append(peers, fmt.Sprintf("%s:%d", strings.TrimSuffix(srv.Target, "."), srv.Port))
+		}
+		logging.Info("Resolved %d bootstrap peers via SRV", len(peers))
+		return peers
+	}
+
+	// Fall back to A/AAAA records
+	addrs, err := r.LookupHost(ctx, hostname)
+	if err != nil {
+		logging.Warn("DNS bootstrap resolution failed for %s: %v", hostname, err)
+		return nil
+	}
+
+	var peers []string
+	for _, addr := range addrs {
+		peers = append(peers, net.JoinHostPort(addr, fmt.Sprint(defaultPort)))
+	}
+	logging.Info("Resolved %d bootstrap peers via DNS", len(peers))
+	return peers
+}
+
+// watchBootstrapDNS re-resolves hostname every interval until ctx ends and
+// calls rebootstrap whenever the resolved seed set differs from the last
+// one, so bootstrap hosts can be rotated without restarting nodes. A failed
+// or empty resolution keeps the previous set.
+func watchBootstrapDNS(ctx context.Context, r dnsResolver, hostname string, defaultPort int, enclave string, interval time.Duration, current []string, rebootstrap func([]string)) {
+	last := sortedCopy(current)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			peers := resolveBootstrapDNS(ctx, r, hostname, defaultPort, enclave)
+			if len(peers) == 0 {
+				continue
+			}
+			if next := sortedCopy(peers); !slices.Equal(next, last) {
+				logging.Info("Bootstrap seeds changed (%d → %d); re-bootstrapping", len(last), len(next))
+				last = next
+				rebootstrap(peers)
+			}
+		}
+	}
+}
+
+func sortedCopy(s []string) []string {
+	c := slices.Clone(s)
+	slices.Sort(c)
+	return c
+}
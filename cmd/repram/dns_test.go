@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	txt   []string
+	srv   []*net.SRV
+	hosts []string
+}
+
+func (f *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.txt == nil {
+		return nil, errors.New("no TXT")
+	}
+	return f.txt, nil
+}
+
+func (f *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if f.srv == nil {
+		return "", nil, errors.New("no SRV")
+	}
+	return "", f.srv, nil
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if f.hosts == nil {
+		return nil, errors.New("no such host")
+	}
+	return f.hosts, nil
+}
+
+func (f *fakeResolver) setTXT(txt []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.txt = txt
+}
+
+func TestResolveBootstrapPrefersTXTInOwnEnclave(t *testing.T) {
+	r := &fakeResolver{
+		txt: []string{
+			"v=spf1 -all",
+			"repram addr=us.example.net:8080 enclave=us",
+			"repram addr=eu.example.net enclave=eu",
+			"repram addr=any.example.net:8081",
+			"repram enclave=eu",
+		},
+		hosts: []string{"10.0.0.1"},
+	}
+	got := resolveBootstrapDNS(context.Background(), r, "seeds", 9090, "eu")
+	want := []string{"eu.example.net:9090", "any.example.net:8081", "us.example.net:8080"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("peers = %v, want %v", got, want)
+	}
+}
+
+func TestResolvePeerPinsFromTXT(t *testing.T) {
+	r := &fakeResolver{txt: []string{
+		"v=spf1 -all",
+		"repram addr=seed.example.net pin=sha256/AAAA",
+		"repram pin=sha256/BBBB pin=0123",
+		"other pin=sha256/CCCC",
+	}}
+	want := []string{"sha256/AAAA", "sha256/BBBB", "0123"}
+	if got := resolvePeerPinsDNS(context.Background(), r, "seeds"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("pins = %v, want %v", got, want)
+	}
+	if got := resolvePeerPinsDNS(context.Background(), &fakeResolver{}, "seeds"); got != nil {
+		t.Fatalf("no TXT records gave pins %v, want nil", got)
+	}
+}
+
+func TestResolveBootstrapFallsBack(t *testing.T) {
+	r := &fakeResolver{srv: []*net.SRV{{Target: "seed.example.net.", Port: 7000}}, hosts: []string{"10.0.0.1"}}
+	if got := resolveBootstrapDNS(context.Background(), r, "seeds", 9090, "default"); !reflect.DeepEqual(got, []string{"seed.example.net:7000"}) {
+		t.Fatalf("SRV peers = %v", got)
+	}
+
+	r.srv = nil
+	if got := resolveBootstrapDNS(context.Background(), r, "seeds", 9090, "default"); !reflect.DeepEqual(got, []string{"10.0.0.1:9090"}) {
+		t.Fatalf("A record peers = %v", got)
+	}
+
+	r.hosts = nil
+	if got := resolveBootstrapDNS(context.Background(), r, "seeds", 9090, "default"); got != nil {
+		t.Fatalf("unresolvable name gave %v, want nil", got)
+	}
+}
+
+func TestWatchBootstrapDNSRebootstrapsOnChange(t *testing.T) {
+	r := &fakeResolver{txt: []string{"repram addr=a:1", "repram addr=b:1"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := make(chan []string, 10)
+	go watchBootstrapDNS(ctx, r, "seeds", 9090, "default", 10*time.Millisecond, []string{"b:1", "a:1"}, func(seeds []string) {
+		calls <- seeds
+	})
+
+	select {
+	case seeds := <-calls:
+		t.Fatalf("re-bootstrapped with unchanged seeds %v", seeds)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	r.setTXT([]string{"repram addr=c:1"})
+	select {
+	case seeds := <-calls:
+		if !reflect.DeepEqual(seeds, []string{"c:1"}) {
+			t.Fatalf("re-bootstrapped with %v, want [c:1]", seeds)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("seed change did not trigger a re-bootstrap")
+	}
+}
@@ -2,522 +2,447 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
-	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"errors"
-
-	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-
+	"repram/internal/audit"
 	"repram/internal/cluster"
-	"repram/internal/gossip"
 	"repram/internal/logging"
 	"repram/internal/node"
-	"repram/internal/storage"
+	"repram/internal/pressure"
+	"repram/internal/server"
+	"repram/internal/systemd"
+	"repram/internal/webhook"
 )
 
+// gossipLoopMaxAge is how long the gossip background loops (30s tick) may go
+// without completing an iteration before the systemd watchdog is withheld.
+const gossipLoopMaxAge = 90 * time.Second
+
 func main() {
 	logging.Init()
 
-	// Generate a unique node ID
-	nodeID := os.Getenv("REPRAM_NODE_ID")
-	if nodeID == "" {
-		nodeID = fmt.Sprintf("node-%d", time.Now().UnixNano())
-	}
-
-	address := os.Getenv("REPRAM_ADDRESS")
-	if address == "" {
-		address = "localhost"
-	}
-
-	// Configuration: one name per setting, no aliases
-	httpPort := envInt("REPRAM_HTTP_PORT", 8080)
-	gossipPort := envInt("REPRAM_GOSSIP_PORT", 9090)
-	replicationFactor := envInt("REPRAM_REPLICATION", 3)
-	minTTL := envInt("REPRAM_MIN_TTL", 300)
-	maxTTL := envInt("REPRAM_MAX_TTL", 86400)
-	rateLimit := envInt("REPRAM_RATE_LIMIT", 100)
-	maxStorageMB := envInt("REPRAM_MAX_STORAGE_MB", 0)    // 0 = unlimited
-	writeTimeout := envInt("REPRAM_WRITE_TIMEOUT", 5)      // seconds
-	clusterSecret := os.Getenv("REPRAM_CLUSTER_SECRET")
-	trustProxy := strings.EqualFold(os.Getenv("REPRAM_TRUST_PROXY"), "true")
-	enclave := os.Getenv("REPRAM_ENCLAVE") // default: "default"
-	network := os.Getenv("REPRAM_NETWORK")
-	if network == "" {
-		network = "public"
-	}
-
-	// Resolve bootstrap peers.
-	// REPRAM_PEERS are HTTP addresses (host:httpPort) since the bootstrap
-	// handshake is an HTTP POST to /v1/bootstrap. Example: "node2:8080,node3:8080"
-	var bootstrapNodes []string
-	if peers := os.Getenv("REPRAM_PEERS"); peers != "" {
-		bootstrapNodes = strings.Split(peers, ",")
-		for i, n := range bootstrapNodes {
-			bootstrapNodes[i] = strings.TrimSpace(n)
-		}
-	}
-
-	// DNS-based bootstrap for public network
-	if network == "public" && len(bootstrapNodes) == 0 {
-		resolved := resolveBootstrapDNS("bootstrap.repram.network", 9090)
-		bootstrapNodes = append(bootstrapNodes, resolved...)
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
+	logging.SetLevel(cfg.LogLevel)
 
-	clusterNode := cluster.NewClusterNode(nodeID, address, gossipPort, httpPort, replicationFactor, int64(maxStorageMB)*1024*1024, time.Duration(writeTimeout)*time.Second, clusterSecret, enclave)
+	// Resolve bootstrap peers: explicit REPRAM_PEERS first, then DNS.
+	bootstrapNodes := cfg.Peers
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	clusterNode := cluster.NewClusterNode(cfg.NodeID, cfg.Address, cfg.GossipPort, cfg.HTTPPort, cfg.ReplicationFactor, int64(cfg.MaxStorageMB)*1024*1024, time.Duration(cfg.WriteTimeout)*time.Second, cfg.ClusterSecret, cfg.Enclave)
 
-	if err := clusterNode.Start(ctx, bootstrapNodes); err != nil {
-		log.Fatalf("Failed to start cluster node: %v", err)
+	// DNS-based bootstrap for public network
+	dnsBootstrap := cfg.Network == "public" && len(bootstrapNodes) == 0
+	if dnsBootstrap {
+		bootstrapNodes = resolveBootstrapDNS(context.Background(), net.DefaultResolver, bootstrapHostname, 9090, clusterNode.Enclave())
+		if len(bootstrapNodes) == 0 {
+			logging.Warn("No bootstrap peers resolved; starting as first node")
+		}
 	}
 
-	server := &HTTPServer{
-		clusterNode: clusterNode,
-		nodeID:      nodeID,
-		network:     network,
-		minTTL:      minTTL,
-		maxTTL:      maxTTL,
-		startTime:   time.Now(),
+	// TLS termination: when enabled, peers share the HTTPS port for gossip
+	serverTLS, err := newServerTLS(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
+	if serverTLS != nil {
+		clusterNode.EnableTLS(peerTLSConfig(cfg, dnsBootstrap))
+	}
+	clusterNode.SetPeerFilter(cfg.PeerFilter())
+	clusterNode.SetMaxValueBytes(int64(cfg.MaxValueBytes))
+	clusterNode.SetSendConcurrency(cfg.GossipConcurrency)
+	clusterNode.SetSendAttempts(cfg.GossipAttempts)
+	clusterNode.SetWriteResend(cfg.WriteResend)
+	clusterNode.SetInternalPort(cfg.InternalPort)
+	clusterNode.SetZone(cfg.Zone)
+	clusterNode.SetReplicationLimits(cfg.MaxReplication, cfg.NamespaceReplicas)
+	clusterNode.SetMaxTTL(time.Duration(cfg.MaxTTL) * time.Second)
+	if cfg.DialBack {
+		clusterNode.EnableDialBack()
+	}
+	if cfg.PeerReputation {
+		nodeKey, err := loadNodeKey(cfg.NodeKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load node key: %v", err)
+		}
+		clusterNode.EnablePublicMode(nodeKey)
 	}
 
-	// Initialize security middleware
-	securityMW := node.NewSecurityMiddleware(
-		rateLimit,
-		rateLimit*2, // burst = 2x rate
-		10*1024*1024, // 10MB max request size
-		trustProxy,
-	)
-	server.securityMW = securityMW
-
-	peerCount := len(bootstrapNodes)
-	logging.Info("REPRAM node online. Peers: %d. Network: %s", peerCount, network)
-	logging.Info("  Node ID: %s", nodeID)
-	logging.Info("  HTTP: :%d  Gossip: :%d  Enclave: %s", httpPort, gossipPort, clusterNode.Enclave())
-	logging.Info("  Replication: %d  TTL range: %d-%ds  Write timeout: %ds", replicationFactor, minTTL, maxTTL, writeTimeout)
-	if clusterSecret != "" {
-		logging.Info("  Gossip authentication: HMAC-SHA256 (cluster secret configured)")
-	} else {
-		logging.Info("  Gossip authentication: none (open mode)")
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Create HTTP server for graceful shutdown support
-	httpServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", httpPort),
-		Handler: server.Router(),
+	// Cluster-wide rate limit: nodes gossip per-client request counts
+	var clusterLimiter *node.ClusterRateLimiter
+	if cfg.ClusterRateLimit > 0 {
+		clusterLimiter = node.NewClusterRateLimiter(cfg.ClusterRateLimit, func(digest []byte) {
+			clusterNode.BroadcastRateDigest(ctx, digest)
+		})
+		clusterNode.SetRateDigestHandler(clusterLimiter.Merge)
 	}
 
-	// Graceful shutdown: drain in-flight requests before exiting
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		logging.Info("Shutting down — draining in-flight requests...")
-
-		// Give in-flight requests up to 10 seconds to complete
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer shutdownCancel()
-
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			logging.Warn("HTTP server shutdown error: %v", err)
+	// Webhooks: callbacks when matching keys are created or expire
+	var webhooks *webhook.Dispatcher
+	if len(cfg.Webhooks) > 0 {
+		hooks, err := webhook.ParseHooks(cfg.Webhooks)
+		if err != nil {
+			log.Fatalf("Invalid webhooks: %v", err)
 		}
-
-		securityMW.Close()
-		clusterNode.Stop()
-		cancel()
-	}()
-
-	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("HTTP server error: %v", err)
+		webhooks = webhook.NewDispatcher(cfg.NodeID, cfg.WebhookSecret, hooks)
+		clusterNode.SetStoreEventHandler(webhooks.Notify)
 	}
-	logging.Info("Shutdown complete.")
-}
 
-// envInt reads an environment variable as int with a default fallback.
-func envInt(key string, defaultVal int) int {
-	if v := os.Getenv(key); v != "" {
-		if n, err := strconv.Atoi(v); err == nil {
-			return n
+	// Audit log: a hashed record of every client write
+	var auditLog *audit.Logger
+	if cfg.AuditFile != "" || cfg.AuditWebhook != "" {
+		auditLog = audit.New(cfg.NodeID, cfg.AuditSalt)
+		if cfg.AuditFile != "" {
+			if err := auditLog.ToFile(cfg.AuditFile, int64(cfg.AuditMaxMB)<<20, audit.DefaultKeep); err != nil {
+				log.Fatalf("Failed to open audit log: %v", err)
+			}
 		}
-	}
-	return defaultVal
-}
-
-// resolveBootstrapDNS resolves bootstrap peers via DNS.
-// Returns host:port strings for each resolved address.
-func resolveBootstrapDNS(hostname string, defaultPort int) []string {
-	// Try SRV records first for port flexibility
-	_, srvRecords, err := net.LookupSRV("gossip", "tcp", hostname)
-	if err == nil && len(srvRecords) > 0 {
-		var peers []string
-		for _, srv := range srvRecords {
-			peers = append(peers, fmt.Sprintf("%s:%d", strings.TrimSuffix(srv.Target, "."), srv.Port))
+		if cfg.AuditWebhook != "" {
+			if webhooks == nil {
+				webhooks = webhook.NewDispatcher(cfg.NodeID, cfg.WebhookSecret, nil)
+			}
+			auditLog.ToWebhook(func(body []byte) { webhooks.Post(cfg.AuditWebhook, body) })
 		}
-		logging.Info("Resolved %d bootstrap peers via SRV", len(peers))
-		return peers
 	}
 
-	// Fall back to A/AAAA records
-	addrs, err := net.LookupHost(hostname)
-	if err != nil {
-		logging.Warn("DNS bootstrap resolution failed for %s: %v (starting as first node)", hostname, err)
-		return nil
+	// Peers known before the last shutdown are tried ahead of the seeds, so
+	// a whole-cluster restart doesn't depend on the seeds being up
+	seeds := bootstrapNodes
+	if cached := loadPeerCache(cfg.PeerCacheFile); len(cached) > 0 {
+		logging.Info("Loaded %d cached peers from %s", len(cached), cfg.PeerCacheFile)
+		seeds = withCachedPeers(cached, bootstrapNodes)
 	}
-
-	var peers []string
-	for _, addr := range addrs {
-		peers = append(peers, fmt.Sprintf("%s:%d", addr, defaultPort))
+	if err := clusterNode.Start(ctx, seeds); err != nil {
+		log.Fatalf("Failed to start cluster node: %v", err)
 	}
-	logging.Info("Resolved %d bootstrap peers via DNS", len(peers))
-	return peers
-}
-
-// CORS middleware
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		if origin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-		}
-		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-TTL")
-		w.Header().Set("Access-Control-Max-Age", "3600")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-type HTTPServer struct {
-	clusterNode *cluster.ClusterNode
-	nodeID      string
-	network     string
-	minTTL      int
-	maxTTL      int
-	startTime   time.Time
-	securityMW  *node.SecurityMiddleware
-}
-
-func (s *HTTPServer) Router() *mux.Router {
-	r := mux.NewRouter()
-
-	// Apply middleware
-	r.Use(corsMiddleware)
-	r.Use(s.securityMW.Middleware)
-	r.Use(node.MaxRequestSizeMiddleware(s.securityMW.MaxRequestSize()))
-	r.Use(node.TimeoutMiddleware(30 * time.Second))
-
-	// v1 API endpoints
-	r.HandleFunc("/v1/data/{key}", s.putHandler).Methods("PUT", "OPTIONS")
-	r.HandleFunc("/v1/data/{key}", s.getHandler).Methods("GET", "HEAD", "OPTIONS")
-	r.HandleFunc("/v1/keys", s.keysHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/v1/health", s.healthHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/v1/status", s.statusHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/v1/metrics", promhttp.Handler().ServeHTTP).Methods("GET", "OPTIONS")
-	r.HandleFunc("/v1/topology", s.topologyHandler).Methods("GET", "OPTIONS")
-
-	// Internal gossip endpoints
-	r.HandleFunc("/v1/gossip/message", s.gossipHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/v1/bootstrap", s.bootstrapHandler).Methods("POST", "OPTIONS")
-
-	return r
-}
-
-func (s *HTTPServer) healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "healthy",
-		"node_id": s.nodeID,
-		"network": s.network,
-		"enclave": s.clusterNode.Enclave(),
-	})
-}
-
-func (s *HTTPServer) statusHandler(w http.ResponseWriter, r *http.Request) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":     "healthy",
-		"node_id":    s.nodeID,
-		"network":    s.network,
-		"enclave":    s.clusterNode.Enclave(),
-		"uptime":     time.Since(s.startTime).String(),
-		"goroutines": runtime.NumGoroutine(),
-		"memory": map[string]interface{}{
-			"alloc":       m.Alloc,
-			"total_alloc": m.TotalAlloc,
-			"sys":         m.Sys,
-			"num_gc":      m.NumGC,
-		},
-	})
-}
-
-func (s *HTTPServer) topologyHandler(w http.ResponseWriter, r *http.Request) {
-	peers := s.clusterNode.Topology()
-
-	type peerInfo struct {
-		ID       string `json:"id"`
-		Address  string `json:"address"`
-		HTTPPort int    `json:"http_port"`
-		Enclave  string `json:"enclave"`
+	if cfg.PeerCacheFile != "" {
+		go watchPeerCache(ctx, cfg.PeerCacheFile, clusterNode.Topology)
 	}
-
-	peerList := make([]peerInfo, 0, len(peers))
-	for _, p := range peers {
-		peerList = append(peerList, peerInfo{
-			ID:       string(p.ID),
-			Address:  p.Address,
-			HTTPPort: p.HTTPPort,
-			Enclave:  p.Enclave,
-		})
+	if dnsBootstrap && cfg.BootstrapRefresh > 0 {
+		go watchBootstrapDNS(ctx, net.DefaultResolver, bootstrapHostname, 9090, clusterNode.Enclave(),
+			time.Duration(cfg.BootstrapRefresh)*time.Second, bootstrapNodes, func(seeds []string) {
+				if err := clusterNode.Bootstrap(ctx, seeds); err != nil {
+					logging.Warn("Re-bootstrap failed: %v", err)
+				}
+			})
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"node_id": s.nodeID,
-		"enclave": s.clusterNode.Enclave(),
-		"peers":   peerList,
-	})
-}
-
-func (s *HTTPServer) putHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	key := vars["key"]
-
-	body, err := io.ReadAll(r.Body)
+	corsOrigins, err := node.ParseCORSOrigins(cfg.CORSOrigins)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	// TTL from header or query param
-	ttl := 3600 // Default 1 hour
-	if ttlStr := r.URL.Query().Get("ttl"); ttlStr != "" {
-		if parsed, err := strconv.Atoi(ttlStr); err == nil && parsed > 0 {
-			ttl = parsed
-		}
-	} else if ttlHeader := r.Header.Get("X-TTL"); ttlHeader != "" {
-		if parsed, err := strconv.Atoi(ttlHeader); err == nil && parsed > 0 {
-			ttl = parsed
-		}
+		log.Fatalf("Invalid CORS origins: %v", err)
 	}
 
-	// Enforce TTL bounds
-	if ttl < s.minTTL {
-		ttl = s.minTTL
+	// Initialize security middleware
+	securityMW := node.NewSecurityMiddleware(
+		cfg.RateLimit,
+		cfg.RateLimit*2, // burst = 2x rate
+		10*1024*1024,    // 10MB max request size
+		cfg.TrustProxy,
+	)
+	securityMW.SetMaxGossipSize(int64(cfg.MaxGossipMB) << 20)
+	if len(cfg.TokenRateLimits) > 0 {
+		securityMW.SetTokenLimits(cfg.TokenRateLimits)
 	}
-	if ttl > s.maxTTL {
-		ttl = s.maxTTL
+	if cfg.NamespaceRateLimit > 0 {
+		securityMW.SetNamespaceLimit(cfg.NamespaceRateLimit, cfg.NamespaceRateLimit*2)
 	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
-	if err := s.clusterNode.Put(ctx, key, body, time.Duration(ttl)*time.Second); err != nil {
-		if errors.Is(err, storage.ErrStoreFull) {
-			http.Error(w, "Node storage capacity exceeded", http.StatusInsufficientStorage)
-			return
-		}
-		if errors.Is(err, cluster.ErrQuorumTimeout) {
-			// Data is stored locally and will propagate via gossip.
-			// 202 Accepted signals "written, replication in progress."
-			w.WriteHeader(http.StatusAccepted)
-			fmt.Fprintf(w, "Accepted (quorum pending)")
-			return
-		}
-		http.Error(w, fmt.Sprintf("Write failed: %v", err), http.StatusInternalServerError)
-		return
+	if clusterLimiter != nil {
+		securityMW.SetClusterRateLimit(clusterLimiter)
 	}
-
-	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, "OK")
-}
-
-func (s *HTTPServer) getHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	key := vars["key"]
-
-	data, createdAt, originalTTL, exists := s.clusterNode.GetWithMetadata(key)
-	if !exists {
-		w.WriteHeader(http.StatusNotFound)
-		return
+	if cfg.WriteByteLimit > 0 {
+		securityMW.SetWriteByteLimit(cfg.WriteByteLimit, cfg.WriteByteLimit*2)
 	}
-
-	elapsed := time.Since(createdAt)
-	remainingTTL := originalTTL - elapsed
-	if remainingTTL < 0 {
-		remainingTTL = 0
+	// Memory pressure: shed low-priority writes near the heap high-water mark
+	var memPressure *pressure.Monitor
+	if cfg.MemoryHighWaterMB > 0 {
+		memPressure = pressure.NewMonitor(uint64(cfg.MemoryHighWaterMB)<<20, clusterNode.SweepExpired)
+		memPressure.Start()
 	}
 
-	w.Header().Set("X-Created-At", createdAt.Format(time.RFC3339))
-	w.Header().Set("X-Original-TTL", strconv.Itoa(int(originalTTL.Seconds())))
-	w.Header().Set("X-Remaining-TTL", strconv.Itoa(int(remainingTTL.Seconds())))
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
-}
-
-func (s *HTTPServer) keysHandler(w http.ResponseWriter, r *http.Request) {
-	keys := s.clusterNode.Scan()
+	policy, err := loadPolicy(cfg.PolicyFile)
+	if err != nil {
+		log.Fatalf("Failed to load request policy: %v", err)
+	}
+	securityMW.SetPolicy(policy)
+
+	// Gossip and bootstrap on their own port get their own rate limit, so
+	// peer traffic and client traffic don't share buckets
+	var internalMW *node.SecurityMiddleware
+	if cfg.InternalPort != 0 {
+		internalMW = node.NewSecurityMiddleware(cfg.RateLimit, cfg.RateLimit*2, int64(cfg.MaxGossipMB)<<20, false)
+		internalMW.SetMaxGossipSize(int64(cfg.MaxGossipMB) << 20)
+	}
+
+	apiServer := server.New(server.Options{
+		ClusterNode:   clusterNode,
+		NodeID:        cfg.NodeID,
+		Network:       cfg.Network,
+		MinTTL:        cfg.MinTTL,
+		MaxTTL:        cfg.MaxTTL,
+		DefaultTTL:    cfg.DefaultTTL,
+		NamespaceTTLs: cfg.NamespaceTTLs,
+		TTLJitterPct:  cfg.TTLJitterPct,
+		SecurityMW:    securityMW,
+		InternalMW:    internalMW,
+		CORSOrigins:   corsOrigins,
+		KeyRules: node.KeyRules{
+			MaxLength:        cfg.MaxKeyLength,
+			ReservedPrefixes: cfg.ReservedPrefixes,
+		},
+		Pressure:    memPressure,
+		Inflight:    node.NewInflightLimiter(cfg.MaxInflight),
+		Timeouts:    cfg.Timeouts(),
+		CacheMaxAge: cfg.CacheMaxAge,
+		UI:          cfg.UI,
+		AdminToken:  cfg.AdminToken,
+		ReadOnly:    cfg.ReadOnly,
+		Audit:       auditLog,
+	})
 
-	// Optional prefix filter
-	if prefix := r.URL.Query().Get("prefix"); prefix != "" {
-		var filtered []string
-		for _, k := range keys {
-			if strings.HasPrefix(k, prefix) {
-				filtered = append(filtered, k)
-			}
+	// Peer traffic skips the client rate limits: with a cluster secret, only
+	// requests signed with it; in open mode, any request to a peer endpoint
+	if !cfg.PeerRateLimit {
+		var gate func(*http.Request) bool
+		if cfg.ClusterSecret != "" {
+			gate = apiServer.PeerSigned
 		}
-		keys = filtered
-	}
-
-	// Sort for stable cursor-based pagination
-	sort.Strings(keys)
-
-	// Cursor: skip keys <= cursor value (cursor is the last key from previous page)
-	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
-		idx := sort.SearchStrings(keys, cursor)
-		// Skip past the cursor key itself
-		if idx < len(keys) && keys[idx] == cursor {
-			idx++
+		securityMW.ExemptPeerPaths(gate)
+		if internalMW != nil {
+			internalMW.ExemptPeerPaths(gate)
 		}
-		keys = keys[idx:]
 	}
 
-	// Limit: cap the number of returned keys
-	limit := 0
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 {
-			limit = parsed
+	// Reload log level, rate limit, request policy, read-only mode, and TLS
+	// certificate files on SIGHUP
+	reload := newReloader(cfg, securityMW)
+	reload.onReload(func(next *Config) error {
+		policy, err := loadPolicy(next.PolicyFile)
+		if err != nil {
+			return err
+		}
+		securityMW.SetPolicy(policy)
+		return nil
+	})
+	// Only a change in the file applies, so a reload doesn't undo a toggle
+	// made through /v1/admin/read-only
+	readOnly := cfg.ReadOnly
+	reload.onReload(func(next *Config) error {
+		if next.ReadOnly != readOnly {
+			readOnly = next.ReadOnly
+			apiServer.SetReadOnly(readOnly)
+		}
+		return nil
+	})
+	if serverTLS != nil {
+		securityMW.EnableHSTS(hstsMaxAge)
+		if serverTLS.certs != nil {
+			reload.onReload(serverTLS.certs.reloadHook)
 		}
 	}
+	stopReload := reload.watch()
 
-	var nextCursor string
-	if limit > 0 && len(keys) > limit {
-		nextCursor = keys[limit-1]
-		keys = keys[:limit]
+	peerCount := len(bootstrapNodes)
+	logging.Info("REPRAM node online. Peers: %d. Network: %s", peerCount, cfg.Network)
+	logging.Info("  Node ID: %s", cfg.NodeID)
+	logging.Info("  HTTP: :%d  Gossip: :%d  Enclave: %s", cfg.HTTPPort, cfg.GossipPort, clusterNode.Enclave())
+	if cfg.Zone != "" {
+		logging.Info("  Zone: %s", cfg.Zone)
 	}
-
-	resp := map[string]interface{}{
-		"keys": keys,
+	if cfg.InternalPort != 0 {
+		logging.Info("  Internal (gossip, bootstrap): %s", net.JoinHostPort(cfg.InternalBind, strconv.Itoa(cfg.InternalPort)))
 	}
-	if nextCursor != "" {
-		resp["next_cursor"] = nextCursor
+	logging.Info("  Replication: %d  TTL range: %d-%ds  Write timeout: %ds", cfg.ReplicationFactor, cfg.MinTTL, cfg.MaxTTL, cfg.WriteTimeout)
+	if cfg.ClusterSecret != "" {
+		logging.Info("  Gossip authentication: HMAC-SHA256 (cluster secret configured)")
+	} else {
+		logging.Info("  Gossip authentication: none (open mode)")
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
-}
-
-func (s *HTTPServer) verifyGossipSignature(w http.ResponseWriter, r *http.Request, body []byte) bool {
-	secret := s.clusterNode.ClusterSecret()
-	if secret == "" {
-		return true // open mode
+	if cfg.PolicyFile != "" {
+		logging.Info("  Request policy: %s", cfg.PolicyFile)
 	}
-	sig := r.Header.Get("X-Repram-Signature")
-	if sig == "" {
-		http.Error(w, "Missing signature", http.StatusForbidden)
-		return false
+	if len(cfg.PeerAllowlist) > 0 || len(cfg.PeerBlocklist) > 0 {
+		logging.Info("  Peer filter: %d allowed, %d blocked", len(cfg.PeerAllowlist), len(cfg.PeerBlocklist))
 	}
-	if !gossip.VerifyBody(secret, body, sig) {
-		http.Error(w, "Invalid signature", http.StatusForbidden)
-		return false
+	if cfg.ClusterRateLimit > 0 {
+		logging.Info("  Cluster rate limit: %d req/s per IP", cfg.ClusterRateLimit)
 	}
-	return true
-}
-
-func (s *HTTPServer) gossipHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+	if cfg.WriteByteLimit > 0 {
+		logging.Info("  Write bandwidth limit: %d bytes/s per client", cfg.WriteByteLimit)
 	}
-
-	if !s.verifyGossipSignature(w, r, body) {
-		return
+	if cfg.MemoryHighWaterMB > 0 {
+		logging.Info("  Memory high-water: %d MB (sheds low-priority writes above it)", cfg.MemoryHighWaterMB)
+	}
+	if len(cfg.Webhooks) > 0 {
+		logging.Info("  Webhooks: %d (signed: %v)", len(cfg.Webhooks), cfg.WebhookSecret != "")
+	}
+	switch {
+	case len(cfg.TLSAutocertHosts) > 0:
+		logging.Info("  TLS: autocert for %s (cache: %s)", strings.Join(cfg.TLSAutocertHosts, ", "), cfg.TLSAutocertDir)
+	case cfg.TLSCert != "":
+		logging.Info("  TLS: certificate %s", cfg.TLSCert)
 	}
 
-	var simpleMsg gossip.SimpleMessage
-	if err := json.Unmarshal(body, &simpleMsg); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+	// Create HTTP server for graceful shutdown support
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.HTTPPort),
+		Handler: apiServer.Router(),
 	}
 
-	gossipMsg := &gossip.Message{
-		Type:      gossip.MessageType(simpleMsg.Type),
-		From:      gossip.NodeID(simpleMsg.From),
-		To:        gossip.NodeID(simpleMsg.To),
-		Key:       simpleMsg.Key,
-		Data:      simpleMsg.Data,
-		TTL:       int(simpleMsg.TTL),
-		Timestamp: time.Unix(simpleMsg.Timestamp, 0),
-		MessageID: simpleMsg.MessageID,
+	// Peer endpoints on their own listener; the client port stops serving them
+	var internalServer *http.Server
+	if cfg.InternalPort != 0 {
+		httpServer.Handler = apiServer.ClientRouter()
+		internalServer = &http.Server{
+			Addr:    net.JoinHostPort(cfg.InternalBind, strconv.Itoa(cfg.InternalPort)),
+			Handler: apiServer.InternalRouter(),
+		}
 	}
 
-	if simpleMsg.NodeInfo != nil {
-		enclave := simpleMsg.NodeInfo.Enclave
-		if enclave == "" {
-			enclave = "default"
+	// Plain HTTP listener that redirects to HTTPS (and answers ACME challenges)
+	var redirectServer *http.Server
+	if serverTLS != nil {
+		httpServer.TLSConfig = serverTLS.config
+		if internalServer != nil {
+			internalServer.TLSConfig = serverTLS.config
 		}
-		gossipMsg.NodeInfo = &gossip.Node{
-			ID:       gossip.NodeID(simpleMsg.NodeInfo.ID),
-			Address:  simpleMsg.NodeInfo.Address,
-			Port:     simpleMsg.NodeInfo.Port,
-			HTTPPort: simpleMsg.NodeInfo.HTTPPort,
-			Enclave:  enclave,
+		if cfg.TLSRedirectPort != 0 {
+			redirectServer = &http.Server{
+				Addr:    fmt.Sprintf(":%d", cfg.TLSRedirectPort),
+				Handler: serverTLS.redirect,
+			}
+			go func() {
+				logging.Info("  HTTP→HTTPS redirect: :%d", cfg.TLSRedirectPort)
+				if err := redirectServer.ListenAndServe(); err != http.ErrServerClosed {
+					logging.Error("Redirect server error: %v", err)
+				}
+			}()
 		}
 	}
 
-	if err := s.clusterNode.HandleGossipMessage(gossipMsg); err != nil {
-		http.Error(w, fmt.Sprintf("Gossip error: %v", err), http.StatusInternalServerError)
-		return
-	}
+	// Graceful shutdown: drain in-flight requests before exiting. Serve
+	// returns as soon as Shutdown starts, so main waits on shutdownDone for
+	// the rest of the teardown to finish.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
-}
+	go func() {
+		defer close(shutdownDone)
+		<-sigChan
+		logging.Info("Shutting down — draining in-flight requests...")
+		systemd.Notify(systemd.Stopping)
+
+		// Give in-flight requests up to 10 seconds to complete
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer shutdownCancel()
 
-func (s *HTTPServer) bootstrapHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logging.Warn("HTTP server shutdown error: %v", err)
+		}
+		if redirectServer != nil {
+			redirectServer.Shutdown(shutdownCtx)
+		}
+		if internalServer != nil {
+			internalServer.Shutdown(shutdownCtx)
+		}
+
+		stopReload()
+		securityMW.Close()
+		if internalMW != nil {
+			internalMW.Close()
+		}
+		if peers := clusterNode.Topology(); cfg.PeerCacheFile != "" && len(peers) > 0 {
+			if err := savePeerCache(cfg.PeerCacheFile, peers); err != nil {
+				logging.Warn("Failed to save peer cache: %v", err)
+			}
+		}
+		clusterNode.Stop()
+		if auditLog != nil {
+			if err := auditLog.Close(); err != nil {
+				logging.Warn("Failed to close audit log: %v", err)
+			}
+		}
+		if webhooks != nil {
+			// Deliver queued callbacks and audit records rather than drop
+			// them, for as long as a stop timeout can spare.
+			flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			webhooks.Shutdown(flushCtx)
+			flushCancel()
+		}
+		if memPressure != nil {
+			memPressure.Close()
+		}
+		cancel()
+	}()
+
+	listener, err := net.Listen("tcp", httpServer.Addr)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+		log.Fatalf("HTTP server error: %v", err)
 	}
-
-	if !s.verifyGossipSignature(w, r, body) {
-		return
+	if internalServer != nil {
+		internalListener, err := net.Listen("tcp", internalServer.Addr)
+		if err != nil {
+			log.Fatalf("Internal server error: %v", err)
+		}
+		go func() {
+			var err error
+			if serverTLS != nil {
+				err = internalServer.ServeTLS(internalListener, "", "")
+			} else {
+				err = internalServer.Serve(internalListener)
+			}
+			if err != http.ErrServerClosed {
+				log.Fatalf("Internal server error: %v", err)
+			}
+		}()
 	}
 
-	var req gossip.BootstrapRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+	// Bootstrap is done and the port is bound: tell systemd we're ready
+	// (no-op outside systemd), and keep its watchdog fed while gossip runs.
+	if ok, err := systemd.Notify(systemd.Ready); err != nil {
+		logging.Warn("systemd readiness notification failed: %v", err)
+	} else if ok {
+		logging.Info("  systemd: READY sent (watchdog: %v)", systemd.WatchdogInterval())
 	}
+	go systemd.RunWatchdog(ctx, func() bool {
+		return clusterNode.GossipAlive(gossipLoopMaxAge)
+	})
 
-	resp := s.clusterNode.HandleBootstrap(&req)
+	if serverTLS != nil {
+		// Certificates come from TLSConfig (GetCertificate), not files
+		err = httpServer.ServeTLS(listener, "", "")
+	} else {
+		err = httpServer.Serve(listener)
+	}
+	if err != http.ErrServerClosed {
+		log.Fatalf("HTTP server error: %v", err)
+	}
+	<-shutdownDone
+	logging.Info("Shutdown complete.")
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+// loadPolicy reads the request policy file. An empty path means no policy:
+// every request is allowed.
+func loadPolicy(path string) (node.Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	policy, err := node.LoadPolicyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
 }
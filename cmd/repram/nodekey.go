@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"repram/internal/logging"
+)
+
+// loadNodeKey returns the node's announcement signing key for public
+// networks. The key is read from path, or generated and written there on
+// first start. With no path the key is generated fresh and lasts only
+// until restart; peers then see a new key for the same node ID, which they
+// reject until the old announcement lapses.
+func loadNodeKey(path string) (ed25519.PrivateKey, error) {
+	if path == "" {
+		logging.Warn("REPRAM_NODE_KEY_FILE is not set; using a temporary node key. Set it so the node keeps its identity across restarts.")
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, pemData, 0o600); err != nil {
+			return nil, fmt.Errorf("write node key: %w", err)
+		}
+		logging.Info("Generated node key %s", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read node key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse node key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadNodeKeyCreatesThenReuses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.key")
+
+	first, err := loadNodeKey(path)
+	if err != nil {
+		t.Fatalf("first load: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("key file not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file mode = %o, want 600", perm)
+	}
+
+	second, err := loadNodeKey(path)
+	if err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+	if !first.Equal(second) {
+		t.Fatal("reloaded key differs from the generated one")
+	}
+}
+
+func TestLoadNodeKeyRejectsGarbage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.key")
+	os.WriteFile(path, []byte("not a key"), 0o600)
+	if _, err := loadNodeKey(path); err == nil {
+		t.Fatal("expected an error for a non-PEM key file")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"repram/internal/gossip"
+	"repram/internal/logging"
+)
+
+// peerCacheInterval is how often the peer table is written to
+// REPRAM_PEER_CACHE_FILE.
+const peerCacheInterval = time.Minute
+
+// maxCachedPeers bounds the peers saved. Each one the node can't reach at
+// start costs a bootstrap timeout before the seeds are tried.
+const maxCachedPeers = 16
+
+// loadPeerCache returns the peer addresses (host:port) saved at path,
+// for use as bootstrap candidates. A missing file is an empty cache; an
+// unreadable one is logged and ignored, since the seeds still work.
+func loadPeerCache(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	var peers []string
+	if err == nil {
+		err = json.Unmarshal(data, &peers)
+	}
+	if err != nil {
+		logging.Warn("Ignoring peer cache %s: %v", path, err)
+		return nil
+	}
+	return peers
+}
+
+// savePeerCache writes the bootstrap addresses of peers to path, replacing the
+// file atomically so a crash mid-write leaves the previous cache intact.
+func savePeerCache(path string, peers []*gossip.Node) error {
+	addrs := make([]string, 0, min(len(peers), maxCachedPeers))
+	for _, peer := range peers {
+		if len(addrs) == maxCachedPeers {
+			break
+		}
+		addrs = append(addrs, net.JoinHostPort(peer.Address, strconv.Itoa(peer.PeerPort())))
+	}
+	data, err := json.Marshal(addrs)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("write peer cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write peer cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write peer cache: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// withCachedPeers puts cached peers ahead of the seeds, dropping repeats.
+func withCachedPeers(cached, seeds []string) []string {
+	seen := make(map[string]bool, len(cached)+len(seeds))
+	var out []string
+	for _, addr := range append(append([]string(nil), cached...), seeds...) {
+		if !seen[addr] {
+			seen[addr] = true
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// watchPeerCache saves the peer table to path every peerCacheInterval until
+// ctx is done. An empty table isn't saved, so a node that lost every peer
+// keeps the last cache it had.
+func watchPeerCache(ctx context.Context, path string, peers func() []*gossip.Node) {
+	ticker := time.NewTicker(peerCacheInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if current := peers(); len(current) > 0 {
+				if err := savePeerCache(path, current); err != nil {
+					logging.Warn("Failed to save peer cache: %v", err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
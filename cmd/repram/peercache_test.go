@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"repram/internal/gossip"
+)
+
+func TestPeerCacheRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	if got := loadPeerCache(path); got != nil {
+		t.Fatalf("missing cache loaded as %v", got)
+	}
+
+	peers := []*gossip.Node{
+		{ID: "a", Address: "10.0.0.1", HTTPPort: 8080},
+		{ID: "b", Address: "fd00::2", HTTPPort: 8081},
+	}
+	if err := savePeerCache(path, peers); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	want := []string{"10.0.0.1:8080", "[fd00::2]:8081"}
+	if got := loadPeerCache(path); !reflect.DeepEqual(got, want) {
+		t.Fatalf("loaded %v, want %v", got, want)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestPeerCacheCapsAndIgnoresGarbage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	var peers []*gossip.Node
+	for i := 0; i < maxCachedPeers+5; i++ {
+		peers = append(peers, &gossip.Node{Address: "10.0.0.1", HTTPPort: 8000 + i})
+	}
+	if err := savePeerCache(path, peers); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if got := loadPeerCache(path); len(got) != maxCachedPeers {
+		t.Errorf("saved %d peers, want %d", len(got), maxCachedPeers)
+	}
+
+	os.WriteFile(path, []byte("not json"), 0o644)
+	if got := loadPeerCache(path); got != nil {
+		t.Errorf("corrupt cache loaded as %v", got)
+	}
+}
+
+func TestWithCachedPeersComeFirst(t *testing.T) {
+	got := withCachedPeers([]string{"c:1", "a:1"}, []string{"a:1", "b:1"})
+	want := []string{"c:1", "a:1", "b:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"repram/internal/logging"
+	"repram/internal/node"
+)
+
+// reloader applies configuration changes on SIGHUP without restarting the
+// node. Only settings that can change safely at runtime are applied (log
+// level, rate limit, and anything registered via onReload); the store, the
+// gossip protocol, and peer connections are left untouched. TLS certificate
+// files are re-read through an onReload hook registered in main.
+type reloader struct {
+	mu         sync.Mutex
+	cfg        *Config
+	securityMW *node.SecurityMiddleware
+	hooks      []func(*Config) error
+}
+
+func newReloader(cfg *Config, securityMW *node.SecurityMiddleware) *reloader {
+	return &reloader{cfg: cfg, securityMW: securityMW}
+}
+
+// onReload registers a hook that runs on every SIGHUP with the new config,
+// e.g. to re-read TLS certificates from disk.
+func (rl *reloader) onReload(hook func(*Config) error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.hooks = append(rl.hooks, hook)
+}
+
+// watch reloads the configuration each time the process receives SIGHUP.
+// It returns a function that stops watching.
+func (rl *reloader) watch() func() {
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-hupChan:
+				logging.Info("SIGHUP received — reloading configuration")
+				if err := rl.reload(); err != nil {
+					logging.Error("Configuration reload failed, keeping previous settings:\n%v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hupChan)
+		close(done)
+	}
+}
+
+// reload re-reads the configuration and applies the runtime-changeable parts.
+// An invalid configuration is rejected as a whole; nothing is applied.
+func (rl *reloader) reload() error {
+	next, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for _, name := range restartRequiredChanges(rl.cfg, next) {
+		logging.Warn("  %s changed but requires a restart to take effect", name)
+	}
+
+	if next.LogLevel != rl.cfg.LogLevel {
+		logging.SetLevel(next.LogLevel)
+		logging.Info("  Log level: %s → %s", rl.cfg.LogLevel, next.LogLevel)
+	}
+	if next.RateLimit != rl.cfg.RateLimit {
+		rl.securityMW.SetRateLimit(next.RateLimit, next.RateLimit*2)
+		logging.Info("  Rate limit: %d → %d req/s", rl.cfg.RateLimit, next.RateLimit)
+	}
+
+	var hookErr error
+	for _, hook := range rl.hooks {
+		if err := hook(next); err != nil {
+			hookErr = err
+			logging.Error("  Reload hook failed: %v", err)
+		}
+	}
+
+	// Only the applied settings move forward; restart-only settings keep
+	// describing what the node is actually running with.
+	applied := *rl.cfg
+	applied.LogLevel = next.LogLevel
+	applied.RateLimit = next.RateLimit
+	rl.cfg = &applied
+
+	return hookErr
+}
+
+// restartRequiredChanges lists settings that differ between the running and
+// reloaded configuration but cannot be applied without a restart. The node
+// ID is not compared because it is regenerated when REPRAM_NODE_ID is unset.
+func restartRequiredChanges(cur, next *Config) []string {
+	var changed []string
+	check := func(name string, a, b any) {
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			changed = append(changed, name)
+		}
+	}
+	check("REPRAM_ADDRESS", cur.Address, next.Address)
+	check("REPRAM_HTTP_PORT", cur.HTTPPort, next.HTTPPort)
+	check("REPRAM_GOSSIP_PORT", cur.GossipPort, next.GossipPort)
+	check("REPRAM_INTERNAL_PORT", cur.InternalPort, next.InternalPort)
+	check("REPRAM_INTERNAL_BIND", cur.InternalBind, next.InternalBind)
+	check("REPRAM_REPLICATION", cur.ReplicationFactor, next.ReplicationFactor)
+	check("REPRAM_MAX_REPLICATION", cur.MaxReplication, next.MaxReplication)
+	check("REPRAM_NAMESPACE_REPLICATION", cur.NamespaceReplicas, next.NamespaceReplicas)
+	check("REPRAM_MIN_TTL", cur.MinTTL, next.MinTTL)
+	check("REPRAM_MAX_TTL", cur.MaxTTL, next.MaxTTL)
+	check("REPRAM_DEFAULT_TTL", cur.DefaultTTL, next.DefaultTTL)
+	check("REPRAM_NAMESPACE_TTL", cur.NamespaceTTLs, next.NamespaceTTLs)
+	check("REPRAM_TTL_JITTER_PCT", cur.TTLJitterPct, next.TTLJitterPct)
+	check("REPRAM_MAX_STORAGE_MB", cur.MaxStorageMB, next.MaxStorageMB)
+	check("REPRAM_WRITE_TIMEOUT", cur.WriteTimeout, next.WriteTimeout)
+	check("REPRAM_WRITE_RESEND", cur.WriteResend, next.WriteResend)
+	check("REPRAM_CACHE_MAX_AGE", cur.CacheMaxAge, next.CacheMaxAge)
+	check("REPRAM_UI", cur.UI, next.UI)
+	check("REPRAM_ADMIN_TOKEN", cur.AdminToken, next.AdminToken)
+	check("REPRAM_AUDIT_FILE", cur.AuditFile, next.AuditFile)
+	check("REPRAM_AUDIT_MAX_MB", cur.AuditMaxMB, next.AuditMaxMB)
+	check("REPRAM_AUDIT_WEBHOOK", cur.AuditWebhook, next.AuditWebhook)
+	check("REPRAM_AUDIT_SALT", cur.AuditSalt, next.AuditSalt)
+	check("REPRAM_CLUSTER_SECRET", cur.ClusterSecret, next.ClusterSecret)
+	check("REPRAM_TRUST_PROXY", cur.TrustProxy, next.TrustProxy)
+	check("REPRAM_BOOTSTRAP_DIAL_BACK", cur.DialBack, next.DialBack)
+	check("REPRAM_PEER_RATE_LIMIT", cur.PeerRateLimit, next.PeerRateLimit)
+	check("REPRAM_ENCLAVE", cur.Enclave, next.Enclave)
+	check("REPRAM_ZONE", cur.Zone, next.Zone)
+	check("REPRAM_NETWORK", cur.Network, next.Network)
+	check("REPRAM_PEER_REPUTATION", cur.PeerReputation, next.PeerReputation)
+	check("REPRAM_NODE_KEY_FILE", cur.NodeKeyFile, next.NodeKeyFile)
+	check("REPRAM_PEER_CACHE_FILE", cur.PeerCacheFile, next.PeerCacheFile)
+	check("REPRAM_BOOTSTRAP_REFRESH", cur.BootstrapRefresh, next.BootstrapRefresh)
+	check("REPRAM_PEERS", cur.Peers, next.Peers)
+	check("REPRAM_RATE_LIMIT_TOKENS", cur.TokenRateLimits, next.TokenRateLimits)
+	check("REPRAM_RATE_LIMIT_NAMESPACE", cur.NamespaceRateLimit, next.NamespaceRateLimit)
+	check("REPRAM_RATE_LIMIT_CLUSTER", cur.ClusterRateLimit, next.ClusterRateLimit)
+	check("REPRAM_RATE_LIMIT_BYTES", cur.WriteByteLimit, next.WriteByteLimit)
+	check("REPRAM_MAX_KEY_LENGTH", cur.MaxKeyLength, next.MaxKeyLength)
+	check("REPRAM_RESERVED_KEY_PREFIXES", cur.ReservedPrefixes, next.ReservedPrefixes)
+	check("REPRAM_CORS_ORIGINS", cur.CORSOrigins, next.CORSOrigins)
+	check("REPRAM_WEBHOOKS", cur.Webhooks, next.Webhooks)
+	check("REPRAM_WEBHOOK_SECRET", cur.WebhookSecret, next.WebhookSecret)
+	check("REPRAM_MAX_GOSSIP_MB", cur.MaxGossipMB, next.MaxGossipMB)
+	check("REPRAM_GOSSIP_CONCURRENCY", cur.GossipConcurrency, next.GossipConcurrency)
+	check("REPRAM_GOSSIP_ATTEMPTS", cur.GossipAttempts, next.GossipAttempts)
+	check("REPRAM_MAX_VALUE_BYTES", cur.MaxValueBytes, next.MaxValueBytes)
+	check("REPRAM_MEMORY_HIGH_WATER_MB", cur.MemoryHighWaterMB, next.MemoryHighWaterMB)
+	check("REPRAM_MAX_INFLIGHT", cur.MaxInflight, next.MaxInflight)
+	check("REPRAM_REQUEST_TIMEOUTS", cur.RequestTimeouts, next.RequestTimeouts)
+	check("REPRAM_PEER_ALLOWLIST", cur.PeerAllowlist, next.PeerAllowlist)
+	check("REPRAM_PEER_BLOCKLIST", cur.PeerBlocklist, next.PeerBlocklist)
+	check("REPRAM_TLS_CERT", cur.TLSCert, next.TLSCert)
+	check("REPRAM_TLS_KEY", cur.TLSKey, next.TLSKey)
+	check("REPRAM_TLS_AUTOCERT_HOSTS", cur.TLSAutocertHosts, next.TLSAutocertHosts)
+	check("REPRAM_TLS_AUTOCERT_DIR", cur.TLSAutocertDir, next.TLSAutocertDir)
+	check("REPRAM_TLS_REDIRECT_PORT", cur.TLSRedirectPort, next.TLSRedirectPort)
+	check("REPRAM_TLS_PEER_PINS", cur.TLSPeerPins, next.TLSPeerPins)
+	return changed
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"repram/internal/logging"
+	"repram/internal/node"
+)
+
+// writeEnvFile points REPRAM_ENV_FILE at a temp file with the given contents.
+func writeEnvFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	t.Setenv("REPRAM_ENV_FILE", path)
+}
+
+// allowedBurst counts how many back-to-back requests from one IP pass the
+// security middleware before the first 429.
+func allowedBurst(sm *node.SecurityMiddleware, ip string) int {
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest("GET", "/v1/health", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code == http.StatusTooManyRequests {
+			return i
+		}
+	}
+	return 100
+}
+
+func TestReloadAppliesLogLevelAndRateLimit(t *testing.T) {
+	defer logging.SetLevel(logging.CurrentLevel())
+
+	path := filepath.Join(t.TempDir(), "repram.env")
+	writeEnvFile(t, path, "REPRAM_LOG_LEVEL=info\nREPRAM_RATE_LIMIT=1\n")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	logging.SetLevel(cfg.LogLevel)
+	sm := node.NewSecurityMiddleware(cfg.RateLimit, cfg.RateLimit*2, 1024, false)
+	defer sm.Close()
+
+	if got := allowedBurst(sm, "10.0.0.1"); got != 2 {
+		t.Fatalf("burst before reload = %d, want 2", got)
+	}
+
+	writeEnvFile(t, path, "# bumped for load test\nREPRAM_LOG_LEVEL=\"debug\"\nREPRAM_RATE_LIMIT=5\n")
+	rl := newReloader(cfg, sm)
+	if err := rl.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	if logging.CurrentLevel() != logging.LevelDebug {
+		t.Errorf("log level = %s, want debug", logging.CurrentLevel())
+	}
+	if got := allowedBurst(sm, "10.0.0.2"); got != 10 {
+		t.Errorf("burst after reload = %d, want 10", got)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	defer logging.SetLevel(logging.CurrentLevel())
+
+	path := filepath.Join(t.TempDir(), "repram.env")
+	writeEnvFile(t, path, "REPRAM_LOG_LEVEL=warn\n")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	logging.SetLevel(cfg.LogLevel)
+	sm := node.NewSecurityMiddleware(cfg.RateLimit, cfg.RateLimit*2, 1024, false)
+	defer sm.Close()
+
+	// An invalid value anywhere rejects the whole reload
+	writeEnvFile(t, path, "REPRAM_LOG_LEVEL=debug\nREPRAM_MIN_TTL=999999\n")
+	rl := newReloader(cfg, sm)
+	if err := rl.reload(); err == nil {
+		t.Fatal("expected reload to fail on invalid config")
+	}
+
+	if logging.CurrentLevel() != logging.LevelWarn {
+		t.Errorf("log level = %s, want warn (unchanged)", logging.CurrentLevel())
+	}
+}
+
+func TestReloadRunsHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repram.env")
+	writeEnvFile(t, path, "REPRAM_NODE_ID=hook-node\n")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	sm := node.NewSecurityMiddleware(cfg.RateLimit, cfg.RateLimit*2, 1024, false)
+	defer sm.Close()
+
+	rl := newReloader(cfg, sm)
+	var got *Config
+	rl.onReload(func(c *Config) error {
+		got = c
+		return nil
+	})
+	if err := rl.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got == nil || got.NodeID != "hook-node" {
+		t.Fatalf("hook not called with reloaded config, got %+v", got)
+	}
+}
+
+func TestRestartRequiredChanges(t *testing.T) {
+	cur := validConfig()
+	next := validConfig()
+	next.NodeID = "regenerated"
+	next.RateLimit = 500
+	next.HTTPPort = 8081
+	next.Peers = []string{"node2:8080"}
+
+	changed := restartRequiredChanges(cur, next)
+	if len(changed) != 2 || changed[0] != "REPRAM_HTTP_PORT" || changed[1] != "REPRAM_PEERS" {
+		t.Fatalf("changed = %v, want [REPRAM_HTTP_PORT REPRAM_PEERS]", changed)
+	}
+}
+
+func TestReadEnvFileRejectsMalformedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repram.env")
+	if err := os.WriteFile(path, []byte("REPRAM_RATE_LIMIT=10\nnot a setting\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readEnvFile(path); err == nil {
+		t.Fatal("expected error for line without '='")
+	}
+}
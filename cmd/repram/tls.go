@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"repram/internal/gossip"
+	"repram/internal/logging"
+)
+
+// hstsMaxAge is the Strict-Transport-Security max-age sent when the node
+// terminates TLS itself.
+const hstsMaxAge = 365 * 24 * time.Hour
+
+// serverTLS is the TLS setup for the client-facing HTTP server.
+type serverTLS struct {
+	config   *tls.Config
+	redirect http.Handler  // handler for the plain HTTP redirect port
+	certs    *certReloader // nil when using autocert
+}
+
+// newServerTLS builds the TLS configuration from either certificate files or
+// autocert. Returns nil if TLS is not enabled.
+func newServerTLS(cfg *Config) (*serverTLS, error) {
+	if !cfg.TLSEnabled() {
+		return nil, nil
+	}
+
+	if len(cfg.TLSAutocertHosts) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertHosts...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertDir),
+		}
+		return &serverTLS{
+			config: manager.TLSConfig(),
+			// ACME HTTP-01 challenges are answered on the redirect port;
+			// everything else is redirected to HTTPS.
+			redirect: manager.HTTPHandler(httpsRedirectHandler(cfg.HTTPPort)),
+		}, nil
+	}
+
+	certs, err := newCertReloader(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	return &serverTLS{
+		config: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.getCertificate,
+		},
+		redirect: httpsRedirectHandler(cfg.HTTPPort),
+		certs:    certs,
+	}, nil
+}
+
+// peerTLSConfig returns the client TLS config for gossip and bootstrap
+// requests: pinned when REPRAM_TLS_PEER_PINS is set or, on the public
+// network, when the bootstrap TXT records publish pins; otherwise nil, which
+// verifies peers against the system roots.
+func peerTLSConfig(cfg *Config, dnsBootstrap bool) *tls.Config {
+	pins := cfg.PeerPins()
+	if pins == nil && dnsBootstrap {
+		published := resolvePeerPinsDNS(context.Background(), net.DefaultResolver, bootstrapHostname)
+		var err error
+		if pins, err = gossip.ParsePeerPins(published); err != nil {
+			logging.Warn("Ignoring peer pins published for %s: %v", bootstrapHostname, err)
+			pins = nil
+		}
+	}
+	if pins == nil {
+		return nil
+	}
+	logging.Info("Peer TLS certificates pinned")
+	return pins.TLSConfig()
+}
+
+// certReloader serves a certificate loaded from disk and swaps it atomically
+// when reloaded, so a renewed certificate is picked up on SIGHUP without
+// dropping connections.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// reload re-reads the certificate and key. On failure the previous
+// certificate stays in use.
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate %s: %w", cr.certFile, err)
+	}
+	cr.cert.Store(&cert)
+	return nil
+}
+
+// reloadHook adapts reload to the reloader's onReload signature.
+func (cr *certReloader) reloadHook(*Config) error {
+	if err := cr.reload(); err != nil {
+		return err
+	}
+	logging.Info("  TLS certificate reloaded from %s", cr.certFile)
+	return nil
+}
+
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cr.cert.Load(), nil
+}
+
+// httpsRedirectHandler redirects plain HTTP requests to the same host and
+// path on the HTTPS port.
+func httpsRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a self-signed certificate and key for commonName
+// into dir and returns their paths.
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestServerTLSDisabledByDefault(t *testing.T) {
+	st, err := newServerTLS(validConfig())
+	if err != nil || st != nil {
+		t.Fatalf("newServerTLS = (%v, %v), want (nil, nil)", st, err)
+	}
+}
+
+func TestServerTLSFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := validConfig()
+	cfg.TLSCert, cfg.TLSKey = writeSelfSignedCert(t, dir, "first.example")
+
+	st, err := newServerTLS(cfg)
+	if err != nil {
+		t.Fatalf("newServerTLS: %v", err)
+	}
+
+	cert, err := st.config.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if leaf.Subject.CommonName != "first.example" {
+		t.Fatalf("CommonName = %q, want first.example", leaf.Subject.CommonName)
+	}
+
+	// Renewed certificate on disk is served after reload
+	writeSelfSignedCert(t, dir, "renewed.example")
+	if err := st.certs.reloadHook(cfg); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	cert, _ = st.config.GetCertificate(nil)
+	leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	if leaf.Subject.CommonName != "renewed.example" {
+		t.Fatalf("CommonName after reload = %q, want renewed.example", leaf.Subject.CommonName)
+	}
+}
+
+func TestCertReloadKeepsOldCertOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "keep.example")
+
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cr.reload(); err == nil {
+		t.Fatal("expected reload to fail on a corrupt certificate")
+	}
+
+	cert, _ := cr.getCertificate(nil)
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if leaf.Subject.CommonName != "keep.example" {
+		t.Fatalf("CommonName = %q, want keep.example (previous cert kept)", leaf.Subject.CommonName)
+	}
+}
+
+func TestServerTLSMissingCertFails(t *testing.T) {
+	cfg := validConfig()
+	cfg.TLSCert = "/nonexistent/cert.pem"
+	cfg.TLSKey = "/nonexistent/key.pem"
+
+	if _, err := newServerTLS(cfg); err == nil {
+		t.Fatal("expected error for missing certificate files")
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		port int
+		host string
+		want string
+	}{
+		{443, "repram.example:80", "https://repram.example/v1/data/k?ttl=600"},
+		{8443, "repram.example", "https://repram.example:8443/v1/data/k?ttl=600"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/data/k?ttl=600", nil)
+		req.Host = tt.host
+		w := httptest.NewRecorder()
+		httpsRedirectHandler(tt.port).ServeHTTP(w, req)
+
+		if w.Code != http.StatusMovedPermanently {
+			t.Fatalf("expected 301, got %d", w.Code)
+		}
+		if got := w.Header().Get("Location"); got != tt.want {
+			t.Errorf("Location = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestValidateTLSSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr string
+	}{
+		{"cert without key", func(c *Config) { c.TLSCert = "cert.pem" }, "must be set together"},
+		{"files and autocert", func(c *Config) {
+			c.TLSCert, c.TLSKey = "cert.pem", "key.pem"
+			c.TLSAutocertHosts = []string{"repram.example"}
+		}, "mutually exclusive"},
+		{"redirect without TLS", func(c *Config) { c.TLSRedirectPort = 80 }, "TLS is not enabled"},
+		{"redirect on HTTP port", func(c *Config) {
+			c.TLSAutocertHosts = []string{"repram.example"}
+			c.TLSRedirectPort = 8080
+		}, "collides"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.mutate(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
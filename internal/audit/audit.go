@@ -0,0 +1,199 @@
+// Package audit keeps an append-only record of client writes for operators
+// investigating abuse. Keys and client identities are stored only as keyed
+// hashes, so the log holds no user data past its TTL: an operator holding
+// the salt can check whether a given key or client appears, but cannot
+// read them back out of the log.
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"repram/internal/logging"
+)
+
+// DefaultKeep is how many rotated files a file log keeps besides the
+// current one.
+const DefaultKeep = 5
+
+// Write describes one client write as the server saw it. Key and Client
+// are hashed before anything is recorded.
+type Write struct {
+	At     time.Time
+	Key    string
+	Client string // API token, or client IP without one
+	Size   int    // bytes
+	TTL    int    // seconds, as stored; 0 if the write was refused first
+	Status int    // HTTP status of the response
+}
+
+// Record is one line of the audit log.
+type Record struct {
+	Time   time.Time `json:"time"`
+	NodeID string    `json:"node_id"`
+	Key    string    `json:"key"`    // Hash of the key
+	Client string    `json:"client"` // Hash of the client
+	Size   int       `json:"size"`
+	TTL    int       `json:"ttl,omitempty"`
+	Status int       `json:"status"`
+}
+
+// Logger writes audit records to a file, a webhook, or both.
+type Logger struct {
+	nodeID string
+	salt   []byte
+
+	mutex sync.Mutex // guards file
+	file  *rotatingFile
+	post  func(body []byte)
+}
+
+// New creates a Logger that writes nowhere until ToFile or ToWebhook is
+// called. An empty salt is replaced by a random one, so hashes can't be
+// matched across restarts; set one to compare them over time.
+func New(nodeID string, salt string) *Logger {
+	l := &Logger{nodeID: nodeID, salt: []byte(salt)}
+	if salt == "" {
+		l.salt = make([]byte, 32)
+		rand.Read(l.salt)
+	}
+	return l
+}
+
+// ToFile appends records to path as JSON lines. When the file would grow
+// past maxBytes it is rotated to path.1, shifting older files up to
+// path.<keep> and deleting the oldest.
+func (l *Logger) ToFile(path string, maxBytes int64, keep int) error {
+	f, err := openRotating(path, maxBytes, keep)
+	if err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	l.file = f
+	l.mutex.Unlock()
+	return nil
+}
+
+// ToWebhook hands each record's JSON to post, which must not block; a
+// webhook.Dispatcher's Post fits.
+func (l *Logger) ToWebhook(post func(body []byte)) {
+	l.post = post
+}
+
+// Hash returns the keyed hash the log records for s, so an operator can
+// look a key or client up.
+func (l *Logger) Hash(s string) string {
+	mac := hmac.New(sha256.New, l.salt)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Log records w. Failures to write the file are logged and otherwise
+// ignored: auditing never fails a client's write.
+func (l *Logger) Log(w Write) {
+	line, _ := json.Marshal(Record{
+		Time:   w.At.UTC(),
+		NodeID: l.nodeID,
+		Key:    l.Hash(w.Key),
+		Client: l.Hash(w.Client),
+		Size:   w.Size,
+		TTL:    w.TTL,
+		Status: w.Status,
+	})
+	if l.post != nil {
+		l.post(line)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file != nil {
+		if err := l.file.write(append(line, '\n')); err != nil {
+			logging.Warn("[audit] Failed to write audit log: %v", err)
+		}
+	}
+}
+
+// Close flushes the log file to disk and closes it. Records handed to a
+// webhook are delivered by its dispatcher, which is shut down separately.
+func (l *Logger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	if err := l.file.f.Sync(); err != nil {
+		l.file.f.Close()
+		return err
+	}
+	return l.file.f.Close()
+}
+
+// rotatingFile is an append-only file rotated by size.
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	keep     int
+	f        *os.File
+	size     int64
+}
+
+func openRotating(path string, maxBytes int64, keep int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxBytes: maxBytes, keep: keep}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size = f, info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) write(line []byte) error {
+	if rf.maxBytes > 0 && rf.size > 0 && rf.size+int64(len(line)) > rf.maxBytes {
+		if err := rf.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := rf.f.Write(line)
+	rf.size += int64(n)
+	return err
+}
+
+// rotate moves path.N to path.N+1 for each kept file, dropping the oldest,
+// moves the current file to path.1, and starts a new one.
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	if rf.keep < 1 {
+		os.Remove(rf.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.keep))
+		for i := rf.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+			// Keep appending to the current file rather than lose records
+			logging.Warn("[audit] Failed to rotate %s: %v", rf.path, err)
+		}
+	}
+	return rf.open()
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestLogHashesKeyAndClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := New("node-1", "0123456789abcdef")
+	if err := l.ToFile(path, 0, DefaultKeep); err != nil {
+		t.Fatal(err)
+	}
+	var posted []string
+	l.ToWebhook(func(body []byte) { posted = append(posted, string(body)) })
+
+	l.Log(Write{At: time.Now(), Key: "secret-key", Client: "203.0.113.9", Size: 42, TTL: 600, Status: 201})
+	l.Close()
+
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), "secret-key") || strings.Contains(string(raw), "203.0.113.9") {
+		t.Fatalf("audit log holds the raw key or client: %s", raw)
+	}
+	records := readRecords(t, path)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	r := records[0]
+	if r.Key != l.Hash("secret-key") || r.Client != l.Hash("203.0.113.9") || r.Size != 42 || r.TTL != 600 || r.Status != 201 || r.NodeID != "node-1" {
+		t.Errorf("record %+v", r)
+	}
+	if len(posted) != 1 || !strings.Contains(posted[0], l.Hash("secret-key")) {
+		t.Errorf("webhook got %v", posted)
+	}
+
+	// The same salt gives the same hashes after a restart
+	if New("node-1", "0123456789abcdef").Hash("secret-key") != r.Key {
+		t.Error("hashes with the same salt differ")
+	}
+}
+
+func TestFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := New("node-1", "")
+	if err := l.ToFile(path, 400, 2); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for range 20 {
+		l.Log(Write{At: time.Now(), Key: "k", Client: "c", Size: 1, TTL: 60, Status: 201})
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if info.Size() > 400 {
+			t.Errorf("%s is %d bytes, over the 400-byte limit", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more than 2 rotated files")
+	}
+}
@@ -1,15 +1,21 @@
 package cluster
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"repram/internal/gossip"
 )
 
@@ -31,6 +37,10 @@ func newTestNode(t *testing.T, nodeID, enclave string, replicationFactor int) *t
 	if err != nil {
 		t.Fatalf("failed to listen: %v", err)
 	}
+	return newTestNodeOn(listener, nodeID, enclave, replicationFactor)
+}
+
+func newTestNodeOn(listener net.Listener, nodeID, enclave string, replicationFactor int) *testNode {
 	port := listener.Addr().(*net.TCPAddr).Port
 
 	cn := NewClusterNode(nodeID, "127.0.0.1", port, port, replicationFactor, 0, 2*time.Second, "", enclave)
@@ -56,6 +66,19 @@ func (tn *testNode) stop() {
 	tn.server.Close()
 }
 
+// restart stops the node and starts a fresh process in its place: same ID
+// and port, empty store.
+func (tn *testNode) restart(t *testing.T, ctx context.Context, bootstrapAddrs []string) {
+	t.Helper()
+	tn.stop()
+	listener, err := net.Listen("tcp", tn.addr())
+	if err != nil {
+		t.Fatalf("failed to listen on %s again: %v", tn.addr(), err)
+	}
+	*tn = *newTestNodeOn(listener, string(tn.node.localNode.ID), tn.node.localNode.Enclave, tn.node.replicationFactor)
+	tn.start(t, ctx, bootstrapAddrs)
+}
+
 func (tn *testNode) addr() string {
 	return fmt.Sprintf("127.0.0.1:%d", tn.port)
 }
@@ -76,14 +99,21 @@ func makeGossipHandler(cn *ClusterNode) http.HandlerFunc {
 		}
 
 		msg := &gossip.Message{
-			Type:      gossip.MessageType(simpleMsg.Type),
-			From:      gossip.NodeID(simpleMsg.From),
-			To:        gossip.NodeID(simpleMsg.To),
-			Key:       simpleMsg.Key,
-			Data:      simpleMsg.Data,
-			TTL:       int(simpleMsg.TTL),
-			Timestamp: time.Unix(simpleMsg.Timestamp, 0),
-			MessageID: simpleMsg.MessageID,
+			Type:        gossip.MessageType(simpleMsg.Type),
+			From:        gossip.NodeID(simpleMsg.From),
+			To:          gossip.NodeID(simpleMsg.To),
+			Key:         simpleMsg.Key,
+			Data:        simpleMsg.Data,
+			Hash:        simpleMsg.Hash,
+			TTL:         int(simpleMsg.TTL),
+			Replication: simpleMsg.Replication,
+			Reason:      simpleMsg.Reason,
+			Resend:      simpleMsg.Resend,
+			Origin:      gossip.NodeID(simpleMsg.Origin),
+			WrittenAt:   simpleMsg.WrittenAtTime(),
+			Timestamp:   time.Unix(simpleMsg.Timestamp, 0),
+			MessageID:   simpleMsg.MessageID,
+			Updates:     gossip.PeerUpdates(simpleMsg.Updates),
 		}
 
 		if simpleMsg.NodeInfo != nil {
@@ -92,11 +122,13 @@ func makeGossipHandler(cn *ClusterNode) http.HandlerFunc {
 				enclave = "default"
 			}
 			msg.NodeInfo = &gossip.Node{
-				ID:       gossip.NodeID(simpleMsg.NodeInfo.ID),
-				Address:  simpleMsg.NodeInfo.Address,
-				Port:     simpleMsg.NodeInfo.Port,
-				HTTPPort: simpleMsg.NodeInfo.HTTPPort,
-				Enclave:  enclave,
+				ID:           gossip.NodeID(simpleMsg.NodeInfo.ID),
+				Address:      simpleMsg.NodeInfo.Address,
+				Port:         simpleMsg.NodeInfo.Port,
+				HTTPPort:     simpleMsg.NodeInfo.HTTPPort,
+				InternalPort: simpleMsg.NodeInfo.InternalPort,
+				Enclave:      enclave,
+				Capacity:     simpleMsg.NodeInfo.Capacity,
 			}
 		}
 
@@ -119,7 +151,11 @@ func makeBootstrapHandler(cn *ClusterNode) http.HandlerFunc {
 			return
 		}
 
-		resp := cn.HandleBootstrap(&req)
+		resp, err := cn.HandleBootstrap(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 	}
@@ -174,6 +210,189 @@ func TestBootstrapPeerDiscovery(t *testing.T) {
 	}
 }
 
+func TestBootstrapRetriesUntilSeedAnswers(t *testing.T) {
+	defer func(min time.Duration) { bootstrapRetryMin = min }(bootstrapRetryMin)
+	bootstrapRetryMin = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The seed's port is reserved but nothing listens on it yet
+	node1 := newTestNode(t, "node1", "default", 2)
+	node1.listener.Close()
+	node2 := newTestNode(t, "node2", "default", 2)
+	defer node2.stop()
+
+	node2.start(t, ctx, []string{node1.addr()})
+	if err := node2.node.Put(ctx, "written-alone", []byte("v"), 300*time.Second); err != nil {
+		t.Fatalf("Put on lone node failed: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", node1.addr())
+	if err != nil {
+		t.Skipf("seed port taken before it could be reused: %v", err)
+	}
+	node1.listener = listener
+	defer node1.stop()
+	node1.start(t, ctx, nil)
+
+	waitForPeers(t, node2, 1, 3*time.Second)
+	waitForPeers(t, node1, 1, 3*time.Second)
+
+	// The rejoining node pushes what it wrote while alone
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if data, ok := node1.node.Get("written-alone"); ok {
+			if string(data) != "v" {
+				t.Fatalf("seed got %q, want %q", data, "v")
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("seed never received the key written before the node joined")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSplitPartitionsMerge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a1 := newTestNode(t, "a1", "default", 3)
+	a2 := newTestNode(t, "a2", "default", 3)
+	b1 := newTestNode(t, "b1", "default", 3)
+	defer a1.stop()
+	defer a2.stop()
+	defer b1.stop()
+
+	// Two partitions of the same enclave, each taking writes
+	a1.start(t, ctx, nil)
+	a2.start(t, ctx, []string{a1.addr()})
+	b1.start(t, ctx, nil)
+	waitForPeers(t, a1, 1, 3*time.Second)
+	if err := a1.node.Put(ctx, "from-a", []byte("a"), 300*time.Second); err != nil {
+		t.Fatalf("Put on a1 failed: %v", err)
+	}
+	if err := b1.node.Put(ctx, "from-b", []byte("b"), 300*time.Second); err != nil {
+		t.Fatalf("Put on b1 failed: %v", err)
+	}
+
+	// b1 learns a seed in the other partition, as a DNS refresh would
+	if err := b1.node.Bootstrap(ctx, []string{a1.addr()}); err != nil {
+		t.Fatalf("Bootstrap failed: %v", err)
+	}
+
+	waitForPeers(t, b1, 2, 3*time.Second)
+	waitForPeers(t, a2, 2, 3*time.Second)
+	deadline := time.Now().Add(3 * time.Second)
+	for _, tn := range []*testNode{a1, a2, b1} {
+		for _, key := range []string{"from-a", "from-b"} {
+			for {
+				if _, ok := tn.node.Get(key); ok {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("node %s never received %s after the merge", tn.node.localNode.ID, key)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestPushLocalDataCountsOnlyDelivered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	up := newTestNode(t, "up", "default", 3)
+	defer up.stop()
+	up.start(t, ctx, nil)
+
+	n := NewClusterNode("n1", "127.0.0.1", 0, 0, 3, 0, time.Second, "", "default")
+	n.SetSendAttempts(1)
+	if err := n.Start(ctx, nil); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer n.Stop()
+	for _, key := range []string{"a", "b"} {
+		if err := n.store.Put(key, []byte("v"), time.Minute); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	live := &gossip.Node{ID: "up", Address: "127.0.0.1", Port: up.port, HTTPPort: up.port, Enclave: "default"}
+	if pushed, failed := n.pushLocalData(ctx, []*gossip.Node{live}); pushed != 2 || failed != 0 {
+		t.Errorf("push to a live peer = %d sent, %d failed; want 2, 0", pushed, failed)
+	}
+	dead := &gossip.Node{ID: "dead", Address: "127.0.0.1", Port: 1, HTTPPort: 1, Enclave: "default"}
+	if pushed, failed := n.pushLocalData(ctx, []*gossip.Node{dead}); pushed != 0 || failed != 2 {
+		t.Errorf("push to an unreachable peer = %d sent, %d failed; want 0, 2", pushed, failed)
+	}
+}
+
+func TestStopContextEndsOnStop(t *testing.T) {
+	n := NewClusterNode("n1", "localhost", 0, 0, 3, 0, time.Second, "", "default")
+	ctx, cancel := n.stopContext()
+	defer cancel()
+
+	n.Stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stop context not cancelled by Stop")
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	n := NewClusterNode("n1", "localhost", 0, 0, 3, 0, time.Second, "", "default")
+	if err := n.Stop(); err != nil {
+		t.Fatalf("first Stop: %v", err)
+	}
+	// Embedders and shutdown paths may both stop the node
+	if err := n.Stop(); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+}
+
+func TestPartitionMetricsRegisterOnProvidedRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newPartitionMetrics(reg)
+	m.count("detected")
+
+	// A second node on the same registry shares the counter
+	newPartitionMetrics(reg).count("detected")
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetName() != "repram_partition_merges_total" {
+		t.Fatalf("registry families = %v, want repram_partition_merges_total", families)
+	}
+	if got := families[0].GetMetric()[0].GetCounter().GetValue(); got != 2 {
+		t.Errorf("detected merges = %v, want 2", got)
+	}
+}
+
+func TestMergePushCooldown(t *testing.T) {
+	n := NewClusterNode("n1", "localhost", 0, 0, 3, 0, time.Second, "", "default")
+	now := time.Now()
+
+	if !n.allowMergePush("peer", now) {
+		t.Fatal("first merge request from a peer should be answered")
+	}
+	if n.allowMergePush("peer", now.Add(time.Second)) {
+		t.Error("a second merge request inside the cooldown should be ignored")
+	}
+	if !n.allowMergePush("other", now.Add(time.Second)) {
+		t.Error("the cooldown is per peer")
+	}
+	if !n.allowMergePush("peer", now.Add(partitionCheckInterval)) {
+		t.Error("a merge request after the cooldown should be answered")
+	}
+}
+
 func TestWriteReplicationAndQuorum(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -214,6 +433,16 @@ func TestWriteReplicationAndQuorum(t *testing.T) {
 	if string(data) != "hello cluster" {
 		t.Fatalf("node2 data = %q, want %q", string(data), "hello cluster")
 	}
+
+	// Both copies name node1 as where the value was written, at one time
+	_, meta1, _ := node1.node.ViewMeta("test-key")
+	_, meta2, _ := node2.node.ViewMeta("test-key")
+	if meta1.Origin.Node != "node1" || meta2.Origin.Node != "node1" {
+		t.Errorf("origins = %q, %q; want node1 on both", meta1.Origin.Node, meta2.Origin.Node)
+	}
+	if meta1.Origin.WrittenAt.IsZero() || !meta2.Origin.WrittenAt.Equal(meta1.Origin.WrittenAt.Truncate(time.Millisecond)) {
+		t.Errorf("written at %v on node1, %v on node2", meta1.Origin.WrittenAt, meta2.Origin.WrittenAt)
+	}
 }
 
 func TestEnclaveIsolation(t *testing.T) {
@@ -295,10 +524,13 @@ func TestQuorumTimeout(t *testing.T) {
 	node2.server.Close()
 
 	// Write on node1 — should store locally but fail quorum (no ACK from node2)
-	err := node1.node.Put(ctx, "timeout-key", []byte("will timeout"), 300*time.Second)
+	result, err := node1.node.PutWithResult(ctx, "timeout-key", []byte("will timeout"), 300*time.Second, 0)
 	if err != ErrQuorumTimeout {
 		t.Fatalf("expected ErrQuorumTimeout, got: %v", err)
 	}
+	if want := (WriteResult{Nodes: 2, Confirmed: 1, Quorum: 2}); result != want {
+		t.Fatalf("result = %+v, want %+v", result, want)
+	}
 
 	// Data should still be stored locally on node1
 	data, exists := node1.node.Get("timeout-key")
@@ -310,6 +542,49 @@ func TestQuorumTimeout(t *testing.T) {
 	}
 }
 
+// A PUT lost on the way to a replica is sent again halfway through the
+// write timeout, and the write still reaches quorum.
+func TestUnansweredPutIsResent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "node1", "default", 3)
+	node2 := newTestNode(t, "node2", "default", 3)
+	defer node1.stop()
+	defer node2.stop()
+
+	// node2 accepts the first PUT and drops it on the floor
+	var dropped atomic.Bool
+	handler := node2.server.Handler
+	node2.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var msg gossip.SimpleMessage
+		json.Unmarshal(body, &msg)
+		if msg.Type == string(gossip.MessageTypePut) && dropped.CompareAndSwap(false, true) {
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	})
+
+	node1.start(t, ctx, nil)
+	node2.start(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node1, 1, 3*time.Second)
+
+	if err := node1.node.Put(ctx, "lossy", []byte("v"), 300*time.Second); err != nil {
+		t.Fatalf("Put with one lost send: %v", err)
+	}
+	if !dropped.Load() {
+		t.Fatal("the first PUT never reached node2")
+	}
+	if resent := node1.node.RecentWrites()[0].Resent; !reflect.DeepEqual(resent, []string{"node2"}) {
+		t.Fatalf("resent = %v, want [node2]", resent)
+	}
+	if _, ok := node2.node.Get("lossy"); !ok {
+		t.Fatal("node2 does not hold the resent value")
+	}
+}
+
 func TestSingleNodeWrite(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -334,6 +609,34 @@ func TestSingleNodeWrite(t *testing.T) {
 	}
 }
 
+func TestRangeReportsRemainingTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "solo", "default", 1)
+	defer node1.stop()
+
+	node1.start(t, ctx, nil)
+
+	if err := node1.node.Put(ctx, "ranged", []byte("v"), 300*time.Second); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	_, _, originalTTL, exists := node1.node.GetWithMetadata("ranged")
+	if !exists || originalTTL != 300*time.Second {
+		t.Fatalf("GetWithMetadata: exists=%v originalTTL=%v, want true 5m0s", exists, originalTTL)
+	}
+
+	seen := make(map[string]int)
+	node1.node.Range(func(key string, ttl int) bool {
+		seen[key] = ttl
+		return true
+	})
+	if ttl, ok := seen["ranged"]; !ok || ttl < 298 || ttl > 300 {
+		t.Fatalf("Range reported ttl=%d (present=%v), want ~300", ttl, ok)
+	}
+}
+
 func TestThreeNodeBootstrapTopology(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -393,3 +696,548 @@ func TestWriteReplicationToThreeNodes(t *testing.T) {
 		}
 	}
 }
+
+func TestPerWriteReplicationLimitsCopies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var nodes []*testNode
+	for i := 1; i <= 4; i++ {
+		tn := newTestNode(t, fmt.Sprintf("node%d", i), "default", 3)
+		defer tn.stop()
+		nodes = append(nodes, tn)
+	}
+	nodes[0].node.SetReplicationLimits(3, map[string]int{"chat": 2})
+	nodes[0].start(t, ctx, nil)
+	for _, tn := range nodes[1:] {
+		tn.start(t, ctx, []string{nodes[0].addr()})
+	}
+	waitForPeers(t, nodes[0], 3, 5*time.Second)
+
+	holders := func(key string) int {
+		n := 0
+		for _, tn := range nodes {
+			if _, ok := tn.node.Get(key); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		key         string
+		replication int
+		want        int
+	}{
+		{"session:a", 0, 4}, // no override: every node
+		{"chat:a", 0, 2},    // namespace default
+		{"session:b", 2, 2}, // per write
+		{"session:c", 9, 3}, // capped
+	}
+	for _, tt := range tests {
+		if err := nodes[0].node.PutReplicated(ctx, tt.key, []byte("v"), 300*time.Second, tt.replication); err != nil {
+			t.Fatalf("PutReplicated(%s, %d) failed: %v", tt.key, tt.replication, err)
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+	for _, tt := range tests {
+		if got := holders(tt.key); got != tt.want {
+			t.Errorf("%s (replication %d) is on %d nodes, want %d", tt.key, tt.replication, got, tt.want)
+		}
+	}
+}
+
+func TestRateDigestCrossesEnclaves(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "node1", "alpha", 3)
+	node2 := newTestNode(t, "node2", "beta", 3)
+	defer node1.stop()
+	defer node2.stop()
+
+	type digest struct {
+		from string
+		data string
+	}
+	received := make(chan digest, 1)
+	node2.node.SetRateDigestHandler(func(from string, data []byte) error {
+		received <- digest{from, string(data)}
+		return nil
+	})
+
+	node1.start(t, ctx, nil)
+	node2.start(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node1, 1, 3*time.Second)
+
+	// Rate limits are cluster-wide, so digests ignore enclave boundaries
+	node1.node.BroadcastRateDigest(ctx, []byte(`{"window":0,"counts":{}}`))
+
+	select {
+	case d := <-received:
+		if d.from != "node1" || d.data != `{"window":0,"counts":{}}` {
+			t.Fatalf("received digest %+v", d)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("rate digest not delivered")
+	}
+}
+
+func TestDuplicatePutSkipsStoreWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "solo", "default", 1)
+	defer node1.stop()
+
+	node1.start(t, ctx, nil)
+
+	data := []byte("same bytes")
+	if err := node1.node.Put(ctx, "dup", data, 300*time.Second); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	_, createdAt, _, _ := node1.node.GetWithMetadata("dup")
+
+	replay := func(id string, data []byte, ttl int) time.Time {
+		t.Helper()
+		msg := &gossip.Message{
+			Type:      gossip.MessageTypePut,
+			From:      "peer",
+			Key:       "dup",
+			Data:      data,
+			Hash:      gossip.ContentHash(data),
+			TTL:       ttl,
+			Timestamp: time.Now(),
+			MessageID: id,
+		}
+		if err := node1.node.HandleGossipMessage(msg); err != nil {
+			t.Fatalf("HandleGossipMessage: %v", err)
+		}
+		_, created, _, _ := node1.node.GetWithMetadata("dup")
+		return created
+	}
+
+	if got := replay("replay-1", data, 300); !got.Equal(createdAt) {
+		t.Error("identical value and expiry should not be rewritten")
+	}
+	if got := replay("replay-2", data, 600); got.Equal(createdAt) {
+		t.Error("identical value with a later expiry should be rewritten")
+	}
+	_, createdAt, _, _ = node1.node.GetWithMetadata("dup")
+	if got := replay("replay-3", []byte("other bytes"), 300); got.Equal(createdAt) {
+		t.Error("different value should be rewritten")
+	}
+}
+
+// A peer whose clock runs behind still holds a value after it expired here,
+// and pushing it back must not resurrect it. A later write of the same
+// bytes is new and is stored.
+func TestExpiredValueNotResurrectedByPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "solo", "default", 1)
+	defer node1.stop()
+	node1.start(t, ctx, nil)
+
+	data := []byte("short-lived")
+	push := func(id string, ttl int) {
+		t.Helper()
+		msg := &gossip.Message{
+			Type:      gossip.MessageTypePut,
+			From:      "peer",
+			Key:       "gone",
+			Data:      data,
+			Hash:      gossip.ContentHash(data),
+			TTL:       ttl,
+			Timestamp: time.Now(),
+			MessageID: id,
+		}
+		if err := node1.node.HandleGossipMessage(msg); err != nil {
+			t.Fatalf("HandleGossipMessage: %v", err)
+		}
+	}
+
+	push("write", 1)
+	time.Sleep(1100 * time.Millisecond)
+	if _, ok := node1.node.Get("gone"); ok {
+		t.Fatal("value readable after its TTL")
+	}
+	// Expiry callbacks run on their own goroutine
+	deadline := time.Now().Add(time.Second)
+	for !node1.node.tombstones.blocks("gone", gossip.ContentHash(data), time.Now()) {
+		if time.Now().After(deadline) {
+			t.Fatal("no tombstone recorded for the expired key")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	push("skewed-push", 2)
+	if _, ok := node1.node.Get("gone"); ok {
+		t.Fatal("expired value was stored again from a peer")
+	}
+	push("rewrite", 300)
+	if _, ok := node1.node.Get("gone"); !ok {
+		t.Fatal("a new write of the same bytes was refused")
+	}
+}
+
+// Concurrent PUTs to one key from one node each track their own quorum by
+// MessageID, and a repeat of a value the peer already holds is still
+// confirmed even though the peer skips rewriting it.
+func TestConcurrentSameKeyWrites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "node1", "default", 3)
+	node2 := newTestNode(t, "node2", "default", 3)
+	defer node1.stop()
+	defer node2.stop()
+
+	node1.start(t, ctx, nil)
+	node2.start(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node1, 1, 3*time.Second)
+	waitForPeers(t, node2, 1, 3*time.Second)
+
+	const writers = 10
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		value := []byte(fmt.Sprintf("value-%d", i))
+		go func() {
+			errs <- node1.node.Put(ctx, "contended", value, 300*time.Second)
+		}()
+	}
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent Put failed: %v", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := node1.node.Put(ctx, "repeated", []byte("same"), 300*time.Second); err != nil {
+			t.Fatalf("identical Put #%d failed: %v", i+1, err)
+		}
+	}
+
+	if pending := node1.node.protocol.PendingRequests(); pending != 0 {
+		t.Fatalf("%d write operations left pending after every Put returned", pending)
+	}
+}
+
+func TestAckCountsEachEnclavePeerOnce(t *testing.T) {
+	cn := NewClusterNode("origin", "127.0.0.1", 1, 1, 5, 0, 2*time.Second, "", "default")
+	for _, peer := range []struct{ id, enclave string }{
+		{"peer-a", "default"}, {"peer-b", "default"}, {"peer-c", "default"}, {"peer-d", "default"}, {"outsider", "other"},
+	} {
+		cn.HandleBootstrap(&gossip.BootstrapRequest{NodeID: peer.id, Address: "127.0.0.1", HTTPPort: 1, Enclave: peer.enclave})
+	}
+	// 5 enclave nodes: quorum is 3, the local write plus two ACKs
+	if q := cn.quorumSize(); q != 3 {
+		t.Fatalf("quorumSize = %d, want 3", q)
+	}
+
+	writeOp := &WriteOperation{Confirmations: 1, AckedBy: make(map[gossip.NodeID]bool)}
+	ack := func(from gossip.NodeID) bool {
+		return cn.recordAck(writeOp, &gossip.Message{Type: gossip.MessageTypeAck, From: from, MessageID: "w1"})
+	}
+
+	for _, from := range []gossip.NodeID{
+		"peer-a",
+		"peer-a",   // replayed
+		"outsider", // other enclave
+		"stranger", // not a peer at all
+		"origin",   // ourselves
+	} {
+		if ack(from) {
+			t.Fatalf("quorum reached with one distinct enclave ACK (confirmations=%d)", writeOp.Confirmations)
+		}
+	}
+
+	if !ack("peer-b") {
+		t.Fatalf("quorum not reached after two distinct enclave ACKs (confirmations=%d)", writeOp.Confirmations)
+	}
+}
+
+// A context deadline replaces the node's write timeout for the quorum wait.
+func TestPutWaitsUntilContextDeadline(t *testing.T) {
+	cn := NewClusterNode("origin", "127.0.0.1", 1, 1, 3, 0, 100*time.Millisecond, "", "default")
+	cn.Start(context.Background(), nil)
+	defer cn.Stop()
+	// A peer that never answers: quorum can't be reached
+	cn.HandleBootstrap(&gossip.BootstrapRequest{NodeID: "silent", Address: "127.0.0.1", HTTPPort: 1})
+
+	start := time.Now()
+	if err := cn.Put(context.Background(), "k1", []byte("v"), time.Minute); !errors.Is(err, ErrQuorumTimeout) {
+		t.Fatalf("Put without deadline: err = %v, want ErrQuorumTimeout", err)
+	}
+	if waited := time.Since(start); waited > 250*time.Millisecond {
+		t.Fatalf("Put without deadline waited %v, want about the 100ms write timeout", waited)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := cn.Put(ctx, "k2", []byte("v"), time.Minute); !errors.Is(err, ErrQuorumTimeout) {
+		t.Fatalf("Put with deadline: err = %v, want ErrQuorumTimeout", err)
+	}
+	if waited := time.Since(start); waited < 350*time.Millisecond {
+		t.Fatalf("Put with a 400ms deadline gave up after %v", waited)
+	}
+}
+
+func TestReplicatedTTLClampedToMax(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "node1", "default", 3)
+	node2 := newTestNode(t, "node2", "default", 3)
+	defer node1.stop()
+	defer node2.stop()
+	node2.node.SetMaxTTL(time.Hour)
+
+	node1.start(t, ctx, nil)
+	node2.start(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node1, 1, 3*time.Second)
+
+	if err := node1.node.Put(ctx, "long-lived", []byte("v"), 30*24*time.Hour); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	_, _, ttl, ok := node2.node.GetWithMetadata("long-lived")
+	if !ok || ttl != time.Hour {
+		t.Fatalf("node2 stored TTL %v (found %v), want 1h", ttl, ok)
+	}
+
+	// The originator learns what was stored from the ACK
+	acks := node1.node.RecentWrites()[0].Acks
+	if len(acks) != 1 || acks[0].TTL != 3600 {
+		t.Fatalf("acks = %+v, want node2 reporting a TTL of 3600", acks)
+	}
+}
+
+func TestGossipStatusReportsClusterState(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "node1", "default", 3)
+	node2 := newTestNode(t, "node2", "default", 3)
+	defer node1.stop()
+	defer node2.stop()
+
+	node1.start(t, ctx, nil)
+	node2.start(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node1, 1, 3*time.Second)
+
+	if err := node1.node.Put(ctx, "k", []byte("v"), time.Minute); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	status := node2.node.GossipStatus()
+	if status.Peers != 1 || status.EnclavePeers != 1 || status.ReplicationFactor != 3 || status.QuorumSize != 2 {
+		t.Fatalf("status = %+v, want 1 enclave peer, replication 3, quorum 2", status)
+	}
+	if status.SeenMessages < 1 || status.PendingWrites != 0 || status.LastPartitionCheck != nil {
+		t.Fatalf("status = %+v, want node1's PUT seen, no pending writes and no partition check yet", status)
+	}
+}
+
+func TestRecentWritesTracksAcksAndOutcome(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "node1", "default", 3)
+	node2 := newTestNode(t, "node2", "default", 3)
+	defer node1.stop()
+	defer node2.stop()
+
+	node1.start(t, ctx, nil)
+	node2.start(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node1, 1, 3*time.Second)
+
+	if err := node1.node.Put(ctx, "traced", []byte("v"), time.Minute); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	writes := node1.node.RecentWrites()
+	if len(writes) != 1 {
+		t.Fatalf("got %d recent writes, want 1", len(writes))
+	}
+	w := writes[0]
+	if w.Key != "traced" || w.Outcome != WriteQuorum || w.Finished == nil {
+		t.Fatalf("record = %+v, want key traced with outcome quorum", w)
+	}
+	if len(w.Acks) != 1 || w.Acks[0].From != "node2" || len(w.Missing) != 0 {
+		t.Fatalf("acks = %+v, missing = %v; want one ACK from node2", w.Acks, w.Missing)
+	}
+
+	// A peer that never answers shows up as missing
+	node1.node.HandleBootstrap(&gossip.BootstrapRequest{NodeID: "silent", Address: "127.0.0.1", HTTPPort: 1})
+	shortCtx, shortCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer shortCancel()
+	// node2 alone would make quorum (2 of 3), so have it refuse the value
+	node2.node.SetMaxValueBytes(1)
+	if err := node1.node.Put(shortCtx, "stalled", []byte("too big"), time.Minute); !errors.Is(err, ErrQuorumTimeout) {
+		t.Fatalf("Put: err = %v, want ErrQuorumTimeout", err)
+	}
+	w = node1.node.RecentWrites()[0]
+	if w.Key != "stalled" || w.Outcome != WriteTimeout {
+		t.Fatalf("newest record = %+v, want stalled with outcome timeout", w)
+	}
+	if len(w.Missing) != 2 {
+		t.Fatalf("missing = %v, want node2 and silent", w.Missing)
+	}
+}
+
+func TestNackFailsWriteWhenQuorumUnreachable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "node1", "default", 3)
+	node2 := newTestNode(t, "node2", "default", 3)
+	node3 := newTestNode(t, "node3", "default", 3)
+	defer node1.stop()
+	defer node2.stop()
+	defer node3.stop()
+	node2.node.SetMaxValueBytes(1)
+	node3.node.SetMaxValueBytes(1)
+
+	node1.start(t, ctx, nil)
+	node2.start(t, ctx, []string{node1.addr()})
+	node3.start(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node1, 2, 3*time.Second)
+
+	start := time.Now()
+	err := node1.node.Put(ctx, "refused", []byte("too big"), time.Minute)
+	var nackErr *NackError
+	if !errors.As(err, &nackErr) {
+		t.Fatalf("Put: err = %v, want a NackError", err)
+	}
+	if elapsed := time.Since(start); elapsed >= node1.node.WriteTimeout() {
+		t.Errorf("Put took %v: NACKs should fail it before the write timeout", elapsed)
+	}
+	want := map[string]string{"node2": NackValueTooLarge, "node3": NackValueTooLarge}
+	if !reflect.DeepEqual(nackErr.Nacks, want) {
+		t.Errorf("NACKs = %v, want %v", nackErr.Nacks, want)
+	}
+	if _, ok := node1.node.Get("refused"); !ok {
+		t.Error("value not kept locally")
+	}
+
+	w := node1.node.RecentWrites()[0]
+	if w.Outcome != WriteRejected || len(w.Nacks) != 2 {
+		t.Errorf("record = %+v, want outcome rejected with 2 NACKs", w)
+	}
+}
+
+func TestNackSendsToReplacementReplica(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var nodes []*testNode
+	for i := 1; i <= 4; i++ {
+		tn := newTestNode(t, fmt.Sprintf("node%d", i), "default", 4)
+		defer tn.stop()
+		nodes = append(nodes, tn)
+	}
+	// Only node4 can take the value; a single replica is picked at random
+	nodes[1].node.SetMaxValueBytes(1)
+	nodes[2].node.SetMaxValueBytes(1)
+	nodes[0].start(t, ctx, nil)
+	for _, tn := range nodes[1:] {
+		tn.start(t, ctx, []string{nodes[0].addr()})
+	}
+	waitForPeers(t, nodes[0], 3, 5*time.Second)
+
+	if err := nodes[0].node.PutReplicated(ctx, "moved", []byte("too big"), time.Minute, 2); err != nil {
+		t.Fatalf("PutReplicated failed: %v", err)
+	}
+	if _, ok := nodes[3].node.Get("moved"); !ok {
+		t.Error("replacement replica node4 doesn't hold the value")
+	}
+	w := nodes[0].node.RecentWrites()[0]
+	if w.Outcome != WriteQuorum || len(w.Peers) != len(w.Nacks)+1 {
+		t.Errorf("record = %+v, want quorum with one peer per NACK plus node4", w)
+	}
+}
+
+func TestRestartedNodeRecoversFromPeers(t *testing.T) {
+	// REPRAM keeps nothing on disk: a restarted node rejoins with an empty
+	// store and asks its enclave peers to push their data back to it.
+	// Later writes reach it as usual.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node1 := newTestNode(t, "node1", "default", 3)
+	node2 := newTestNode(t, "node2", "default", 3)
+	node3 := newTestNode(t, "node3", "default", 3)
+	defer node1.stop()
+	defer node2.stop()
+	defer func() { node3.stop() }()
+
+	node1.start(t, ctx, nil)
+	node2.start(t, ctx, []string{node1.addr()})
+	node3.start(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node1, 2, 3*time.Second)
+	waitForPeers(t, node3, 2, 3*time.Second)
+
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("batch:%d", i)
+		if err := node1.node.Put(ctx, keys[i], []byte("v"), time.Minute); err != nil {
+			t.Fatalf("Put(%s) failed: %v", keys[i], err)
+		}
+	}
+	// Every node has the batch once quorum gossip settles
+	time.Sleep(200 * time.Millisecond)
+	for _, key := range keys {
+		if _, ok := node3.node.Get(key); !ok {
+			t.Fatalf("node3 missing %s before restart", key)
+		}
+	}
+
+	node3.restart(t, ctx, []string{node1.addr()})
+	waitForPeers(t, node3, 2, 3*time.Second)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for _, key := range keys {
+		for {
+			if _, ok := node3.node.Get(key); ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("restarted node3 never recovered %s from its peers", key)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		for _, tn := range []*testNode{node1, node2} {
+			if _, ok := tn.node.Get(key); !ok {
+				t.Errorf("%s lost %s when node3 restarted", tn.node.localNode.ID, key)
+			}
+		}
+	}
+
+	if err := node1.node.Put(ctx, "after", []byte("v"), time.Minute); err != nil {
+		t.Fatalf("Put after restart failed: %v", err)
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := node3.node.Get("after"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("write after the restart never reached node3")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestWriteLogKeepsNewest(t *testing.T) {
+	l := newWriteLog()
+	for i := 0; i < writeLogSize+10; i++ {
+		l.begin(fmt.Sprintf("k%d", i), "", 1, nil)
+	}
+	recent := l.recent()
+	if len(recent) != writeLogSize {
+		t.Fatalf("kept %d records, want %d", len(recent), writeLogSize)
+	}
+	if newest, oldest := recent[0].Key, recent[writeLogSize-1].Key; newest != fmt.Sprintf("k%d", writeLogSize+9) || oldest != "k10" {
+		t.Fatalf("newest = %s, oldest = %s; want k%d and k10", newest, oldest, writeLogSize+9)
+	}
+}
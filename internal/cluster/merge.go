@@ -0,0 +1,350 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"repram/internal/gossip"
+	"repram/internal/logging"
+)
+
+// Bootstrap retry backoff, for a node whose seeds all failed at Start.
+var (
+	bootstrapRetryMin = time.Second
+	bootstrapRetryMax = 5 * time.Minute
+)
+
+// partitionCheckInterval is how often a node bootstraps from its seeds
+// again to look for a partition of its enclave it has split from.
+var partitionCheckInterval = 2 * time.Minute
+
+// partitionMetrics counts partition merges for Prometheus.
+type partitionMetrics struct {
+	merges *prometheus.CounterVec
+}
+
+var (
+	sharedPartitionMetrics     *partitionMetrics
+	sharedPartitionMetricsOnce sync.Once
+)
+
+// newPartitionMetrics returns the counters registered on reg. A nil reg
+// means the default registry, whose counters every node shares.
+func newPartitionMetrics(reg prometheus.Registerer) *partitionMetrics {
+	if reg == nil {
+		sharedPartitionMetricsOnce.Do(func() {
+			sharedPartitionMetrics = registerPartitionMetrics(prometheus.DefaultRegisterer)
+		})
+		return sharedPartitionMetrics
+	}
+	return registerPartitionMetrics(reg)
+}
+
+func registerPartitionMetrics(reg prometheus.Registerer) *partitionMetrics {
+	merges := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repram_partition_merges_total",
+		Help: "Merges with a split partition of this node's enclave, by side: detected here or requested by a peer",
+	}, []string{"side"})
+	if err := reg.Register(merges); err != nil {
+		// Nodes sharing a registry share the counter
+		var exists prometheus.AlreadyRegisteredError
+		if !errors.As(err, &exists) {
+			panic(err)
+		}
+		merges = exists.ExistingCollector.(*prometheus.CounterVec)
+	}
+	return &partitionMetrics{merges: merges}
+}
+
+func (m *partitionMetrics) count(side string) {
+	if m != nil {
+		m.merges.WithLabelValues(side).Inc()
+	}
+}
+
+func (cn *ClusterNode) setSeeds(seeds []string) {
+	cn.seedsMutex.Lock()
+	defer cn.seedsMutex.Unlock()
+	cn.seeds = append([]string(nil), seeds...)
+}
+
+func (cn *ClusterNode) currentSeeds() []string {
+	cn.seedsMutex.Lock()
+	defer cn.seedsMutex.Unlock()
+	return cn.seeds
+}
+
+// watchSeeds keeps this node joined to the cluster its seeds belong to.
+// A node that couldn't reach any seed at Start (alone) retries with
+// exponential backoff first. After that the seeds are checked every
+// partitionCheckInterval, so two partitions of an enclave that formed
+// separately find each other and merge.
+func (cn *ClusterNode) watchSeeds(ctx context.Context, alone bool) {
+	if alone && !cn.retryBootstrap(ctx) {
+		return
+	}
+
+	ticker := time.NewTicker(partitionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if seeds := cn.currentSeeds(); len(seeds) > 0 {
+				if err := cn.joinSeeds(ctx, seeds); err != nil {
+					logging.Debug("[%s] Partition check failed: %v", cn.localNode.ID, err)
+				}
+				cn.partitionCheck.Store(time.Now().UnixNano())
+			}
+		case <-cn.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// retryBootstrap tries the seeds with exponential backoff until one answers
+// and the node has merged into the cluster. It returns false if the node
+// stopped first.
+func (cn *ClusterNode) retryBootstrap(ctx context.Context) bool {
+	delay := bootstrapRetryMin
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-cn.done:
+			timer.Stop()
+			return false
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+
+		err := cn.joinSeeds(ctx, cn.currentSeeds())
+		if err == nil {
+			logging.Info("[%s] Bootstrap retry succeeded, joined the cluster", cn.localNode.ID)
+			cn.protocol.Announce(ctx)
+			return true
+		}
+		delay = min(delay*2, bootstrapRetryMax)
+		logging.Info("[%s] Bootstrap retry failed (%v), next attempt in %v", cn.localNode.ID, err, delay)
+	}
+}
+
+// joinSeeds bootstraps from seeds and merges with any enclave peers the
+// seeds know that this node didn't. Those peers wrote without this node,
+// and it without them, whether they were a whole partition or a node that
+// joined unseen.
+func (cn *ClusterNode) joinSeeds(ctx context.Context, seeds []string) error {
+	known := make(map[gossip.NodeID]bool)
+	for _, peer := range cn.protocol.GetReplicationPeers() {
+		known[peer.ID] = true
+	}
+	if err := cn.protocol.Bootstrap(ctx, seeds); err != nil {
+		return err
+	}
+
+	var unknown []*gossip.Node
+	for _, peer := range cn.protocol.GetReplicationPeers() {
+		if !known[peer.ID] {
+			unknown = append(unknown, peer)
+		}
+	}
+	if len(unknown) > 0 {
+		cn.merge(ctx, unknown)
+	}
+	return nil
+}
+
+// merge joins this node with enclave peers from a partition it had split
+// from: the two sides exchange peer tables, this node pushes its data to
+// them, and each of them is asked to push its data back.
+func (cn *ClusterNode) merge(ctx context.Context, peers []*gossip.Node) {
+	logging.Warn("[%s] Found %d enclave peers this node had split from; merging", cn.localNode.ID, len(peers))
+	cn.metrics.count("detected")
+
+	cn.requestPushes(ctx, peers)
+	pushed, failed := cn.pushLocalData(ctx, peers)
+	logging.Info("[%s] Pushed %d local keys to %d merged peers (%d failed)", cn.localNode.ID, pushed, len(peers), failed)
+}
+
+// catchUp asks every enclave peer to push its data to this node after it
+// joins the cluster. REPRAM keeps nothing on disk, so a restarted node
+// comes back empty and would otherwise hold only the writes made after it
+// rejoined.
+func (cn *ClusterNode) catchUp(ctx context.Context) {
+	peers := cn.protocol.GetReplicationPeers()
+	if len(peers) == 0 {
+		return
+	}
+	logging.Info("[%s] Asking %d enclave peers for their data", cn.localNode.ID, len(peers))
+	cn.requestPushes(ctx, peers)
+}
+
+// requestPushes sends this node's info to peers, so each knows it as an
+// enclave peer, then asks each of them to push its data to this node.
+func (cn *ClusterNode) requestPushes(ctx context.Context, peers []*gossip.Node) {
+	request := &gossip.Message{
+		Type:      gossip.MessageTypeMerge,
+		From:      cn.localNode.ID,
+		Timestamp: time.Now(),
+		MessageID: gossip.NewMessageID(),
+	}
+	for _, peer := range peers {
+		if err := cn.protocol.RequestPeerList(ctx, peer); err != nil {
+			logging.Debug("[%s] Failed to exchange peer lists with %s: %v", cn.localNode.ID, peer.ID, err)
+		}
+	}
+	if err := cn.protocol.SendTo(ctx, peers, request); err != nil {
+		logging.Debug("[%s] Merge request not delivered to every peer: %v", cn.localNode.ID, err)
+	}
+}
+
+// handleMergeMessage answers a merge request from an enclave peer that has
+// just found this node's partition, or just joined, by pushing this node's
+// data to it. A push sends every live value, so each peer gets at most one
+// per partitionCheckInterval, the rate an honest peer finds a partition at;
+// further requests inside that window are ignored. A push that sent
+// nothing doesn't count, so a node that restarts soon after joining an
+// empty cluster still catches up.
+func (cn *ClusterNode) handleMergeMessage(msg *gossip.Message) error {
+	if cn.protocol.MarkSeen(msg.MessageID) {
+		return nil
+	}
+	var from *gossip.Node
+	for _, peer := range cn.protocol.GetReplicationPeers() {
+		if peer.ID == msg.From {
+			from = peer
+			break
+		}
+	}
+	if from == nil {
+		logging.Debug("[%s] Ignoring merge request from %s: not an enclave peer", cn.localNode.ID, msg.From)
+		return nil
+	}
+	if !cn.allowMergePush(from.ID, time.Now()) {
+		logging.Debug("[%s] Ignoring merge request from %s: already pushed to it within %v", cn.localNode.ID, msg.From, partitionCheckInterval)
+		return nil
+	}
+
+	logging.Info("[%s] Merging with %s at its request", cn.localNode.ID, msg.From)
+	cn.metrics.count("requested")
+	go func() {
+		ctx, cancel := cn.stopContext()
+		defer cancel()
+		pushed, failed := cn.pushLocalData(ctx, []*gossip.Node{from})
+		if pushed == 0 && failed == 0 {
+			cn.forgetMergePush(from.ID)
+		}
+		logging.Info("[%s] Pushed %d local keys to %s (%d failed)", cn.localNode.ID, pushed, msg.From, failed)
+	}()
+	return nil
+}
+
+// stopContext returns a context cancelled when the node stops, for work
+// started from a gossip message that would otherwise outlive it.
+func (cn *ClusterNode) stopContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-cn.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// allowMergePush reports whether id may be sent a merge push at now, and
+// if so records it. Entries older than the cooldown are pruned as it goes,
+// so peers that stop asking don't accumulate.
+func (cn *ClusterNode) allowMergePush(id gossip.NodeID, now time.Time) bool {
+	cn.mergeMutex.Lock()
+	defer cn.mergeMutex.Unlock()
+	for peer, at := range cn.mergePushes {
+		if now.Sub(at) >= partitionCheckInterval {
+			delete(cn.mergePushes, peer)
+		}
+	}
+	if _, recent := cn.mergePushes[id]; recent {
+		return false
+	}
+	cn.mergePushes[id] = now
+	return true
+}
+
+// forgetMergePush clears id's merge push cooldown.
+func (cn *ClusterNode) forgetMergePush(id gossip.NodeID) {
+	cn.mergeMutex.Lock()
+	defer cn.mergeMutex.Unlock()
+	delete(cn.mergePushes, id)
+}
+
+// pushLocalData offers every live local value to peers, with its remaining
+// TTL. It returns how many values reached every peer and how many failed
+// to reach at least one. Peers that already hold a value skip the write by
+// content hash. It stops early when ctx ends.
+func (cn *ClusterNode) pushLocalData(ctx context.Context, peers []*gossip.Node) (pushed, failed int) {
+	type entry struct {
+		key string
+		ttl int
+	}
+	// Collect first: View takes the store lock Range is holding
+	var entries []entry
+	cn.store.Range(func(key string, ttl int) bool {
+		if ttl > 0 {
+			entries = append(entries, entry{key, ttl})
+		}
+		return true
+	})
+
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		data, meta, ok := cn.store.ViewMeta(e.key)
+		if !ok {
+			continue
+		}
+		msg := &gossip.Message{
+			Type:      gossip.MessageTypePut,
+			From:      cn.localNode.ID,
+			Key:       e.key,
+			Data:      data,
+			Hash:      gossip.ContentHash(data),
+			TTL:       e.ttl,
+			Timestamp: time.Now(),
+			MessageID: fmt.Sprintf("%s-%s", e.key, gossip.NewMessageID()),
+			Origin:    gossip.NodeID(meta.Origin.Node),
+			WrittenAt: meta.Origin.WrittenAt,
+			Expires:   meta.ExpiresAt,
+		}
+		if err := cn.protocol.SendTo(ctx, peers, msg); err != nil {
+			logging.Debug("[%s] Failed to push key %s: %v", cn.localNode.ID, e.key, err)
+			failed++
+			continue
+		}
+		pushed++
+	}
+	return pushed, failed
+}
+
+// HandOff offers every live local value to every enclave peer that takes
+// writes, so a node going down for maintenance leaves nothing that only it
+// held. Peers skip values they already hold by content hash, so only the
+// values they are missing are stored. Returns how many values reached
+// every peer.
+func (cn *ClusterNode) HandOff(ctx context.Context) int {
+	peers := cn.protocol.GetReplicationTargets()
+	if len(peers) == 0 {
+		return 0
+	}
+	pushed, failed := cn.pushLocalData(ctx, peers)
+	logging.Info("[%s] Handed off %d local keys to %d peers (%d failed)", cn.localNode.ID, pushed, len(peers), failed)
+	return pushed
+}
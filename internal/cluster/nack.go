@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"repram/internal/gossip"
+	"repram/internal/logging"
+	"repram/internal/storage"
+)
+
+// Reasons a replica gives in a NACK for a PUT it could not store. The
+// server's gossip validation adds its own (invalid_key, ttl_out_of_range,
+// invalid_hash).
+const (
+	NackStorageFull   = "storage_full"
+	NackValueTooLarge = "value_too_large"
+	NackStoreError    = "store_error"
+)
+
+// NackError is returned by Put when enough replicas refused a write that
+// quorum can no longer be reached. The value is stored locally; replicas
+// that refused it won't hold it.
+type NackError struct {
+	Nacks map[string]string // peer ID → reason
+}
+
+func (e *NackError) Error() string {
+	return "quorum unreachable: " + e.Summary()
+}
+
+// Summary lists the refusals, e.g. "rejected by node-2 (storage_full)".
+func (e *NackError) Summary() string {
+	peers := make([]string, 0, len(e.Nacks))
+	for peer := range e.Nacks {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	for i, peer := range peers {
+		peers[i] = fmt.Sprintf("%s (%s)", peer, e.Nacks[peer])
+	}
+	return "rejected by " + strings.Join(peers, ", ")
+}
+
+// nackReason maps a store error to the reason sent in a NACK.
+func nackReason(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrStoreFull):
+		return NackStorageFull
+	case errors.Is(err, storage.ErrValueTooLarge):
+		return NackValueTooLarge
+	default:
+		return NackStoreError
+	}
+}
+
+// RejectPut tells the originator of a replicated PUT that this node did not
+// store it, for a message refused before it reached the cluster node.
+func (cn *ClusterNode) RejectPut(from, key, messageID, reason string) {
+	cn.sendNack(&gossip.Message{From: gossip.NodeID(from), Key: key, MessageID: messageID}, reason)
+}
+
+// sendNack tells the originator of a replicated PUT that this node could
+// not store it, and why. Like an ACK it carries the PUT's MessageID.
+func (cn *ClusterNode) sendNack(msg *gossip.Message, reason string) {
+	nack := &gossip.Message{
+		Type:      gossip.MessageTypeNack,
+		From:      cn.localNode.ID,
+		To:        msg.From,
+		Key:       msg.Key,
+		Reason:    reason,
+		MessageID: msg.MessageID,
+		Timestamp: time.Now(),
+	}
+	for _, peer := range cn.protocol.GetPeers() {
+		if peer.ID == msg.From {
+			logging.Debug("[%s] Sending NACK (%s) for key %s to %s", cn.localNode.ID, reason, msg.Key, peer.ID)
+			cn.protocol.Send(context.Background(), peer, nack)
+			return
+		}
+	}
+}
+
+// recordNack records a replica's refusal of writeOp. A write with its own
+// replication count is sent on to a replacement replica; once the write can
+// no longer reach quorum, recordNack returns the NackError Put fails with.
+func (cn *ClusterNode) recordNack(writeOp *WriteOperation, msg *gossip.Message) error {
+	if writeOp.AckedBy[msg.From] || writeOp.NackedBy[msg.From] != "" {
+		return nil
+	}
+	if !cn.mayNack(writeOp, msg.From) {
+		logging.Debug("[%s] Ignoring NACK from %s for %s: not a replica of the write", cn.localNode.ID, msg.From, msg.MessageID)
+		return nil
+	}
+	reason := msg.Reason
+	if reason == "" {
+		reason = NackStoreError
+	}
+	writeOp.NackedBy[msg.From] = reason
+	logging.Warn("[%s] %s could not store key %s: %s", cn.localNode.ID, msg.From, writeOp.Key, reason)
+	if writeOp.record != nil {
+		cn.writes.nack(writeOp.record, string(msg.From), reason)
+	}
+
+	if writeOp.Targets != nil {
+		if peer := cn.replacementFor(writeOp); peer != nil {
+			writeOp.Targets[peer.ID] = true
+			if writeOp.record != nil {
+				cn.writes.addPeer(writeOp.record, string(peer.ID))
+			}
+			logging.Info("[%s] Sending key %s to %s in place of %s", cn.localNode.ID, writeOp.Key, peer.ID, msg.From)
+			go func(put *gossip.Message) {
+				if err := cn.protocol.Send(context.Background(), peer, put); err != nil {
+					logging.Debug("[%s] Failed to send key %s to %s: %v", cn.localNode.ID, put.Key, peer.ID, err)
+				}
+			}(writeOp.msg)
+			return nil
+		}
+	}
+
+	if writeOp.Confirmations+cn.outstanding(writeOp) < cn.quorumFor(writeOp) {
+		nacks := make(map[string]string, len(writeOp.NackedBy))
+		for id, r := range writeOp.NackedBy {
+			nacks[string(id)] = r
+		}
+		return &NackError{Nacks: nacks}
+	}
+	return nil
+}
+
+// mayNack reports whether a NACK from id concerns op: it's one of the
+// write's replicas, or for a write to the whole enclave, an enclave peer.
+// Nearly full peers aren't replication targets but still refuse writes
+// forwarded to them.
+func (cn *ClusterNode) mayNack(op *WriteOperation, id gossip.NodeID) bool {
+	if op.Targets != nil {
+		return op.Targets[id]
+	}
+	for _, peer := range cn.protocol.GetReplicationPeers() {
+		if peer.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// replacementFor picks a replication target that op wasn't sent to, best
+// first, or nil if every target already has it.
+func (cn *ClusterNode) replacementFor(op *WriteOperation) *gossip.Node {
+	for _, peer := range cn.protocol.GetReplicationTargets() {
+		if !op.Targets[peer.ID] {
+			return peer
+		}
+	}
+	return nil
+}
+
+// outstanding counts the replicas of op that have neither ACKed nor NACKed.
+func (cn *ClusterNode) outstanding(op *WriteOperation) int {
+	replicas := op.Targets
+	if replicas == nil {
+		replicas = make(map[gossip.NodeID]bool)
+		for _, peer := range cn.protocol.GetReplicationTargets() {
+			replicas[peer.ID] = true
+		}
+	}
+	n := 0
+	for id := range replicas {
+		if !op.AckedBy[id] && op.NackedBy[id] == "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (cn *ClusterNode) quorumFor(op *WriteOperation) int {
+	if op.Quorum == 0 {
+		return cn.quorumSize()
+	}
+	return op.Quorum
+}
+
+// resendPut sends op's PUT again to the replicas that have neither ACKed
+// nor NACKed it. Put calls it once, halfway through its wait for quorum, so
+// a write on a lossy network gets a second chance before it times out.
+func (cn *ClusterNode) resendPut(op *WriteOperation) {
+	var peers []*gossip.Node
+	var ids []string
+	for _, peer := range cn.protocol.GetReplicationPeers() {
+		if cn.mayNack(op, peer.ID) && !op.AckedBy[peer.ID] && op.NackedBy[peer.ID] == "" {
+			peers = append(peers, peer)
+			ids = append(ids, string(peer.ID))
+		}
+	}
+	if len(peers) == 0 {
+		return
+	}
+	logging.Info("[%s] No reply for key %s from %s; sending it again", cn.localNode.ID, op.Key, strings.Join(ids, ", "))
+	if op.record != nil {
+		cn.writes.resend(op.record, ids)
+	}
+	put := *op.msg
+	put.Resend = true
+	go func() {
+		if err := cn.protocol.SendTo(context.Background(), peers, &put); err != nil {
+			logging.Debug("[%s] Resend of key %s not delivered to every peer: %v", cn.localNode.ID, put.Key, err)
+		}
+	}()
+}
@@ -2,10 +2,18 @@ package cluster
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"repram/internal/gossip"
 	"repram/internal/logging"
 	"repram/internal/storage"
@@ -23,25 +31,80 @@ type ClusterNode struct {
 	replicationFactor int
 	writeTimeout      time.Duration
 	clusterSecret     string
-
-	pendingWrites map[string]*WriteOperation
-	writesMutex   sync.RWMutex
+	tlsEnabled        bool
+	tlsConfig         *tls.Config
+	peerFilter        *gossip.PeerFilter
+	sendAttempts      int  // tries per gossip send; 0 = gossip.DefaultRetryPolicy
+	resendUnanswered  bool // resend a PUT to silent replicas halfway through the quorum wait
+
+	writes        *writeLog     // recent writes, for RecentWrites
+	tombstones    *tombstones   // keys taken down, refused on replication
+	pendingWrites atomic.Int64  // writes waiting on quorum
+	writesTotal   atomic.Uint64 // writes stored through this node since start
+
+	rateDigestHandler func(from string, data []byte) error
+
+	maxTTL               time.Duration  // longest TTL a replicated write is stored with (0 = no cap)
+	maxReplication       int            // cap on per-write replication (0 = none)
+	namespaceReplication map[string]int // default replication per key namespace
+
+	seedsMutex     sync.Mutex
+	seeds          []string // bootstrap seeds, re-checked for partitions
+	metrics        *partitionMetrics
+	registerer     prometheus.Registerer // for metrics; nil = the default registry
+	partitionCheck atomic.Int64          // unix nanos of the last partition check; 0 = none yet
+	mergeMutex     sync.Mutex
+	mergePushes    map[gossip.NodeID]time.Time // when each peer's MERGE was last answered
+
+	done     chan struct{} // closed by Stop
+	stopOnce sync.Once
+	stopErr  error
 }
 
+// WriteOperation tracks a replicated write's replies while Put waits for
+// quorum. Only the waiting Put touches it.
 type WriteOperation struct {
-	Key         string
-	Data        []byte
-	TTL         time.Duration
+	Key           string
+	Data          []byte
+	TTL           time.Duration
 	Confirmations int
-	Complete    chan bool
-	Error       error
+	Quorum        int                      // 0 = the enclave's current quorum
+	Targets       map[gossip.NodeID]bool   // nodes whose ACKs count; nil = every enclave peer
+	AckedBy       map[gossip.NodeID]bool   // peers whose ACK has been counted
+	NackedBy      map[gossip.NodeID]string // peers that refused the write, with their reasons
+	record        *WriteRecord
+	msg           *gossip.Message // the PUT, resent to replacement replicas
+}
+
+// ttlLeft returns how much of the write's TTL is left, in seconds.
+func (op *WriteOperation) ttlLeft() int {
+	if op.msg == nil || op.msg.Expires.IsZero() {
+		return int(op.TTL.Seconds())
+	}
+	return int(time.Until(op.msg.Expires).Seconds())
 }
 
 type Store interface {
 	Put(key string, data []byte, ttl time.Duration) error
+	PutHashed(key string, data []byte, ttl time.Duration, hash string) error
+	PutOrigin(key string, data []byte, ttl time.Duration, hash string, origin storage.Origin) error
+	Holds(key, hash string, expiresAt time.Time) bool // live value with hash expiring no earlier
 	Get(key string) ([]byte, bool)
 	GetWithMetadata(key string) ([]byte, time.Time, time.Duration, bool) // data, createdAt, originalTTL, exists
+	View(key string) ([]byte, time.Time, time.Duration, bool)            // GetWithMetadata without copying; read-only
+	ViewMeta(key string) ([]byte, storage.EntryMeta, bool)               // View with hash and origin
 	Scan() []string
+	Range(fn func(key string, ttl int) bool)                                                                  // remaining TTL in seconds; return false to stop
+	RangePrefix(prefix, after string, fn func(key string, ttl int) bool)                                      // in key order
+	RangeByExpiry(prefix string, after storage.ExpiryPosition, fn func(key string, expiresAt time.Time) bool) // soonest first
+	CountPrefix(prefix string) int
+	SameValue(key string, data []byte) (time.Duration, bool) // remaining TTL, value equal
+	SetEventHandler(fn func(storage.Event))
+	SetMaxValueBytes(n int64)
+	Sweep()                                      // remove expired entries now
+	Expire(key string) (storage.EntryMeta, bool) // remove key now; reports the live entry removed
+	Usage() (maxBytes, usedBytes int64, items int)
+	LastSweep() time.Time // when the cleanup worker last ran
 }
 
 func NewClusterNode(nodeID string, address string, gossipPort int, httpPort int, replicationFactor int, maxStorageBytes int64, writeTimeout time.Duration, clusterSecret string, enclave string) *ClusterNode {
@@ -57,23 +120,164 @@ func NewClusterNode(nodeID string, address string, gossipPort int, httpPort int,
 	}
 
 	protocol := gossip.NewProtocol(localNode, replicationFactor, clusterSecret)
+	store := storage.NewMemoryStore(maxStorageBytes)
+	protocol.SetCapacityFunc(func() gossip.Capacity {
+		maxBytes, used, items := store.Usage()
+		return gossip.Capacity{MaxBytes: maxBytes, UsedBytes: used, Items: items}
+	})
 
-	return &ClusterNode{
+	cn := &ClusterNode{
 		localNode:         localNode,
 		protocol:          protocol,
-		store:             storage.NewMemoryStore(maxStorageBytes),
+		store:             store,
 		replicationFactor: replicationFactor,
 		writeTimeout:      writeTimeout,
 		clusterSecret:     clusterSecret,
-		pendingWrites:     make(map[string]*WriteOperation),
+		resendUnanswered:  true,
+		writes:            newWriteLog(),
+		tombstones:        newTombstones(),
+		mergePushes:       make(map[gossip.NodeID]time.Time),
+		done:              make(chan struct{}),
 	}
+	store.OnExpire(func(key string, meta storage.EntryMeta) {
+		cn.tombstones.expired(key, meta.Hash, meta.ExpiresAt)
+	})
+	return cn
+}
+
+// EnableTLS makes gossip and bootstrap traffic use HTTPS, for nodes whose
+// HTTP port is served with TLS. config is the client-side TLS config used to
+// verify peers (nil = system roots). Must be called before Start.
+func (cn *ClusterNode) EnableTLS(config *tls.Config) {
+	cn.tlsEnabled = true
+	cn.tlsConfig = config
+}
+
+// SetMaxValueBytes limits the size of a single value, for local writes and
+// replicated ones alike. Oversized writes fail with storage.ErrValueTooLarge.
+// 0 means unlimited. Must be called before Start.
+func (cn *ClusterNode) SetMaxValueBytes(n int64) {
+	cn.store.SetMaxValueBytes(n)
+}
+
+// EnablePublicMode turns on the signed node registry and peer reputation,
+// for public networks that opt in with REPRAM_PEER_REPUTATION. key signs this node's announcements. Must be
+// called before Start.
+func (cn *ClusterNode) EnablePublicMode(key ed25519.PrivateKey) {
+	cn.protocol.EnablePublicMode(key)
+}
+
+// ReportInvalidMessage counts a malformed or invalid gossip message against
+// the peer that sent it. It does nothing outside public mode.
+func (cn *ClusterNode) ReportInvalidMessage(from string) {
+	cn.protocol.Reputation().RecordInvalid(gossip.NodeID(from))
+}
+
+// PeerStanding reports what this node has observed of a peer in public
+// mode: its behaviour, its reputation score, and whether it has a verified
+// announcement. ok is false outside public mode.
+func (cn *ClusterNode) PeerStanding(id gossip.NodeID) (stats gossip.PeerStats, verified bool, ok bool) {
+	rep := cn.protocol.Reputation()
+	if rep == nil {
+		return gossip.PeerStats{}, false, false
+	}
+	return rep.Stats(id), cn.protocol.Registry().Verified(id), true
+}
+
+// PeerCapacity returns the storage usage a peer last advertised in a PONG
+// or SYNC. ok is false if it hasn't advertised any.
+func (cn *ClusterNode) PeerCapacity(id gossip.NodeID) (gossip.Capacity, bool) {
+	return cn.protocol.PeerCapacity(id)
+}
+
+// PeerRTT returns the smoothed PING/PONG round trip to a peer. ok is false
+// until a PONG has answered one of this node's PINGs.
+func (cn *ClusterNode) PeerRTT(id gossip.NodeID) (time.Duration, bool) {
+	return cn.protocol.PeerRTT(id)
+}
+
+// SetMetricsRegisterer registers the cluster node's partition merge
+// metrics on reg instead of the default registry, for running several
+// nodes in one process that each expose their own metrics. Must be called
+// before Start.
+func (cn *ClusterNode) SetMetricsRegisterer(reg prometheus.Registerer) {
+	cn.registerer = reg
+}
+
+// SetSendAttempts sets how many times a gossip send of an idempotent
+// message (PUT, ACK, SYNC, ...) is tried before it is dropped as a dead
+// letter. 1 disables retries. Must be called before Start.
+func (cn *ClusterNode) SetSendAttempts(n int) {
+	cn.sendAttempts = n
+}
+
+// SetWriteResend turns resending of unanswered PUTs on or off (on by
+// default). Halfway through a write's wait for quorum, replicas that have
+// neither ACKed nor NACKed are sent the PUT again, in case it or their
+// reply was lost. Must be called before Start.
+func (cn *ClusterNode) SetWriteResend(on bool) {
+	cn.resendUnanswered = on
+}
+
+// SetInternalPort advertises port as where this node serves the gossip
+// and bootstrap endpoints, when they're on their own listener rather than
+// the HTTP port. 0 means the HTTP port. Must be called before Start.
+func (cn *ClusterNode) SetInternalPort(port int) {
+	cn.localNode.InternalPort = port
+}
+
+// SetZone declares the failure domain this node runs in, such as a region
+// or rack, advertised to peers on bootstrap and SYNC. Writes stored on
+// fewer nodes than the whole enclave spread their copies across zones.
+// Must be called before Start.
+func (cn *ClusterNode) SetZone(zone string) {
+	cn.localNode.Zone = zone
+}
+
+// SetSendConcurrency sets how many peers a broadcast sends to at once.
+// Must be called before Start.
+func (cn *ClusterNode) SetSendConcurrency(n int) {
+	cn.protocol.SetSendConcurrency(n)
+}
+
+// SweepExpired removes expired entries from the local store immediately,
+// instead of waiting for the periodic cleanup.
+func (cn *ClusterNode) SweepExpired() {
+	cn.store.Sweep()
+}
+
+// SetPeerFilter restricts which nodes may gossip with this node, by node ID
+// or address. Excluded nodes are never added as peers, and AdmitsPeer
+// reports them so the HTTP layer can refuse their requests. Must be called
+// before Start.
+func (cn *ClusterNode) SetPeerFilter(filter *gossip.PeerFilter) {
+	cn.peerFilter = filter
+	cn.protocol.SetPeerFilter(filter)
+}
+
+// AdmitsPeer reports whether the peer filter admits a node with the given
+// ID connecting from ip.
+func (cn *ClusterNode) AdmitsPeer(id string, ip net.IP) bool {
+	return cn.peerFilter.Admits(gossip.NodeID(id), ip)
 }
 
 func (cn *ClusterNode) Start(ctx context.Context, bootstrapAddresses []string) error {
 	transport := gossip.NewHTTPTransport(cn.localNode, cn.clusterSecret)
+	if cn.tlsEnabled {
+		transport.EnableTLS(cn.tlsConfig)
+		cn.protocol.EnableTLS(cn.tlsConfig)
+	}
+	if cn.sendAttempts > 0 {
+		policy := gossip.DefaultRetryPolicy
+		policy.Attempts = cn.sendAttempts
+		transport.SetRetryPolicy(policy)
+	}
+	transport.EnableMetrics()
 	cn.protocol.SetTransport(transport)
+	cn.protocol.SetHTTPClient(transport.Client())
 	cn.protocol.SetMessageHandler(cn.handleGossipMessage)
 	cn.protocol.EnableMetrics()
+	cn.metrics = newPartitionMetrics(cn.registerer)
 
 	// Start the gossip protocol
 	if err := cn.protocol.Start(ctx); err != nil {
@@ -81,92 +285,258 @@ func (cn *ClusterNode) Start(ctx context.Context, bootstrapAddresses []string) e
 	}
 
 	// Bootstrap from seed nodes
+	cn.setSeeds(bootstrapAddresses)
+	alone := false
 	if len(bootstrapAddresses) > 0 {
 		logging.Info("[%s] Bootstrapping from %d seed nodes", cn.localNode.ID, len(bootstrapAddresses))
 		if err := cn.protocol.Bootstrap(ctx, bootstrapAddresses); err != nil {
-			// Bootstrap failure is not fatal - we might be the first node
-			logging.Warn("[%s] Bootstrap completed with warning: %v", cn.localNode.ID, err)
+			// Not fatal: serve on our own and keep trying the seeds, so a
+			// node started while they were down doesn't stay partitioned
+			logging.Warn("[%s] Bootstrap failed, starting alone and retrying in the background: %v", cn.localNode.ID, err)
+			alone = true
+		} else {
+			cn.catchUp(ctx)
 		}
 	} else {
 		logging.Info("[%s] Starting as first node (no bootstrap addresses)", cn.localNode.ID)
 	}
+	go cn.watchSeeds(ctx, alone)
+
+	// Public mode: introduce ourselves to the registry now rather than on
+	// the first topology sync tick
+	cn.protocol.Announce(ctx)
 
 	return nil
 }
 
+// Bootstrap joins the cluster through the given seeds again, for when the
+// seed set changes after Start. Peers already known are kept, and enclave
+// peers this node didn't know are merged with as a split partition. The
+// seeds replace those given to Start for later partition checks.
+func (cn *ClusterNode) Bootstrap(ctx context.Context, seeds []string) error {
+	cn.setSeeds(seeds)
+	return cn.joinSeeds(ctx, seeds)
+}
+
+// Stop stops the node's background work and its gossip protocol. Calls
+// after the first do nothing and return the first call's error.
 func (cn *ClusterNode) Stop() error {
-	return cn.protocol.Stop()
+	cn.stopOnce.Do(func() {
+		close(cn.done)
+		cn.stopErr = cn.protocol.Stop()
+	})
+	return cn.stopErr
+}
+
+// SetMaxTTL caps the TTL replicated writes are stored with, so a peer can't
+// keep values alive past this node's policy. Longer TTLs are clamped, and
+// the ACK tells the originator what was stored. 0 means no cap. Must be
+// called before Start.
+func (cn *ClusterNode) SetMaxTTL(ttl time.Duration) {
+	cn.maxTTL = ttl
+}
+
+// SetReplicationLimits caps how many nodes a single write may ask to be
+// stored on (0 = no cap) and sets default counts for key namespaces, the
+// part of a key before the first ':'. Must be called before Start.
+func (cn *ClusterNode) SetReplicationLimits(max int, namespaces map[string]int) {
+	cn.maxReplication = max
+	cn.namespaceReplication = namespaces
+}
+
+// replicationFor is how many nodes a write to key is stored on: requested,
+// else the key's namespace default, capped by SetReplicationLimits. 0 means
+// every enclave peer.
+func (cn *ClusterNode) replicationFor(key string, requested int) int {
+	if requested <= 0 {
+		if ns, _, found := strings.Cut(key, ":"); found {
+			requested = cn.namespaceReplication[ns]
+		}
+	}
+	if cn.maxReplication > 0 && requested > cn.maxReplication {
+		requested = cn.maxReplication
+	}
+	return requested
 }
 
 func (cn *ClusterNode) Put(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	return cn.PutReplicated(ctx, key, data, ttl, 0)
+}
+
+// PutReplicated is Put for a value stored on replication nodes, this one
+// included, rather than on every enclave peer. 0 uses the key's namespace
+// default, or every peer if it has none. The count is capped by
+// SetReplicationLimits and by the size of the enclave, and quorum is a
+// majority of the nodes written to.
+func (cn *ClusterNode) PutReplicated(ctx context.Context, key string, data []byte, ttl time.Duration, replication int) error {
+	_, err := cn.PutWithResult(ctx, key, data, ttl, replication)
+	return err
+}
+
+// WriteResult says how far a write had got when Put returned.
+type WriteResult struct {
+	Nodes     int // nodes the write is meant for, this one included
+	Confirmed int // of those, how many had stored it: this node and each ACK
+	Quorum    int // confirmations the write needed
+}
+
+// PutWithResult is PutReplicated, also reporting how many replicas had
+// confirmed the write when it returned. The result is zero if the local
+// write failed.
+func (cn *ClusterNode) PutWithResult(ctx context.Context, key string, data []byte, ttl time.Duration, replication int) (_ WriteResult, err error) {
 	quorum := cn.quorumSize()
+	targets := cn.protocol.GetReplicationTargets()
+	if replication = cn.replicationFor(key, replication); replication > 0 {
+		if replication-1 < len(targets) {
+			targets = cn.protocol.PickReplicationTargets(replication - 1)
+		} else {
+			replication = 0 // the whole enclave; gossip it as usual
+		}
+		quorum = (len(targets)+1)/2 + 1
+	}
 
+	now := time.Now()
 	msg := &gossip.Message{
-		Type:      gossip.MessageTypePut,
-		From:      cn.localNode.ID,
-		Key:       key,
-		Data:      data,
-		TTL:       int(ttl.Seconds()),
-		Timestamp: time.Now(),
-		MessageID: fmt.Sprintf("%s-%d", key, time.Now().UnixNano()),
+		Type:        gossip.MessageTypePut,
+		From:        cn.localNode.ID,
+		Key:         key,
+		Data:        data,
+		Hash:        gossip.ContentHash(data),
+		TTL:         int(ttl.Seconds()),
+		Timestamp:   now,
+		MessageID:   fmt.Sprintf("%s-%s", key, gossip.NewMessageID()),
+		Replication: replication,
+		Origin:      cn.localNode.ID,
+		WrittenAt:   now,
+		Expires:     now.Add(ttl),
+	}
+
+	var peerIDs []string
+	targetSet := make(map[gossip.NodeID]bool, len(targets))
+	for _, peer := range targets {
+		peerIDs = append(peerIDs, string(peer.ID))
+		targetSet[peer.ID] = true
 	}
+	record := cn.writes.begin(key, msg.MessageID, quorum, peerIDs)
+	defer func() { cn.writes.finish(record, err) }()
 
 	writeOp := &WriteOperation{
 		Key:           key,
 		Data:          data,
 		TTL:           ttl,
 		Confirmations: 1, // Count local write
-		Complete:      make(chan bool, 1),
+		Quorum:        quorum,
+		Targets:       targetSet,
+		AckedBy:       make(map[gossip.NodeID]bool),
+		NackedBy:      make(map[gossip.NodeID]string),
+		record:        record,
+		msg:           msg,
 	}
 
-	// Key on MessageID so concurrent writes to the same key don't
-	// collide — each write tracks its own quorum independently.
-	cn.writesMutex.Lock()
-	cn.pendingWrites[msg.MessageID] = writeOp
-	cn.writesMutex.Unlock()
-
-	if err := cn.store.Put(key, data, ttl); err != nil {
-		cn.writesMutex.Lock()
-		delete(cn.pendingWrites, msg.MessageID)
-		cn.writesMutex.Unlock()
-		return fmt.Errorf("local write failed: %w", err)
+	if err := cn.store.PutOrigin(key, data, ttl, msg.Hash, storage.Origin{Node: string(msg.Origin), WrittenAt: now}); err != nil {
+		return WriteResult{}, fmt.Errorf("local write failed: %w", err)
 	}
+	cn.writesTotal.Add(1)
 
 	// Check if local write is sufficient for quorum (single node or single-node enclave)
 	if writeOp.Confirmations >= quorum {
-		cn.writesMutex.Lock()
-		delete(cn.pendingWrites, msg.MessageID)
-		cn.writesMutex.Unlock()
-		close(writeOp.Complete)
 		logging.Debug("Write completed locally (quorum=%d, confirmations=%d)", quorum, writeOp.Confirmations)
-		return nil
+		return cn.writeResult(writeOp), nil
 	}
 
-	logging.Debug("[%s] Broadcasting PUT for key %s to enclave peers", cn.localNode.ID, key)
-	if err := cn.protocol.BroadcastToEnclave(ctx, msg); err != nil {
-		logging.Warn("[%s] Failed to broadcast write to enclave: %v", cn.localNode.ID, err)
+	// Replies carry the PUT's MessageID, so concurrent writes to the same
+	// key each count their own quorum.
+	replies := cn.protocol.AwaitReplies(msg.MessageID)
+	defer replies.Close()
+	cn.pendingWrites.Add(1)
+	defer cn.pendingWrites.Add(-1)
+
+	// Send in the background: quorum can be reached while a slow or
+	// unreachable peer is still being retried, and the replicas past quorum
+	// should still get the value after Put returns.
+	go func(ctx context.Context) {
+		var sendErr error
+		if msg.Replication > 0 {
+			logging.Debug("[%s] Sending PUT for key %s to %d replicas", cn.localNode.ID, key, len(targets))
+			sendErr = cn.protocol.SendTo(ctx, targets, msg)
+		} else {
+			logging.Debug("[%s] Broadcasting PUT for key %s to enclave peers", cn.localNode.ID, key)
+			sendErr = cn.protocol.BroadcastToEnclave(ctx, msg)
+		}
+		if sendErr != nil {
+			logging.Warn("[%s] Failed to broadcast write to enclave: %v", cn.localNode.ID, sendErr)
+		}
+	}(context.WithoutCancel(ctx))
+
+	// A caller's deadline replaces the node's write timeout, so a caller
+	// willing to wait longer for quorum can.
+	var timeout <-chan time.Time
+	wait := cn.writeTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = time.Until(deadline)
+	} else {
+		timer := time.NewTimer(cn.writeTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var resend <-chan time.Time
+	if cn.resendUnanswered {
+		timer := time.NewTimer(wait / 2)
+		defer timer.Stop()
+		resend = timer.C
 	}
 
-	select {
-	case <-writeOp.Complete:
-		cn.writesMutex.Lock()
-		err := writeOp.Error
-		delete(cn.pendingWrites, msg.MessageID)
-		cn.writesMutex.Unlock()
-		return err
-	case <-time.After(cn.writeTimeout):
-		cn.writesMutex.Lock()
-		delete(cn.pendingWrites, msg.MessageID)
-		cn.writesMutex.Unlock()
-		return ErrQuorumTimeout
-	case <-ctx.Done():
-		cn.writesMutex.Lock()
-		delete(cn.pendingWrites, msg.MessageID)
-		cn.writesMutex.Unlock()
-		return ctx.Err()
+	for {
+		select {
+		case reply := <-replies.C:
+			switch reply.Type {
+			case gossip.MessageTypeAck:
+				if cn.recordAck(writeOp, reply) {
+					return cn.writeResult(writeOp), nil
+				}
+			case gossip.MessageTypeNack:
+				if err := cn.recordNack(writeOp, reply); err != nil {
+					return cn.writeResult(writeOp), err
+				}
+			}
+		case <-resend:
+			resend = nil
+			cn.resendPut(writeOp)
+		case <-timeout:
+			return cn.writeResult(writeOp), ErrQuorumTimeout
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return cn.writeResult(writeOp), ErrQuorumTimeout
+			}
+			return cn.writeResult(writeOp), ctx.Err()
+		}
 	}
 }
 
+// writeResult reports how far op has got.
+func (cn *ClusterNode) writeResult(op *WriteOperation) WriteResult {
+	return WriteResult{Nodes: len(op.Targets) + 1, Confirmed: op.Confirmations, Quorum: cn.quorumFor(op)}
+}
+
+// RecentWrites returns the last writes made through this node, newest
+// first, with the ACKs each received and how it ended. ACKs that arrive
+// after Put returned are not recorded.
+func (cn *ClusterNode) RecentWrites() []WriteRecord {
+	return cn.writes.recent()
+}
+
+// MembershipEvents returns this node's recent peer joins, rejoins,
+// evictions and address changes, newest first.
+func (cn *ClusterNode) MembershipEvents() []gossip.MembershipEvent {
+	return cn.protocol.MembershipEvents()
+}
+
+// WriteTimeout is how long Put waits for quorum when its context has no
+// deadline.
+func (cn *ClusterNode) WriteTimeout() time.Duration {
+	return cn.writeTimeout
+}
+
 func (cn *ClusterNode) Get(key string) ([]byte, bool) {
 	return cn.store.Get(key)
 }
@@ -175,11 +545,25 @@ func (cn *ClusterNode) GetWithMetadata(key string) ([]byte, time.Time, time.Dura
 	return cn.store.GetWithMetadata(key)
 }
 
+// View returns the stored value without copying it. The slice is shared
+// with the store and other readers and must not be modified.
+func (cn *ClusterNode) View(key string) ([]byte, time.Time, time.Duration, bool) {
+	return cn.store.View(key)
+}
+
+// ViewMeta is View with the entry's full metadata, including where the
+// value entered the cluster.
+func (cn *ClusterNode) ViewMeta(key string) ([]byte, storage.EntryMeta, bool) {
+	return cn.store.ViewMeta(key)
+}
+
 func (cn *ClusterNode) HandleGossipMessage(msg *gossip.Message) error {
 	// Route protocol messages to the protocol handler
 	switch msg.Type {
-	case gossip.MessageTypePing, gossip.MessageTypePong, gossip.MessageTypeSync:
-		// Let the protocol handle its own messages
+	case gossip.MessageTypePing, gossip.MessageTypePingReq, gossip.MessageTypePong, gossip.MessageTypeSync,
+		gossip.MessageTypeAck, gossip.MessageTypeNack:
+		// Let the protocol handle its own messages, and route replies to
+		// the writes waiting on them
 		return cn.protocol.HandleMessage(msg)
 	default:
 		// Application messages
@@ -190,13 +574,24 @@ func (cn *ClusterNode) HandleGossipMessage(msg *gossip.Message) error {
 func (cn *ClusterNode) handleGossipMessage(msg *gossip.Message) error {
 	// First let the protocol handle system messages
 	switch msg.Type {
-	case gossip.MessageTypePing, gossip.MessageTypePong, gossip.MessageTypeSync:
+	case gossip.MessageTypePing, gossip.MessageTypePingReq, gossip.MessageTypePong, gossip.MessageTypeSync:
 		logging.Warn("[%s] Unexpected %s message in cluster handler", cn.localNode.ID, msg.Type)
 		return nil
 	case gossip.MessageTypePut:
 		return cn.handlePutMessage(msg)
-	case gossip.MessageTypeAck:
-		return cn.handleAckMessage(msg)
+	case gossip.MessageTypeAck, gossip.MessageTypeNack:
+		// Replies to a write still waiting on quorum go straight to its
+		// Put; this one arrived after Put returned.
+		logging.Debug("[%s] Ignoring late %s from %s for %s", cn.localNode.ID, msg.Type, msg.From, msg.MessageID)
+		return nil
+	case gossip.MessageTypeMerge:
+		return cn.handleMergeMessage(msg)
+	case gossip.MessageTypeTombstone:
+		return cn.handleTombstoneMessage(msg)
+	case gossip.MessageTypeRate:
+		if cn.rateDigestHandler != nil {
+			return cn.rateDigestHandler(string(msg.From), msg.Data)
+		}
 	}
 	return nil
 }
@@ -205,79 +600,235 @@ func (cn *ClusterNode) handlePutMessage(msg *gossip.Message) error {
 	// Dedup: if we've already processed this message, skip it.
 	// MarkSeen returns true if it was already seen.
 	if cn.protocol.MarkSeen(msg.MessageID) {
+		// A resend means the originator never heard back: the ACK may
+		// have been lost. Forwarded duplicates aren't answered, or every
+		// copy of a write would ACK.
+		if msg.Resend && cn.store.Holds(msg.Key, gossip.ContentHash(msg.Data), time.Time{}) {
+			cn.sendAck(msg, time.Duration(msg.TTL)*time.Second)
+		}
 		logging.Debug("[%s] Skipping duplicate PUT for key %s (msg %s)", cn.localNode.ID, msg.Key, msg.MessageID)
 		return nil
 	}
 
 	logging.Debug("[%s] Received PUT message for key %s from %s", cn.localNode.ID, msg.Key, msg.From)
 	ttl := time.Duration(msg.TTL) * time.Second
-	if err := cn.store.Put(msg.Key, msg.Data, ttl); err != nil {
+	// Forwarded copies carry what is left of the TTL when they go out
+	msg.Expires = time.Now().Add(ttl)
+	// Only the maximum is enforced: values pushed after a partition merge
+	// carry their remaining TTL, and raising it to a minimum would keep
+	// them past their expiry.
+	if cn.maxTTL > 0 && ttl > cn.maxTTL {
+		logging.Warn("[%s] Clamping TTL of replicated PUT for key %s from %s: %v exceeds the maximum %v", cn.localNode.ID, msg.Key, msg.From, ttl, cn.maxTTL)
+		ttl = cn.maxTTL
+	}
+
+	// A value this node took down or already expired must not come back
+	// from a peer that still holds it.
+	if cn.tombstones.blocks(msg.Key, gossip.ContentHash(msg.Data), msg.Timestamp.Add(ttl)) {
+		logging.Debug("[%s] Refusing PUT for key %s from %s: removed here", cn.localNode.ID, msg.Key, msg.From)
+		cn.sendNack(msg, NackTombstoned)
+		return nil
+	}
+
+	// Content dedup: re-replication and partition merges resend values under new
+	// message IDs. If we already hold the same bytes for at least as long as
+	// the originator intended, skip the write. Still ACK: the originator may
+	// be a concurrent write of the same value waiting on its own quorum.
+	// Timestamps travel in whole seconds and clocks drift, so allow a second
+	// of slack.
+	if cn.store.Holds(msg.Key, msg.Hash, msg.Timestamp.Add(ttl-time.Second)) {
+		logging.Debug("[%s] Skipping PUT for key %s: identical value already held", cn.localNode.ID, msg.Key)
+		cn.sendAck(msg, ttl)
+		cn.forward(msg)
+		return nil
+	}
+
+	// Don't trust a sender's hash for our own index; a peer running an older
+	// version sends none, nor an origin.
+	origin := storage.Origin{Node: string(msg.Origin), WrittenAt: msg.WrittenAt}
+	if err := cn.store.PutOrigin(msg.Key, msg.Data, ttl, gossip.ContentHash(msg.Data), origin); err != nil {
+		cn.sendNack(msg, nackReason(err))
 		return fmt.Errorf("failed to store replicated data: %w", err)
 	}
 	logging.Debug("[%s] Successfully stored replicated data for key %s", cn.localNode.ID, msg.Key)
 
-	// Send ACK directly to the originator
+	cn.sendAck(msg, ttl)
+
+	cn.forward(msg)
+
+	return nil
+}
+
+// forward continues epidemic forwarding of a PUT to other enclave peers. A
+// write with its own replication count already went to every node meant
+// to hold it.
+func (cn *ClusterNode) forward(msg *gossip.Message) {
+	if msg.Replication == 0 {
+		cn.protocol.ForwardToEnclave(context.Background(), msg)
+	}
+}
+
+// sendAck confirms a replicated PUT directly to its originator. The ACK
+// carries the PUT's MessageID, which ties it to the originator's write, and
+// the TTL the value was stored with.
+func (cn *ClusterNode) sendAck(msg *gossip.Message, ttl time.Duration) {
 	ack := &gossip.Message{
 		Type:      gossip.MessageTypeAck,
 		From:      cn.localNode.ID,
 		To:        msg.From,
 		Key:       msg.Key,
+		TTL:       int(ttl.Seconds()),
 		MessageID: msg.MessageID,
 		Timestamp: time.Now(),
 	}
 
-	cn.writesMutex.RLock()
-	peers := cn.protocol.GetPeers()
-	cn.writesMutex.RUnlock()
-
-	for _, peer := range peers {
+	for _, peer := range cn.protocol.GetPeers() {
 		if peer.ID == msg.From {
 			logging.Debug("[%s] Sending ACK for key %s to %s", cn.localNode.ID, msg.Key, peer.ID)
 			cn.protocol.Send(context.Background(), peer, ack)
 			break
 		}
 	}
-
-	// Continue epidemic forwarding to other enclave peers
-	cn.protocol.ForwardToEnclave(context.Background(), msg)
-
-	return nil
 }
 
-func (cn *ClusterNode) handleAckMessage(msg *gossip.Message) error {
-	cn.writesMutex.Lock()
-	defer cn.writesMutex.Unlock()
+// recordAck counts a replica's ACK toward writeOp and reports whether the
+// write has reached quorum.
+func (cn *ClusterNode) recordAck(writeOp *WriteOperation, msg *gossip.Message) bool {
+	// Each replica counts once: a duplicated or replayed ACK, or one from a
+	// node the write wasn't meant for (outside the enclave, not among the
+	// write's replicas, or in public mode a demoted peer), must not fake
+	// quorum.
+	if writeOp.AckedBy[msg.From] {
+		logging.Debug("[%s] Ignoring duplicate ACK from %s for %s", cn.localNode.ID, msg.From, msg.MessageID)
+		return false
+	}
+	if !cn.countsToward(writeOp, msg.From) {
+		logging.Debug("[%s] Ignoring ACK from %s for %s: not a replica of the write", cn.localNode.ID, msg.From, msg.MessageID)
+		return false
+	}
+	writeOp.AckedBy[msg.From] = true
+	writeOp.Confirmations++
 
-	writeOp, exists := cn.pendingWrites[msg.MessageID]
-	if !exists {
-		return nil
+	// A replica that stored a shorter TTL than the write had left clamped
+	// it to its own maximum. Older nodes send no TTL. A second of slack
+	// covers rounding of the TTL sent.
+	clamped := 0
+	if left := writeOp.ttlLeft(); msg.TTL > 0 && msg.TTL < left-1 {
+		clamped = msg.TTL
+		logging.Warn("[%s] %s stored key %s with TTL %ds instead of %ds", cn.localNode.ID, msg.From, writeOp.Key, msg.TTL, left)
+	}
+	if writeOp.record != nil {
+		cn.writes.ack(writeOp.record, string(msg.From), clamped)
 	}
 
-	writeOp.Confirmations++
+	return writeOp.Confirmations >= cn.quorumFor(writeOp)
+}
 
-	if writeOp.Confirmations >= cn.quorumSize() {
-		select {
-		case writeOp.Complete <- true:
-		default:
+// countsToward reports whether an ACK from id counts toward op's quorum.
+func (cn *ClusterNode) countsToward(op *WriteOperation, id gossip.NodeID) bool {
+	if op.Targets != nil {
+		return op.Targets[id]
+	}
+	return cn.isReplicationPeer(id)
+}
+
+// isReplicationPeer reports whether id is one of the peers quorum is
+// counted over.
+func (cn *ClusterNode) isReplicationPeer(id gossip.NodeID) bool {
+	for _, peer := range cn.protocol.GetReplicationTargets() {
+		if peer.ID == id {
+			return true
 		}
 	}
+	return false
+}
 
-	return nil
+// SetRateDigestHandler registers the handler for rate limit digests gossiped
+// by peers. Must be called before Start.
+func (cn *ClusterNode) SetRateDigestHandler(handler func(from string, data []byte) error) {
+	cn.rateDigestHandler = handler
+}
+
+// BroadcastRateDigest sends this node's rate limit digest to every peer.
+// Rate limits are cluster-wide, so digests cross enclave boundaries.
+func (cn *ClusterNode) BroadcastRateDigest(ctx context.Context, data []byte) {
+	msg := &gossip.Message{
+		Type:      gossip.MessageTypeRate,
+		From:      cn.localNode.ID,
+		Data:      data,
+		Timestamp: time.Now(),
+		MessageID: fmt.Sprintf("rate-%s-%s", cn.localNode.ID, gossip.NewMessageID()),
+	}
+	if err := cn.protocol.Broadcast(ctx, msg); err != nil {
+		logging.Debug("[%s] Rate digest not delivered to every peer: %v", cn.localNode.ID, err)
+	}
 }
 
 func (cn *ClusterNode) Scan() []string {
 	return cn.store.Scan()
 }
 
-func (cn *ClusterNode) HandleBootstrap(req *gossip.BootstrapRequest) *gossip.BootstrapResponse {
+// RangePrefix calls fn in key order for each live key starting with prefix
+// and sorting after the key "after", with its remaining TTL in seconds,
+// until fn returns false.
+func (cn *ClusterNode) RangePrefix(prefix, after string, fn func(key string, ttl int) bool) {
+	cn.store.RangePrefix(prefix, after, fn)
+}
+
+// RangeByExpiry calls fn for each live key starting with prefix, soonest to
+// expire first, beginning after the given position, until fn returns false.
+func (cn *ClusterNode) RangeByExpiry(prefix string, after storage.ExpiryPosition, fn func(key string, expiresAt time.Time) bool) {
+	cn.store.RangeByExpiry(prefix, after, fn)
+}
+
+// SameValue reports whether key holds exactly data locally, and if so the
+// value's remaining TTL.
+func (cn *ClusterNode) SameValue(key string, data []byte) (time.Duration, bool) {
+	return cn.store.SameValue(key, data)
+}
+
+// CountPrefix returns the number of live keys starting with prefix.
+func (cn *ClusterNode) CountPrefix(prefix string) int {
+	return cn.store.CountPrefix(prefix)
+}
+
+// SetStoreEventHandler registers fn to observe puts and expirations in the
+// local store, whether written by a client or replicated from a peer. fn must
+// not block. Call before Start.
+func (cn *ClusterNode) SetStoreEventHandler(fn func(storage.Event)) {
+	cn.store.SetEventHandler(fn)
+}
+
+// Range calls fn for each live key with its remaining TTL in seconds, in key
+// order, until fn returns false.
+func (cn *ClusterNode) Range(fn func(key string, ttl int) bool) {
+	cn.store.Range(fn)
+}
+
+// HandleBootstrap adds a joining node as a peer and returns the cluster
+// topology, or refuses it with an error wrapping gossip.ErrBadBootstrap.
+func (cn *ClusterNode) HandleBootstrap(req *gossip.BootstrapRequest) (*gossip.BootstrapResponse, error) {
 	return cn.protocol.HandleBootstrap(req)
 }
 
+// VerifyPeerRequest checks the signature on a gossip or bootstrap request
+// body against the cluster secret. It returns gossip.ErrMissingSignature or
+// gossip.ErrInvalidSignature, or nil in open mode.
+func (cn *ClusterNode) VerifyPeerRequest(body []byte, signature string) error {
+	return gossip.VerifyRequest(cn.clusterSecret, body, signature)
+}
+
+// EnableDialBack makes the node connect to a joining node's claimed address
+// before adding it as a peer. Must be called before Start.
+func (cn *ClusterNode) EnableDialBack() {
+	cn.protocol.EnableDialBack()
+}
+
 // quorumSize calculates the current quorum based on enclave peer count.
 // Quorum = (min(enclaveNodes, replicationFactor) / 2) + 1
 // where enclaveNodes includes the local node.
 func (cn *ClusterNode) quorumSize() int {
-	enclaveNodes := len(cn.protocol.GetReplicationPeers()) + 1 // +1 for self
+	enclaveNodes := len(cn.protocol.GetReplicationTargets()) + 1 // +1 for self; demoted peers don't count
 	effective := enclaveNodes
 	if cn.replicationFactor < effective {
 		effective = cn.replicationFactor
@@ -289,16 +840,96 @@ func (cn *ClusterNode) quorumSize() int {
 	return q
 }
 
+// GossipAlive reports whether the gossip protocol's background loops have
+// made progress within maxAge. Used to gate the systemd watchdog.
+func (cn *ClusterNode) GossipAlive(maxAge time.Duration) bool {
+	return cn.protocol.LoopsAlive(maxAge)
+}
+
 // ClusterSecret returns the configured cluster secret (empty string if open mode).
 func (cn *ClusterNode) ClusterSecret() string {
 	return cn.clusterSecret
 }
 
+// GossipStatus is a snapshot of this node's view of the cluster.
+type GossipStatus struct {
+	Peers              int        `json:"peers"`                // every known peer, in any enclave
+	EnclavePeers       int        `json:"enclave_peers"`        // peers writes replicate to
+	ReplicationFactor  int        `json:"replication_factor"`   // configured
+	QuorumSize         int        `json:"quorum_size"`          // confirmations a write needs now, counting this node
+	SeenMessages       int        `json:"seen_messages"`        // message IDs in the dedup cache
+	PendingWrites      int        `json:"pending_writes"`       // writes waiting on quorum
+	LastPartitionCheck *time.Time `json:"last_partition_check"` // nil before the first
+}
+
+// GossipStatus reports the state of this node's gossip protocol.
+func (cn *ClusterNode) GossipStatus() GossipStatus {
+	status := GossipStatus{
+		Peers:             len(cn.protocol.GetPeers()),
+		EnclavePeers:      len(cn.protocol.GetReplicationPeers()),
+		ReplicationFactor: cn.replicationFactor,
+		QuorumSize:        cn.quorumSize(),
+		SeenMessages:      cn.protocol.SeenMessages(),
+		PendingWrites:     int(cn.pendingWrites.Load()),
+	}
+	if nanos := cn.partitionCheck.Load(); nanos != 0 {
+		at := time.Unix(0, nanos)
+		status.LastPartitionCheck = &at
+	}
+	return status
+}
+
+// StorageStatus is a snapshot of this node's store.
+type StorageStatus struct {
+	MaxBytes  int64  `json:"max_bytes"`  // 0 = unlimited
+	UsedBytes int64  `json:"used_bytes"` // payload bytes of live values
+	Items     int    `json:"items"`
+	Writes    uint64 `json:"writes"` // writes stored through this node since start, not counting replicas
+}
+
+// StorageStatus reports this node's storage usage and write count.
+func (cn *ClusterNode) StorageStatus() StorageStatus {
+	maxBytes, used, items := cn.store.Usage()
+	return StorageStatus{MaxBytes: maxBytes, UsedBytes: used, Items: items, Writes: cn.writesTotal.Load()}
+}
+
+// Health problems reported by HealthProblems.
+const (
+	HealthStorageFull    = "storage_full"    // the store is over 95% of its cap
+	HealthCleanupStalled = "cleanup_stalled" // expired values aren't being removed
+	HealthIsolated       = "isolated"        // every peer has been evicted
+)
+
+// HealthProblems lists what stops this node from doing its job, for a
+// health check that should take it out of rotation: a store too full to
+// take writes, a cleanup worker that has missed three passes and so leaves
+// expired values holding memory, or, with bootstrap seeds configured, a
+// node that has lost every peer it had. A node with no seeds may run alone
+// by design. Nil means healthy.
+func (cn *ClusterNode) HealthProblems() []string {
+	var problems []string
+	if maxBytes, used, _ := cn.store.Usage(); maxBytes > 0 && used*100 > maxBytes*95 {
+		problems = append(problems, HealthStorageFull)
+	}
+	if time.Since(cn.store.LastSweep()) > 3*storage.CleanupInterval {
+		problems = append(problems, HealthCleanupStalled)
+	}
+	if len(cn.currentSeeds()) > 0 && cn.protocol.Isolated() {
+		problems = append(problems, HealthIsolated)
+	}
+	return problems
+}
+
 // Enclave returns this node's enclave name.
 func (cn *ClusterNode) Enclave() string {
 	return cn.localNode.Enclave
 }
 
+// Zone returns this node's zone, "" if none was declared.
+func (cn *ClusterNode) Zone() string {
+	return cn.localNode.Zone
+}
+
 // Topology returns the full peer list with enclave membership.
 func (cn *ClusterNode) Topology() []*gossip.Node {
 	return cn.protocol.GetPeers()
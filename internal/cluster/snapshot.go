@@ -0,0 +1,52 @@
+package cluster
+
+import (
+	"time"
+
+	"repram/internal/gossip"
+)
+
+// SnapshotEntry is one live value in a snapshot of the local store.
+type SnapshotEntry struct {
+	Key  string
+	Data []byte        // read-only: the stored value itself, not a copy
+	TTL  time.Duration // remaining when the entry was read
+}
+
+// Snapshot calls fn for each live value in the local store, in key order,
+// until fn returns false. Each value's remaining TTL is taken as it is
+// read, so a slow consumer doesn't hand on TTLs that have already run
+// down. Values written during the walk may or may not be included.
+func (cn *ClusterNode) Snapshot(fn func(SnapshotEntry) bool) {
+	// Collect first: View takes the store lock Range is holding
+	var keys []string
+	cn.store.Range(func(key string, _ int) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	for _, key := range keys {
+		data, createdAt, ttl, ok := cn.store.View(key)
+		if !ok {
+			continue
+		}
+		remaining := time.Until(createdAt.Add(ttl))
+		if remaining <= 0 {
+			continue
+		}
+		if !fn(SnapshotEntry{Key: key, Data: data, TTL: remaining}) {
+			return
+		}
+	}
+}
+
+// Restore stores a snapshot entry in the local store only. It is not
+// gossiped: the peers of the node the snapshot came from already hold
+// their copies. TTLs over the node's maximum are lowered to it.
+func (cn *ClusterNode) Restore(e SnapshotEntry) error {
+	ttl := e.TTL
+	if cn.maxTTL > 0 && ttl > cn.maxTTL {
+		ttl = cn.maxTTL
+	}
+	return cn.store.PutHashed(e.Key, e.Data, ttl, gossip.ContentHash(e.Data))
+}
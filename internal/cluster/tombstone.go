@@ -0,0 +1,176 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"repram/internal/gossip"
+	"repram/internal/logging"
+)
+
+// NackTombstoned is the NACK reason for a PUT of a value the receiving node
+// has taken down or already expired.
+const NackTombstoned = "tombstoned"
+
+// minTombstoneHold is how long a takedown's tombstone is held at least, and
+// for a key whose value is unknown. Copies of a removed value can still be
+// in flight as retries, forwards, or merge pushes for a while after the
+// takedown.
+const minTombstoneHold = 10 * time.Minute
+
+// maxClockSkew is how far a peer's clock may run behind this node's and
+// still have a value of a key this node just expired refused. A peer whose
+// clock is behind still holds the value after it expired here, and would
+// hand it back in a merge push or handoff.
+const maxClockSkew = time.Minute
+
+// tombstonePruneInterval spaces out sweeps of lapsed tombstones; a node
+// expiring many keys records a tombstone for each.
+const tombstonePruneInterval = time.Minute
+
+// tombstones remembers keys removed on this node, taken down or expired, so
+// that copies of the removed value held by peers are not stored again.
+type tombstones struct {
+	mu        sync.Mutex
+	keys      map[string]tombstone
+	lastPrune time.Time
+}
+
+type tombstone struct {
+	hash    string    // content hash of the removed value; "" = any value
+	expires time.Time // copies expiring later are new writes; zero = refuse every copy
+	until   time.Time // when the tombstone lapses
+}
+
+func newTombstones() *tombstones {
+	return &tombstones{keys: make(map[string]tombstone)}
+}
+
+// takedown records a tombstone refusing every copy of key's value with
+// hash until the given time.
+func (t *tombstones) takedown(key, hash string, until time.Time) {
+	t.add(key, tombstone{hash: hash, until: until})
+}
+
+// expired records a tombstone for a value of key with hash that expired at
+// expiresAt. Copies that expire no later, allowing for clock skew, are
+// the same write; a value that outlives them was written again since.
+// Keys stored without a hash can't be recognised and get none.
+func (t *tombstones) expired(key, hash string, expiresAt time.Time) {
+	if hash == "" {
+		return
+	}
+	cutoff := expiresAt.Add(maxClockSkew)
+	t.add(key, tombstone{hash: hash, expires: cutoff, until: cutoff})
+}
+
+func (t *tombstones) add(key string, ts tombstone) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Sub(t.lastPrune) >= tombstonePruneInterval {
+		for k, old := range t.keys {
+			if !now.Before(old.until) {
+				delete(t.keys, k)
+			}
+		}
+		t.lastPrune = now
+	}
+	// A takedown removes the key through the store, which reports it as
+	// expired too; that must not weaken the takedown's tombstone.
+	if old, ok := t.keys[key]; ok && old.expires.IsZero() && now.Before(old.until) && !ts.expires.IsZero() {
+		return
+	}
+	t.keys[key] = ts
+}
+
+// blocks reports whether a copy of key's removed value, with the given
+// content hash and expiring at expiresAt, must not be stored again.
+func (t *tombstones) blocks(key, hash string, expiresAt time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts, ok := t.keys[key]
+	if !ok {
+		return false
+	}
+	if !time.Now().Before(ts.until) {
+		delete(t.keys, key)
+		return false
+	}
+	if ts.hash != "" && ts.hash != hash {
+		return false
+	}
+	return ts.expires.IsZero() || !expiresAt.After(ts.expires)
+}
+
+// Takedown removes key from the local store now, for abuse reports, and
+// reports whether it held a live value. The removal is tombstoned so
+// replicas pushing the value back are refused. On a cluster with a secret
+// the takedown is gossiped to enclave peers as a TOMBSTONE, which they act
+// on only because the message is signed; without one it stays local, as
+// any host could otherwise delete keys cluster-wide.
+func (cn *ClusterNode) Takedown(ctx context.Context, key string) (removed, gossiped bool) {
+	hash := ""
+	if data, _, _, ok := cn.store.View(key); ok {
+		hash = gossip.ContentHash(data)
+	}
+	meta, removed := cn.store.Expire(key)
+	until := time.Now().Add(minTombstoneHold)
+	if removed && meta.ExpiresAt.After(until) {
+		until = meta.ExpiresAt
+	}
+	cn.tombstones.takedown(key, hash, until)
+	logging.Info("[%s] Took down key %s", cn.localNode.ID, key)
+
+	if cn.clusterSecret == "" {
+		return removed, false
+	}
+	msg := &gossip.Message{
+		Type:      gossip.MessageTypeTombstone,
+		From:      cn.localNode.ID,
+		Key:       key,
+		Hash:      hash,
+		TTL:       int(time.Until(until).Seconds()),
+		Timestamp: time.Now(),
+		MessageID: fmt.Sprintf("%s-%s", key, gossip.NewMessageID()),
+	}
+	if err := cn.protocol.BroadcastToEnclave(ctx, msg); err != nil {
+		logging.Warn("[%s] Tombstone for %s not delivered to every peer: %v", cn.localNode.ID, key, err)
+	}
+	return removed, true
+}
+
+// handleTombstoneMessage drops a key taken down on an enclave peer and
+// holds the tombstone for as long as the peer asked, up to the node's
+// maximum TTL. Without a cluster secret gossip is unsigned, so tombstones
+// are ignored.
+func (cn *ClusterNode) handleTombstoneMessage(msg *gossip.Message) error {
+	if cn.protocol.MarkSeen(msg.MessageID) {
+		return nil
+	}
+	if cn.clusterSecret == "" {
+		logging.Debug("[%s] Ignoring unsigned tombstone for %s from %s", cn.localNode.ID, msg.Key, msg.From)
+		return nil
+	}
+	if !cn.isReplicationPeer(msg.From) {
+		logging.Debug("[%s] Ignoring tombstone for %s from %s: not an enclave peer", cn.localNode.ID, msg.Key, msg.From)
+		return nil
+	}
+
+	hold := time.Duration(msg.TTL) * time.Second
+	if cn.maxTTL > 0 && hold > cn.maxTTL {
+		hold = cn.maxTTL
+	}
+	if hold < minTombstoneHold {
+		hold = minTombstoneHold
+	}
+	cn.tombstones.takedown(msg.Key, msg.Hash, time.Now().Add(hold))
+	if _, removed := cn.store.Expire(msg.Key); removed {
+		logging.Info("[%s] Dropped key %s taken down by %s", cn.localNode.ID, msg.Key, msg.From)
+	}
+
+	cn.protocol.ForwardToEnclave(context.Background(), msg)
+	return nil
+}
@@ -0,0 +1,157 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// writeLogSize is how many recent writes RecentWrites remembers.
+const writeLogSize = 256
+
+// Write outcomes reported by RecentWrites.
+const (
+	WritePending  = "pending"  // still waiting for quorum
+	WriteQuorum   = "quorum"   // confirmed by a quorum
+	WriteTimeout  = "timeout"  // stored locally; quorum not reached in time
+	WriteRejected = "rejected" // stored locally; too many replicas NACKed for quorum
+	WriteCanceled = "canceled" // the caller gave up before quorum
+	WriteFailed   = "failed"   // not stored
+)
+
+// AckRecord is one counted ACK for a write.
+type AckRecord struct {
+	From string    `json:"from"`
+	At   time.Time `json:"at"`
+	TTL  int       `json:"ttl,omitempty"` // seconds, when the peer clamped the write's TTL
+}
+
+// NackRecord is one replica's refusal of a write.
+type NackRecord struct {
+	From   string    `json:"from"`
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason"`
+}
+
+// WriteRecord traces one write from this node through its quorum wait.
+// Missing lists the enclave peers at write time that have not ACKed, which
+// is usually the question being asked.
+type WriteRecord struct {
+	Key       string       `json:"key"`
+	MessageID string       `json:"message_id"`
+	Quorum    int          `json:"quorum"`
+	Peers     []string     `json:"peers"`
+	Acks      []AckRecord  `json:"acks"`
+	Nacks     []NackRecord `json:"nacks,omitempty"`
+	Resent    []string     `json:"resent,omitempty"` // peers sent the PUT again for want of a reply
+	Missing   []string     `json:"missing"`
+	Outcome   string       `json:"outcome"`
+	Started   time.Time    `json:"started"`
+	Finished  *time.Time   `json:"finished,omitempty"`
+}
+
+// writeLog is a ring buffer of the most recent writes.
+type writeLog struct {
+	mu      sync.Mutex
+	records []*WriteRecord
+	next    int
+}
+
+func newWriteLog() *writeLog {
+	return &writeLog{records: make([]*WriteRecord, 0, writeLogSize)}
+}
+
+func (l *writeLog) begin(key, messageID string, quorum int, peers []string) *WriteRecord {
+	rec := &WriteRecord{
+		Key:       key,
+		MessageID: messageID,
+		Quorum:    quorum,
+		Peers:     peers,
+		Outcome:   WritePending,
+		Started:   time.Now(),
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) < writeLogSize {
+		l.records = append(l.records, rec)
+	} else {
+		l.records[l.next] = rec
+	}
+	l.next = (l.next + 1) % writeLogSize
+	return rec
+}
+
+func (l *writeLog) ack(rec *WriteRecord, from string, clampedTTL int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Acks = append(rec.Acks, AckRecord{From: from, At: time.Now(), TTL: clampedTTL})
+}
+
+func (l *writeLog) nack(rec *WriteRecord, from, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Nacks = append(rec.Nacks, NackRecord{From: from, At: time.Now(), Reason: reason})
+}
+
+// resend records the peers a write was sent to again.
+func (l *writeLog) resend(rec *WriteRecord, peers []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Resent = append(rec.Resent, peers...)
+}
+
+// addPeer records a replica the write was sent to after it began, in place
+// of one that NACKed.
+func (l *writeLog) addPeer(rec *WriteRecord, peer string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Peers = append(rec.Peers, peer)
+}
+
+// finish records how Put ended, from the error it returns.
+func (l *writeLog) finish(rec *WriteRecord, err error) {
+	outcome := WriteFailed
+	var nackErr *NackError
+	switch {
+	case err == nil:
+		outcome = WriteQuorum
+	case errors.Is(err, ErrQuorumTimeout):
+		outcome = WriteTimeout
+	case errors.As(err, &nackErr):
+		outcome = WriteRejected
+	case errors.Is(err, context.Canceled):
+		outcome = WriteCanceled
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Outcome = outcome
+	rec.Finished = &now
+}
+
+// recent returns copies of the logged writes, newest first.
+func (l *writeLog) recent() []WriteRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]WriteRecord, 0, len(l.records))
+	for i := 1; i <= len(l.records); i++ {
+		rec := *l.records[(l.next-i+len(l.records))%len(l.records)]
+		rec.Peers = append([]string{}, rec.Peers...)
+		rec.Acks = append([]AckRecord{}, rec.Acks...)
+		rec.Nacks = append([]NackRecord(nil), rec.Nacks...)
+		rec.Resent = append([]string(nil), rec.Resent...)
+		acked := make(map[string]bool, len(rec.Acks))
+		for _, a := range rec.Acks {
+			acked[a.From] = true
+		}
+		rec.Missing = []string{}
+		for _, peer := range rec.Peers {
+			if !acked[peer] {
+				rec.Missing = append(rec.Missing, peer)
+			}
+		}
+		out = append(out, rec)
+	}
+	return out
+}
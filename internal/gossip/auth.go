@@ -4,6 +4,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 )
 
 // SignBody computes an HMAC-SHA256 signature of body using secret.
@@ -18,3 +19,24 @@ func VerifyBody(secret string, body []byte, signature string) bool {
 	expected := SignBody(secret, body)
 	return hmac.Equal([]byte(expected), []byte(signature))
 }
+
+// Reasons VerifyRequest refuses a peer request.
+var (
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// VerifyRequest checks the X-Repram-Signature of a gossip or bootstrap
+// request body. With no secret (open mode) every request passes.
+func VerifyRequest(secret string, body []byte, signature string) error {
+	if secret == "" {
+		return nil
+	}
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	if !VerifyBody(secret, body, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package gossip
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestSignAndVerify(t *testing.T) {
 	secret := "test-secret-key"
@@ -54,3 +57,21 @@ func TestVerifyRejectsGarbageSignature(t *testing.T) {
 		t.Fatal("VerifyBody accepted garbage signature")
 	}
 }
+
+func TestVerifyRequest(t *testing.T) {
+	body := []byte(`{"node_id":"node-2"}`)
+	sig := SignBody("secret", body)
+
+	if err := VerifyRequest("", body, ""); err != nil {
+		t.Errorf("open mode: err = %v", err)
+	}
+	if err := VerifyRequest("secret", body, sig); err != nil {
+		t.Errorf("valid signature: err = %v", err)
+	}
+	if err := VerifyRequest("secret", body, ""); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("no signature: err = %v, want ErrMissingSignature", err)
+	}
+	if err := VerifyRequest("secret", body, SignBody("other", body)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: err = %v, want ErrInvalidSignature", err)
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"repram/internal/logging"
@@ -13,11 +17,13 @@ import (
 
 // BootstrapRequest is sent when a node wants to join the cluster
 type BootstrapRequest struct {
-	NodeID     string `json:"node_id"`
-	Address    string `json:"address"`
-	GossipPort int    `json:"gossip_port"`
-	HTTPPort   int    `json:"http_port"`
-	Enclave    string `json:"enclave,omitempty"` // Empty treated as "default"
+	NodeID       string `json:"node_id"`
+	Address      string `json:"address"`
+	GossipPort   int    `json:"gossip_port"`
+	HTTPPort     int    `json:"http_port"`
+	InternalPort int    `json:"internal_port,omitempty"` // 0: peer endpoints are on HTTPPort
+	Enclave      string `json:"enclave,omitempty"`       // Empty treated as "default"
+	Zone         string `json:"zone,omitempty"`
 }
 
 // BootstrapResponse contains the current cluster topology
@@ -26,16 +32,68 @@ type BootstrapResponse struct {
 	Peers   []*Node `json:"peers"`
 }
 
-// Bootstrap connects to seed nodes and retrieves the cluster topology
+// ErrBadBootstrap means a join request was refused: a malformed field, or
+// with dial-back enabled, an address the node couldn't be reached at.
+var ErrBadBootstrap = errors.New("bootstrap request rejected")
+
+// maxNodeIDLength bounds the node IDs, enclave names and zones a join
+// request may claim.
+const maxNodeIDLength = 128
+
+// dialBackTimeout bounds the connection attempt to a joining node.
+const dialBackTimeout = 3 * time.Second
+
+// Validate checks the fields of a join request before its node is added.
+func (r *BootstrapRequest) Validate() error {
+	if r.NodeID == "" || len(r.NodeID) > maxNodeIDLength {
+		return fmt.Errorf("%w: node_id must be 1-%d bytes", ErrBadBootstrap, maxNodeIDLength)
+	}
+	if len(r.Enclave) > maxNodeIDLength {
+		return fmt.Errorf("%w: enclave longer than %d bytes", ErrBadBootstrap, maxNodeIDLength)
+	}
+	if len(r.Zone) > maxNodeIDLength {
+		return fmt.Errorf("%w: zone longer than %d bytes", ErrBadBootstrap, maxNodeIDLength)
+	}
+	// A host name or IP, with nothing that would change the URL peers build
+	if r.Address == "" || strings.ContainsAny(r.Address, "/?#@[] \t\r\n") {
+		return fmt.Errorf("%w: invalid address %q", ErrBadBootstrap, r.Address)
+	}
+	if r.HTTPPort < 1 || r.HTTPPort > 65535 {
+		return fmt.Errorf("%w: http_port %d out of range", ErrBadBootstrap, r.HTTPPort)
+	}
+	if r.GossipPort < 0 || r.GossipPort > 65535 {
+		return fmt.Errorf("%w: gossip_port %d out of range", ErrBadBootstrap, r.GossipPort)
+	}
+	if r.InternalPort < 0 || r.InternalPort > 65535 {
+		return fmt.Errorf("%w: internal_port %d out of range", ErrBadBootstrap, r.InternalPort)
+	}
+	return nil
+}
+
+// EnableDialBack makes HandleBootstrap connect to a joining node's claimed
+// address before adding it, so a node can't point its peers at an address
+// it doesn't serve.
+func (p *Protocol) EnableDialBack() {
+	p.dialBack = true
+}
+
+// ErrNoSeeds means none of the seed nodes answered a bootstrap request.
+// The node keeps running on its own; callers decide whether to retry.
+var ErrNoSeeds = errors.New("no seed node responded")
+
+// Bootstrap connects to seed nodes and retrieves the cluster topology.
+// It returns ErrNoSeeds if every seed fails.
 func (p *Protocol) Bootstrap(ctx context.Context, seedNodes []string) error {
 	logging.Info("[%s] Starting bootstrap process with %d seed nodes", p.localNode.ID, len(seedNodes))
 
 	req := &BootstrapRequest{
-		NodeID:     string(p.localNode.ID),
-		Address:    p.localNode.Address,
-		GossipPort: p.localNode.Port,
-		HTTPPort:   p.localNode.HTTPPort,
-		Enclave:    p.localNode.Enclave,
+		NodeID:       string(p.localNode.ID),
+		Address:      p.localNode.Address,
+		GossipPort:   p.localNode.Port,
+		HTTPPort:     p.localNode.HTTPPort,
+		InternalPort: p.localNode.InternalPort,
+		Enclave:      p.localNode.Enclave,
+		Zone:         p.localNode.Zone,
 	}
 
 	// Try each seed node until we get a successful response
@@ -51,8 +109,7 @@ func (p *Protocol) Bootstrap(ctx context.Context, seedNodes []string) error {
 		// Add all discovered peers
 		for _, peer := range peers {
 			if peer.ID != p.localNode.ID {
-				p.addPeer(peer)
-				logging.Info("[%s] Discovered peer %s via bootstrap", p.localNode.ID, peer.ID)
+				p.addPeer(peer, "bootstrap from "+seed)
 			}
 		}
 
@@ -60,9 +117,8 @@ func (p *Protocol) Bootstrap(ctx context.Context, seedNodes []string) error {
 		return nil
 	}
 
-	// If no seed nodes responded, we might be the first node
-	logging.Info("[%s] No seed nodes available, starting as first node", p.localNode.ID)
-	return nil
+	logging.Warn("[%s] None of %d seed nodes responded", p.localNode.ID, len(seedNodes))
+	return ErrNoSeeds
 }
 
 func (p *Protocol) sendBootstrapRequest(ctx context.Context, seedAddr string, req *BootstrapRequest) ([]*Node, error) {
@@ -71,7 +127,11 @@ func (p *Protocol) sendBootstrapRequest(ctx context.Context, seedAddr string, re
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("http://%s/v1/bootstrap", seedAddr)
+	scheme := "http"
+	if p.tlsEnabled {
+		scheme = "https"
+	}
+	url := fmt.Sprintf("%s://%s/v1/bootstrap", scheme, seedAddr)
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -81,7 +141,13 @@ func (p *Protocol) sendBootstrapRequest(ctx context.Context, seedAddr string, re
 		httpReq.Header.Set("X-Repram-Signature", SignBody(p.clusterSecret, jsonData))
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := p.httpClient
+	if client == nil {
+		client = &http.Client{Timeout: peerRequestTimeout}
+		if p.tlsEnabled {
+			client.Transport = &http.Transport{TLSClientConfig: p.tlsConfig}
+		}
+	}
 	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
@@ -104,24 +170,41 @@ func (p *Protocol) sendBootstrapRequest(ctx context.Context, seedAddr string, re
 	return bootstrapResp.Peers, nil
 }
 
-// HandleBootstrap processes incoming bootstrap requests
-func (p *Protocol) HandleBootstrap(req *BootstrapRequest) *BootstrapResponse {
+// HandleBootstrap processes incoming bootstrap requests. Invalid requests,
+// and with dial-back enabled unreachable nodes, are refused with an error
+// wrapping ErrBadBootstrap.
+func (p *Protocol) HandleBootstrap(req *BootstrapRequest) (*BootstrapResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
 	// Create node info from request
 	enclave := req.Enclave
 	if enclave == "" {
 		enclave = "default"
 	}
 	newNode := &Node{
-		ID:       NodeID(req.NodeID),
-		Address:  req.Address,
-		Port:     req.GossipPort,
-		HTTPPort: req.HTTPPort,
-		Enclave:  enclave,
+		ID:           NodeID(req.NodeID),
+		Address:      req.Address,
+		Port:         req.GossipPort,
+		HTTPPort:     req.HTTPPort,
+		InternalPort: req.InternalPort,
+		Enclave:      enclave,
+		Zone:         req.Zone,
+	}
+
+	if p.dialBack {
+		addr := net.JoinHostPort(newNode.Address, strconv.Itoa(newNode.PeerPort()))
+		conn, err := net.DialTimeout("tcp", addr, dialBackTimeout)
+		if err != nil {
+			logging.Warn("[%s] Refusing bootstrap from %s: %s is unreachable", p.localNode.ID, req.NodeID, addr)
+			return nil, fmt.Errorf("%w: %s is unreachable", ErrBadBootstrap, addr)
+		}
+		conn.Close()
 	}
 
-	// Add the new node as a peer
-	p.addPeer(newNode)
-	logging.Info("[%s] Node %s joined via bootstrap", p.localNode.ID, req.NodeID)
+	// Add the new node as a peer. Callers reject excluded nodes before this;
+	// the filter check in addPeer is a backstop.
+	p.addPeer(newNode, "bootstrapped from this node")
 
 	// Notify all existing peers about the new node
 	// This ensures all nodes know about each other
@@ -135,7 +218,7 @@ func (p *Protocol) HandleBootstrap(req *BootstrapRequest) *BootstrapResponse {
 	return &BootstrapResponse{
 		Success: true,
 		Peers:   allPeers,
-	}
+	}, nil
 }
 
 // notifyPeersAboutNewNode sends a SYNC message to existing peers about a new node
@@ -148,7 +231,7 @@ func (p *Protocol) notifyPeersAboutNewNode(newNode *Node) {
 				Type:      MessageTypeSync,
 				From:      p.localNode.ID,
 				Timestamp: time.Now(),
-				MessageID: generateMessageID(),
+				MessageID: NewMessageID(),
 				NodeInfo:  newNode,
 			}
 
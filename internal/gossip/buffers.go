@@ -0,0 +1,85 @@
+package gossip
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer caps the capacity of buffers returned to the pools. A
+// buffer that grew past it to carry one large value is dropped rather than
+// pinning that memory for the life of the process.
+const maxPooledBuffer = 1 << 20
+
+// encodeBuffer is a pooled buffer with a JSON encoder bound to it, so
+// neither is reallocated per message.
+type encodeBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var encodePool = sync.Pool{
+	New: func() any {
+		b := &encodeBuffer{}
+		b.enc = json.NewEncoder(&b.Buffer)
+		return b
+	},
+}
+
+var readPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// encodeMessage encodes v as JSON into a pooled buffer. The caller must
+// release the buffer with putEncodeBuffer once the bytes are no longer
+// referenced.
+func encodeMessage(v any) (*encodeBuffer, error) {
+	b := encodePool.Get().(*encodeBuffer)
+	b.Reset()
+	if err := b.enc.Encode(v); err != nil {
+		putEncodeBuffer(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+func putEncodeBuffer(b *encodeBuffer) {
+	if b.Cap() <= maxPooledBuffer {
+		encodePool.Put(b)
+	}
+}
+
+// pooledBody is a request body backed by a pooled buffer. The HTTP client
+// may still be writing the body after Do returns, so the buffer goes back to
+// the pool only when the client closes it.
+type pooledBody struct {
+	*bytes.Reader
+	buf  *encodeBuffer
+	once sync.Once
+}
+
+func (p *pooledBody) Close() error {
+	p.once.Do(func() { putEncodeBuffer(p.buf) })
+	return nil
+}
+
+// ReadBody reads r into a pooled buffer. Call ReleaseBody when done with the
+// returned bytes; they must not be retained after that. json.Unmarshal
+// copies everything it decodes, so a body may be released once unmarshaled.
+func ReadBody(r io.Reader) (*bytes.Buffer, error) {
+	buf := readPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if _, err := buf.ReadFrom(r); err != nil {
+		ReleaseBody(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ReleaseBody returns a buffer from ReadBody to the pool.
+func ReleaseBody(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		readPool.Put(buf)
+	}
+}
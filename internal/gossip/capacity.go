@@ -0,0 +1,82 @@
+package gossip
+
+// MinHeadroom is the free fraction of its storage below which a peer counts
+// as nearly full. Nearly full peers stop receiving replicated writes, which
+// they would otherwise reject and leave short of quorum.
+const MinHeadroom = 0.05
+
+// Capacity is a node's storage usage, advertised in its PONG and SYNC
+// messages.
+type Capacity struct {
+	MaxBytes  int64 `json:"max_bytes"` // 0 means unlimited
+	UsedBytes int64 `json:"used_bytes"`
+	Items     int   `json:"items"`
+}
+
+// Headroom returns the free fraction of the node's storage, from 0 to 1.
+// Unlimited storage has a headroom of 1.
+func (c Capacity) Headroom() float64 {
+	if c.MaxBytes <= 0 {
+		return 1
+	}
+	free := float64(c.MaxBytes-c.UsedBytes) / float64(c.MaxBytes)
+	return max(free, 0)
+}
+
+// NearlyFull reports whether the headroom is below MinHeadroom.
+func (c Capacity) NearlyFull() bool {
+	return c.Headroom() < MinHeadroom
+}
+
+// SetCapacityFunc sets how this node reads its own storage usage for its
+// PONG and SYNC messages. Without one, no capacity is advertised.
+func (p *Protocol) SetCapacityFunc(fn func() Capacity) {
+	p.capacityFunc = fn
+}
+
+// selfInfo returns this node's info for a PONG or SYNC, with its current
+// capacity.
+func (p *Protocol) selfInfo() *Node {
+	if p.capacityFunc == nil {
+		return p.localNode
+	}
+	info := *p.localNode
+	capacity := p.capacityFunc()
+	info.Capacity = &capacity
+	return &info
+}
+
+// recordCapacity keeps the capacity a peer advertised about itself.
+// Capacity relayed about a third node is ignored: it is only as fresh as
+// the relay's last contact. Callers must hold peersMutex.
+func (p *Protocol) recordCapacity(msg *Message) {
+	if msg.NodeInfo == nil || msg.NodeInfo.ID != msg.From || msg.NodeInfo.Capacity == nil {
+		return
+	}
+	if _, ok := p.peers[msg.From]; ok {
+		p.capacities[msg.From] = *msg.NodeInfo.Capacity
+	}
+}
+
+// PeerCapacity returns the capacity id last advertised, if any.
+func (p *Protocol) PeerCapacity(id NodeID) (Capacity, bool) {
+	p.peersMutex.RLock()
+	defer p.peersMutex.RUnlock()
+	c, ok := p.capacities[id]
+	return c, ok
+}
+
+// withHeadroom drops nearly full peers. Peers that haven't advertised a
+// capacity are kept.
+func (p *Protocol) withHeadroom(peers []*Node) []*Node {
+	p.peersMutex.RLock()
+	defer p.peersMutex.RUnlock()
+	kept := make([]*Node, 0, len(peers))
+	for _, peer := range peers {
+		if c, ok := p.capacities[peer.ID]; ok && c.NearlyFull() {
+			continue
+		}
+		kept = append(kept, peer)
+	}
+	return kept
+}
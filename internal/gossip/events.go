@@ -0,0 +1,97 @@
+package gossip
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"repram/internal/logging"
+)
+
+// eventLogSize is how many membership events MembershipEvents remembers.
+const eventLogSize = 512
+
+// Membership event types reported by MembershipEvents.
+const (
+	EventJoin          = "join"           // a node this node hadn't seen before
+	EventRejoin        = "rejoin"         // a node returning after being evicted
+	EventEvict         = "evict"          // a node dropped as unreachable
+	EventAddressChange = "address_change" // a known node now reachable somewhere else
+)
+
+// MembershipEvent is one change to this node's peer table.
+type MembershipEvent struct {
+	Type    string    `json:"type"`
+	Node    NodeID    `json:"node"`
+	Address string    `json:"address"` // host:port the node's peer endpoints are on
+	Enclave string    `json:"enclave"`
+	Reason  string    `json:"reason,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// eventLog is a ring buffer of the most recent membership events, so an
+// operator can reconstruct what the cluster did during an incident after
+// the fact, without debug logging.
+type eventLog struct {
+	mu     sync.Mutex
+	events []MembershipEvent
+	next   int
+}
+
+// record adds an event for node and logs it.
+func (l *eventLog) record(local NodeID, typ string, node *Node, reason string) {
+	ev := MembershipEvent{
+		Type:    typ,
+		Node:    node.ID,
+		Address: peerAddress(node),
+		Enclave: node.Enclave,
+		Reason:  reason,
+		At:      time.Now(),
+	}
+	logging.Info("[%s] Membership %s: %s at %s (enclave: %s): %s", local, typ, node.ID, ev.Address, ev.Enclave, reason)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) < eventLogSize {
+		l.events = append(l.events, ev)
+	} else {
+		l.events[l.next] = ev
+	}
+	l.next = (l.next + 1) % eventLogSize
+}
+
+// evicted reports whether the latest logged event for id is an eviction.
+// A node whose eviction has aged out of the log rejoins as a plain join.
+func (l *eventLog) evicted(id NodeID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 1; i <= len(l.events); i++ {
+		ev := l.events[(l.next-i+len(l.events))%len(l.events)]
+		if ev.Node == id {
+			return ev.Type == EventEvict
+		}
+	}
+	return false
+}
+
+// recent returns the logged events, newest first.
+func (l *eventLog) recent() []MembershipEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]MembershipEvent, 0, len(l.events))
+	for i := 1; i <= len(l.events); i++ {
+		out = append(out, l.events[(l.next-i+len(l.events))%len(l.events)])
+	}
+	return out
+}
+
+// MembershipEvents returns this node's last 512 peer joins, rejoins,
+// evictions and address changes, newest first.
+func (p *Protocol) MembershipEvents() []MembershipEvent {
+	return p.events.recent()
+}
+
+func peerAddress(n *Node) string {
+	return net.JoinHostPort(n.Address, strconv.Itoa(n.PeerPort()))
+}
@@ -3,8 +3,9 @@ package gossip
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -14,24 +15,42 @@ import (
 
 // SimpleMessage is the HTTP wire format for gossip messages.
 type SimpleMessage struct {
-	Type      string          `json:"type"`
-	From      string          `json:"from"`
-	To        string          `json:"to,omitempty"`
-	Key       string          `json:"key,omitempty"`
-	Data      []byte          `json:"data,omitempty"`
-	TTL       int32           `json:"ttl,omitempty"`
-	Timestamp int64           `json:"timestamp"`
-	MessageID string          `json:"message_id"`
-	NodeInfo  *SimpleNodeInfo `json:"node_info,omitempty"`
+	Type        string             `json:"type"`
+	From        string             `json:"from"`
+	To          string             `json:"to,omitempty"`
+	Key         string             `json:"key,omitempty"`
+	Data        []byte             `json:"data,omitempty"`
+	Hash        string             `json:"hash,omitempty"`
+	TTL         int32              `json:"ttl,omitempty"`
+	Replication int                `json:"replication,omitempty"`
+	Reason      string             `json:"reason,omitempty"`
+	Resend      bool               `json:"resend,omitempty"`
+	Origin      string             `json:"origin,omitempty"`
+	WrittenAt   int64              `json:"written_at,omitempty"` // Unix milliseconds
+	Timestamp   int64              `json:"timestamp"`
+	MessageID   string             `json:"message_id"`
+	NodeInfo    *SimpleNodeInfo    `json:"node_info,omitempty"`
+	Updates     []SimplePeerUpdate `json:"updates,omitempty"`
 }
 
 // SimpleNodeInfo is the wire format for node information in gossip messages.
 type SimpleNodeInfo struct {
-	ID       string `json:"id"`
-	Address  string `json:"address"`
-	Port     int    `json:"port"`
-	HTTPPort int    `json:"http_port"`
-	Enclave  string `json:"enclave,omitempty"` // Empty treated as "default" for backwards compat
+	ID           string    `json:"id"`
+	Address      string    `json:"address"`
+	Port         int       `json:"port"`
+	HTTPPort     int       `json:"http_port"`
+	InternalPort int       `json:"internal_port,omitempty"`
+	Enclave      string    `json:"enclave,omitempty"` // Empty treated as "default" for backwards compat
+	Zone         string    `json:"zone,omitempty"`
+	Capacity     *Capacity `json:"capacity,omitempty"`
+}
+
+// WrittenAtTime returns WrittenAt as a time, zero if it wasn't sent.
+func (m *SimpleMessage) WrittenAtTime() time.Time {
+	if m.WrittenAt == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(m.WrittenAt)
 }
 
 // HTTPTransport implements gossip communication over HTTP
@@ -39,22 +58,70 @@ type HTTPTransport struct {
 	localNode      *Node
 	messageHandler func(*Message) error
 	client         *http.Client
+	roundTripper   *peerRoundTripper
+	urgentClient   *http.Client // urgent messages, on their own connections
+	urgentRT       *peerRoundTripper
+	retryPolicy    RetryPolicy
+	retryMetrics   *retryMetrics // nil in tests (skip metrics)
 	clusterSecret  string
+	scheme         string // "http", or "https" once EnableTLS is called
 	mu             sync.RWMutex
 }
 
 // NewHTTPTransport creates a new HTTP-based transport.
 // If clusterSecret is non-empty, all outgoing messages are HMAC-signed.
+//
+// Urgent messages (see MessageType.Urgent) use a separate connection pool,
+// so a PING or ACK never waits for a connection held by a large PUT.
 func NewHTTPTransport(localNode *Node, clusterSecret string) *HTTPTransport {
+	rt := newPeerRoundTripper()
+	urgentRT := newPeerRoundTripper()
 	return &HTTPTransport{
 		localNode:     localNode,
 		clusterSecret: clusterSecret,
+		scheme:        "http",
+		roundTripper:  rt,
 		client: &http.Client{
-			Timeout: 5 * time.Second,
+			Timeout:   peerRequestTimeout,
+			Transport: rt,
 		},
+		urgentRT: urgentRT,
+		urgentClient: &http.Client{
+			Timeout:   peerRequestTimeout,
+			Transport: urgentRT,
+		},
+		retryPolicy: DefaultRetryPolicy,
 	}
 }
 
+// Client returns the transport's HTTP client, so other peer traffic (such
+// as bootstrap requests) can share its connection pool.
+func (t *HTTPTransport) Client() *http.Client {
+	return t.client
+}
+
+// EnableMetrics counts connection reuse, retries and dead letters for
+// Prometheus. Call before Start.
+func (t *HTTPTransport) EnableMetrics() {
+	t.roundTripper.metrics = newConnMetrics()
+	t.urgentRT.metrics = t.roundTripper.metrics
+	t.retryMetrics = newRetryMetrics()
+}
+
+// SetRetryPolicy changes how failed sends of idempotent messages are
+// retried. Call before Start.
+func (t *HTTPTransport) SetRetryPolicy(policy RetryPolicy) {
+	t.retryPolicy = policy
+}
+
+// EnableTLS switches outgoing gossip to HTTPS. Peers must serve their HTTP
+// port with TLS as well. A nil config verifies peers against system roots.
+func (t *HTTPTransport) EnableTLS(config *tls.Config) {
+	t.scheme = "https"
+	t.roundTripper.setTLSConfig(config)
+	t.urgentRT.setTLSConfig(config)
+}
+
 // Start initializes the transport (no-op for HTTP as we use the main HTTP server)
 func (t *HTTPTransport) Start(ctx context.Context) error {
 	logging.Info("[HTTPTransport] Started for node %s (HTTP port: %d)", t.localNode.ID, t.localNode.HTTPPort)
@@ -70,55 +137,94 @@ func (t *HTTPTransport) Stop() error {
 func (t *HTTPTransport) Send(ctx context.Context, node *Node, msg *Message) error {
 	// Convert to SimpleMessage for HTTP transport
 	simpleMsg := &SimpleMessage{
-		Type:      string(msg.Type),
-		From:      string(msg.From),
-		To:        string(msg.To),
-		Key:       msg.Key,
-		Data:      msg.Data,
-		TTL:       int32(msg.TTL),
-		Timestamp: msg.Timestamp.Unix(),
-		MessageID: msg.MessageID,
+		Type:        string(msg.Type),
+		From:        string(msg.From),
+		To:          string(msg.To),
+		Key:         msg.Key,
+		Data:        msg.Data,
+		Hash:        msg.Hash,
+		TTL:         int32(msg.TTL),
+		Replication: msg.Replication,
+		Reason:      msg.Reason,
+		Resend:      msg.Resend,
+		Origin:      string(msg.Origin),
+		Timestamp:   msg.Timestamp.Unix(),
+		MessageID:   msg.MessageID,
+		Updates:     wireUpdates(msg.Updates),
+	}
+	if !msg.WrittenAt.IsZero() {
+		simpleMsg.WrittenAt = msg.WrittenAt.UnixMilli()
 	}
 	
 	// Include NodeInfo if present
 	if msg.NodeInfo != nil {
 		simpleMsg.NodeInfo = &SimpleNodeInfo{
-			ID:       string(msg.NodeInfo.ID),
-			Address:  msg.NodeInfo.Address,
-			Port:     msg.NodeInfo.Port,
-			HTTPPort: msg.NodeInfo.HTTPPort,
-			Enclave:  msg.NodeInfo.Enclave,
+			ID:           string(msg.NodeInfo.ID),
+			Address:      msg.NodeInfo.Address,
+			Port:         msg.NodeInfo.Port,
+			HTTPPort:     msg.NodeInfo.HTTPPort,
+			InternalPort: msg.NodeInfo.InternalPort,
+			Enclave:      msg.NodeInfo.Enclave,
+			Zone:         msg.NodeInfo.Zone,
+			Capacity:     msg.NodeInfo.Capacity,
 		}
 	}
-	
+
+	return t.sendWithRetry(ctx, msg, func() error {
+		if !msg.Expires.IsZero() {
+			now := time.Now()
+			ttl, live := msg.sendTTL(now)
+			if !live {
+				return errExpiredBeforeSend
+			}
+			simpleMsg.TTL = int32(ttl)
+			simpleMsg.Timestamp = now.Unix()
+		}
+		return t.post(ctx, node, msg.Type, simpleMsg)
+	})
+}
+
+// post makes one attempt at delivering simpleMsg to node. The message is
+// encoded afresh each time: the pooled body of a failed attempt may still
+// be in use by the HTTP client.
+func (t *HTTPTransport) post(ctx context.Context, node *Node, msgType MessageType, simpleMsg *SimpleMessage) error {
 	// Send to the HTTP gossip endpoint
-	url := fmt.Sprintf("http://%s:%d/v1/gossip/message", node.Address, node.HTTPPort)
+	url := fmt.Sprintf("%s://%s:%d/v1/gossip/message", t.scheme, node.Address, node.PeerPort())
 	
-	jsonData, err := json.Marshal(simpleMsg)
+	buf, err := encodeMessage(simpleMsg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
-	
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	body := &pooledBody{Reader: bytes.NewReader(buf.Bytes()), buf: buf}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
+		body.Close()
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.ContentLength = int64(buf.Len())
 	req.Header.Set("Content-Type", "application/json")
 	if t.clusterSecret != "" {
-		req.Header.Set("X-Repram-Signature", SignBody(t.clusterSecret, jsonData))
+		req.Header.Set("X-Repram-Signature", SignBody(t.clusterSecret, buf.Bytes()))
 	}
 
-	resp, err := t.client.Do(req)
+	client := t.client
+	if msgType.Urgent() {
+		client = t.urgentClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send message to %s: %w", url, err)
 	}
 	defer resp.Body.Close()
+	// Drain the (small) reply so the connection goes back to the idle pool
+	defer io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
 	
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("message rejected by %s with status: %d", node.ID, resp.StatusCode)
+		return &statusError{peer: node.ID, code: resp.StatusCode}
 	}
 	
-	logging.Debug("[HTTPTransport] Sent %s message to %s at %s", msg.Type, node.ID, url)
+	logging.Debug("[HTTPTransport] Sent %s message to %s at %s", msgType, node.ID, url)
 	return nil
 }
 
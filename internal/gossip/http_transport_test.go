@@ -0,0 +1,275 @@
+package gossip
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPTransportSendsOverTLS(t *testing.T) {
+	received := make(chan SimpleMessage, 1)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg SimpleMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	defer srv.Close()
+
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	peer := &Node{ID: "peer", Address: host, HTTPPort: port}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	transport := NewHTTPTransport(&Node{ID: "local"}, "")
+	transport.EnableTLS(&tls.Config{RootCAs: pool})
+
+	msg := &Message{Type: MessageTypePing, From: "local", Timestamp: time.Now(), MessageID: "tls-1"}
+	if err := transport.Send(context.Background(), peer, msg); err != nil {
+		t.Fatalf("Send over TLS: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if got.MessageID != "tls-1" {
+			t.Fatalf("MessageID = %q, want tls-1", got.MessageID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestHTTPTransportPlainRejectedByTLSPeer(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer srv.Close()
+
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	peer := &Node{ID: "peer", Address: host, HTTPPort: port}
+
+	transport := NewHTTPTransport(&Node{ID: "local"}, "")
+	msg := &Message{Type: MessageTypePing, From: "local", Timestamp: time.Now(), MessageID: "plain-1"}
+	if err := transport.Send(context.Background(), peer, msg); err == nil {
+		t.Fatal("plain HTTP send to a TLS peer should fail")
+	}
+}
+
+// Pooled buffers are reused across sends; each signature must still cover
+// exactly the body that went out with it
+func TestHTTPTransportSignsPooledBodies(t *testing.T) {
+	const secret = "s3cret"
+	bad := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ReadBody(r.Body)
+		defer ReleaseBody(body)
+		if !VerifyBody(secret, body.Bytes(), r.Header.Get("X-Repram-Signature")) {
+			bad <- r.Header.Get("X-Repram-Signature")
+		}
+	}))
+	defer srv.Close()
+
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	peer := &Node{ID: "peer", Address: host, HTTPPort: port}
+	transport := NewHTTPTransport(&Node{ID: "local"}, secret)
+
+	for i := 0; i < 5; i++ {
+		msg := &Message{Type: MessageTypePut, From: "local", Key: "k" + strconv.Itoa(i),
+			Data: make([]byte, 100*i), TTL: 60, Timestamp: time.Now(), MessageID: strconv.Itoa(i)}
+		if err := transport.Send(context.Background(), peer, msg); err != nil {
+			t.Fatalf("Send %d: %v", i, err)
+		}
+	}
+	if len(bad) > 0 {
+		t.Fatalf("%d pooled bodies failed signature verification", len(bad))
+	}
+}
+
+func benchmarkMessage() *SimpleMessage {
+	return &SimpleMessage{Type: string(MessageTypePut), From: "node-1", Key: "bench",
+		Data: make([]byte, 4096), TTL: 300, Timestamp: time.Now().Unix(), MessageID: "bench-1"}
+}
+
+func BenchmarkMarshalMessage(b *testing.B) {
+	msg := benchmarkMessage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeMessagePooled(b *testing.B) {
+	msg := benchmarkMessage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := encodeMessage(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		putEncodeBuffer(buf)
+	}
+}
+
+func TestHTTPTransportReusesConnections(t *testing.T) {
+	var dials atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true}`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	peer := &Node{ID: "peer", Address: host, HTTPPort: port}
+	transport := NewHTTPTransport(&Node{ID: "local"}, "")
+
+	for i := 0; i < 5; i++ {
+		msg := &Message{Type: MessageTypePing, From: "local", Timestamp: time.Now(), MessageID: strconv.Itoa(i)}
+		if err := transport.Send(context.Background(), peer, msg); err != nil {
+			t.Fatalf("Send %d: %v", i, err)
+		}
+	}
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("opened %d connections for 5 sequential sends, want 1", n)
+	}
+}
+
+func TestHTTPTransportSendsToInternalPort(t *testing.T) {
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+	}))
+	defer srv.Close()
+
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	// Nothing listens on HTTPPort 1; gossip must go to the internal port
+	peer := &Node{ID: "peer", Address: host, HTTPPort: 1, InternalPort: port}
+	transport := NewHTTPTransport(&Node{ID: "local"}, "")
+
+	msg := &Message{Type: MessageTypePing, From: "local", Timestamp: time.Now(), MessageID: "internal-1"}
+	if err := transport.Send(context.Background(), peer, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if path := <-received; path != "/v1/gossip/message" {
+		t.Fatalf("path = %q, want /v1/gossip/message", path)
+	}
+}
+
+func TestHTTPTransportRetriesIdempotentSends(t *testing.T) {
+	var calls atomic.Int32
+	failures := int32(2)
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+		}
+	}))
+	defer srv.Close()
+
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	peer := &Node{ID: "peer", Address: host, HTTPPort: port}
+	transport := NewHTTPTransport(&Node{ID: "local"}, "")
+	transport.SetRetryPolicy(RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	send := func(typ MessageType) error {
+		calls.Store(0)
+		return transport.Send(context.Background(), peer, &Message{Type: typ, From: "local", Timestamp: time.Now(), MessageID: "retry"})
+	}
+
+	if err := send(MessageTypePut); err != nil {
+		t.Fatalf("PUT failing twice with 503 was not retried: %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("PUT took %d attempts, want 3", n)
+	}
+
+	if err := send(MessageTypePing); err == nil {
+		t.Error("PING was retried")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("PING took %d attempts, want 1", n)
+	}
+
+	failures = 3
+	if err := send(MessageTypeAck); err == nil {
+		t.Error("ACK succeeded after every attempt failed")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("ACK took %d attempts, want 3", n)
+	}
+
+	// A peer that refuses the message will refuse it again
+	status = http.StatusBadRequest
+	if err := send(MessageTypePut); err == nil {
+		t.Error("PUT rejected with 400 reported success")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("PUT rejected with 400 took %d attempts, want 1", n)
+	}
+}
+
+func TestHTTPTransportSendsRemainingTTL(t *testing.T) {
+	received := make(chan SimpleMessage, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg SimpleMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	defer srv.Close()
+
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	peer := &Node{ID: "peer", Address: host, HTTPPort: port}
+	transport := NewHTTPTransport(&Node{ID: "local"}, "")
+
+	// Written ten minutes ago with an hour to live: 50 minutes are left
+	written := time.Now().Add(-10 * time.Minute)
+	msg := &Message{Type: MessageTypePut, From: "local", Key: "k", Data: []byte("v"), TTL: 3600,
+		Timestamp: written, MessageID: "late", Expires: written.Add(time.Hour)}
+	if err := transport.Send(context.Background(), peer, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := <-received
+	if got.TTL != 3000 {
+		t.Errorf("TTL sent = %d, want 3000", got.TTL)
+	}
+	if age := time.Now().Unix() - got.Timestamp; age > 1 {
+		t.Errorf("timestamp sent is %ds old, want the send time", age)
+	}
+
+	msg.Expires = time.Now().Add(-time.Second)
+	if err := transport.Send(context.Background(), peer, msg); err == nil {
+		t.Error("PUT of an expired value was sent")
+	}
+}
+
+func TestRetryBackoffIsJitteredAndCapped(t *testing.T) {
+	policy := RetryPolicy{Attempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n := 1; n <= 8; n++ {
+		full := min(policy.BaseDelay<<(n-1), policy.MaxDelay)
+		for i := 0; i < 20; i++ {
+			if d := policy.backoff(n); d < full/2 || d > full {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", n, d, full/2, full)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package gossip
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// rttWeight is how much a new round trip moves a peer's smoothed RTT, as
+// TCP smooths its SRTT. One slow PONG doesn't make a near peer look far.
+const rttWeight = 0.125
+
+// notePingSent records when a PING went out to id, for the PONG that answers
+// it. Only the latest PING is timed: a PONG to an earlier one that arrives
+// late is measured against the later send and reads short, once.
+func (p *Protocol) notePingSent(id NodeID) {
+	p.peersMutex.Lock()
+	defer p.peersMutex.Unlock()
+	p.pingsSent[id] = time.Now()
+}
+
+// recordRTT folds the round trip from this node's last PING to id into its
+// smoothed RTT. PONGs to PINGs this node didn't send, such as indirect
+// probes it relayed, aren't timed. Callers must hold peersMutex.
+func (p *Protocol) recordRTT(id NodeID) {
+	sent, ok := p.pingsSent[id]
+	if !ok {
+		return
+	}
+	delete(p.pingsSent, id)
+	if _, known := p.peers[id]; !known {
+		return
+	}
+	rtt := time.Since(sent)
+	if prev, ok := p.rtts[id]; ok {
+		rtt = prev + time.Duration(rttWeight*float64(rtt-prev))
+	}
+	p.rtts[id] = rtt
+	if p.metrics != nil {
+		p.metrics.peerRTT.WithLabelValues(string(id)).Set(rtt.Seconds())
+	}
+}
+
+// PeerRTT returns the smoothed PING/PONG round trip to id, if one has been
+// measured.
+func (p *Protocol) PeerRTT(id NodeID) (time.Duration, bool) {
+	p.peersMutex.RLock()
+	defer p.peersMutex.RUnlock()
+	rtt, ok := p.rtts[id]
+	return rtt, ok
+}
+
+// selectNearby picks n of peers, excluding skipID: the nearest half by
+// measured RTT, and the rest at random. Gossip forwarded only to near
+// peers would stay in one region of a spread enclave, so half the fanout
+// still goes anywhere. Peers without a measured RTT are only picked at
+// random.
+func (p *Protocol) selectNearby(peers []*Node, n int, skipID NodeID) []*Node {
+	candidates := selectRandomPeers(peers, len(peers), skipID)
+	if len(candidates) <= n {
+		return candidates
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	p.peersMutex.RLock()
+	rtts := make(map[NodeID]time.Duration, len(candidates))
+	for _, peer := range candidates {
+		if rtt, ok := p.rtts[peer.ID]; ok {
+			rtts[peer.ID] = rtt
+		}
+	}
+	p.peersMutex.RUnlock()
+
+	// Measured peers first, nearest first; the shuffle above breaks ties
+	// and orders the rest.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, aok := rtts[candidates[i].ID]
+		b, bok := rtts[candidates[j].ID]
+		if aok != bok {
+			return aok
+		}
+		return aok && a < b
+	})
+	near := min((n+1)/2, len(rtts))
+	rest := candidates[near:]
+	rand.Shuffle(len(rest), func(i, j int) {
+		rest[i], rest[j] = rest[j], rest[i]
+	})
+	return candidates[:n]
+}
@@ -0,0 +1,90 @@
+package gossip
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Connection pool sizing for peer traffic. Gossip talks to a fixed, small
+// set of hosts, so the idle pool is sized per peer rather than globally:
+// net/http's default of 2 idle connections per host forces a fresh dial (and
+// TLS handshake) for most concurrent sends during a broadcast.
+const (
+	maxIdleConnsPerPeer = 16
+	maxConnsPerPeer     = 64 // caps concurrent sends to one slow peer
+	maxIdleConns        = 1024
+	idleConnTimeout     = 90 * time.Second
+	peerDialTimeout     = 3 * time.Second
+	peerKeepAlive       = 30 * time.Second
+	peerRequestTimeout  = 5 * time.Second
+)
+
+type connMetrics struct {
+	conns *prometheus.CounterVec
+}
+
+var (
+	sharedConnMetrics     *connMetrics
+	sharedConnMetricsOnce sync.Once
+)
+
+func newConnMetrics() *connMetrics {
+	sharedConnMetricsOnce.Do(func() {
+		sharedConnMetrics = &connMetrics{
+			conns: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "repram_gossip_connections_total",
+				Help: "Connections used for peer requests, by whether an idle connection was reused (reused=\"true\") or a new one dialed",
+			}, []string{"reused"}),
+		}
+		prometheus.MustRegister(sharedConnMetrics.conns)
+	})
+	return sharedConnMetrics
+}
+
+// peerRoundTripper is the keep-alive transport shared by all peer traffic
+// from this node. It counts connection reuse when metrics are enabled.
+type peerRoundTripper struct {
+	base    *http.Transport
+	metrics *connMetrics // nil in tests (skip metrics)
+}
+
+func newPeerRoundTripper() *peerRoundTripper {
+	dialer := &net.Dialer{Timeout: peerDialTimeout, KeepAlive: peerKeepAlive}
+	return &peerRoundTripper{
+		base: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        maxIdleConns,
+			MaxIdleConnsPerHost: maxIdleConnsPerPeer,
+			MaxConnsPerHost:     maxConnsPerPeer,
+			IdleConnTimeout:     idleConnTimeout,
+			TLSHandshakeTimeout: peerDialTimeout,
+		},
+	}
+}
+
+func (rt *peerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if m := rt.metrics; m != nil {
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if info.Reused {
+					m.conns.WithLabelValues("true").Inc()
+				} else {
+					m.conns.WithLabelValues("false").Inc()
+				}
+			},
+		}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	}
+	return rt.base.RoundTrip(req)
+}
+
+func (rt *peerRoundTripper) setTLSConfig(config *tls.Config) {
+	rt.base.TLSClientConfig = config
+}
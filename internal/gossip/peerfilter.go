@@ -0,0 +1,84 @@
+package gossip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// PeerList matches nodes by node ID or by IP address. Entries that parse as
+// an IP address or CIDR range match by address; anything else is a node ID.
+type PeerList struct {
+	ids  map[NodeID]bool
+	nets []*net.IPNet
+}
+
+// ParsePeerList parses node IDs, IP addresses, and CIDR ranges.
+func ParsePeerList(entries []string) (PeerList, error) {
+	var l PeerList
+	for _, entry := range entries {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			l.nets = append(l.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return PeerList{}, fmt.Errorf("%q is not a valid CIDR range", entry)
+			}
+			l.nets = append(l.nets, ipNet)
+			continue
+		}
+		if l.ids == nil {
+			l.ids = make(map[NodeID]bool)
+		}
+		l.ids[NodeID(entry)] = true
+	}
+	return l, nil
+}
+
+// Empty reports whether the list has no entries.
+func (l PeerList) Empty() bool {
+	return len(l.ids) == 0 && len(l.nets) == 0
+}
+
+// Match reports whether id or ip is on the list. ip may be nil when the
+// node's address is a hostname; it then matches by ID only.
+func (l PeerList) Match(id NodeID, ip net.IP) bool {
+	if l.ids[id] {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, n := range l.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerFilter decides which nodes may take part in gossip with this node.
+// A node is admitted unless it matches Block, and, when Allow is not empty,
+// only if it matches Allow. A nil filter admits every node.
+type PeerFilter struct {
+	Allow PeerList
+	Block PeerList
+}
+
+// Admits reports whether the node with the given ID and address may gossip
+// with this node.
+func (f *PeerFilter) Admits(id NodeID, ip net.IP) bool {
+	if f == nil {
+		return true
+	}
+	if f.Block.Match(id, ip) {
+		return false
+	}
+	return f.Allow.Empty() || f.Allow.Match(id, ip)
+}
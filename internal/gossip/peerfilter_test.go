@@ -0,0 +1,88 @@
+package gossip
+
+import (
+	"net"
+	"testing"
+)
+
+func mustPeerList(t *testing.T, entries ...string) PeerList {
+	t.Helper()
+	l, err := ParsePeerList(entries)
+	if err != nil {
+		t.Fatalf("ParsePeerList(%q): %v", entries, err)
+	}
+	return l
+}
+
+func TestPeerFilterBlocklist(t *testing.T) {
+	f := &PeerFilter{Block: mustPeerList(t, "rogue", "203.0.113.0/24", "2001:db8::1")}
+
+	tests := []struct {
+		id   NodeID
+		ip   string
+		want bool
+	}{
+		{"node-1", "10.0.0.1", true},
+		{"rogue", "10.0.0.1", false},
+		{"node-1", "203.0.113.9", false},
+		{"node-1", "2001:db8::1", false},
+		{"node-1", "", true}, // hostname address: ID only
+	}
+	for _, tt := range tests {
+		if got := f.Admits(tt.id, net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Admits(%s, %q) = %v, want %v", tt.id, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestPeerFilterAllowlist(t *testing.T) {
+	f := &PeerFilter{
+		Allow: mustPeerList(t, "trusted", "10.0.0.0/8"),
+		Block: mustPeerList(t, "10.6.6.6"),
+	}
+
+	tests := []struct {
+		id   NodeID
+		ip   string
+		want bool
+	}{
+		{"trusted", "198.51.100.1", true},
+		{"anyone", "10.1.2.3", true},
+		{"anyone", "198.51.100.1", false},
+		{"anyone", "", false},
+		{"trusted", "10.6.6.6", false}, // blocklist wins
+	}
+	for _, tt := range tests {
+		if got := f.Admits(tt.id, net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Admits(%s, %q) = %v, want %v", tt.id, tt.ip, got, tt.want)
+		}
+	}
+
+	var none *PeerFilter
+	if !none.Admits("anyone", nil) {
+		t.Error("nil filter should admit every node")
+	}
+}
+
+func TestParsePeerListRejectsBadCIDR(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "not-an-ip/8"} {
+		if _, err := ParsePeerList([]string{entry}); err == nil {
+			t.Errorf("ParsePeerList(%q) should fail", entry)
+		}
+	}
+}
+
+func TestAddPeerRespectsFilter(t *testing.T) {
+	p := NewProtocol(&Node{ID: "local"}, 3, "")
+	p.SetPeerFilter(&PeerFilter{Block: mustPeerList(t, "rogue")})
+
+	if p.addPeer(&Node{ID: "rogue", Address: "10.0.0.2"}, "") {
+		t.Error("addPeer should refuse a blocked node")
+	}
+	if !p.addPeer(&Node{ID: "friend", Address: "10.0.0.3"}, "") {
+		t.Error("addPeer should accept an admitted node")
+	}
+	if peers := p.GetPeers(); len(peers) != 1 || peers[0].ID != "friend" {
+		t.Errorf("peers = %v, want only friend", peers)
+	}
+}
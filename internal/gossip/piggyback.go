@@ -0,0 +1,182 @@
+package gossip
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxPiggyback caps the peer updates one PING or PONG carries, so health
+// checks stay small however fast the topology changes.
+const maxPiggyback = 8
+
+// PeerUpdate is a change to the peer table: a node joined, or was evicted
+// after failed pings. Updates ride on PING and PONG messages (as in SWIM),
+// so topology changes spread with health checks instead of waiting for
+// the next SYNC round.
+type PeerUpdate struct {
+	Node    *Node     `json:"node"`
+	Evicted bool      `json:"evicted,omitempty"`
+	At      time.Time `json:"at"` // when the change was first seen, by whichever node saw it
+}
+
+// SimplePeerUpdate is the wire format for a PeerUpdate.
+type SimplePeerUpdate struct {
+	Node    SimpleNodeInfo `json:"node"`
+	Evicted bool           `json:"evicted,omitempty"`
+	At      int64          `json:"at"` // unix seconds
+}
+
+// peerDeltas holds recent peer table changes until each has been
+// piggybacked on enough messages to have reached the whole cluster.
+type peerDeltas struct {
+	mu      sync.Mutex
+	pending map[NodeID]*pendingUpdate // latest change per node
+}
+
+type pendingUpdate struct {
+	PeerUpdate
+	sends int
+}
+
+// queue records u for piggybacking, replacing any older change to the
+// same node.
+func (d *peerDeltas) queue(u PeerUpdate) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending == nil {
+		d.pending = make(map[NodeID]*pendingUpdate)
+	}
+	d.pending[u.Node.ID] = &pendingUpdate{PeerUpdate: u}
+}
+
+// take returns up to maxPiggyback updates for one outgoing message, least
+// sent first. An update is dropped once it has gone out about 3·log₂(n)
+// times for a cluster of n peers, by which point an epidemic has almost
+// surely reached every node.
+func (d *peerDeltas) take(peers int) []PeerUpdate {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending) == 0 {
+		return nil
+	}
+
+	queued := make([]*pendingUpdate, 0, len(d.pending))
+	for _, u := range d.pending {
+		queued = append(queued, u)
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		if queued[i].sends != queued[j].sends {
+			return queued[i].sends < queued[j].sends
+		}
+		return queued[i].Node.ID < queued[j].Node.ID
+	})
+
+	limit := 3 * bits.Len(uint(peers+1))
+	updates := make([]PeerUpdate, 0, min(len(queued), maxPiggyback))
+	for _, u := range queued[:min(len(queued), maxPiggyback)] {
+		updates = append(updates, u.PeerUpdate)
+		if u.sends++; u.sends >= limit {
+			delete(d.pending, u.Node.ID)
+		}
+	}
+	return updates
+}
+
+// piggyback returns the peer updates to attach to a PING or PONG.
+func (p *Protocol) piggyback() []PeerUpdate {
+	p.peersMutex.RLock()
+	peers := len(p.peers)
+	p.peersMutex.RUnlock()
+	return p.deltas.take(peers)
+}
+
+// applyUpdates merges peer updates piggybacked on a message from a peer.
+// A joined node is added as if learned by SYNC. An eviction is only
+// followed when this node's own pings to the peer have started failing
+// too: a peer one node can't reach may be fine from here. Applied updates
+// are passed on in turn.
+func (p *Protocol) applyUpdates(from NodeID, updates []PeerUpdate) {
+	for _, u := range updates {
+		if u.Node == nil || u.Node.ID == p.localNode.ID || u.Node.ID == from {
+			continue
+		}
+		if u.Node.Enclave == "" {
+			u.Node.Enclave = "default"
+		}
+		u.Node.Capacity = nil // only a node's own word on its capacity counts
+
+		p.peersMutex.RLock()
+		_, known := p.peers[u.Node.ID]
+		failing := p.peerFailures[u.Node.ID] > 0
+		p.peersMutex.RUnlock()
+
+		switch {
+		case u.Evicted && known && failing:
+			p.removePeer(u.Node.ID, "unreachable from here and from "+string(from))
+			if p.metrics != nil {
+				p.metrics.peerEvictions.Inc()
+			}
+		case !u.Evicted && !known:
+			if !p.addPeer(u.Node, "PING/PONG from "+string(from)) {
+				continue
+			}
+		default:
+			continue
+		}
+		// addPeer queued the join as first seen now; keep the original time
+		p.deltas.queue(u)
+		if p.metrics != nil {
+			p.metrics.updateAge.Observe(max(0, time.Since(u.At).Seconds()))
+		}
+	}
+}
+
+// wireUpdates converts peer updates to their wire format.
+func wireUpdates(updates []PeerUpdate) []SimplePeerUpdate {
+	if len(updates) == 0 {
+		return nil
+	}
+	wire := make([]SimplePeerUpdate, len(updates))
+	for i, u := range updates {
+		wire[i] = SimplePeerUpdate{
+			Node: SimpleNodeInfo{
+				ID:           string(u.Node.ID),
+				Address:      u.Node.Address,
+				Port:         u.Node.Port,
+				HTTPPort:     u.Node.HTTPPort,
+				InternalPort: u.Node.InternalPort,
+				Enclave:      u.Node.Enclave,
+				Zone:         u.Node.Zone,
+			},
+			Evicted: u.Evicted,
+			At:      u.At.Unix(),
+		}
+	}
+	return wire
+}
+
+// PeerUpdates converts peer updates received on the wire.
+func PeerUpdates(wire []SimplePeerUpdate) []PeerUpdate {
+	if len(wire) == 0 {
+		return nil
+	}
+	updates := make([]PeerUpdate, len(wire))
+	for i, u := range wire {
+		updates[i] = PeerUpdate{
+			Node: &Node{
+				ID:           NodeID(u.Node.ID),
+				Address:      u.Node.Address,
+				Port:         u.Node.Port,
+				HTTPPort:     u.Node.HTTPPort,
+				InternalPort: u.Node.InternalPort,
+				Enclave:      u.Node.Enclave,
+				Zone:         u.Node.Zone,
+			},
+			Evicted: u.Evicted,
+			At:      time.Unix(u.At, 0),
+		}
+	}
+	return updates
+}
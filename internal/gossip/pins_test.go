@@ -0,0 +1,65 @@
+package gossip
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParsePeerPinsRejectsMalformedPins(t *testing.T) {
+	for _, entry := range []string{
+		"sha256/not-base64!",
+		"sha256/" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"abcd",
+		strings.Repeat("zz", 32),
+	} {
+		if _, err := ParsePeerPins([]string{entry}); err == nil {
+			t.Errorf("ParsePeerPins(%q) accepted a malformed pin", entry)
+		}
+	}
+	if pins, err := ParsePeerPins(nil); pins != nil || err != nil {
+		t.Fatalf("ParsePeerPins(nil) = (%v, %v), want (nil, nil)", pins, err)
+	}
+}
+
+func TestPeerPinsTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	cert := srv.Certificate()
+	spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	fingerprint := sha256.Sum256(cert.Raw)
+	colons := strings.ToUpper(hex.EncodeToString(fingerprint[:]))
+	for i := len(colons) - 2; i > 0; i -= 2 {
+		colons = colons[:i] + ":" + colons[i:]
+	}
+	other := sha256.Sum256([]byte("some other key"))
+
+	tests := []struct {
+		name string
+		pin  string
+		ok   bool
+	}{
+		{"SPKI pin", "sha256/" + base64.StdEncoding.EncodeToString(spki[:]), true},
+		{"certificate fingerprint", hex.EncodeToString(fingerprint[:]), true},
+		{"openssl-style fingerprint", colons, true},
+		{"unrelated pin", "sha256/" + base64.StdEncoding.EncodeToString(other[:]), false},
+	}
+	for _, tt := range tests {
+		pins, err := ParsePeerPins([]string{tt.pin})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: pins.TLSConfig()}}
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: request error = %v, want success %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package gossip
+
+import "context"
+
+// maxBulkSends caps the bulk messages (PUT replication, merges and other
+// non-urgent traffic) this node has in flight at once, across every
+// broadcast. Urgent messages don't count against it.
+const maxBulkSends = 32
+
+// Urgent reports whether messages of this type jump the bulk send queue:
+// health checks (PING, PING-REQ, PONG) and write confirmations (ACK, NACK). Stuck
+// behind large PUTs during a burst, a late PONG gets a healthy peer evicted
+// and a late ACK fails a write that had reached quorum.
+func (t MessageType) Urgent() bool {
+	switch t {
+	case MessageTypePing, MessageTypePingReq, MessageTypePong, MessageTypeAck, MessageTypeNack:
+		return true
+	}
+	return false
+}
+
+// transmit hands msg to the transport. Bulk messages first wait for one of
+// the maxBulkSends slots; urgent ones go straight out.
+func (p *Protocol) transmit(ctx context.Context, node *Node, msg *Message) error {
+	if !msg.Type.Urgent() && p.bulkSends != nil {
+		select {
+		case p.bulkSends <- struct{}{}:
+			defer func() { <-p.bulkSends }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return p.transport.Send(ctx, node, msg)
+}
@@ -0,0 +1,142 @@
+package gossip
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"repram/internal/logging"
+)
+
+// IndirectProbes is how many other peers are asked to ping a peer that has
+// failed MaxPingFailures direct pings, before it is evicted. As in SWIM, a
+// peer is only evicted if none of them can reach it either, so a degraded
+// link between two nodes doesn't cost the cluster a healthy peer.
+const IndirectProbes = 3
+
+// defaultProbeTimeout is how long a node waits for the peers it asked to
+// probe on its behalf. It covers their ping and its retries.
+const defaultProbeTimeout = 10 * time.Second
+
+// probeIndirect asks up to IndirectProbes other peers to ping target and
+// reports whether any of them reached it. With no other peers to ask, the
+// target counts as unreachable.
+func (p *Protocol) probeIndirect(ctx context.Context, target *Node) bool {
+	helpers := selectRandomPeers(p.getPeers(), IndirectProbes, target.ID)
+	if len(helpers) == 0 {
+		return false
+	}
+
+	req := &Message{
+		Type:      MessageTypePingReq,
+		From:      p.localNode.ID,
+		Timestamp: time.Now(),
+		MessageID: NewMessageID(),
+		NodeInfo:  target,
+	}
+	replies := p.AwaitReplies(req.MessageID)
+	defer replies.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, p.probeTimeout)
+	defer cancel()
+
+	asked := make(map[NodeID]bool, len(helpers))
+	failed := make(chan NodeID, len(helpers))
+	for _, helper := range helpers {
+		asked[helper.ID] = true
+		go func(helper *Node) {
+			if err := p.transmit(ctx, helper, req); err != nil {
+				failed <- helper.ID
+			}
+		}(helper)
+	}
+
+	for len(asked) > 0 {
+		select {
+		case reply := <-replies.C:
+			if !asked[reply.From] {
+				continue
+			}
+			if reply.Type == MessageTypeAck {
+				logging.Info("[%s] Peer %s reachable via %s; not evicting", p.localNode.ID, target.ID, reply.From)
+				return true
+			}
+			delete(asked, reply.From)
+		case id := <-failed:
+			delete(asked, id)
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return false
+}
+
+// probeAll runs probeIndirect for each peer at once and returns the ones
+// nobody could reach.
+func (p *Protocol) probeAll(ctx context.Context, peers []*Node) []*Node {
+	reached := make([]bool, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer *Node) {
+			defer wg.Done()
+			reached[i] = p.probeIndirect(ctx, peer)
+		}(i, peer)
+	}
+	wg.Wait()
+
+	var unreachable []*Node
+	for i, peer := range peers {
+		if !reached[i] {
+			unreachable = append(unreachable, peer)
+		}
+	}
+	return unreachable
+}
+
+// handlePingReq pings the peer named in a PING-REQ on the sender's behalf
+// and answers with an ACK if the ping got through, or a NACK if it didn't.
+// Only peers already in the table are probed, so a PING-REQ can't point
+// this node at an arbitrary address. The probe runs in the background, so
+// the requester's send returns at once.
+func (p *Protocol) handlePingReq(msg *Message) error {
+	if msg.NodeInfo == nil {
+		return nil
+	}
+	p.peersMutex.RLock()
+	requester := p.peers[msg.From]
+	target := p.peers[msg.NodeInfo.ID]
+	p.peersMutex.RUnlock()
+	if requester == nil {
+		return nil
+	}
+
+	go func() {
+		reply := &Message{
+			Type:      MessageTypeAck,
+			From:      p.localNode.ID,
+			To:        msg.From,
+			Timestamp: time.Now(),
+			MessageID: msg.MessageID,
+		}
+		if target == nil {
+			reply.Type, reply.Reason = MessageTypeNack, "unknown_peer"
+		} else {
+			ping := &Message{
+				Type:      MessageTypePing,
+				From:      p.localNode.ID,
+				To:        target.ID,
+				Timestamp: time.Now(),
+				MessageID: NewMessageID(),
+			}
+			if err := p.transmit(context.Background(), target, ping); err != nil {
+				logging.Debug("[%s] Indirect ping of %s for %s failed: %v", p.localNode.ID, target.ID, msg.From, err)
+				reply.Type, reply.Reason = MessageTypeNack, "unreachable"
+			}
+		}
+		if err := p.transmit(context.Background(), requester, reply); err != nil {
+			logging.Debug("[%s] Failed to answer PING-REQ from %s: %v", p.localNode.ID, msg.From, err)
+		}
+	}()
+	return nil
+}
@@ -2,9 +2,16 @@ package gossip
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"net"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,6 +27,8 @@ type clusterMetrics struct {
 	peerEvictions  prometheus.Counter
 	peerJoins      prometheus.Counter
 	pingFailures   prometheus.Counter
+	updateAge      prometheus.Histogram
+	peerRTT        *prometheus.GaugeVec
 }
 
 var (
@@ -46,8 +55,17 @@ func newClusterMetrics() *clusterMetrics {
 				Name: "repram_ping_failures_total",
 				Help: "Total number of failed ping attempts to peers",
 			}),
+			updateAge: prometheus.NewHistogram(prometheus.HistogramOpts{
+				Name:    "repram_topology_update_age_seconds",
+				Help:    "Time from a peer joining or being evicted to this node applying the change from a PING or PONG",
+				Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+			}),
+			peerRTT: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "repram_peer_rtt_seconds",
+				Help: "Smoothed PING/PONG round-trip time to each peer",
+			}, []string{"peer"}),
 		}
-		prometheus.MustRegister(sharedMetrics.peersActive, sharedMetrics.peerEvictions, sharedMetrics.peerJoins, sharedMetrics.pingFailures)
+		prometheus.MustRegister(sharedMetrics.peersActive, sharedMetrics.peerEvictions, sharedMetrics.peerJoins, sharedMetrics.pingFailures, sharedMetrics.updateAge, sharedMetrics.peerRTT)
 	})
 	return sharedMetrics
 }
@@ -55,28 +73,70 @@ func newClusterMetrics() *clusterMetrics {
 type NodeID string
 
 type Node struct {
-	ID       NodeID `json:"id"`
-	Address  string `json:"address"`
-	Port     int    `json:"port"`      // Gossip port
-	HTTPPort int    `json:"http_port"` // HTTP API port
-	Enclave  string `json:"enclave"`   // Replication boundary (default: "default")
+	ID           NodeID    `json:"id"`
+	Address      string    `json:"address"`
+	Port         int       `json:"port"`                    // Gossip port
+	HTTPPort     int       `json:"http_port"`               // HTTP API port
+	InternalPort int       `json:"internal_port,omitempty"` // Gossip and bootstrap endpoints, if not on HTTPPort
+	Enclave      string    `json:"enclave"`                 // Replication boundary (default: "default")
+	Zone         string    `json:"zone,omitempty"`          // Failure domain, such as a region or rack; "" = none declared
+	Capacity     *Capacity `json:"capacity,omitempty"`      // Storage usage, in PONG and direct SYNC only
 }
 
 func (n *Node) String() string {
 	return fmt.Sprintf("%s@%s:%d", n.ID, n.Address, n.Port)
 }
 
+// PeerPort returns the port n serves its gossip and bootstrap endpoints on:
+// its internal port if it has one, otherwise its HTTP port.
+func (n *Node) PeerPort() int {
+	if n.InternalPort != 0 {
+		return n.InternalPort
+	}
+	return n.HTTPPort
+}
+
 type Message struct {
-	Type      MessageType `json:"type"`
-	From      NodeID      `json:"from"`
-	To        NodeID      `json:"to,omitempty"`
-	Key       string      `json:"key,omitempty"`
-	Data      []byte      `json:"data,omitempty"`
-	TTL       int         `json:"ttl,omitempty"`
-	Timestamp time.Time   `json:"timestamp"`
-	MessageID string      `json:"message_id"`
+	Type        MessageType `json:"type"`
+	From        NodeID      `json:"from"`
+	To          NodeID      `json:"to,omitempty"`
+	Key         string      `json:"key,omitempty"`
+	Data        []byte      `json:"data,omitempty"`
+	Hash        string      `json:"hash,omitempty"` // ContentHash(Data), set on PUT
+	TTL         int         `json:"ttl,omitempty"`
+	Replication int         `json:"replication,omitempty"` // nodes a PUT is stored on, set per write; 0 = every peer
+	Reason      string      `json:"reason,omitempty"`      // why a NACKed PUT wasn't stored
+	Resend      bool        `json:"resend,omitempty"`      // a PUT sent again to replicas that hadn't answered
+	Origin      NodeID      `json:"origin,omitempty"`      // node a client wrote a PUT's value to; "" = unknown
+	WrittenAt   time.Time   `json:"written_at,omitempty"`  // when the client wrote it there
+	Timestamp   time.Time   `json:"timestamp"`
+	MessageID   string      `json:"message_id"`
 	// Node information for JOIN messages
-	NodeInfo  *Node       `json:"node_info,omitempty"`
+	NodeInfo *Node `json:"node_info,omitempty"`
+	// Peer table changes piggybacked on PING and PONG
+	Updates []PeerUpdate `json:"updates,omitempty"`
+	// Expires is when a PUT's value expires on the sending node. When set,
+	// each send carries the TTL left at that moment instead of TTL, with
+	// the send time as Timestamp, so a PUT held up in retries or resent
+	// later doesn't outlive the value. Not sent on the wire.
+	Expires time.Time `json:"-"`
+}
+
+// sendTTL returns the TTL to send m with at now, rounded to the nearest
+// second, and false if its value has already expired.
+func (m *Message) sendTTL(now time.Time) (int, bool) {
+	if m.Expires.IsZero() {
+		return m.TTL, true
+	}
+	left := m.Expires.Sub(now).Round(time.Second)
+	return int(left / time.Second), left >= time.Second
+}
+
+// ContentHash returns the hex SHA-256 of data, as carried in PUT messages so
+// receivers can recognise a value they already hold.
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 type MessageType string
@@ -88,10 +148,17 @@ const (
 	MessageTypePong       MessageType = "PONG"
 	MessageTypeSync       MessageType = "SYNC"
 	MessageTypeAck        MessageType = "ACK"
+	MessageTypeRate       MessageType = "RATE" // rate limit counter digest
+	MessageTypeAnnounce   MessageType = "ANNOUNCE" // signed node announcement (public networks)
+	MessageTypeMerge      MessageType = "MERGE"    // asks a peer from another partition to push its data
+	MessageTypeNack       MessageType = "NACK"     // a replicated PUT the receiver could not store
+	MessageTypePingReq    MessageType = "PING-REQ" // asks a peer to ping NodeInfo for the sender; answered by ACK or NACK
+	MessageTypeTombstone  MessageType = "TOMBSTONE" // a key taken down by an operator; peers drop it
 )
 
 // MaxPingFailures is the number of consecutive failed health checks before
-// a peer is evicted from the peer list. With a 30-second ping interval this
+// a peer is evicted from the peer list, unless one of the peers asked to
+// probe it (see IndirectProbes) can reach it. With a 30-second ping interval this
 // means a peer is removed after ~90 seconds of unreachability. Evicted peers
 // rejoin automatically if they come back online and re-bootstrap.
 const MaxPingFailures = 3
@@ -101,6 +168,11 @@ const MaxPingFailures = 3
 // threshold, every enclave peer receives each message directly.
 const FanoutThreshold = 10
 
+// DefaultSendConcurrency is how many peers a broadcast sends to at once.
+// Sends run in parallel so one slow peer doesn't hold up the rest, and the
+// cap keeps a large peer set from opening a connection to every peer at once.
+const DefaultSendConcurrency = 8
+
 // seenMessageTTL is how long a message ID stays in the dedup cache.
 // Should be longer than the maximum expected propagation time.
 const seenMessageTTL = 60 * time.Second
@@ -124,6 +196,26 @@ type Protocol struct {
 	metrics           *clusterMetrics // nil in tests (skip metrics)
 	seenMessages      map[string]time.Time // message ID → expiry time (dedup cache)
 	seenMutex         sync.Mutex
+	tlsEnabled        bool        // bootstrap seeds are contacted over HTTPS
+	tlsConfig         *tls.Config // client config for HTTPS bootstrap (nil = system roots)
+	httpClient        *http.Client // shared with the transport; nil builds one per bootstrap request
+	peerFilter        *PeerFilter // nil admits every node
+	sendConcurrency   int          // peers sent to in parallel by a broadcast
+	bulkSends         chan struct{} // slots for bulk messages in flight; see transmit
+	replies           replyWaiters  // requests awaiting an ACK or NACK; see AwaitReplies
+	deltas            peerDeltas    // recent peer joins and evictions, piggybacked on PING and PONG
+	events            eventLog      // recent membership changes, for MembershipEvents
+	probeTimeout      time.Duration // how long an indirect probe waits for answers
+	registry          *Registry    // signed announcements; nil outside public networks
+	reputation        *Reputation  // peer behaviour; nil outside public networks
+	capacities        map[NodeID]Capacity // storage usage peers advertised about themselves
+	capacityFunc      func() Capacity     // this node's storage usage; nil advertises none
+	pingsSent         map[NodeID]time.Time     // when each peer's unanswered PING went out
+	rtts              map[NodeID]time.Duration // smoothed PING/PONG round trip per peer
+	dialBack          bool                // connect to joining nodes before adding them
+	healthLoopBeat    atomic.Int64 // unix nanos of the last health check loop iteration
+	syncLoopBeat      atomic.Int64 // unix nanos of the last topology sync loop iteration
+	hadPeers          atomic.Bool  // a peer has been added since start; see Isolated
 }
 
 type Transport interface {
@@ -139,11 +231,17 @@ func NewProtocol(localNode *Node, replicationFactor int, clusterSecret string) *
 		localNode:         localNode,
 		peers:             make(map[NodeID]*Node),
 		peerFailures:      make(map[NodeID]int),
+		capacities:        make(map[NodeID]Capacity),
+		pingsSent:         make(map[NodeID]time.Time),
+		rtts:              make(map[NodeID]time.Duration),
 		replicationFactor: replicationFactor,
 		quorumSize:        quorumSize,
 		clusterSecret:     clusterSecret,
 		stopChan:          make(chan struct{}),
 		seenMessages:      make(map[string]time.Time),
+		sendConcurrency:   DefaultSendConcurrency,
+		bulkSends:         make(chan struct{}, maxBulkSends),
+		probeTimeout:      defaultProbeTimeout,
 	}
 }
 
@@ -154,6 +252,46 @@ func (p *Protocol) EnableMetrics() {
 	p.metrics = newClusterMetrics()
 }
 
+// EnableTLS makes bootstrap requests use HTTPS. Call before Bootstrap.
+func (p *Protocol) EnableTLS(config *tls.Config) {
+	p.tlsEnabled = true
+	p.tlsConfig = config
+}
+
+// SetSendConcurrency sets how many peers a broadcast sends to at once.
+// Values below 1 mean DefaultSendConcurrency. Call before Start.
+func (p *Protocol) SetSendConcurrency(n int) {
+	if n < 1 {
+		n = DefaultSendConcurrency
+	}
+	p.sendConcurrency = n
+}
+
+// EnablePublicMode turns on the signed node registry and peer reputation
+// for a public network. key signs this node's announcements. Replication
+// then prefers well-behaved peers and skips demoted ones. Call before Start.
+func (p *Protocol) EnablePublicMode(key ed25519.PrivateKey) {
+	p.registry = NewRegistry(key)
+	p.reputation = NewReputation()
+}
+
+// Registry returns the node registry, or nil outside public mode.
+func (p *Protocol) Registry() *Registry {
+	return p.registry
+}
+
+// Reputation returns the peer reputation tracker, or nil outside public
+// mode. A nil tracker is safe to use.
+func (p *Protocol) Reputation() *Reputation {
+	return p.reputation
+}
+
+// SetHTTPClient makes bootstrap requests use client, normally the
+// transport's, so they share its connection pool. Call before Bootstrap.
+func (p *Protocol) SetHTTPClient(client *http.Client) {
+	p.httpClient = client
+}
+
 func (p *Protocol) SetTransport(transport Transport) {
 	p.transport = transport
 	// Always use protocol's handleMessage which will delegate to app handler
@@ -172,6 +310,10 @@ func (p *Protocol) Start(ctx context.Context) error {
 	// Create ticker before goroutine to avoid data race with Stop()
 	p.topologyTicker = time.NewTicker(30 * time.Second)
 
+	now := time.Now().UnixNano()
+	p.healthLoopBeat.Store(now)
+	p.syncLoopBeat.Store(now)
+
 	// Start periodic health checks
 	go p.startHealthCheck(ctx)
 
@@ -195,28 +337,65 @@ func (p *Protocol) Stop() error {
 	return nil
 }
 
-func (p *Protocol) addPeer(node *Node) {
+// SetPeerFilter keeps nodes the filter does not admit out of the peer list,
+// however they are learned. Must be called before Start.
+func (p *Protocol) SetPeerFilter(filter *PeerFilter) {
+	p.peerFilter = filter
+}
+
+// addPeer adds or replaces a peer, recording how it was learned of in the
+// membership event log. Returns false if the peer filter excludes it.
+func (p *Protocol) addPeer(node *Node, reason string) bool {
+	if !p.peerFilter.Admits(node.ID, net.ParseIP(node.Address)) {
+		logging.Debug("[%s] Ignoring peer %s: excluded by peer filter", p.localNode.ID, node)
+		return false
+	}
+
 	p.peersMutex.Lock()
+	existing, known := p.peers[node.ID]
 	p.peers[node.ID] = node
 	delete(p.peerFailures, node.ID) // reset failure counter on (re-)add
 	peerCount := len(p.peers)
 	p.peersMutex.Unlock()
 
+	switch {
+	case !known:
+		p.hadPeers.Store(true)
+		p.deltas.queue(PeerUpdate{Node: node, At: time.Now()})
+		typ := EventJoin
+		if p.events.evicted(node.ID) {
+			typ = EventRejoin
+		}
+		p.events.record(p.localNode.ID, typ, node, reason)
+	case peerAddress(existing) != peerAddress(node):
+		p.events.record(p.localNode.ID, EventAddressChange, node, "moved from "+peerAddress(existing)+", "+reason)
+	}
+
 	if p.metrics != nil {
 		p.metrics.peersActive.Set(float64(peerCount))
 		p.metrics.peerJoins.Inc()
 	}
+	return true
 }
 
-func (p *Protocol) removePeer(nodeID NodeID) {
+// removePeer evicts a peer, recording why in the membership event log.
+func (p *Protocol) removePeer(nodeID NodeID, reason string) {
 	p.peersMutex.Lock()
+	node, known := p.peers[nodeID]
 	delete(p.peers, nodeID)
 	delete(p.peerFailures, nodeID)
+	delete(p.capacities, nodeID)
+	delete(p.pingsSent, nodeID)
+	delete(p.rtts, nodeID)
 	peerCount := len(p.peers)
 	p.peersMutex.Unlock()
 
+	if known {
+		p.events.record(p.localNode.ID, EventEvict, node, reason)
+	}
 	if p.metrics != nil {
 		p.metrics.peersActive.Set(float64(peerCount))
+		p.metrics.peerRTT.DeleteLabelValues(string(nodeID))
 	}
 }
 
@@ -238,9 +417,21 @@ func (p *Protocol) handleMessage(msg *Message) error {
 		return p.handlePing(msg)
 	case MessageTypePong:
 		return p.handlePong(msg)
+	case MessageTypePingReq:
+		return p.handlePingReq(msg)
 	case MessageTypeSync:
 		return p.handleSync(msg)
-	case MessageTypePut, MessageTypeAck:
+	case MessageTypeAnnounce:
+		return p.handleAnnounce(msg)
+	case MessageTypeAck, MessageTypeNack:
+		if p.deliverReply(msg) {
+			return nil
+		}
+		if p.messageHandler != nil {
+			return p.messageHandler(msg)
+		}
+		return nil
+	case MessageTypePut, MessageTypeRate, MessageTypeMerge, MessageTypeTombstone:
 		// Application-level messages - pass to handler
 		if p.messageHandler != nil {
 			return p.messageHandler(msg)
@@ -261,16 +452,21 @@ func (p *Protocol) handlePing(msg *Message) error {
 		From:      p.localNode.ID,
 		To:        msg.From,
 		Timestamp: time.Now(),
-		MessageID: generateMessageID(),
-		NodeInfo:  p.localNode, // Include our identity and enclave membership
+		MessageID: NewMessageID(),
+		NodeInfo:  p.selfInfo(), // Include our identity, enclave membership and capacity
 	}
 
 	p.peersMutex.RLock()
 	peer := p.peers[msg.From]
 	p.peersMutex.RUnlock()
 
+	p.applyUpdates(msg.From, msg.Updates)
+	if peer != nil {
+		pong.Updates = p.piggyback()
+	}
+
 	if peer != nil {
-		return p.transport.Send(context.Background(), peer, pong)
+		return p.transmit(context.Background(), peer, pong)
 	}
 	return nil
 }
@@ -289,8 +485,12 @@ func (p *Protocol) handlePong(msg *Message) error {
 			existing.Enclave = msg.NodeInfo.Enclave
 			logging.Debug("[%s] Updated peer %s enclave to %s via PONG", p.localNode.ID, msg.NodeInfo.ID, msg.NodeInfo.Enclave)
 		}
+		p.recordCapacity(msg)
 	}
+	p.recordRTT(msg.From)
 	p.peersMutex.Unlock()
+
+	p.applyUpdates(msg.From, msg.Updates)
 	return nil
 }
 
@@ -316,18 +516,25 @@ func (p *Protocol) handleSync(msg *Message) error {
 		p.peersMutex.RUnlock()
 
 		if !exists {
-			p.addPeer(msg.NodeInfo)
-			logging.Info("[%s] Learned about new peer %s (enclave: %s) via SYNC from %s",
-				p.localNode.ID, msg.NodeInfo.ID, msg.NodeInfo.Enclave, msg.From)
+			if !p.addPeer(msg.NodeInfo, "SYNC from "+string(msg.From)) {
+				return nil
+			}
 		} else if existing.Enclave != msg.NodeInfo.Enclave {
 			// Update enclave if it changed (e.g., node upgraded and now reports enclave)
-			p.addPeer(msg.NodeInfo)
+			p.addPeer(msg.NodeInfo, "SYNC from "+string(msg.From))
 			logging.Info("[%s] Updated peer %s enclave: %s → %s (via SYNC from %s)",
 				p.localNode.ID, msg.NodeInfo.ID, existing.Enclave, msg.NodeInfo.Enclave, msg.From)
+		} else if existing.Zone != msg.NodeInfo.Zone {
+			p.addPeer(msg.NodeInfo, "SYNC from "+string(msg.From))
+			logging.Info("[%s] Updated peer %s zone: %q → %q (via SYNC from %s)",
+				p.localNode.ID, msg.NodeInfo.ID, existing.Zone, msg.NodeInfo.Zone, msg.From)
 		} else {
 			logging.Debug("[%s] Already know peer %s (SYNC from %s)",
 				p.localNode.ID, msg.NodeInfo.ID, msg.From)
 		}
+		p.peersMutex.Lock()
+		p.recordCapacity(msg)
+		p.peersMutex.Unlock()
 	} else {
 		logging.Debug("[%s] SYNC message from %s has no NodeInfo", p.localNode.ID, msg.From)
 	}
@@ -335,8 +542,10 @@ func (p *Protocol) handleSync(msg *Message) error {
 	// Respond with our peer list so the sender can discover peers
 	// it doesn't know about yet. Only respond to direct SYNC messages
 	// (where From == NodeInfo sender), not to propagated peer info,
-	// to prevent amplification loops.
-	if msg.NodeInfo != nil && msg.NodeInfo.ID == msg.From {
+	// to prevent amplification loops. Responses are addressed (To set);
+	// our own entry in a peer's response looks direct, and answering it
+	// would ping-pong peer lists between the two nodes indefinitely.
+	if msg.NodeInfo != nil && msg.NodeInfo.ID == msg.From && msg.To == "" {
 		p.respondWithPeerList(msg.From)
 	}
 
@@ -362,7 +571,7 @@ func (p *Protocol) respondWithPeerList(targetID NodeID) {
 	p.peersMutex.RUnlock()
 
 	// Send a SYNC for each peer we know about (including ourselves)
-	allNodes := append(peers, p.localNode)
+	allNodes := append(peers, p.selfInfo())
 	for _, node := range allNodes {
 		// Don't tell the target about itself
 		if node.ID == targetID {
@@ -372,13 +581,14 @@ func (p *Protocol) respondWithPeerList(targetID NodeID) {
 		syncMsg := &Message{
 			Type:      MessageTypeSync,
 			From:      p.localNode.ID,
+			To:        targetID,
 			Timestamp: time.Now(),
-			MessageID: generateMessageID(),
+			MessageID: NewMessageID(),
 			NodeInfo:  node,
 		}
 
 		ctx := context.Background()
-		if err := p.transport.Send(ctx, target, syncMsg); err != nil {
+		if err := p.transmit(ctx, target, syncMsg); err != nil {
 			logging.Debug("[%s] Failed to send peer info for %s to %s: %v",
 				p.localNode.ID, node.ID, targetID, err)
 		}
@@ -396,13 +606,14 @@ func (p *Protocol) startHealthCheck(ctx context.Context) {
 		case <-ticker.C:
 			p.pingPeers(ctx)
 			p.cleanupSeenMessages()
+			p.healthLoopBeat.Store(time.Now().UnixNano())
 		}
 	}
 }
 
 func (p *Protocol) pingPeers(ctx context.Context) {
 	peers := p.getPeers()
-	var evictions []NodeID
+	var evictions []*Node
 
 	for _, peer := range peers {
 		ping := &Message{
@@ -410,9 +621,13 @@ func (p *Protocol) pingPeers(ctx context.Context) {
 			From:      p.localNode.ID,
 			To:        peer.ID,
 			Timestamp: time.Now(),
-			MessageID: generateMessageID(),
+			MessageID: NewMessageID(),
+			Updates:   p.piggyback(),
 		}
-		if err := p.transport.Send(ctx, peer, ping); err != nil {
+		p.notePingSent(peer.ID)
+		err := p.transmit(ctx, peer, ping)
+		p.reputation.RecordPing(peer.ID, err == nil)
+		if err != nil {
 			p.peersMutex.Lock()
 			p.peerFailures[peer.ID]++
 			failures := p.peerFailures[peer.ID]
@@ -426,18 +641,17 @@ func (p *Protocol) pingPeers(ctx context.Context) {
 				p.localNode.ID, peer.ID, failures, MaxPingFailures, err)
 
 			if failures >= MaxPingFailures {
-				evictions = append(evictions, peer.ID)
+				evictions = append(evictions, peer)
 			}
 		}
 	}
 
-	for _, id := range evictions {
-		p.removePeer(id)
+	for _, peer := range p.probeAll(ctx, evictions) {
+		p.removePeer(peer.ID, fmt.Sprintf("%d consecutive ping failures and failed indirect probes", MaxPingFailures))
+		p.deltas.queue(PeerUpdate{Node: peer, Evicted: true, At: time.Now()})
 		if p.metrics != nil {
 			p.metrics.peerEvictions.Inc()
 		}
-		logging.Info("[%s] Evicted peer %s after %d consecutive ping failures",
-			p.localNode.ID, id, MaxPingFailures)
 	}
 }
 
@@ -445,9 +659,11 @@ func (p *Protocol) Send(ctx context.Context, node *Node, msg *Message) error {
 	if p.transport == nil {
 		return fmt.Errorf("transport not set")
 	}
-	return p.transport.Send(ctx, node, msg)
+	return p.transmit(ctx, node, msg)
 }
 
+// Broadcast sends msg to every known peer. A failed send doesn't stop the
+// others; the returned error joins the failures, one per peer.
 func (p *Protocol) Broadcast(ctx context.Context, msg *Message) error {
 	if p.transport == nil {
 		return fmt.Errorf("transport not set")
@@ -456,15 +672,34 @@ func (p *Protocol) Broadcast(ctx context.Context, msg *Message) error {
 	// Send to all known peers
 	peers := p.getPeers()
 	logging.Debug("[%s] Broadcasting %s message to %d peers", p.localNode.ID, msg.Type, len(peers))
-	for _, peer := range peers {
-		logging.Debug("[%s] Sending %s to peer %s", p.localNode.ID, msg.Type, peer.ID)
-		if err := p.transport.Send(ctx, peer, msg); err != nil {
-			logging.Warn("[%s] Failed to send to peer %s: %v", p.localNode.ID, peer.ID, err)
-			// Continue to other peers even if one fails
-		}
-	}
+	return p.sendAll(ctx, peers, msg)
+}
 
-	return nil
+// sendAll sends msg to each peer, up to sendConcurrency at a time, and waits
+// for every send to finish. The result joins the per-peer errors, each
+// naming its peer, or is nil if every send succeeded.
+func (p *Protocol) sendAll(ctx context.Context, peers []*Node, msg *Message) error {
+	limit := p.sendConcurrency
+	if limit < 1 {
+		limit = DefaultSendConcurrency
+	}
+	sem := make(chan struct{}, limit)
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, peer *Node) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			logging.Debug("[%s] Sending %s to peer %s", p.localNode.ID, msg.Type, peer.ID)
+			if err := p.transmit(ctx, peer, msg); err != nil {
+				errs[i] = fmt.Errorf("peer %s: %w", peer.ID, err)
+			}
+		}(i, peer)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
 // MarkSeen records a message ID in the dedup cache. Returns true if the
@@ -517,6 +752,13 @@ func (p *Protocol) evictSeenLocked() {
 	}
 }
 
+// SeenMessages returns how many message IDs the dedup cache holds.
+func (p *Protocol) SeenMessages() int {
+	p.seenMutex.Lock()
+	defer p.seenMutex.Unlock()
+	return len(p.seenMessages)
+}
+
 // cleanupSeenMessages removes expired entries from the dedup cache.
 func (p *Protocol) cleanupSeenMessages() {
 	p.seenMutex.Lock()
@@ -563,8 +805,9 @@ func selectRandomPeers(peers []*Node, n int, skipID NodeID) []*Node {
 
 // BroadcastToEnclave sends a message to peers in the same enclave.
 // For small enclaves (≤ FanoutThreshold peers), sends to all peers directly.
-// For larger enclaves, uses probabilistic fanout: sends to √N random peers,
-// which forward to their own √N subset. Deduplication prevents re-processing.
+// For larger enclaves, uses probabilistic fanout: sends to √N peers, half of
+// them the nearest, which forward to their own √N subset. Deduplication prevents re-processing.
+// Failed sends are joined into the returned error, as with Broadcast.
 func (p *Protocol) BroadcastToEnclave(ctx context.Context, msg *Message) error {
 	if p.transport == nil {
 		return fmt.Errorf("transport not set")
@@ -573,29 +816,45 @@ func (p *Protocol) BroadcastToEnclave(ctx context.Context, msg *Message) error {
 	// Mark as seen by the originator so we don't re-forward our own messages
 	p.MarkSeen(msg.MessageID)
 
-	peers := p.GetReplicationPeers()
+	peers := p.GetReplicationTargets()
 
 	if len(peers) <= FanoutThreshold {
 		// Small enclave: full broadcast (original behavior)
 		logging.Debug("[%s] Broadcasting %s to %d enclave peers (%s)", p.localNode.ID, msg.Type, len(peers), p.localNode.Enclave)
-		for _, peer := range peers {
-			if err := p.transport.Send(ctx, peer, msg); err != nil {
-				logging.Warn("[%s] Failed to send to enclave peer %s: %v", p.localNode.ID, peer.ID, err)
-			}
-		}
-	} else {
-		// Large enclave: probabilistic fanout
-		fanout := fanoutSize(len(peers))
-		targets := selectRandomPeers(peers, fanout, "")
-		logging.Debug("[%s] Fanout %s to %d/%d enclave peers (%s)", p.localNode.ID, msg.Type, len(targets), len(peers), p.localNode.Enclave)
-		for _, peer := range targets {
-			if err := p.transport.Send(ctx, peer, msg); err != nil {
-				logging.Warn("[%s] Failed to send to enclave peer %s: %v", p.localNode.ID, peer.ID, err)
-			}
-		}
+		return p.sendAll(ctx, peers, msg)
 	}
 
-	return nil
+	// Large enclave: probabilistic fanout
+	fanout := fanoutSize(len(peers))
+	targets := p.selectTargets(peers, fanout, "")
+	logging.Debug("[%s] Fanout %s to %d/%d enclave peers (%s)", p.localNode.ID, msg.Type, len(targets), len(peers), p.localNode.Enclave)
+	return p.sendAll(ctx, targets, msg)
+}
+
+// SendTo sends msg to the given peers, as a broadcast would. Failed sends
+// are joined into the returned error.
+func (p *Protocol) SendTo(ctx context.Context, peers []*Node, msg *Message) error {
+	if p.transport == nil {
+		return fmt.Errorf("transport not set")
+	}
+	p.MarkSeen(msg.MessageID)
+	return p.sendAll(ctx, peers, msg)
+}
+
+// RequestPeerList sends this node's info to peer as a direct SYNC. The peer
+// adds this node and answers with every peer it knows, so the two peer
+// tables are unioned.
+func (p *Protocol) RequestPeerList(ctx context.Context, peer *Node) error {
+	if p.transport == nil {
+		return fmt.Errorf("transport not set")
+	}
+	return p.transmit(ctx, peer, &Message{
+		Type:      MessageTypeSync,
+		From:      p.localNode.ID,
+		Timestamp: time.Now(),
+		MessageID: NewMessageID(),
+		NodeInfo:  p.selfInfo(),
+	})
 }
 
 // ForwardToEnclave is called by receiving nodes to continue probabilistic gossip.
@@ -603,22 +862,20 @@ func (p *Protocol) BroadcastToEnclave(ctx context.Context, msg *Message) error {
 // but only if the enclave is above the fanout threshold. For small enclaves,
 // the originator already sent to everyone, so no forwarding is needed.
 func (p *Protocol) ForwardToEnclave(ctx context.Context, msg *Message) {
-	peers := p.GetReplicationPeers()
+	peers := p.GetReplicationTargets()
 	if len(peers) <= FanoutThreshold {
 		return // originator already sent to all peers
 	}
 
 	fanout := fanoutSize(len(peers))
-	targets := selectRandomPeers(peers, fanout, msg.From)
+	targets := p.selectTargets(peers, fanout, msg.From)
 	if len(targets) == 0 {
 		return
 	}
 
 	logging.Debug("[%s] Forwarding %s (key: %s) to %d enclave peers", p.localNode.ID, msg.Type, msg.Key, len(targets))
-	for _, peer := range targets {
-		if err := p.transport.Send(ctx, peer, msg); err != nil {
-			logging.Warn("[%s] Failed to forward to enclave peer %s: %v", p.localNode.ID, peer.ID, err)
-		}
+	if err := p.sendAll(ctx, targets, msg); err != nil {
+		logging.Warn("[%s] Failed to forward %s to enclave peers: %v", p.localNode.ID, msg.Type, err)
 	}
 }
 
@@ -626,6 +883,45 @@ func (p *Protocol) GetPeers() []*Node {
 	return p.getPeers()
 }
 
+// GetReplicationTargets returns the enclave peers that writes are sent to:
+// all of them except nearly full peers. In public mode these are ranked
+// best first and also exclude demoted peers.
+func (p *Protocol) GetReplicationTargets() []*Node {
+	return p.reputation.Rank(p.withHeadroom(p.GetReplicationPeers()))
+}
+
+// PickReplicationTargets returns n of the replication targets, for a write
+// stored on fewer nodes than the whole enclave: the best-ranked in public
+// mode, otherwise the nearest half and the rest at random. Peers in zones
+// not yet holding a copy are picked over those that would double one up.
+func (p *Protocol) PickReplicationTargets(n int) []*Node {
+	peers := p.withHeadroom(p.GetReplicationPeers())
+	picked := p.selectTargets(peers, n, "")
+	if len(picked) < n {
+		return picked
+	}
+	return spreadZones(p.localNode.Zone, picked, p.selectTargets(peers, len(peers), ""), n)
+}
+
+// selectTargets picks n fanout targets, excluding skipID. With reputation
+// enabled it takes the best-ranked peers, shuffling first so that equally
+// ranked peers share the load; otherwise it favours near peers (see
+// selectNearby).
+func (p *Protocol) selectTargets(peers []*Node, n int, skipID NodeID) []*Node {
+	if p.reputation == nil {
+		return p.selectNearby(peers, n, skipID)
+	}
+	candidates := selectRandomPeers(peers, len(peers), skipID)
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	ranked := p.reputation.Rank(candidates)
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
 // GetReplicationPeers returns only peers in the same enclave as the local node.
 func (p *Protocol) GetReplicationPeers() []*Node {
 	p.peersMutex.RLock()
@@ -640,6 +936,18 @@ func (p *Protocol) GetReplicationPeers() []*Node {
 	return peers
 }
 
+// Isolated reports whether this node has lost every peer it had. A node
+// that has never had one, such as the first node of a cluster waiting for
+// the rest, isn't isolated.
+func (p *Protocol) Isolated() bool {
+	if !p.hadPeers.Load() {
+		return false
+	}
+	p.peersMutex.RLock()
+	defer p.peersMutex.RUnlock()
+	return len(p.peers) == 0
+}
+
 // PeerFailureCount returns the number of consecutive ping failures for a peer.
 func (p *Protocol) PeerFailureCount(id NodeID) int {
 	p.peersMutex.RLock()
@@ -647,6 +955,14 @@ func (p *Protocol) PeerFailureCount(id NodeID) int {
 	return p.peerFailures[id]
 }
 
+// LoopsAlive reports whether both background loops (health check and
+// topology sync) have completed an iteration within maxAge. A loop blocked
+// on a hung send stops updating its heartbeat and makes this return false.
+func (p *Protocol) LoopsAlive(maxAge time.Duration) bool {
+	cutoff := time.Now().Add(-maxAge).UnixNano()
+	return p.healthLoopBeat.Load() >= cutoff && p.syncLoopBeat.Load() >= cutoff
+}
+
 func (p *Protocol) SetMessageHandler(handler func(*Message) error) {
 	p.messageHandler = handler
 }
@@ -658,7 +974,10 @@ func (p *Protocol) HandleMessage(msg *Message) error {
 
 var messageCounter uint64
 
-func generateMessageID() string {
+// NewMessageID returns an ID unique within this process. The counter keeps
+// IDs distinct even when the clock's resolution is coarser than the rate
+// messages are created at.
+func NewMessageID() string {
 	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), atomic.AddUint64(&messageCounter, 1))
 }
 
@@ -668,7 +987,9 @@ func (p *Protocol) startTopologySync(ctx context.Context) {
 	for {
 		select {
 		case <-p.topologyTicker.C:
+			p.Announce(ctx)
 			p.performTopologySync(ctx)
+			p.syncLoopBeat.Store(time.Now().UnixNano())
 		case <-p.stopChan:
 			return
 		case <-ctx.Done():
@@ -696,8 +1017,8 @@ func (p *Protocol) performTopologySync(ctx context.Context) {
 		Type:      MessageTypeSync,
 		From:      p.localNode.ID,
 		Timestamp: time.Now(),
-		MessageID: generateMessageID(),
-		NodeInfo:  p.localNode, // Include our own node info
+		MessageID: NewMessageID(),
+		NodeInfo:  p.selfInfo(), // Include our own node info
 	}
 
 	// Broadcast to all known peers
@@ -2,8 +2,12 @@ package gossip
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -78,6 +82,7 @@ func newTestProtocol() (*Protocol, *mockTransport) {
 		Enclave:  "default",
 	}
 	p := NewProtocol(localNode, 3, "")
+	p.probeTimeout = 50 * time.Millisecond
 	mt := newMockTransport()
 	p.SetTransport(mt)
 	return p, mt
@@ -87,7 +92,7 @@ func TestPeerEvictionAfterConsecutiveFailures(t *testing.T) {
 	p, mt := newTestProtocol()
 
 	deadPeer := &Node{ID: "dead-peer", Address: "dead", Port: 9090, HTTPPort: 8080, Enclave: "default"}
-	p.addPeer(deadPeer)
+	p.addPeer(deadPeer, "")
 	mt.setFail("dead-peer", true)
 
 	// Verify peer exists
@@ -117,7 +122,7 @@ func TestPongResetsPingFailures(t *testing.T) {
 	p, mt := newTestProtocol()
 
 	flakyPeer := &Node{ID: "flaky", Address: "flaky", Port: 9090, HTTPPort: 8080, Enclave: "default"}
-	p.addPeer(flakyPeer)
+	p.addPeer(flakyPeer, "")
 	mt.setFail("flaky", true)
 
 	// Accumulate failures just under the threshold
@@ -157,7 +162,7 @@ func TestEvictedPeerRejoinsViaBootstrap(t *testing.T) {
 	p, mt := newTestProtocol()
 
 	peer := &Node{ID: "rejoiner", Address: "rejoiner", Port: 9090, HTTPPort: 8080, Enclave: "default"}
-	p.addPeer(peer)
+	p.addPeer(peer, "")
 	mt.setFail("rejoiner", true)
 
 	// Evict via ping failures
@@ -170,7 +175,7 @@ func TestEvictedPeerRejoinsViaBootstrap(t *testing.T) {
 
 	// Simulate peer coming back via addPeer (called during bootstrap)
 	mt.setFail("rejoiner", false)
-	p.addPeer(peer)
+	p.addPeer(peer, "")
 
 	if len(p.GetPeers()) != 1 {
 		t.Fatal("peer should be re-added after bootstrap")
@@ -184,7 +189,7 @@ func TestHealthyPeerNotEvicted(t *testing.T) {
 	p, _ := newTestProtocol()
 
 	healthyPeer := &Node{ID: "healthy", Address: "healthy", Port: 9090, HTTPPort: 8080, Enclave: "default"}
-	p.addPeer(healthyPeer)
+	p.addPeer(healthyPeer, "")
 
 	// Ping many times — all succeed
 	for i := 0; i < MaxPingFailures*3; i++ {
@@ -204,8 +209,8 @@ func TestMixedPeerEviction(t *testing.T) {
 
 	alive := &Node{ID: "alive", Address: "alive", Port: 9090, HTTPPort: 8080, Enclave: "default"}
 	dead := &Node{ID: "dead", Address: "dead", Port: 9090, HTTPPort: 8080, Enclave: "default"}
-	p.addPeer(alive)
-	p.addPeer(dead)
+	p.addPeer(alive, "")
+	p.addPeer(dead, "")
 	mt.setFail("dead", true)
 
 	for i := 0; i < MaxPingFailures; i++ {
@@ -250,8 +255,8 @@ func TestSyncPropagatesPeerList(t *testing.T) {
 
 	// B knows A and C
 	nodeA := &Node{ID: "node-a", Address: "a", Port: 9090, HTTPPort: 8080, Enclave: "default"}
-	protocolB.addPeer(nodeA)
-	protocolB.addPeer(nodeC)
+	protocolB.addPeer(nodeA, "")
+	protocolB.addPeer(nodeC, "")
 
 	// A sends a SYNC to B (introducing itself)
 	syncMsg := &Message{
@@ -300,7 +305,7 @@ func TestSyncDoesNotAmplifyPropagatedInfo(t *testing.T) {
 	protocolB.SetTransport(mtB)
 
 	nodeA := &Node{ID: "node-a", Address: "a", Port: 9090, HTTPPort: 8080, Enclave: "default"}
-	protocolB.addPeer(nodeA)
+	protocolB.addPeer(nodeA, "")
 
 	// A sends a SYNC about C (propagated info — From != NodeInfo.ID)
 	nodeC := &Node{ID: "node-c", Address: "c", Port: 9090, HTTPPort: 8080, Enclave: "default"}
@@ -331,6 +336,200 @@ func TestSyncDoesNotAmplifyPropagatedInfo(t *testing.T) {
 	}
 }
 
+func TestSyncDoesNotAnswerResponses(t *testing.T) {
+	// B's own entry in its response to A looks like a direct SYNC. A must
+	// not answer it, or the two would trade peer lists forever.
+	localA := &Node{ID: "node-a", Address: "a", Port: 9090, HTTPPort: 8080, Enclave: "default"}
+	protocolA := NewProtocol(localA, 3, "")
+	mtA := newMockTransport()
+	protocolA.SetTransport(mtA)
+
+	nodeB := &Node{ID: "node-b", Address: "b", Port: 9090, HTTPPort: 8080, Enclave: "default"}
+	protocolA.addPeer(nodeB, "")
+
+	response := &Message{
+		Type:      MessageTypeSync,
+		From:      "node-b",
+		To:        "node-a",
+		Timestamp: time.Now(),
+		MessageID: "sync-4",
+		NodeInfo:  nodeB,
+	}
+	if err := protocolA.handleSync(response); err != nil {
+		t.Fatalf("handleSync error: %v", err)
+	}
+	if sent := mtA.getSentMessages(); len(sent) != 0 {
+		t.Fatalf("A answered a SYNC response with %d messages", len(sent))
+	}
+}
+
+func TestPongAdvertisesCapacity(t *testing.T) {
+	p, mt := newTestProtocol()
+	p.SetCapacityFunc(func() Capacity { return Capacity{MaxBytes: 1000, UsedBytes: 400, Items: 7} })
+	p.addPeer(&Node{ID: "peer-1", Address: "p1", Port: 9090, HTTPPort: 8080, Enclave: "default"}, "")
+
+	if err := p.handlePing(&Message{Type: MessageTypePing, From: "peer-1", MessageID: "ping-1"}); err != nil {
+		t.Fatalf("handlePing error: %v", err)
+	}
+	sent := mt.getSentMessages()
+	if len(sent) != 1 || sent[0].Msg.NodeInfo.Capacity == nil {
+		t.Fatalf("expected a PONG carrying capacity, got %+v", sent)
+	}
+	if got := *sent[0].Msg.NodeInfo.Capacity; got != (Capacity{MaxBytes: 1000, UsedBytes: 400, Items: 7}) {
+		t.Errorf("PONG capacity = %+v", got)
+	}
+	if p.localNode.Capacity != nil {
+		t.Error("advertising capacity modified the local node")
+	}
+}
+
+func TestNearlyFullPeersSkippedForReplication(t *testing.T) {
+	p, _ := newTestProtocol()
+	for _, id := range []NodeID{"roomy", "full", "silent"} {
+		p.addPeer(&Node{ID: id, Address: string(id), Port: 9090, HTTPPort: 8080, Enclave: "default"}, "")
+	}
+	pong := func(id NodeID, used int64) *Message {
+		return &Message{
+			Type:      MessageTypePong,
+			From:      id,
+			MessageID: NewMessageID(),
+			NodeInfo:  &Node{ID: id, Enclave: "default", Capacity: &Capacity{MaxBytes: 1000, UsedBytes: used}},
+		}
+	}
+	p.handlePong(pong("roomy", 500))
+	p.handlePong(pong("full", 990))
+
+	targets := p.GetReplicationTargets()
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 replication targets, got %d", len(targets))
+	}
+	for _, peer := range targets {
+		if peer.ID == "full" {
+			t.Error("nearly full peer is still a replication target")
+		}
+	}
+	if picked := p.PickReplicationTargets(3); len(picked) != 2 {
+		t.Errorf("PickReplicationTargets returned %d peers, want 2", len(picked))
+	}
+	if len(p.GetReplicationPeers()) != 3 {
+		t.Error("nearly full peer dropped from the enclave")
+	}
+
+	// Freeing space makes it a target again
+	p.handlePong(pong("full", 100))
+	if len(p.GetReplicationTargets()) != 3 {
+		t.Error("peer with room again is not a replication target")
+	}
+}
+
+func TestPickReplicationTargetsSpreadsZones(t *testing.T) {
+	p, _ := newTestProtocol()
+	p.localNode.Zone = "us-east"
+	zones := map[NodeID]string{
+		"east-1": "us-east", "east-2": "us-east", "east-3": "us-east",
+		"west-1": "us-west", "west-2": "us-west",
+		"eu-1":  "eu-central",
+		"plain": "",
+	}
+	for id, zone := range zones {
+		p.addPeer(&Node{ID: id, Address: string(id), Port: 9090, HTTPPort: 8080, Enclave: "default", Zone: zone}, "")
+	}
+
+	for round := 0; round < 20; round++ {
+		targets := p.PickReplicationTargets(2)
+		if len(targets) != 2 {
+			t.Fatalf("expected 2 targets, got %d", len(targets))
+		}
+		got := map[string]bool{}
+		for _, peer := range targets {
+			got[peer.Zone] = true
+		}
+		if !got["us-west"] || !got["eu-central"] {
+			t.Fatalf("targets %s, %s don't cover the two other zones", targets[0].ID, targets[1].ID)
+		}
+	}
+
+	// More copies than zones: the rest fill up from any zone
+	if targets := p.PickReplicationTargets(4); len(targets) != 4 {
+		t.Fatalf("expected 4 targets, got %d", len(targets))
+	}
+}
+
+func TestRelayedCapacityIgnored(t *testing.T) {
+	p, _ := newTestProtocol()
+	p.addPeer(&Node{ID: "relay", Address: "r", Port: 9090, HTTPPort: 8080, Enclave: "default"}, "")
+	p.handleSync(&Message{
+		Type:      MessageTypeSync,
+		From:      "relay",
+		To:        "local",
+		MessageID: "sync-5",
+		NodeInfo:  &Node{ID: "third", Address: "t", Port: 9090, HTTPPort: 8080, Enclave: "default", Capacity: &Capacity{MaxBytes: 1000, UsedBytes: 1000}},
+	})
+	if _, ok := p.PeerCapacity("third"); ok {
+		t.Error("capacity relayed by another node was recorded")
+	}
+	if len(p.GetReplicationTargets()) != 2 {
+		t.Error("peer excluded on relayed capacity")
+	}
+}
+
+func TestHandleBootstrapValidatesRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  BootstrapRequest
+	}{
+		{"missing node ID", BootstrapRequest{Address: "10.0.0.2", HTTPPort: 8080}},
+		{"long node ID", BootstrapRequest{NodeID: strings.Repeat("n", maxNodeIDLength+1), Address: "10.0.0.2", HTTPPort: 8080}},
+		{"missing address", BootstrapRequest{NodeID: "n", HTTPPort: 8080}},
+		{"address with path", BootstrapRequest{NodeID: "n", Address: "evil.example/x?", HTTPPort: 8080}},
+		{"zero HTTP port", BootstrapRequest{NodeID: "n", Address: "10.0.0.2"}},
+		{"HTTP port out of range", BootstrapRequest{NodeID: "n", Address: "10.0.0.2", HTTPPort: 70000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProtocol()
+			if _, err := p.HandleBootstrap(&tt.req); !errors.Is(err, ErrBadBootstrap) {
+				t.Fatalf("err = %v, want ErrBadBootstrap", err)
+			}
+			if len(p.GetPeers()) != 0 {
+				t.Error("refused node was added as a peer")
+			}
+		})
+	}
+
+	p, _ := newTestProtocol()
+	resp, err := p.HandleBootstrap(&BootstrapRequest{NodeID: "n", Address: "10.0.0.2", HTTPPort: 8080})
+	if err != nil || !resp.Success {
+		t.Fatalf("valid request refused: %v", err)
+	}
+}
+
+func TestHandleBootstrapDialsBack(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	p, _ := newTestProtocol()
+	p.EnableDialBack()
+	if _, err := p.HandleBootstrap(&BootstrapRequest{NodeID: "live", Address: "127.0.0.1", HTTPPort: port}); err != nil {
+		t.Fatalf("reachable node refused: %v", err)
+	}
+
+	// Nothing listens on a port just released
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	if _, err := p.HandleBootstrap(&BootstrapRequest{NodeID: "liar", Address: "127.0.0.1", HTTPPort: closedPort}); !errors.Is(err, ErrBadBootstrap) {
+		t.Fatalf("unreachable node: err = %v, want ErrBadBootstrap", err)
+	}
+	if len(p.GetPeers()) != 1 {
+		t.Errorf("got %d peers, want only the reachable node", len(p.GetPeers()))
+	}
+}
+
 func TestSyncSkipsSelf(t *testing.T) {
 	// If a SYNC arrives with our own NodeInfo, we should ignore it
 	// (don't add ourselves as a peer).
@@ -407,6 +606,63 @@ func TestSelectRandomPeers(t *testing.T) {
 	}
 }
 
+func TestPongRecordsRTT(t *testing.T) {
+	p, _ := newTestProtocol()
+	p.addPeer(&Node{ID: "peer-1", Address: "p1", Port: 9090, HTTPPort: 8080, Enclave: "default"}, "")
+
+	// A PONG this node didn't ask for isn't timed
+	p.handlePong(&Message{Type: MessageTypePong, From: "peer-1", MessageID: "pong-0"})
+	if _, ok := p.PeerRTT("peer-1"); ok {
+		t.Fatal("unsolicited PONG recorded an RTT")
+	}
+
+	p.pingPeers(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	p.handlePong(&Message{Type: MessageTypePong, From: "peer-1", MessageID: "pong-1"})
+	rtt, ok := p.PeerRTT("peer-1")
+	if !ok || rtt < 20*time.Millisecond {
+		t.Fatalf("PeerRTT = %v, %v; want at least 20ms", rtt, ok)
+	}
+
+	p.removePeer("peer-1", "test")
+	if _, ok := p.PeerRTT("peer-1"); ok {
+		t.Error("RTT kept after the peer was evicted")
+	}
+}
+
+func TestSelectTargetsPrefersNearPeers(t *testing.T) {
+	p, _ := newTestProtocol()
+	var peers []*Node
+	for i := 0; i < 10; i++ {
+		peer := &Node{ID: NodeID(fmt.Sprintf("peer-%d", i)), Address: "p", Port: 9090, HTTPPort: 8080, Enclave: "default"}
+		p.addPeer(peer, "")
+		peers = append(peers, peer)
+	}
+	p.peersMutex.Lock()
+	for i, peer := range peers {
+		p.rtts[peer.ID] = time.Duration(i+1) * 10 * time.Millisecond
+	}
+	p.peersMutex.Unlock()
+
+	for round := 0; round < 20; round++ {
+		targets := p.selectTargets(peers, 4, "peer-0")
+		if len(targets) != 4 {
+			t.Fatalf("expected 4 targets, got %d", len(targets))
+		}
+		// The nearest two (peer-0 is skipped) always go first
+		if targets[0].ID != "peer-1" || targets[1].ID != "peer-2" {
+			t.Fatalf("targets = %s, %s, ...; want peer-1, peer-2 first", targets[0].ID, targets[1].ID)
+		}
+		seen := map[NodeID]bool{}
+		for _, target := range targets {
+			if target.ID == "peer-0" || seen[target.ID] {
+				t.Fatalf("bad target %s in %v", target.ID, targets)
+			}
+			seen[target.ID] = true
+		}
+	}
+}
+
 func TestMarkSeenDedup(t *testing.T) {
 	p, _ := newTestProtocol()
 
@@ -470,7 +726,7 @@ func TestBroadcastToEnclaveFullBroadcastBelowThreshold(t *testing.T) {
 			HTTPPort: 8080,
 			Enclave: "default",
 		}
-		p.addPeer(peer)
+		p.addPeer(peer, "")
 	}
 
 	msg := &Message{
@@ -506,7 +762,7 @@ func TestBroadcastToEnclaveFanoutAboveThreshold(t *testing.T) {
 			HTTPPort: 8080,
 			Enclave: "default",
 		}
-		p.addPeer(peer)
+		p.addPeer(peer, "")
 	}
 
 	msg := &Message{
@@ -545,7 +801,7 @@ func TestForwardToEnclaveSkipsBelowThreshold(t *testing.T) {
 			HTTPPort: 8080,
 			Enclave: "default",
 		}
-		p.addPeer(peer)
+		p.addPeer(peer, "")
 	}
 
 	msg := &Message{
@@ -578,7 +834,7 @@ func TestForwardToEnclaveAboveThreshold(t *testing.T) {
 			HTTPPort: 8080,
 			Enclave: "default",
 		}
-		p.addPeer(peer)
+		p.addPeer(peer, "")
 	}
 
 	msg := &Message{
@@ -614,8 +870,8 @@ func TestBroadcastToEnclaveOnlySameEnclave(t *testing.T) {
 	// Add peers in different enclaves
 	sameEnclave := &Node{ID: "same", Address: "same", Port: 9090, HTTPPort: 8080, Enclave: "default"}
 	diffEnclave := &Node{ID: "diff", Address: "diff", Port: 9090, HTTPPort: 8080, Enclave: "other"}
-	p.addPeer(sameEnclave)
-	p.addPeer(diffEnclave)
+	p.addPeer(sameEnclave, "")
+	p.addPeer(diffEnclave, "")
 
 	msg := &Message{
 		Type:      MessageTypePut,
@@ -641,7 +897,7 @@ func TestEvictionMetrics(t *testing.T) {
 	p.EnableMetrics()
 
 	peer := &Node{ID: "doomed", Address: "doomed", Port: 9090, HTTPPort: 8080, Enclave: "default"}
-	p.addPeer(peer)
+	p.addPeer(peer, "")
 	mt.setFail("doomed", true)
 
 	// Verify active peers gauge
@@ -677,7 +933,7 @@ func TestEvictionMetrics(t *testing.T) {
 	// Re-add the peer — should increment joins counter
 	joinsBefore := counterValue(p.metrics.peerJoins)
 	mt.setFail("doomed", false)
-	p.addPeer(peer)
+	p.addPeer(peer, "")
 
 	joinsAfter := counterValue(p.metrics.peerJoins)
 	if joinsAfter-joinsBefore != 1 {
@@ -689,3 +945,470 @@ func TestEvictionMetrics(t *testing.T) {
 		t.Fatalf("peersActive after rejoin = %v, want 1", v)
 	}
 }
+
+// --- Loop liveness ---
+
+func TestLoopsAlive(t *testing.T) {
+	p, _ := newTestProtocol()
+
+	// Not started: no heartbeats yet
+	if p.LoopsAlive(time.Minute) {
+		t.Fatal("loops should not be alive before Start")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer p.Stop()
+
+	if !p.LoopsAlive(time.Minute) {
+		t.Fatal("loops should be alive right after Start")
+	}
+
+	// Simulate a health check loop stuck for two minutes
+	p.healthLoopBeat.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if p.LoopsAlive(time.Minute) {
+		t.Fatal("stale health check heartbeat should report loops as not alive")
+	}
+}
+
+func TestIsolatedOnlyAfterLosingPeers(t *testing.T) {
+	p, _ := newTestProtocol()
+
+	if p.Isolated() {
+		t.Fatal("a node that never had peers should not be isolated")
+	}
+	p.addPeer(&Node{ID: "peer-1", Address: "127.0.0.1", Port: 9091}, "test")
+	if p.Isolated() {
+		t.Fatal("a node with a peer should not be isolated")
+	}
+	p.removePeer("peer-1", "test")
+	if !p.Isolated() {
+		t.Fatal("a node that lost its only peer should be isolated")
+	}
+}
+
+// slowTransport sleeps on every send and records the peak number of sends
+// in flight at once.
+type slowTransport struct {
+	*mockTransport
+	delay    time.Duration
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (t *slowTransport) Send(ctx context.Context, node *Node, msg *Message) error {
+	n := t.inFlight.Add(1)
+	defer t.inFlight.Add(-1)
+	for {
+		peak := t.peak.Load()
+		if n <= peak || t.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(t.delay)
+	return t.mockTransport.Send(ctx, node, msg)
+}
+
+func TestBroadcastSendsInParallelUpToCap(t *testing.T) {
+	p, _ := newTestProtocol()
+	st := &slowTransport{mockTransport: newMockTransport(), delay: 50 * time.Millisecond}
+	p.SetTransport(st)
+	p.SetSendConcurrency(4)
+	for i := 0; i < 8; i++ {
+		p.addPeer(&Node{ID: NodeID(fmt.Sprintf("peer-%d", i)), Address: "peer", Enclave: "default"}, "")
+	}
+
+	start := time.Now()
+	if err := p.Broadcast(context.Background(), &Message{Type: MessageTypeSync, MessageID: "par-1"}); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if peak := st.peak.Load(); peak != 4 {
+		t.Fatalf("peak concurrent sends = %d, want 4", peak)
+	}
+	// 8 peers at 4 at a time is two rounds, not eight sequential sends
+	if elapsed >= 8*st.delay {
+		t.Fatalf("broadcast took %v; sends were not parallel", elapsed)
+	}
+}
+
+// blockingTransport holds every PUT until release is closed.
+type blockingTransport struct {
+	*mockTransport
+	release chan struct{}
+	puts    atomic.Int32
+}
+
+func (t *blockingTransport) Send(ctx context.Context, node *Node, msg *Message) error {
+	if msg.Type == MessageTypePut {
+		t.puts.Add(1)
+		<-t.release
+	}
+	return t.mockTransport.Send(ctx, node, msg)
+}
+
+func TestUrgentMessagesSkipBulkQueue(t *testing.T) {
+	p, _ := newTestProtocol()
+	bt := &blockingTransport{mockTransport: newMockTransport(), release: make(chan struct{})}
+	p.SetTransport(bt)
+	peer := &Node{ID: "peer-1", Address: "peer", Enclave: "default"}
+	p.addPeer(peer, "")
+
+	// Fill every bulk slot, plus one PUT left waiting for a slot
+	var wg sync.WaitGroup
+	for i := 0; i <= maxBulkSends; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p.Send(context.Background(), peer, &Message{Type: MessageTypePut, MessageID: fmt.Sprintf("put-%d", i)})
+		}(i)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for bt.puts.Load() < maxBulkSends && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := bt.puts.Load(); n != maxBulkSends {
+		t.Fatalf("%d PUTs in flight, want %d", n, maxBulkSends)
+	}
+
+	for _, typ := range []MessageType{MessageTypePing, MessageTypePong, MessageTypeAck, MessageTypeNack} {
+		done := make(chan error, 1)
+		go func() { done <- p.Send(context.Background(), peer, &Message{Type: typ}) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("%s: %v", typ, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s queued behind bulk PUTs", typ)
+		}
+	}
+
+	// A bulk message waits for a slot, and gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Send(ctx, peer, &Message{Type: MessageTypeSync}); err != context.DeadlineExceeded {
+		t.Fatalf("SYNC with every bulk slot taken: err = %v, want deadline exceeded", err)
+	}
+
+	close(bt.release)
+	wg.Wait()
+	if n := bt.puts.Load(); n != maxBulkSends+1 {
+		t.Fatalf("%d PUTs sent, want %d", n, maxBulkSends+1)
+	}
+}
+
+func TestBroadcastJoinsPerPeerErrors(t *testing.T) {
+	p, mt := newTestProtocol()
+	for i := 0; i < 3; i++ {
+		p.addPeer(&Node{ID: NodeID(fmt.Sprintf("peer-%d", i)), Address: "peer", Enclave: "default"}, "")
+	}
+	mt.setFail("peer-0", true)
+	mt.setFail("peer-2", true)
+
+	err := p.BroadcastToEnclave(context.Background(), &Message{Type: MessageTypePut, MessageID: "err-1"})
+	if err == nil {
+		t.Fatal("expected an error when two peers fail")
+	}
+	for _, id := range []string{"peer-0", "peer-2"} {
+		if !strings.Contains(err.Error(), "peer "+id) {
+			t.Errorf("error %q does not name %s", err, id)
+		}
+	}
+	if strings.Contains(err.Error(), "peer-1") {
+		t.Errorf("error %q names peer-1, which succeeded", err)
+	}
+	if mt.getSendCount("peer-1") != 1 {
+		t.Error("healthy peer was not sent to")
+	}
+}
+
+func TestAwaitRepliesRoutesByMessageID(t *testing.T) {
+	p, _ := newTestProtocol()
+	var delivered []*Message
+	p.SetMessageHandler(func(msg *Message) error {
+		delivered = append(delivered, msg)
+		return nil
+	})
+
+	replies := p.AwaitReplies("req-1")
+	p.HandleMessage(&Message{Type: MessageTypeAck, From: "peer-1", MessageID: "req-2"})
+	p.HandleMessage(&Message{Type: MessageTypeNack, From: "peer-1", MessageID: "req-1", Reason: "storage_full"})
+	select {
+	case reply := <-replies.C:
+		if reply.Type != MessageTypeNack || reply.Reason != "storage_full" {
+			t.Fatalf("reply = %+v, want the NACK for req-1", reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reply to req-1 was not delivered to its waiter")
+	}
+	replies.Close()
+	if n := p.PendingRequests(); n != 0 {
+		t.Fatalf("%d requests still pending after Close", n)
+	}
+
+	// Only the reply without a waiter reaches the message handler, and so
+	// does one arriving after the waiter closed
+	p.HandleMessage(&Message{Type: MessageTypeAck, From: "peer-1", MessageID: "req-1"})
+	if len(delivered) != 2 || delivered[0].MessageID != "req-2" || delivered[1].MessageID != "req-1" {
+		t.Fatalf("message handler got %d replies, want the uncorrelated and the late one", len(delivered))
+	}
+}
+
+func TestPeerDeltasRetransmitLimit(t *testing.T) {
+	var d peerDeltas
+	d.queue(PeerUpdate{Node: &Node{ID: "joined"}, At: time.Now()})
+
+	// 3 peers: each update goes out 3·bits.Len(4) = 9 times
+	for i := 0; i < 9; i++ {
+		if updates := d.take(3); len(updates) != 1 || updates[0].Node.ID != "joined" {
+			t.Fatalf("take #%d = %v, want the queued update", i+1, updates)
+		}
+	}
+	if updates := d.take(3); updates != nil {
+		t.Fatalf("update still piggybacked after its last transmission: %v", updates)
+	}
+
+	// Past maxPiggyback, the least-sent updates go first
+	for i := 0; i < maxPiggyback+2; i++ {
+		d.queue(PeerUpdate{Node: &Node{ID: NodeID(fmt.Sprintf("node-%02d", i))}, At: time.Now()})
+	}
+	if updates := d.take(3); len(updates) != maxPiggyback {
+		t.Fatalf("took %d updates, want %d", len(updates), maxPiggyback)
+	}
+	updates := d.take(3)
+	if len(updates) != maxPiggyback || updates[0].Node.ID != "node-08" || updates[1].Node.ID != "node-09" {
+		t.Fatalf("second take starts with %v, want the two updates not yet sent", updates[:2])
+	}
+}
+
+func TestPingCarriesPeerJoins(t *testing.T) {
+	p, mt := newTestProtocol()
+	p.addPeer(&Node{ID: "peer-a", Address: "a", Enclave: "default"}, "")
+	p.addPeer(&Node{ID: "peer-b", Address: "b", Enclave: "default"}, "")
+
+	p.pingPeers(context.Background())
+
+	for _, sent := range mt.getSentMessages() {
+		ids := make(map[NodeID]bool)
+		for _, u := range sent.Msg.Updates {
+			ids[u.Node.ID] = true
+		}
+		if !ids["peer-a"] || !ids["peer-b"] {
+			t.Fatalf("PING to %s carries %v, want both joins", sent.To, sent.Msg.Updates)
+		}
+	}
+}
+
+func TestPongUpdatesApplyJoinsAndConfirmedEvictions(t *testing.T) {
+	p, _ := newTestProtocol()
+	p.addPeer(&Node{ID: "peer-a", Address: "a", Enclave: "default"}, "")
+	p.addPeer(&Node{ID: "peer-b", Address: "b", Enclave: "default"}, "")
+	p.addPeer(&Node{ID: "peer-c", Address: "c", Enclave: "default"}, "")
+	p.peerFailures["peer-c"] = 1
+
+	p.HandleMessage(&Message{Type: MessageTypePong, From: "peer-a", MessageID: "pong-1", Updates: []PeerUpdate{
+		{Node: &Node{ID: "peer-new", Address: "n", HTTPPort: 8080}, At: time.Now()},
+		{Node: &Node{ID: "peer-b"}, Evicted: true, At: time.Now()}, // still answers our pings
+		{Node: &Node{ID: "peer-c"}, Evicted: true, At: time.Now()}, // failing here too
+		{Node: &Node{ID: "local"}, At: time.Now()},
+	}})
+
+	p.peersMutex.RLock()
+	defer p.peersMutex.RUnlock()
+	if n := p.peers["peer-new"]; n == nil || n.Enclave != "default" || n.HTTPPort != 8080 {
+		t.Fatalf("piggybacked join not applied: %+v", n)
+	}
+	if p.peers["peer-b"] == nil {
+		t.Fatal("peer-b evicted on another node's word while reachable from here")
+	}
+	if p.peers["peer-c"] != nil {
+		t.Fatal("peer-c kept after an eviction confirmed by failed pings here")
+	}
+	if p.peers["local"] != nil {
+		t.Fatal("local node added itself as a peer")
+	}
+}
+
+func TestPeerUpdatesRoundTripWireFormat(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	in := []PeerUpdate{
+		{Node: &Node{ID: "joined", Address: "10.0.0.1", Port: 9090, HTTPPort: 8080, InternalPort: 9443, Enclave: "blue"}, At: at},
+		{Node: &Node{ID: "gone"}, Evicted: true, At: at},
+	}
+	out := PeerUpdates(wireUpdates(in))
+	if len(out) != 2 || *out[0].Node != *in[0].Node || !out[0].At.Equal(at) || out[0].Evicted || !out[1].Evicted || out[1].Node.ID != "gone" {
+		t.Fatalf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+// helperTransport answers each PING-REQ from the helper it was sent to,
+// with an ACK if reachable is set and a NACK otherwise.
+type helperTransport struct {
+	*mockTransport
+	p         *Protocol
+	reachable bool
+}
+
+func (t *helperTransport) Send(ctx context.Context, node *Node, msg *Message) error {
+	if err := t.mockTransport.Send(ctx, node, msg); err != nil {
+		return err
+	}
+	if msg.Type == MessageTypePingReq {
+		reply := &Message{Type: MessageTypeNack, From: node.ID, MessageID: msg.MessageID}
+		if t.reachable {
+			reply.Type = MessageTypeAck
+		}
+		go t.p.HandleMessage(reply)
+	}
+	return nil
+}
+
+func TestIndirectProbeKeepsPeerReachableFromHelper(t *testing.T) {
+	p, mt := newTestProtocol()
+	ht := &helperTransport{mockTransport: mt, p: p, reachable: true}
+	p.SetTransport(ht)
+	p.addPeer(&Node{ID: "flaky", Address: "flaky", Enclave: "default"}, "")
+	p.addPeer(&Node{ID: "helper", Address: "helper", Enclave: "default"}, "")
+	mt.setFail("flaky", true)
+
+	for i := 0; i < MaxPingFailures; i++ {
+		p.pingPeers(context.Background())
+	}
+	if len(p.GetPeers()) != 2 {
+		t.Fatal("peer reachable from a helper should not be evicted")
+	}
+	var req *Message
+	for _, sent := range mt.getSentMessages() {
+		if sent.Msg.Type == MessageTypePingReq {
+			if sent.To != "helper" || req != nil {
+				t.Fatalf("unexpected PING-REQ to %s", sent.To)
+			}
+			req = sent.Msg
+		}
+	}
+	if req == nil || req.NodeInfo == nil || req.NodeInfo.ID != "flaky" {
+		t.Fatalf("PING-REQ = %+v, want one asking helper to probe flaky", req)
+	}
+
+	// Once the helpers can't reach it either, it goes
+	ht.reachable = false
+	p.pingPeers(context.Background())
+	if peers := p.GetPeers(); len(peers) != 1 || peers[0].ID != "helper" {
+		t.Fatalf("peers = %v, want only helper after failed indirect probes", peers)
+	}
+}
+
+func TestIndirectProbeTimesOutWithoutReplies(t *testing.T) {
+	p, mt := newTestProtocol()
+	p.addPeer(&Node{ID: "dead", Address: "dead", Enclave: "default"}, "")
+	p.addPeer(&Node{ID: "silent", Address: "silent", Enclave: "default"}, "")
+	mt.setFail("dead", true)
+
+	if p.probeIndirect(context.Background(), &Node{ID: "dead"}) {
+		t.Fatal("probe with no replies reported the peer reachable")
+	}
+	if n := p.PendingRequests(); n != 0 {
+		t.Fatalf("%d probes still pending", n)
+	}
+}
+
+func TestHandlePingReqProbesKnownPeers(t *testing.T) {
+	p, mt := newTestProtocol()
+	p.addPeer(&Node{ID: "requester", Address: "requester", Enclave: "default"}, "")
+	p.addPeer(&Node{ID: "up", Address: "up", Enclave: "default"}, "")
+	p.addPeer(&Node{ID: "down", Address: "down", Enclave: "default"}, "")
+	mt.setFail("down", true)
+
+	tests := []struct {
+		target string
+		want   MessageType
+		reason string
+	}{
+		{"up", MessageTypeAck, ""},
+		{"down", MessageTypeNack, "unreachable"},
+		{"stranger", MessageTypeNack, "unknown_peer"},
+	}
+	for _, tt := range tests {
+		id := "probe-" + tt.target
+		p.HandleMessage(&Message{Type: MessageTypePingReq, From: "requester", MessageID: id, NodeInfo: &Node{ID: NodeID(tt.target), Address: "elsewhere"}})
+
+		var reply *Message
+		deadline := time.Now().Add(2 * time.Second)
+		for reply == nil && time.Now().Before(deadline) {
+			for _, sent := range mt.getSentMessages() {
+				if sent.To == "requester" && sent.Msg.MessageID == id {
+					reply = sent.Msg
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if reply == nil || reply.Type != tt.want || reply.Reason != tt.reason {
+			t.Fatalf("reply to PING-REQ for %s = %+v, want %s %q", tt.target, reply, tt.want, tt.reason)
+		}
+	}
+	if n := mt.getSendCount("stranger"); n != 0 {
+		t.Fatalf("pinged a node missing from the peer table %d times", n)
+	}
+
+	// Requests from nodes outside the peer table are ignored
+	p.HandleMessage(&Message{Type: MessageTypePingReq, From: "nobody", MessageID: "probe-x", NodeInfo: &Node{ID: "up"}})
+	time.Sleep(20 * time.Millisecond)
+	for _, sent := range mt.getSentMessages() {
+		if sent.Msg.MessageID == "probe-x" {
+			t.Fatalf("answered a PING-REQ from an unknown node: %+v", sent.Msg)
+		}
+	}
+}
+
+func TestMembershipEventsTrackPeerTable(t *testing.T) {
+	p, mt := newTestProtocol()
+	peer := &Node{ID: "peer-1", Address: "10.0.0.1", HTTPPort: 8080, Enclave: "default"}
+	p.addPeer(peer, "bootstrap from seed")
+	p.addPeer(peer, "SYNC from peer-2") // already known: no event
+	p.addPeer(&Node{ID: "peer-1", Address: "10.0.0.9", HTTPPort: 8080, Enclave: "default"}, "bootstrapped from this node")
+
+	mt.setFail("peer-1", true)
+	for i := 0; i < MaxPingFailures; i++ {
+		p.pingPeers(context.Background())
+	}
+	p.addPeer(peer, "PING/PONG from peer-2")
+
+	want := []struct {
+		typ, address, reason string
+	}{
+		{EventRejoin, "10.0.0.1:8080", "PING/PONG from peer-2"},
+		{EventEvict, "10.0.0.9:8080", "3 consecutive ping failures and failed indirect probes"},
+		{EventAddressChange, "10.0.0.9:8080", "moved from 10.0.0.1:8080, bootstrapped from this node"},
+		{EventJoin, "10.0.0.1:8080", "bootstrap from seed"},
+	}
+	events := p.MembershipEvents()
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		ev := events[i]
+		if ev.Type != w.typ || ev.Node != "peer-1" || ev.Address != w.address || ev.Reason != w.reason {
+			t.Errorf("event %d = %+v, want %s at %s (%s)", i, ev, w.typ, w.address, w.reason)
+		}
+	}
+}
+
+func TestEventLogKeepsNewest(t *testing.T) {
+	var l eventLog
+	for i := 0; i < eventLogSize+10; i++ {
+		l.record("local", EventJoin, &Node{ID: NodeID(fmt.Sprintf("peer-%d", i)), Address: "peer"}, "")
+	}
+	events := l.recent()
+	if len(events) != eventLogSize {
+		t.Fatalf("kept %d events, want %d", len(events), eventLogSize)
+	}
+	if events[0].Node != NodeID(fmt.Sprintf("peer-%d", eventLogSize+9)) || events[len(events)-1].Node != "peer-10" {
+		t.Fatalf("kept %s..%s, want the newest %d", events[0].Node, events[len(events)-1].Node, eventLogSize)
+	}
+}
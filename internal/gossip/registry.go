@@ -0,0 +1,189 @@
+package gossip
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"repram/internal/logging"
+)
+
+// announcementTTL is how long a node's announcement stays in the registry
+// without being refreshed. Nodes re-announce on every topology sync tick,
+// so an entry only lapses for a node that has been gone for several ticks;
+// once it lapses, the node ID may be claimed by a new key.
+const announcementTTL = 5 * time.Minute
+
+// maxAnnouncementSkew rejects announcements issued too far in the future,
+// which would otherwise pin an entry past announcementTTL.
+const maxAnnouncementSkew = time.Minute
+
+// Announcement is a node's signed statement of who and where it is.
+type Announcement struct {
+	NodeID    NodeID    `json:"node_id"`
+	Address   string    `json:"address"`
+	HTTPPort  int       `json:"http_port"`
+	Enclave   string    `json:"enclave"`
+	PublicKey []byte    `json:"public_key"`
+	Issued    time.Time `json:"issued"`
+	Signature []byte    `json:"signature,omitempty"`
+}
+
+// ErrBadAnnouncement means an announcement failed verification: a bad
+// signature, a key that doesn't match the one registered for the node ID,
+// or a stale or future issue time.
+var ErrBadAnnouncement = errors.New("announcement failed verification")
+
+// signedBytes is the canonical encoding the signature covers: the
+// announcement without its signature.
+func (a *Announcement) signedBytes() []byte {
+	unsigned := *a
+	unsigned.Signature = nil
+	data, _ := json.Marshal(unsigned)
+	return data
+}
+
+// Sign fills in PublicKey and Signature from key.
+func (a *Announcement) Sign(key ed25519.PrivateKey) {
+	a.PublicKey = key.Public().(ed25519.PublicKey)
+	a.Signature = ed25519.Sign(key, a.signedBytes())
+}
+
+// Verify checks the signature against the announcement's own key.
+func (a *Announcement) Verify() bool {
+	return len(a.PublicKey) == ed25519.PublicKeySize &&
+		ed25519.Verify(ed25519.PublicKey(a.PublicKey), a.signedBytes(), a.Signature)
+}
+
+type registryEntry struct {
+	announcement Announcement
+	expires      time.Time
+}
+
+// Registry holds the signed announcements of the nodes in a public network.
+// The first key seen for a node ID is pinned until the node's entry lapses,
+// so another node can't take over an ID that is in use.
+type Registry struct {
+	key     ed25519.PrivateKey
+	mu      sync.RWMutex
+	entries map[NodeID]*registryEntry
+}
+
+// NewRegistry creates a registry that signs this node's announcements with
+// key.
+func NewRegistry(key ed25519.PrivateKey) *Registry {
+	return &Registry{key: key, entries: make(map[NodeID]*registryEntry)}
+}
+
+// Announce returns a freshly signed announcement for local.
+func (r *Registry) Announce(local *Node) *Announcement {
+	a := &Announcement{
+		NodeID:   local.ID,
+		Address:  local.Address,
+		HTTPPort: local.HTTPPort,
+		Enclave:  local.Enclave,
+		Issued:   time.Now().UTC().Truncate(time.Second),
+	}
+	a.Sign(r.key)
+	return a
+}
+
+// Accept verifies a and records it. It returns true if a is news (a node
+// not registered before, or a newer announcement than the one held), false
+// for a repeat. A failed check returns an error wrapping ErrBadAnnouncement.
+func (r *Registry) Accept(a *Announcement) (bool, error) {
+	if !a.Verify() {
+		return false, fmt.Errorf("%w: bad signature from %s", ErrBadAnnouncement, a.NodeID)
+	}
+	now := time.Now()
+	if a.Issued.After(now.Add(maxAnnouncementSkew)) || a.Issued.Before(now.Add(-announcementTTL)) {
+		return false, fmt.Errorf("%w: %s issued at %s", ErrBadAnnouncement, a.NodeID, a.Issued.Format(time.RFC3339))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cur, ok := r.entries[a.NodeID]; ok && now.Before(cur.expires) {
+		if !ed25519.PublicKey(cur.announcement.PublicKey).Equal(ed25519.PublicKey(a.PublicKey)) {
+			return false, fmt.Errorf("%w: %s announced with a different key", ErrBadAnnouncement, a.NodeID)
+		}
+		if !a.Issued.After(cur.announcement.Issued) {
+			return false, nil
+		}
+	}
+	r.entries[a.NodeID] = &registryEntry{announcement: *a, expires: a.Issued.Add(announcementTTL)}
+	return true, nil
+}
+
+// Verified reports whether id has a current, verified announcement.
+func (r *Registry) Verified(id NodeID) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.entries[id]
+	return ok && time.Now().Before(entry.expires)
+}
+
+// Announce sends this node's signed announcement to every peer. It does
+// nothing outside public mode.
+func (p *Protocol) Announce(ctx context.Context) {
+	if p.registry == nil {
+		return
+	}
+	data, err := json.Marshal(p.registry.Announce(p.localNode))
+	if err != nil {
+		return
+	}
+	msg := &Message{
+		Type:      MessageTypeAnnounce,
+		From:      p.localNode.ID,
+		Data:      data,
+		Timestamp: time.Now(),
+		MessageID: NewMessageID(),
+	}
+	p.MarkSeen(msg.MessageID)
+	if err := p.Broadcast(ctx, msg); err != nil {
+		logging.Debug("[%s] Announcement not delivered to every peer: %v", p.localNode.ID, err)
+	}
+}
+
+// handleAnnounce records a peer's announcement and passes news on to a
+// fanout of other peers, so announcements spread beyond direct neighbours.
+// Bad announcements count against the peer that sent them.
+func (p *Protocol) handleAnnounce(msg *Message) error {
+	if p.registry == nil || p.MarkSeen(msg.MessageID) {
+		return nil
+	}
+	var a Announcement
+	if err := json.Unmarshal(msg.Data, &a); err != nil {
+		p.reputation.RecordInvalid(msg.From)
+		return nil
+	}
+	news, err := p.registry.Accept(&a)
+	if err != nil {
+		p.reputation.RecordFailedVerification(msg.From)
+		logging.Warn("[%s] Rejected announcement from %s: %v", p.localNode.ID, msg.From, err)
+		return nil
+	}
+	if !news {
+		return nil
+	}
+
+	forward := *msg
+	forward.From = p.localNode.ID
+	peers := p.getPeers()
+	for _, peer := range selectRandomPeers(peers, fanoutSize(len(peers)), msg.From) {
+		if peer.ID == a.NodeID {
+			continue
+		}
+		if err := p.transmit(context.Background(), peer, &forward); err != nil {
+			logging.Debug("[%s] Failed to forward announcement of %s to %s: %v", p.localNode.ID, a.NodeID, peer.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package gossip
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAnnouncementSignature(t *testing.T) {
+	a := NewRegistry(newKey(t)).Announce(&Node{ID: "n1", Address: "10.0.0.1", HTTPPort: 8080, Enclave: "default"})
+	if !a.Verify() {
+		t.Fatal("freshly signed announcement does not verify")
+	}
+
+	// Round trip through JSON, as over the wire
+	data, _ := json.Marshal(a)
+	var decoded Announcement
+	json.Unmarshal(data, &decoded)
+	if !decoded.Verify() {
+		t.Fatal("announcement does not verify after a JSON round trip")
+	}
+
+	decoded.Address = "10.0.0.66"
+	if decoded.Verify() {
+		t.Fatal("tampered announcement verified")
+	}
+}
+
+func TestRegistryPinsFirstKey(t *testing.T) {
+	reg := NewRegistry(newKey(t))
+	node := &Node{ID: "n1", Address: "10.0.0.1", HTTPPort: 8080}
+	owner := NewRegistry(newKey(t))
+	impostor := NewRegistry(newKey(t))
+
+	first := owner.Announce(node)
+	if news, err := reg.Accept(first); err != nil || !news {
+		t.Fatalf("first announcement: news=%v err=%v", news, err)
+	}
+	if news, err := reg.Accept(first); err != nil || news {
+		t.Fatalf("repeated announcement: news=%v err=%v, want not news", news, err)
+	}
+	if _, err := reg.Accept(impostor.Announce(node)); !errors.Is(err, ErrBadAnnouncement) {
+		t.Fatalf("announcement under another key: err = %v, want ErrBadAnnouncement", err)
+	}
+	if !reg.Verified("n1") {
+		t.Fatal("n1 should be verified")
+	}
+
+	later := *first
+	later.Issued = first.Issued.Add(time.Second)
+	later.Sign(owner.key)
+	if news, err := reg.Accept(&later); err != nil || !news {
+		t.Fatalf("newer announcement: news=%v err=%v", news, err)
+	}
+}
+
+func TestRegistryRejectsStaleAnnouncement(t *testing.T) {
+	owner := NewRegistry(newKey(t))
+	a := owner.Announce(&Node{ID: "n1"})
+	a.Issued = time.Now().Add(-announcementTTL - time.Minute).UTC().Truncate(time.Second)
+	a.Sign(owner.key)
+	if _, err := NewRegistry(newKey(t)).Accept(a); !errors.Is(err, ErrBadAnnouncement) {
+		t.Fatalf("stale announcement: err = %v, want ErrBadAnnouncement", err)
+	}
+}
+
+func TestHandleAnnounceCountsBadSignatures(t *testing.T) {
+	p, mt := newTestProtocol()
+	p.EnablePublicMode(newKey(t))
+	p.addPeer(&Node{ID: "relay", Address: "relay", Enclave: "default"}, "")
+	p.addPeer(&Node{ID: "other", Address: "other", Enclave: "default"}, "")
+
+	a := NewRegistry(newKey(t)).Announce(&Node{ID: "n1"})
+	a.Address = "forged"
+	data, _ := json.Marshal(a)
+	p.handleMessage(&Message{Type: MessageTypeAnnounce, From: "relay", Data: data, MessageID: "a1"})
+
+	if got := p.Reputation().Stats("relay").FailedVerifications; got != 1 {
+		t.Fatalf("relay failed verifications = %d, want 1", got)
+	}
+	if p.Registry().Verified("n1") {
+		t.Fatal("forged announcement was registered")
+	}
+	if len(mt.getSentMessages()) != 0 {
+		t.Fatal("forged announcement was forwarded")
+	}
+
+	// A good announcement is registered and passed on
+	good, _ := json.Marshal(NewRegistry(newKey(t)).Announce(&Node{ID: "n2"}))
+	p.handleMessage(&Message{Type: MessageTypeAnnounce, From: "relay", Data: good, MessageID: "a2"})
+	if !p.Registry().Verified("n2") {
+		t.Fatal("valid announcement was not registered")
+	}
+	if mt.getSendCount("other") != 1 {
+		t.Fatal("valid announcement was not forwarded to other peers")
+	}
+}
+
+func TestAnnounceIsNoOpOutsidePublicMode(t *testing.T) {
+	p, mt := newTestProtocol()
+	p.addPeer(&Node{ID: "peer", Address: "peer", Enclave: "default"}, "")
+	p.Announce(context.Background())
+	if len(mt.getSentMessages()) != 0 {
+		t.Fatal("private node sent an announcement")
+	}
+}
@@ -0,0 +1,76 @@
+package gossip
+
+import (
+	"sync"
+
+	"repram/internal/logging"
+)
+
+// replyBuffer is how many replies a Replies holds before further ones are
+// dropped. A write's replies are drained as they arrive, so this only needs
+// to cover a burst from a large enclave.
+const replyBuffer = 256
+
+// replyWaiters routes ACKs and NACKs to whoever is waiting on them. Over
+// HTTP a reply is a separate message sent back to the requester, so the
+// only link to its request is the MessageID they share.
+type replyWaiters struct {
+	mu      sync.Mutex
+	waiting map[string]chan *Message // request MessageID → replies
+}
+
+// Replies receives the ACKs and NACKs sent in answer to one request.
+type Replies struct {
+	C <-chan *Message
+
+	p  *Protocol
+	id string
+}
+
+// AwaitReplies starts collecting the replies to the message with the given
+// ID. Call it before sending the message, so a fast reply isn't missed, and
+// Close the result when done. Replies from any peer are delivered, since a
+// PUT fanned out across a large enclave is answered by peers it was
+// forwarded to as well.
+func (p *Protocol) AwaitReplies(messageID string) *Replies {
+	ch := make(chan *Message, replyBuffer)
+	p.replies.mu.Lock()
+	if p.replies.waiting == nil {
+		p.replies.waiting = make(map[string]chan *Message)
+	}
+	p.replies.waiting[messageID] = ch
+	p.replies.mu.Unlock()
+	return &Replies{C: ch, p: p, id: messageID}
+}
+
+// Close stops collecting replies. Replies arriving later go to the message
+// handler like any other message.
+func (r *Replies) Close() {
+	r.p.replies.mu.Lock()
+	delete(r.p.replies.waiting, r.id)
+	r.p.replies.mu.Unlock()
+}
+
+// PendingRequests is the number of requests still collecting replies.
+func (p *Protocol) PendingRequests() int {
+	p.replies.mu.Lock()
+	defer p.replies.mu.Unlock()
+	return len(p.replies.waiting)
+}
+
+// deliverReply hands an ACK or NACK to the request waiting on it, and
+// reports whether there was one.
+func (p *Protocol) deliverReply(msg *Message) bool {
+	p.replies.mu.Lock()
+	defer p.replies.mu.Unlock()
+	ch, ok := p.replies.waiting[msg.MessageID]
+	if !ok {
+		return false
+	}
+	select {
+	case ch <- msg:
+	default:
+		logging.Warn("[%s] Dropping %s from %s for %s: too many unread replies", p.localNode.ID, msg.Type, msg.From, msg.MessageID)
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package gossip
+
+import (
+	"sort"
+	"sync"
+)
+
+// DemoteScore is the reputation below which a peer stops receiving
+// replicated writes from this node. Three invalid messages or failed
+// verifications put any peer below it; fewer do for a peer that also fails
+// health checks.
+const DemoteScore = 0.25
+
+// PeerStats is what a node has observed of one peer.
+type PeerStats struct {
+	PingsOK             int `json:"pings_ok"`
+	PingsFailed         int `json:"pings_failed"`
+	InvalidMessages     int `json:"invalid_messages"`
+	FailedVerifications int `json:"failed_verifications"`
+}
+
+// Score rates the peer from 0 to 1: its health check success rate, halved
+// for each invalid message or failed verification. A peer with no history
+// scores 1.
+func (s PeerStats) Score() float64 {
+	// One assumed success keeps a single failed ping from zeroing a new peer
+	uptime := float64(s.PingsOK+1) / float64(s.PingsOK+s.PingsFailed+1)
+	score := uptime
+	for i := 0; i < s.InvalidMessages+s.FailedVerifications && score > 0; i++ {
+		score /= 2
+	}
+	return score
+}
+
+// Reputation tracks peer behaviour in a public network. A nil Reputation
+// ignores observations and treats every peer as in good standing.
+type Reputation struct {
+	mu    sync.Mutex
+	stats map[NodeID]*PeerStats
+}
+
+// NewReputation creates an empty reputation tracker.
+func NewReputation() *Reputation {
+	return &Reputation{stats: make(map[NodeID]*PeerStats)}
+}
+
+func (r *Reputation) update(id NodeID, fn func(*PeerStats)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.stats[id]
+	if !ok {
+		s = &PeerStats{}
+		r.stats[id] = s
+	}
+	fn(s)
+}
+
+// RecordPing records the outcome of a health check.
+func (r *Reputation) RecordPing(id NodeID, ok bool) {
+	r.update(id, func(s *PeerStats) {
+		if ok {
+			s.PingsOK++
+		} else {
+			s.PingsFailed++
+		}
+	})
+}
+
+// RecordInvalid records a message from id that failed validation.
+func (r *Reputation) RecordInvalid(id NodeID) {
+	r.update(id, func(s *PeerStats) { s.InvalidMessages++ })
+}
+
+// RecordFailedVerification records a bad signature or announcement from id.
+func (r *Reputation) RecordFailedVerification(id NodeID) {
+	r.update(id, func(s *PeerStats) { s.FailedVerifications++ })
+}
+
+// Stats returns what has been observed of id.
+func (r *Reputation) Stats(id NodeID) PeerStats {
+	if r == nil {
+		return PeerStats{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.stats[id]; ok {
+		return *s
+	}
+	return PeerStats{}
+}
+
+// Rank orders peers best first and drops those scoring below DemoteScore.
+// Peers with equal scores keep their relative order. A nil Reputation
+// returns peers unchanged.
+func (r *Reputation) Rank(peers []*Node) []*Node {
+	if r == nil {
+		return peers
+	}
+	scores := make(map[NodeID]float64, len(peers))
+	ranked := make([]*Node, 0, len(peers))
+	for _, peer := range peers {
+		score := r.Stats(peer.ID).Score()
+		if score < DemoteScore {
+			continue
+		}
+		scores[peer.ID] = score
+		ranked = append(ranked, peer)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].ID] > scores[ranked[j].ID]
+	})
+	return ranked
+}
@@ -0,0 +1,46 @@
+package gossip
+
+import "testing"
+
+func TestPeerScore(t *testing.T) {
+	cases := []struct {
+		name  string
+		stats PeerStats
+		want  float64
+	}{
+		{"new peer", PeerStats{}, 1},
+		{"always up", PeerStats{PingsOK: 9}, 1},
+		{"half up", PeerStats{PingsOK: 4, PingsFailed: 5}, 0.5},
+		{"one invalid message", PeerStats{PingsOK: 9, InvalidMessages: 1}, 0.5},
+		{"invalid and unverified", PeerStats{PingsOK: 9, InvalidMessages: 1, FailedVerifications: 2}, 0.125},
+	}
+	for _, c := range cases {
+		if got := c.stats.Score(); got != c.want {
+			t.Errorf("%s: score = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRankDemotesAndOrders(t *testing.T) {
+	r := NewReputation()
+	flaky, good, bad := &Node{ID: "flaky"}, &Node{ID: "good"}, &Node{ID: "bad"}
+	r.RecordPing("flaky", true)
+	r.RecordPing("flaky", false)
+	for i := 0; i < 3; i++ {
+		r.RecordInvalid("bad")
+	}
+
+	ranked := r.Rank([]*Node{flaky, bad, good})
+	if len(ranked) != 2 || ranked[0] != good || ranked[1] != flaky {
+		ids := make([]NodeID, len(ranked))
+		for i, n := range ranked {
+			ids[i] = n.ID
+		}
+		t.Fatalf("ranked = %v, want [good flaky]", ids)
+	}
+
+	var none *Reputation
+	if got := none.Rank([]*Node{bad, good}); len(got) != 2 {
+		t.Fatal("nil reputation should leave peers unchanged")
+	}
+}
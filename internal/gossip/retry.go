@@ -0,0 +1,142 @@
+package gossip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RetryPolicy is how HTTPTransport retries a failed send of an idempotent
+// message to a peer. Each peer send is retried on its own, so one
+// unreachable peer doesn't cost the others any attempts.
+type RetryPolicy struct {
+	Attempts  int           // tries per send, including the first; 1 disables retries
+	BaseDelay time.Duration // wait before the first retry, doubled for each one after
+	MaxDelay  time.Duration // cap on the wait between tries
+}
+
+// DefaultRetryPolicy retries a failed send twice, about 100ms and 200ms
+// later: enough to ride out a dropped connection or a peer's brief GC
+// pause, short enough to finish well inside a write timeout.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+// backoff returns the wait before retry n (1 for the first retry): the
+// exponential delay with up to half of it taken off at random, so peers
+// retrying after the same failure don't do so in lockstep.
+func (rp RetryPolicy) backoff(n int) time.Duration {
+	delay := rp.BaseDelay << (n - 1)
+	if delay > rp.MaxDelay || delay <= 0 {
+		delay = rp.MaxDelay
+	}
+	if half := int64(delay / 2); half > 0 {
+		delay -= time.Duration(rand.Int63n(half + 1))
+	}
+	return delay
+}
+
+// Idempotent reports whether a message of this type can be delivered twice
+// without harm, so a failed send may be retried. Receivers dedup PUT, MERGE
+// and ANNOUNCE by message ID, ACKs and NACKs by sender, and a SYNC only
+// re-adds a peer. PING and PONG are not retried: a late answer says nothing
+// about the peer's health now. RATE digests add to counters.
+func (t MessageType) Idempotent() bool {
+	switch t {
+	case MessageTypePut, MessageTypeAck, MessageTypeNack, MessageTypeSync, MessageTypeMerge, MessageTypeAnnounce:
+		return true
+	}
+	return false
+}
+
+// statusError is a send the peer answered with a non-200 status.
+type statusError struct {
+	peer NodeID
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("message rejected by %s with status: %d", e.peer, e.code)
+}
+
+// errExpiredBeforeSend is returned for a PUT whose value expired before it
+// could be sent.
+var errExpiredBeforeSend = errors.New("value expired before it was sent")
+
+// retryable reports whether a failed send may succeed if tried again: the
+// request never got an answer, or the peer was overloaded or failing. A
+// peer that refused the message (4xx) will refuse it again, and a value
+// that has expired stays expired.
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, errExpiredBeforeSend)
+}
+
+// retryMetrics counts gossip sends retried and given up on for Prometheus.
+type retryMetrics struct {
+	retries     *prometheus.CounterVec
+	deadLetters *prometheus.CounterVec
+}
+
+var (
+	sharedRetryMetrics     *retryMetrics
+	sharedRetryMetricsOnce sync.Once
+)
+
+func newRetryMetrics() *retryMetrics {
+	sharedRetryMetricsOnce.Do(func() {
+		sharedRetryMetrics = &retryMetrics{
+			retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "repram_gossip_send_retries_total",
+				Help: "Gossip sends retried after a failure, by message type",
+			}, []string{"type"}),
+			deadLetters: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "repram_gossip_dead_letters_total",
+				Help: "Gossip messages dropped after every retry failed, by message type",
+			}, []string{"type"}),
+		}
+		prometheus.MustRegister(sharedRetryMetrics.retries, sharedRetryMetrics.deadLetters)
+	})
+	return sharedRetryMetrics
+}
+
+// sendWithRetry calls send until it succeeds, fails for good, or the policy
+// runs out of attempts. Only idempotent messages are retried. A message
+// that exhausts its attempts is counted as a dead letter.
+func (t *HTTPTransport) sendWithRetry(ctx context.Context, msg *Message, send func() error) error {
+	policy := t.retryPolicy
+	attempts := policy.Attempts
+	if !msg.Type.Idempotent() || attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for n := 1; ; n++ {
+		if err = send(); err == nil || !retryable(err) {
+			return err
+		}
+		if n == attempts {
+			break
+		}
+		timer := time.NewTimer(policy.backoff(n))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		if t.retryMetrics != nil {
+			t.retryMetrics.retries.WithLabelValues(string(msg.Type)).Inc()
+		}
+	}
+	if attempts > 1 && t.retryMetrics != nil {
+		t.retryMetrics.deadLetters.WithLabelValues(string(msg.Type)).Inc()
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package gossip
+
+// spreadZones picks n of the peers in order, picked first then the rest of
+// pool, taking peers in zones not yet holding a copy of the write before
+// any others, so that losing one zone loses as few copies as it can. The
+// local node's copy counts for its own zone. Peers that declare no zone
+// are only taken to fill up; with no zones declared anywhere the result is
+// picked unchanged.
+func spreadZones(localZone string, picked, pool []*Node, n int) []*Node {
+	order := append([]*Node(nil), picked...)
+	inPicked := make(map[NodeID]bool, len(picked))
+	for _, peer := range picked {
+		inPicked[peer.ID] = true
+	}
+	for _, peer := range pool {
+		if !inPicked[peer.ID] {
+			order = append(order, peer)
+		}
+	}
+
+	zones := map[string]bool{}
+	if localZone != "" {
+		zones[localZone] = true
+	}
+	taken := make(map[NodeID]bool, n)
+	targets := make([]*Node, 0, n)
+	for _, peer := range order {
+		if len(targets) == n {
+			return targets
+		}
+		if peer.Zone != "" && !zones[peer.Zone] {
+			zones[peer.Zone] = true
+			taken[peer.ID] = true
+			targets = append(targets, peer)
+		}
+	}
+	for _, peer := range order {
+		if len(targets) == n {
+			break
+		}
+		if !taken[peer.ID] {
+			targets = append(targets, peer)
+		}
+	}
+	return targets
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync/atomic"
 )
 
 type Level int
@@ -23,24 +24,53 @@ var levelNames = map[Level]string{
 	LevelError: "ERROR",
 }
 
-var currentLevel = LevelInfo
+func (l Level) String() string {
+	return strings.ToLower(levelNames[l])
+}
+
+// currentLevel is atomic so the level can be changed at runtime (SIGHUP
+// reload) while other goroutines are logging.
+var currentLevel atomic.Int32
+
+func init() {
+	currentLevel.Store(int32(LevelInfo))
+}
 
 func Init() {
-	switch strings.ToLower(os.Getenv("REPRAM_LOG_LEVEL")) {
+	if level, err := ParseLevel(os.Getenv("REPRAM_LOG_LEVEL")); err == nil {
+		SetLevel(level)
+	}
+	log.SetFlags(log.Ldate | log.Ltime)
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) to a Level.
+// An empty string is treated as info.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
 	case "debug":
-		currentLevel = LevelDebug
-	case "info":
-		currentLevel = LevelInfo
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
 	case "warn":
-		currentLevel = LevelWarn
+		return LevelWarn, nil
 	case "error":
-		currentLevel = LevelError
+		return LevelError, nil
 	}
-	log.SetFlags(log.Ldate | log.Ltime)
+	return LevelInfo, fmt.Errorf("unknown log level %q (want debug, info, warn, or error)", name)
+}
+
+// SetLevel changes the minimum level that is logged.
+func SetLevel(level Level) {
+	currentLevel.Store(int32(level))
+}
+
+// CurrentLevel returns the minimum level that is logged.
+func CurrentLevel() Level {
+	return Level(currentLevel.Load())
 }
 
 func logf(level Level, format string, args ...any) {
-	if level < currentLevel {
+	if level < CurrentLevel() {
 		return
 	}
 	msg := fmt.Sprintf(format, args...)
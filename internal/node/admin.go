@@ -0,0 +1,30 @@
+package node
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// SnapshotPath streams a node's whole store out (GET) or in (POST). It is an
+// admin endpoint, but a transfer takes as long as the store is big, so it
+// is exempt from the request timeout and the client body limit; the
+// handler bounds each entry instead.
+const SnapshotPath = "/v1/admin/snapshot"
+
+// RequireAdminToken serves next only to requests carrying token in
+// "Authorization: Bearer", answering 401 otherwise. With no token
+// configured the admin endpoints don't exist: every request gets 404.
+func RequireAdminToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			WriteError(w, r, http.StatusNotFound, CodeNotFound, "No such endpoint")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="repram-admin"`)
+			WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Admin endpoints need the node's admin token")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// ReasonWriteBandwidth is the reason on a 429 for a client over its write
+// bandwidth budget, rather than its request rate.
+const ReasonWriteBandwidth = "write_bandwidth"
+
+// SetWriteByteLimit budgets the bytes each client may write per second,
+// on top of the request rate limits: a client sending large values at the
+// request limit would otherwise fill the store in seconds. Clients are
+// told apart as by the request limits, by known API token or else by IP.
+// A write is let through whenever the client's bucket isn't empty and its
+// body is charged as it is read, so a value larger than the burst still
+// goes through once; the bucket goes into debt and the client's next write
+// waits until it is paid back. Call before serving requests.
+func (sm *SecurityMiddleware) SetWriteByteLimit(rate, burst int) {
+	sm.writeBytes = NewRateLimiter(rate, burst)
+}
+
+// writeByteKey returns the bucket r's body is charged to: its known API
+// token, or its client IP.
+func (sm *SecurityMiddleware) writeByteKey(r *http.Request, clientIP string) string {
+	if token := bearerToken(r); sm.tokens != nil && sm.tokens.Known(token) {
+		return "token:" + token
+	}
+	return "ip:" + clientIP
+}
+
+// allowWriteBytes admits r if it is not a write, or its client has write
+// bandwidth left, and then charges its body as it is read. It returns how
+// long a rejected client should wait.
+func (sm *SecurityMiddleware) allowWriteBytes(r *http.Request, clientIP string) (bool, time.Duration) {
+	if sm.writeBytes == nil || RequestClass(r) != ClassWrite {
+		return true, 0
+	}
+	key := sm.writeByteKey(r, clientIP)
+	if !sm.writeBytes.inCredit(key, time.Now()) {
+		return false, sm.writeBytes.RetryAfter(key)
+	}
+	r.Body = &chargedBody{ReadCloser: r.Body, charge: func(n int) {
+		sm.writeBytes.charge(key, n, time.Now())
+	}}
+	return true, 0
+}
+
+// inCredit reports whether key's bucket holds any tokens at now. Unlike
+// Allow it takes none.
+func (rl *RateLimiter) inCredit(key string, now time.Time) bool {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	return rl.refill(key, now).tokens > 0
+}
+
+// charge takes n tokens from key's bucket at now, leaving it in debt if it
+// holds fewer.
+func (rl *RateLimiter) charge(key string, n int, now time.Time) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.refill(key, now).tokens -= float64(n)
+}
+
+// chargedBody charges the bytes read from a request body to its client's
+// write bandwidth.
+type chargedBody struct {
+	io.ReadCloser
+	charge func(n int)
+}
+
+func (b *chargedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.charge(n)
+	}
+	return n, err
+}
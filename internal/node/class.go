@@ -0,0 +1,39 @@
+package node
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Endpoint classes, for limits and timeouts that differ between cheap reads
+// and writes that wait on quorum.
+const (
+	ClassWrite  = "write"  // PUT /v1/data/{key}
+	ClassRead   = "read"   // GET and HEAD /v1/data/{key}, /v1/keys, /v1/scan
+	ClassGossip = "gossip" // gossip and bootstrap, from peers
+	ClassAdmin  = "admin"  // health, status, metrics, topology and the rest
+)
+
+// Classes lists every endpoint class.
+var Classes = []string{ClassWrite, ClassRead, ClassGossip, ClassAdmin}
+
+// RequestClass returns the endpoint class r belongs to.
+func RequestClass(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case isPeerPath(path):
+		return ClassGossip
+	case strings.HasPrefix(path, "/v1/data/"):
+		switch r.Method {
+		case http.MethodPut:
+			return ClassWrite
+		case http.MethodGet, http.MethodHead:
+			return ClassRead
+		}
+	case path == "/v1/keys", path == "/v1/scan", path == "/scan", path == "/raw/scan":
+		if r.Method == http.MethodGet {
+			return ClassRead
+		}
+	}
+	return ClassAdmin
+}
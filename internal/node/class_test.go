@@ -0,0 +1,29 @@
+package node
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestClass(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{"PUT", "/v1/data/k", ClassWrite},
+		{"GET", "/v1/data/k", ClassRead},
+		{"HEAD", "/v1/data/k", ClassRead},
+		{"OPTIONS", "/v1/data/k", ClassAdmin},
+		{"GET", "/v1/keys", ClassRead},
+		{"GET", "/v1/scan", ClassRead},
+		{"GET", "/raw/scan", ClassRead},
+		{"POST", "/v1/gossip/message", ClassGossip},
+		{"POST", "/v1/bootstrap", ClassGossip},
+		{"GET", "/v1/health", ClassAdmin},
+		{"GET", "/v1/metrics", ClassAdmin},
+	}
+	for _, tt := range tests {
+		if got := RequestClass(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("RequestClass(%s %s) = %s, want %s", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
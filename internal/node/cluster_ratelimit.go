@@ -0,0 +1,259 @@
+package node
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClusterRateWindow is the counting window for cluster-wide rate limits.
+// Limits are enforced with a sliding-window estimate over the current and
+// previous window, so the window length bounds how long a burst is
+// remembered, not how coarse the limit is.
+const ClusterRateWindow = 10 * time.Second
+
+// clusterRatePublishInterval is how often a node gossips its local counts.
+// Peers see a client's traffic on this node at most one interval late.
+const clusterRatePublishInterval = time.Second
+
+// maxRateDigestKeys caps the number of clients in a single digest. Only the
+// busiest clients are included; clients below the cut are far from any
+// limit and are enforced locally until they climb into it.
+const maxRateDigestKeys = 1000
+
+// RateDigest is one node's request counts for a counting window. Counts are
+// per-node totals that only grow within a window, so merging takes the
+// maximum and digests can be lost, duplicated, or reordered safely
+// (a grow-only counter CRDT).
+type RateDigest struct {
+	Window int64          `json:"window"` // window start, unix seconds
+	Counts map[string]int `json:"counts"`
+}
+
+// rateWindow holds the local and remote counts for one counting window.
+type rateWindow struct {
+	start  int64
+	local  map[string]int
+	remote map[string]map[string]int // node ID → client key → count
+}
+
+func newRateWindow(start int64) *rateWindow {
+	return &rateWindow{
+		start:  start,
+		local:  make(map[string]int),
+		remote: make(map[string]map[string]int),
+	}
+}
+
+func (w *rateWindow) total(key string) int {
+	n := w.local[key]
+	for _, counts := range w.remote {
+		n += counts[key]
+	}
+	return n
+}
+
+// ClusterRateLimiter enforces a per-client rate across the whole cluster.
+// Each node counts the requests it serves and periodically gossips a
+// RateDigest; a request is allowed only while the cluster-wide estimate for
+// the client stays under the limit. This stops a client from multiplying
+// its rate by spreading requests across nodes, at the cost of up to one
+// publish interval of lag.
+type ClusterRateLimiter struct {
+	mutex     sync.Mutex
+	rate      int // requests per second per client, cluster-wide
+	cur       *rateWindow
+	prev      *rateWindow
+	published int64 // start of the last window whose final counts were sent
+	publish   func([]byte)
+	now       func() time.Time
+	stop      chan struct{}
+}
+
+// NewClusterRateLimiter creates a limiter allowing rate requests per second
+// per client across the cluster. publish is called with an encoded
+// RateDigest to gossip to peers; received digests are passed to Merge.
+func NewClusterRateLimiter(rate int, publish func([]byte)) *ClusterRateLimiter {
+	cl := newClusterRateLimiter(rate, publish, time.Now)
+	go cl.publishLoop()
+	return cl
+}
+
+func newClusterRateLimiter(rate int, publish func([]byte), now func() time.Time) *ClusterRateLimiter {
+	start := windowStart(now())
+	return &ClusterRateLimiter{
+		rate:      rate,
+		cur:       newRateWindow(start),
+		prev:      newRateWindow(start - windowSeconds()),
+		published: start - windowSeconds(),
+		publish:   publish,
+		now:       now,
+		stop:      make(chan struct{}),
+	}
+}
+
+func windowSeconds() int64 {
+	return int64(ClusterRateWindow / time.Second)
+}
+
+func windowStart(t time.Time) int64 {
+	s := t.Unix()
+	return s - s%windowSeconds()
+}
+
+// advanceLocked rolls the windows forward to the one containing now.
+func (cl *ClusterRateLimiter) advanceLocked(now time.Time) {
+	start := windowStart(now)
+	switch {
+	case start == cl.cur.start:
+		return
+	case start == cl.cur.start+windowSeconds():
+		cl.prev = cl.cur
+	default:
+		// Idle for more than a window: nothing recent to remember
+		cl.prev = newRateWindow(start - windowSeconds())
+	}
+	cl.cur = newRateWindow(start)
+}
+
+// estimateLocked is the sliding-window estimate of a client's requests over
+// the last ClusterRateWindow: the current window's count plus the previous
+// window's count weighted by how much of it is still inside the slide.
+func (cl *ClusterRateLimiter) estimateLocked(key string, now time.Time) float64 {
+	elapsed := now.Sub(time.Unix(cl.cur.start, 0))
+	weight := 1 - float64(elapsed)/float64(ClusterRateWindow)
+	return float64(cl.cur.total(key)) + float64(cl.prev.total(key))*weight
+}
+
+// Allow counts a request from key and reports whether the client is still
+// under the cluster-wide limit.
+func (cl *ClusterRateLimiter) Allow(key string) bool {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	now := cl.now()
+	cl.advanceLocked(now)
+	limit := float64(cl.rate) * ClusterRateWindow.Seconds()
+	if cl.estimateLocked(key, now) >= limit {
+		return false
+	}
+	cl.cur.local[key]++
+	return true
+}
+
+// Merge applies a digest gossiped by another node. Digests for windows other
+// than the current or previous one (stale, or from a badly skewed clock)
+// are ignored.
+func (cl *ClusterRateLimiter) Merge(from string, data []byte) error {
+	var d RateDigest
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.advanceLocked(cl.now())
+	var w *rateWindow
+	switch d.Window {
+	case cl.cur.start:
+		w = cl.cur
+	case cl.prev.start:
+		w = cl.prev
+	default:
+		return nil
+	}
+
+	counts := w.remote[from]
+	if counts == nil {
+		counts = make(map[string]int, len(d.Counts))
+		w.remote[from] = counts
+	}
+	for key, n := range d.Counts {
+		if n > counts[key] {
+			counts[key] = n
+		}
+	}
+	return nil
+}
+
+// digestsLocked returns the digests to publish now: the final counts of the
+// previous window if they haven't been sent since it closed, and the
+// running counts of the current window. Empty windows are skipped.
+func (cl *ClusterRateLimiter) digestsLocked() []RateDigest {
+	cl.advanceLocked(cl.now())
+	var digests []RateDigest
+	if cl.published < cl.prev.start {
+		if len(cl.prev.local) > 0 {
+			digests = append(digests, newRateDigest(cl.prev))
+		}
+		cl.published = cl.prev.start
+	}
+	if len(cl.cur.local) > 0 {
+		digests = append(digests, newRateDigest(cl.cur))
+	}
+	return digests
+}
+
+func newRateDigest(w *rateWindow) RateDigest {
+	counts := w.local
+	if len(counts) > maxRateDigestKeys {
+		keys := make([]string, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+		top := make(map[string]int, maxRateDigestKeys)
+		for _, key := range keys[:maxRateDigestKeys] {
+			top[key] = counts[key]
+		}
+		counts = top
+	} else {
+		copied := make(map[string]int, len(counts))
+		for key, n := range counts {
+			copied[key] = n
+		}
+		counts = copied
+	}
+	return RateDigest{Window: w.start, Counts: counts}
+}
+
+func (cl *ClusterRateLimiter) publishLoop() {
+	ticker := time.NewTicker(clusterRatePublishInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cl.mutex.Lock()
+			digests := cl.digestsLocked()
+			cl.mutex.Unlock()
+
+			for _, d := range digests {
+				data, err := json.Marshal(d)
+				if err != nil {
+					continue
+				}
+				cl.publish(data)
+			}
+		case <-cl.stop:
+			return
+		}
+	}
+}
+
+func (cl *ClusterRateLimiter) Close() {
+	close(cl.stop)
+}
+
+// SetClusterRateLimit adds a cluster-wide per-IP limit. Requests carrying a
+// known API token are exempt, like they are from the local per-IP limit;
+// their per-token rate is the operator's choice.
+func (sm *SecurityMiddleware) SetClusterRateLimit(cl *ClusterRateLimiter) {
+	sm.AddRateDimension(RateDimension{
+		Name:    "cluster",
+		Key:     sm.ipRateKey,
+		Limiter: cl,
+	})
+}
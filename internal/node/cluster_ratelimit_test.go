@@ -0,0 +1,181 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for ClusterRateLimiter tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// newTestClusterLimiter creates a limiter on a fake clock without the
+// publish loop; tests exchange digests explicitly.
+func newTestClusterLimiter(rate int, clock *fakeClock) *ClusterRateLimiter {
+	return newClusterRateLimiter(rate, func([]byte) {}, clock.now)
+}
+
+// exchange delivers every pending digest from one limiter to another.
+func exchange(t *testing.T, from *ClusterRateLimiter, fromID string, to *ClusterRateLimiter) {
+	t.Helper()
+	from.mutex.Lock()
+	digests := from.digestsLocked()
+	from.mutex.Unlock()
+	for _, d := range digests {
+		data, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := to.Merge(fromID, data); err != nil {
+			t.Fatalf("Merge: %v", err)
+		}
+	}
+}
+
+func TestClusterRateLimiterEnforcesLocally(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	cl := newTestClusterLimiter(1, clock) // 10 requests per 10s window
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if cl.Allow("10.0.0.1") {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Fatalf("allowed = %d, want 10", allowed)
+	}
+	if !cl.Allow("10.0.0.2") {
+		t.Fatal("other clients should not be affected")
+	}
+}
+
+func TestClusterRateLimiterSharesCountsAcrossNodes(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	a := newTestClusterLimiter(1, clock)
+	b := newTestClusterLimiter(1, clock)
+
+	// Client spends 8 of its 10 requests on node A
+	for i := 0; i < 8; i++ {
+		if !a.Allow("10.0.0.1") {
+			t.Fatalf("request %d on A should be allowed", i)
+		}
+	}
+	exchange(t, a, "node-a", b)
+
+	// Node B only has 2 left for that client
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if b.Allow("10.0.0.1") {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Fatalf("allowed on B = %d, want 2", allowed)
+	}
+
+	// Redelivering the same digest must not double-count
+	exchange(t, a, "node-a", b)
+	b.mutex.Lock()
+	total := b.cur.total("10.0.0.1")
+	b.mutex.Unlock()
+	if total != 10 {
+		t.Fatalf("cluster total = %d, want 10 after duplicate digests", total)
+	}
+}
+
+func TestClusterRateLimiterSlidingWindow(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	cl := newTestClusterLimiter(1, clock)
+
+	for i := 0; i < 10; i++ {
+		cl.Allow("10.0.0.1")
+	}
+
+	// Halfway through the next window, half of the previous window's
+	// count still applies: 10*0.5 = 5 of 10 used
+	clock.t = clock.t.Add(ClusterRateWindow + ClusterRateWindow/2)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if cl.Allow("10.0.0.1") {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("allowed = %d, want 5", allowed)
+	}
+
+	// After two full idle windows the client starts fresh
+	clock.t = clock.t.Add(3 * ClusterRateWindow)
+	if !cl.Allow("10.0.0.1") {
+		t.Fatal("request should be allowed after idle windows")
+	}
+}
+
+func TestClusterRateLimiterIgnoresStaleDigests(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	cl := newTestClusterLimiter(1, clock)
+
+	stale, _ := json.Marshal(RateDigest{
+		Window: windowStart(clock.t) - 5*int64(ClusterRateWindow/time.Second),
+		Counts: map[string]int{"10.0.0.1": 100},
+	})
+	if err := cl.Merge("node-b", stale); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if !cl.Allow("10.0.0.1") {
+		t.Fatal("stale digest should not count against the client")
+	}
+
+	if err := cl.Merge("node-b", []byte("not json")); err == nil {
+		t.Fatal("expected error for malformed digest")
+	}
+}
+
+func TestClusterRateLimiterPublishesFinalPreviousWindow(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	a := newTestClusterLimiter(1, clock)
+	b := newTestClusterLimiter(1, clock)
+
+	for i := 0; i < 6; i++ {
+		a.Allow("10.0.0.1")
+	}
+
+	// The window closes before A publishes; its final counts still reach B
+	clock.t = clock.t.Add(ClusterRateWindow)
+	exchange(t, a, "node-a", b)
+
+	b.mutex.Lock()
+	prev := b.prev.total("10.0.0.1")
+	b.mutex.Unlock()
+	if prev != 6 {
+		t.Fatalf("previous window total on B = %d, want 6", prev)
+	}
+
+	// The closed window is published only once
+	a.mutex.Lock()
+	digests := a.digestsLocked()
+	a.mutex.Unlock()
+	if len(digests) != 0 {
+		t.Fatalf("got %d digests with no new traffic, want 0", len(digests))
+	}
+}
+
+func TestRateDigestKeepsBusiestClients(t *testing.T) {
+	w := newRateWindow(0)
+	for i := 0; i < maxRateDigestKeys+10; i++ {
+		w.local[fmt.Sprintf("client-%d", i)] = 1
+	}
+	w.local["heavy"] = 500
+
+	d := newRateDigest(w)
+	if len(d.Counts) != maxRateDigestKeys {
+		t.Fatalf("digest has %d keys, want %d", len(d.Counts), maxRateDigestKeys)
+	}
+	if d.Counts["heavy"] != 500 {
+		t.Fatal("busiest client missing from capped digest")
+	}
+}
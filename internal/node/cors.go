@@ -0,0 +1,109 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CORSOrigins is the set of browser origins allowed to call the API.
+// Patterns are "*" (any origin), an exact origin such as
+// "https://app.example.com", or a subdomain wildcard such as
+// "https://*.example.com". Matching is on the whole origin; a pattern never
+// matches as a substring.
+type CORSOrigins struct {
+	any       bool
+	exact     map[string]bool
+	wildcards []corsWildcard
+}
+
+// corsWildcard matches origins "<scheme>://<anything>.<suffix>".
+type corsWildcard struct {
+	scheme string
+	suffix string // ".example.com", including any ":port"
+}
+
+// ParseCORSOrigins compiles origin patterns. An empty list allows no
+// cross-origin requests.
+func ParseCORSOrigins(patterns []string) (*CORSOrigins, error) {
+	c := &CORSOrigins{exact: make(map[string]bool)}
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			c.any = true
+			continue
+		}
+
+		scheme, host, ok := strings.Cut(strings.ToLower(pattern), "://")
+		if !ok || scheme == "" || host == "" {
+			return nil, fmt.Errorf("origin %q must be \"*\" or scheme://host[:port]", pattern)
+		}
+		if strings.ContainsAny(host, "/?#") {
+			return nil, fmt.Errorf("origin %q must not include a path", pattern)
+		}
+
+		if rest, wildcard := strings.CutPrefix(host, "*."); wildcard {
+			if rest == "" || strings.Contains(rest, "*") {
+				return nil, fmt.Errorf("origin %q: wildcard must be followed by a domain", pattern)
+			}
+			c.wildcards = append(c.wildcards, corsWildcard{scheme: scheme, suffix: "." + rest})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("origin %q: '*' is only allowed as the leftmost label (https://*.example.com)", pattern)
+		}
+		c.exact[scheme+"://"+host] = true
+	}
+	return c, nil
+}
+
+// Allowed reports whether origin may make cross-origin requests.
+func (c *CORSOrigins) Allowed(origin string) bool {
+	if c == nil || origin == "" {
+		return false
+	}
+	if c.any {
+		return true
+	}
+
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	normalized := u.Scheme + "://" + u.Host
+	if c.exact[normalized] {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if u.Scheme == w.scheme && len(u.Host) > len(w.suffix) && strings.HasSuffix(u.Host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSMiddleware answers preflight requests and sets CORS headers for
+// allowed origins. Requests from other origins get no CORS headers, so
+// browsers refuse to expose the response.
+func CORSMiddleware(origins *CORSOrigins) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origins.Allowed(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-TTL, X-Dedup, X-Priority, X-Replication, X-Replication-Status, X-Content-SHA256, If-None-Match, Authorization")
+				w.Header().Set("Access-Control-Expose-Headers", "X-Repram-Peers, X-Repram-Quorum, X-Replication-Warning")
+				w.Header().Set("Access-Control-Max-Age", "3600")
+			}
+
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
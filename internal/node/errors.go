@@ -0,0 +1,150 @@
+package node
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of every error response. Codes are
+// part of the API: clients branch on them, so an existing code never changes
+// meaning. Messages are for humans and may change.
+const (
+	CodeBadRequest       = "bad_request"        // 400: malformed request
+	CodeInvalidKey       = "invalid_key"        // 400: key breaks the key grammar (see "reason")
+	CodeInvalidJSON      = "invalid_json"       // 400: body is not the expected JSON
+	CodeInvalidMessage   = "invalid_message"    // 400: gossip message fails validation (see "reason")
+	CodeChecksumMismatch = "checksum_mismatch"  // 400: body doesn't match its X-Content-SHA256
+	CodeInvalidTTL       = "invalid_ttl"        // 400: ttl or X-TTL is not seconds or a duration
+	CodeUnauthorized     = "unauthorized"       // 401: admin endpoint without the node's admin token
+	CodeForbidden        = "forbidden"          // 403: denied by the operator's request policy
+	CodeInvalidSignature = "invalid_signature"  // 403: gossip request missing or failing HMAC verification
+	CodeNotFound         = "not_found"          // 404: key or route does not exist
+	CodeMethodNotAllowed = "method_not_allowed" // 405
+	CodePayloadTooLarge  = "payload_too_large"  // 413
+	CodeRateLimited      = "rate_limited"       // 429: retry later
+	CodeInternal         = "internal_error"     // 500
+	CodeTimeout          = "timeout"            // 503: request exceeded the server timeout
+	CodeOverloaded       = "overloaded"         // 503: shed under memory pressure or at an in-flight limit; see Retry-After
+	CodeDraining         = "draining"           // 503: node refusing writes for maintenance; write to another node
+	CodeReadOnly         = "read_only"          // 503: node set read-only by its operator; write to another node
+	CodeStorageFull      = "storage_full"       // 507: node at capacity; frees up as keys expire
+)
+
+// retryableCodes are errors a client can expect to succeed if it retries
+// the same request later.
+var retryableCodes = map[string]bool{
+	CodeRateLimited: true,
+	CodeInternal:    true,
+	CodeTimeout:     true,
+	CodeOverloaded:  true,
+	CodeDraining:    true,
+	CodeReadOnly:    true,
+	CodeStorageFull: true,
+}
+
+// APIError is the JSON envelope for every non-2xx response.
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+	Retryable bool   `json:"retryable"`
+	Reason    string `json:"reason,omitempty"` // finer-grained cause, e.g. for invalid_key
+}
+
+const requestIDKey contextKey = "request_id"
+
+// maxRequestIDLength bounds client-supplied X-Request-ID values.
+const maxRequestIDLength = 64
+
+// RequestIDMiddleware tags each request with an ID, echoed in the
+// X-Request-ID response header and in error bodies. A well-formed
+// X-Request-ID from the client is kept so traces line up end to end.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestID returns the ID assigned by RequestIDMiddleware, or "" if the
+// request did not pass through it.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// newAPIError builds the envelope for r. Requests that bypassed
+// RequestIDMiddleware (unmatched routes) get a fresh ID.
+func newAPIError(w http.ResponseWriter, r *http.Request, code, message string) APIError {
+	id := RequestID(r)
+	if id == "" {
+		id = newRequestID()
+		w.Header().Set("X-Request-ID", id)
+	}
+	return APIError{
+		Code:      code,
+		Message:   message,
+		RequestID: id,
+		Retryable: retryableCodes[code],
+	}
+}
+
+// WriteError sends a JSON error envelope with the given status.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeAPIError(w, status, newAPIError(w, r, code, message))
+}
+
+// WriteErrorReason is WriteError with a machine-readable reason refining
+// the code, as for invalid_key.
+func WriteErrorReason(w http.ResponseWriter, r *http.Request, status int, code, reason, message string) {
+	apiErr := newAPIError(w, r, code, message)
+	apiErr.Reason = reason
+	writeAPIError(w, status, apiErr)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, apiErr APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErr)
+}
+
+// NotFoundHandler and MethodNotAllowedHandler replace the router's plain-text
+// defaults so unmatched requests get the same envelope.
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "No such endpoint")
+	})
+}
+
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed for this endpoint")
+	})
+}
@@ -0,0 +1,99 @@
+package node
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type inflightMetrics struct {
+	inflight *prometheus.GaugeVec
+	shed     *prometheus.CounterVec
+}
+
+var (
+	sharedInflightMetrics     *inflightMetrics
+	sharedInflightMetricsOnce sync.Once
+)
+
+// newInflightMetrics returns the metrics registered on reg. A nil reg
+// means the default registry, whose metrics every limiter shares.
+func newInflightMetrics(reg prometheus.Registerer) *inflightMetrics {
+	if reg == nil {
+		sharedInflightMetricsOnce.Do(func() {
+			sharedInflightMetrics = registerInflightMetrics(prometheus.DefaultRegisterer)
+		})
+		return sharedInflightMetrics
+	}
+	return registerInflightMetrics(reg)
+}
+
+func registerInflightMetrics(reg prometheus.Registerer) *inflightMetrics {
+	return &inflightMetrics{
+		inflight: registerCollector(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "repram_http_requests_in_flight",
+			Help: "HTTP requests being served, by endpoint class",
+		}, []string{"class"})),
+		shed: registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "repram_http_requests_shed_total",
+			Help: "HTTP requests rejected because their endpoint class was at its in-flight limit",
+		}, []string{"class"})),
+	}
+}
+
+// InflightLimiter caps the requests served at once per endpoint class. A
+// request over its class's cap gets 503 overloaded with a Retry-After
+// straight away, instead of queueing until TimeoutMiddleware gives up on
+// it; a burst of PUTs waiting on quorum otherwise ties up goroutines and
+// memory for the whole write timeout.
+type InflightLimiter struct {
+	slots   map[string]chan struct{} // class → one token per request in flight; absent = unlimited
+	metrics *inflightMetrics
+}
+
+// NewInflightLimiter creates a limiter with the given per-class caps (see
+// Classes). A class missing from limits, or with a limit of 0, is counted
+// but not limited.
+func NewInflightLimiter(limits map[string]int) *InflightLimiter {
+	return NewInflightLimiterWithRegisterer(nil, limits)
+}
+
+// NewInflightLimiterWithRegisterer is NewInflightLimiter with its metrics
+// registered on reg instead of the default registry. A nil reg means the
+// default registry.
+func NewInflightLimiterWithRegisterer(reg prometheus.Registerer, limits map[string]int) *InflightLimiter {
+	l := &InflightLimiter{
+		slots:   make(map[string]chan struct{}),
+		metrics: newInflightMetrics(reg),
+	}
+	for class, n := range limits {
+		if n > 0 {
+			l.slots[class] = make(chan struct{}, n)
+		}
+	}
+	return l
+}
+
+// Middleware sheds requests over their class's limit. Install it before
+// TimeoutMiddleware, so shed requests don't start the timeout.
+func (l *InflightLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := RequestClass(r)
+		if slots, ok := l.slots[class]; ok {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				l.metrics.shed.WithLabelValues(class).Inc()
+				w.Header().Set("Retry-After", "1")
+				WriteError(w, r, http.StatusServiceUnavailable, CodeOverloaded, "Too many "+class+" requests in flight")
+				return
+			}
+		}
+		gauge := l.metrics.inflight.WithLabelValues(class)
+		gauge.Inc()
+		defer gauge.Dec()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestInflightLimiterShedsOverLimit(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	handler := NewInflightLimiter(map[string]int{ClassWrite: 1}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	shedBefore := shedCount(t, ClassWrite)
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("PUT", "/v1/data/a", nil))
+		done <- rec.Code
+	}()
+	<-entered
+
+	// A second write is shed at once; reads are in another class
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("PUT", "/v1/data/b", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("second write: %d, Retry-After %q; want 503 with Retry-After 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var apiErr APIError
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil || apiErr.Code != CodeOverloaded {
+		t.Fatalf("error = %+v (%v), want overloaded", apiErr, err)
+	}
+	if n := shedCount(t, ClassWrite); n != shedBefore+1 {
+		t.Fatalf("shed counter = %v, want %v", n, shedBefore+1)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/data/a", nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("read while writes are full: %d, want it served", rec.Code)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusCreated {
+		t.Fatalf("first write: %d, want 201", code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("PUT", "/v1/data/c", nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("write after the slot freed up: %d, want 201", rec.Code)
+	}
+}
+
+func TestInflightLimiterCountsRequests(t *testing.T) {
+	var during float64
+	handler := NewInflightLimiter(nil).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = inflightCount(t, ClassGossip)
+	}))
+	before := inflightCount(t, ClassGossip)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/gossip/message", nil))
+	if during != before+1 {
+		t.Fatalf("in-flight gauge during request = %v, want %v", during, before+1)
+	}
+	if after := inflightCount(t, ClassGossip); after != before {
+		t.Fatalf("in-flight gauge after request = %v, want %v", after, before)
+	}
+}
+
+func TestInflightLimiterRegistersOnProvidedRegistry(t *testing.T) {
+	regA, regB := prometheus.NewRegistry(), prometheus.NewRegistry()
+	handler := NewInflightLimiterWithRegisterer(regA, map[string]int{ClassWrite: 0}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// A second limiter on the same registry shares its metrics
+	NewInflightLimiterWithRegisterer(regA, nil)
+	NewInflightLimiterWithRegisterer(regB, nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/v1/data/k", nil))
+	for name, reg := range map[string]*prometheus.Registry{"A": regA, "B": regB} {
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		served := 0
+		for _, mf := range families {
+			if mf.GetName() == "repram_http_requests_in_flight" {
+				served = len(mf.GetMetric())
+			}
+		}
+		if want := map[string]int{"A": 1, "B": 0}[name]; served != want {
+			t.Errorf("registry %s has in-flight gauges for %d classes, want %d", name, served, want)
+		}
+	}
+}
+
+func shedCount(t *testing.T, class string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := newInflightMetrics(nil).shed.WithLabelValues(class).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func inflightCount(t *testing.T, class string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := newInflightMetrics(nil).inflight.WithLabelValues(class).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
@@ -0,0 +1,84 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxKeyLength is the longest key accepted when KeyRules.MaxLength is 0.
+const DefaultMaxKeyLength = 512
+
+// KeyRules is the key grammar enforced at the API edge. A valid key is
+// 1 to MaxLength bytes of UTF-8 with no control or whitespace characters,
+// and does not start with a reserved prefix. Beyond that, keys stay opaque;
+// conventions like "namespace:" prefixes are not enforced.
+type KeyRules struct {
+	MaxLength        int      // bytes; 0 = DefaultMaxKeyLength
+	ReservedPrefixes []string // prefixes kept for internal use
+}
+
+// KeyError describes why a key was rejected. Reason is a stable,
+// machine-readable identifier; Message is for humans.
+type KeyError struct {
+	Reason  string
+	Message string
+}
+
+func (e *KeyError) Error() string {
+	return e.Message
+}
+
+// Validate checks key against the grammar. Returns nil if it is valid.
+func (kr KeyRules) Validate(key string) *KeyError {
+	maxLength := kr.MaxLength
+	if maxLength == 0 {
+		maxLength = DefaultMaxKeyLength
+	}
+
+	if key == "" {
+		return &KeyError{Reason: "empty", Message: "key must not be empty"}
+	}
+	if len(key) > maxLength {
+		return &KeyError{Reason: "too_long", Message: fmt.Sprintf("key is %d bytes; the maximum is %d", len(key), maxLength)}
+	}
+	if !utf8.ValidString(key) {
+		return &KeyError{Reason: "invalid_utf8", Message: "key must be valid UTF-8"}
+	}
+	for i, c := range key {
+		if unicode.IsControl(c) {
+			return &KeyError{Reason: "control_character", Message: fmt.Sprintf("key contains control character %U at byte %d", c, i)}
+		}
+		if unicode.IsSpace(c) {
+			return &KeyError{Reason: "whitespace", Message: fmt.Sprintf("key contains whitespace %U at byte %d", c, i)}
+		}
+	}
+	for _, prefix := range kr.ReservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return &KeyError{Reason: "reserved_prefix", Message: fmt.Sprintf("keys starting with %q are reserved", prefix)}
+		}
+	}
+	return nil
+}
+
+// KeyValidationMiddleware rejects /v1/data/{key} requests whose key breaks
+// the grammar with 400 Bad Request and an invalid_key error whose "reason"
+// says which rule was broken.
+func KeyValidationMiddleware(rules KeyRules) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, isData := strings.CutPrefix(r.URL.Path, "/v1/data/")
+			if isData && r.Method != "OPTIONS" {
+				if keyErr := rules.Validate(key); keyErr != nil {
+					apiErr := newAPIError(w, r, CodeInvalidKey, keyErr.Message)
+					apiErr.Reason = keyErr.Reason
+					writeAPIError(w, http.StatusBadRequest, apiErr)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
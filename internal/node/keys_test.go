@@ -0,0 +1,51 @@
+package node
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyRulesAcceptsConventionalKeys(t *testing.T) {
+	rules := KeyRules{}
+	keys := []string{
+		"simple",
+		"lock:pipeline:stage-2",
+		"handoff:task-742:agent-a→agent-b",
+		"scratch:550e8400-e29b-41d4-a716-446655440000",
+		"user_selection",
+		strings.Repeat("k", DefaultMaxKeyLength),
+	}
+	for _, key := range keys {
+		if err := rules.Validate(key); err != nil {
+			t.Errorf("Validate(%q) = %v, want valid", key, err)
+		}
+	}
+}
+
+func TestKeyRulesRejections(t *testing.T) {
+	rules := KeyRules{MaxLength: 16, ReservedPrefixes: []string{"_repram:"}}
+	tests := []struct {
+		key    string
+		reason string
+	}{
+		{"", "empty"},
+		{strings.Repeat("k", 17), "too_long"},
+		{"bad\xffkey", "invalid_utf8"},
+		{"bad\x00key", "control_character"},
+		{"bad\x1bkey", "control_character"},
+		{"bad\u0085key", "control_character"},
+		{"two words", "whitespace"},
+		{"tab　key", "whitespace"},
+		{"_repram:meta", "reserved_prefix"},
+	}
+	for _, tt := range tests {
+		err := rules.Validate(tt.key)
+		if err == nil {
+			t.Errorf("Validate(%q) = nil, want %s", tt.key, tt.reason)
+			continue
+		}
+		if err.Reason != tt.reason {
+			t.Errorf("Validate(%q) reason = %s, want %s", tt.key, err.Reason, tt.reason)
+		}
+	}
+}
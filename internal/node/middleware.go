@@ -2,10 +2,13 @@ package node
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -17,19 +20,22 @@ type contextKey string
 
 const clientIPKey contextKey = "client_ip"
 
-// RateLimiter implements a simple token bucket rate limiter per IP
+// RateLimiter implements a token bucket rate limiter per IP. One mutex
+// guards every bucket: a check is a few arithmetic operations, so finer
+// locking would only add ways to get it wrong.
 type RateLimiter struct {
 	buckets map[string]*tokenBucket
-	mutex   sync.RWMutex
-	rate    int           // requests per second
-	burst   int           // max burst size
+	mutex   sync.Mutex
+	rate    int // requests per second
+	burst   int // max burst size
 	cleanup chan struct{}
 }
 
+// tokenBucket counts fractional tokens, so time between requests too short
+// to earn a whole token still counts toward the next one.
 type tokenBucket struct {
-	tokens    int
-	lastRefill time.Time
-	mutex     sync.Mutex
+	tokens float64
+	last   time.Time // when tokens was last brought up to date
 }
 
 func NewRateLimiter(rate, burst int) *RateLimiter {
@@ -45,39 +51,68 @@ func NewRateLimiter(rate, burst int) *RateLimiter {
 }
 
 func (rl *RateLimiter) Allow(ip string) bool {
+	return rl.allowAt(ip, time.Now())
+}
+
+func (rl *RateLimiter) allowAt(ip string, now time.Time) bool {
 	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	bucket := rl.refill(ip, now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true
+	}
+	return false
+}
+
+// refill brings ip's bucket up to date at now, creating it full, and
+// returns it. The caller holds rl.mutex.
+func (rl *RateLimiter) refill(ip string, now time.Time) *tokenBucket {
 	bucket, exists := rl.buckets[ip]
 	if !exists {
-		bucket = &tokenBucket{
-			tokens:     rl.burst,
-			lastRefill: time.Now(),
-		}
+		bucket = &tokenBucket{tokens: float64(rl.burst), last: now}
 		rl.buckets[ip] = bucket
+		return bucket
 	}
-	rl.mutex.Unlock()
-	
-	bucket.mutex.Lock()
-	defer bucket.mutex.Unlock()
-	
-	// Refill tokens based on time elapsed
-	now := time.Now()
-	elapsed := now.Sub(bucket.lastRefill)
-	tokensToAdd := int(elapsed.Seconds() * float64(rl.rate))
-	
-	if tokensToAdd > 0 {
-		bucket.tokens += tokensToAdd
-		if bucket.tokens > rl.burst {
-			bucket.tokens = rl.burst
-		}
-		bucket.lastRefill = now
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens += elapsed.Seconds() * float64(rl.rate)
+		bucket.last = now
 	}
-	
-	if bucket.tokens > 0 {
-		bucket.tokens--
-		return true
+	bucket.tokens = min(bucket.tokens, float64(rl.burst))
+	return bucket
+}
+
+// RetryAfter estimates how long until ip's bucket next has a token. It
+// implements RetryAdvisor.
+func (rl *RateLimiter) RetryAfter(ip string) time.Duration {
+	return rl.retryAfterAt(ip, time.Now())
+}
+
+func (rl *RateLimiter) retryAfterAt(ip string, now time.Time) time.Duration {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if _, exists := rl.buckets[ip]; !exists {
+		return 0
 	}
-	
-	return false
+	if rl.rate <= 0 {
+		return defaultRetryAfter
+	}
+	bucket := rl.refill(ip, now)
+	if bucket.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) / float64(rl.rate) * float64(time.Second))
+}
+
+// SetLimits changes the rate and burst applied to all clients. Existing
+// buckets keep their current tokens, capped to the new burst on next refill.
+func (rl *RateLimiter) SetLimits(rate, burst int) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.rate = rate
+	rl.burst = burst
 }
 
 func (rl *RateLimiter) cleanupStaleEntries() {
@@ -90,11 +125,9 @@ func (rl *RateLimiter) cleanupStaleEntries() {
 			rl.mutex.Lock()
 			cutoff := time.Now().Add(-10 * time.Minute)
 			for ip, bucket := range rl.buckets {
-				bucket.mutex.Lock()
-				if bucket.lastRefill.Before(cutoff) {
+				if bucket.last.Before(cutoff) {
 					delete(rl.buckets, ip)
 				}
-				bucket.mutex.Unlock()
 			}
 			rl.mutex.Unlock()
 		case <-rl.cleanup:
@@ -107,18 +140,36 @@ func (rl *RateLimiter) Close() {
 	close(rl.cleanup)
 }
 
+// Join attempts allowed per IP on /v1/bootstrap, on top of the per-IP
+// request limit. A node joins at start and again on each partition check,
+// so a few at once and one a second after that is plenty.
+const (
+	joinRate  = 1
+	joinBurst = 5
+)
+
 // SecurityMiddleware provides various security features
 type SecurityMiddleware struct {
-	rateLimiter    *RateLimiter
+	rateLimiter    *RateLimiter    // per-IP limit
+	joinLimiter    *RateLimiter    // per-IP limit on bootstrap requests
+	dimensions     []RateDimension // additional limits (token, namespace, ...)
+	tokens         *TokenLimiter   // nil unless SetTokenLimits was called
+	writeBytes     *RateLimiter    // write bandwidth per client, in bytes; nil = unlimited
 	maxRequestSize int64
+	maxGossipSize  int64 // body limit for peer endpoints; see SetMaxGossipSize
 	trustProxy     bool
+	hstsMaxAge     time.Duration // 0 = no Strict-Transport-Security header
+	policy         atomic.Pointer[Policy]   // nil = allow all
+	peerExempt     bool                     // peer endpoints skip the rate limits; see ExemptPeerPaths
+	peerGate       func(*http.Request) bool // nil exempts every peer request
 	metrics        *SecurityMetrics
 }
 
 type SecurityMetrics struct {
 	rateLimitedRequests   prometheus.Counter
 	oversizedRequests     prometheus.Counter
-	suspiciousRequests    prometheus.Counter
+	deniedRequests        prometheus.Counter
+	bandwidthLimited      prometheus.Counter
 }
 
 var (
@@ -126,37 +177,71 @@ var (
 	sharedSecurityMetricsOnce sync.Once
 )
 
-func newSecurityMetrics() *SecurityMetrics {
-	sharedSecurityMetricsOnce.Do(func() {
-		sharedSecurityMetrics = &SecurityMetrics{
-			rateLimitedRequests: prometheus.NewCounter(prometheus.CounterOpts{
-				Name: "repram_rate_limited_requests_total",
-				Help: "Total number of rate-limited requests",
-			}),
-			oversizedRequests: prometheus.NewCounter(prometheus.CounterOpts{
-				Name: "repram_oversized_requests_total",
-				Help: "Total number of oversized requests rejected",
-			}),
-			suspiciousRequests: prometheus.NewCounter(prometheus.CounterOpts{
-				Name: "repram_suspicious_requests_total",
-				Help: "Total number of suspicious requests detected",
-			}),
+// newSecurityMetrics returns the counters registered on reg. A nil reg
+// means the default registry, whose counters every middleware shares.
+func newSecurityMetrics(reg prometheus.Registerer) *SecurityMetrics {
+	if reg == nil {
+		sharedSecurityMetricsOnce.Do(func() {
+			sharedSecurityMetrics = registerSecurityMetrics(prometheus.DefaultRegisterer)
+		})
+		return sharedSecurityMetrics
+	}
+	return registerSecurityMetrics(reg)
+}
+
+func registerSecurityMetrics(reg prometheus.Registerer) *SecurityMetrics {
+	return &SecurityMetrics{
+		rateLimitedRequests: registerCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "repram_rate_limited_requests_total",
+			Help: "Total number of rate-limited requests",
+		})),
+		oversizedRequests: registerCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "repram_oversized_requests_total",
+			Help: "Total number of oversized requests rejected",
+		})),
+		deniedRequests: registerCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "repram_suspicious_requests_total",
+			Help: "Total number of requests denied by the request policy",
+		})),
+		bandwidthLimited: registerCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "repram_write_bandwidth_limited_total",
+			Help: "Total number of writes rejected for exceeding the client's write bandwidth",
+		})),
+	}
+}
+
+// registerCollector registers c on reg, or returns the collector already
+// registered under its name, so middlewares sharing a registry share
+// metrics.
+func registerCollector[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var exists prometheus.AlreadyRegisteredError
+		if errors.As(err, &exists) {
+			if existing, ok := exists.ExistingCollector.(C); ok {
+				return existing
+			}
 		}
-		prometheus.MustRegister(
-			sharedSecurityMetrics.rateLimitedRequests,
-			sharedSecurityMetrics.oversizedRequests,
-			sharedSecurityMetrics.suspiciousRequests,
-		)
-	})
-	return sharedSecurityMetrics
+		panic(err)
+	}
+	return c
 }
 
 func NewSecurityMiddleware(rateLimit, burst int, maxRequestSize int64, trustProxy bool) *SecurityMiddleware {
+	return NewSecurityMiddlewareWithRegisterer(nil, rateLimit, burst, maxRequestSize, trustProxy)
+}
+
+// NewSecurityMiddlewareWithRegisterer is NewSecurityMiddleware with its
+// metrics registered on reg instead of the default registry, for running
+// several nodes in one process that each expose their own metrics. A nil
+// reg means the default registry.
+func NewSecurityMiddlewareWithRegisterer(reg prometheus.Registerer, rateLimit, burst int, maxRequestSize int64, trustProxy bool) *SecurityMiddleware {
 	return &SecurityMiddleware{
 		rateLimiter:    NewRateLimiter(rateLimit, burst),
+		joinLimiter:    NewRateLimiter(joinRate, joinBurst),
 		maxRequestSize: maxRequestSize,
+		maxGossipSize:  DefaultMaxGossipSize,
 		trustProxy:     trustProxy,
-		metrics:        newSecurityMetrics(),
+		metrics:        newSecurityMetrics(reg),
 	}
 }
 
@@ -167,23 +252,38 @@ func (sm *SecurityMiddleware) Middleware(next http.Handler) http.Handler {
 		
 		// Check rate limiting
 		clientIP := sm.getClientIP(r)
-		if !sm.rateLimiter.Allow(clientIP) {
+		if rejected, wait := sm.allowRate(r, clientIP); rejected != "" {
+			sm.metrics.rateLimitedRequests.Inc()
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			WriteError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+			return
+		}
+		if r.URL.Path == "/v1/bootstrap" && sm.joinLimiter != nil && !sm.joinLimiter.Allow(clientIP) {
 			sm.metrics.rateLimitedRequests.Inc()
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			w.Header().Set("Retry-After", retryAfterSeconds(sm.joinLimiter.RetryAfter(clientIP)))
+			WriteError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Too many join attempts")
 			return
 		}
 		
 		// Check request size
-		if r.ContentLength > sm.maxRequestSize {
+		if r.ContentLength > sm.RequestSizeLimit(r) {
 			sm.metrics.oversizedRequests.Inc()
-			http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+			WriteError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request too large")
 			return
 		}
 		
-		// Check for suspicious patterns
-		if sm.isSuspiciousRequest(r) {
-			sm.metrics.suspiciousRequests.Inc()
-			http.Error(w, "Forbidden", http.StatusForbidden)
+		// Check the operator's request policy (none by default)
+		if sm.deniedByPolicy(r, clientIP) {
+			sm.metrics.deniedRequests.Inc()
+			WriteError(w, r, http.StatusForbidden, CodeForbidden, "Request denied by policy")
+			return
+		}
+
+		// Check the client's write bandwidth (unlimited by default)
+		if ok, wait := sm.allowWriteBytes(r, clientIP); !ok {
+			sm.metrics.bandwidthLimited.Inc()
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			WriteErrorReason(w, r, http.StatusTooManyRequests, CodeRateLimited, ReasonWriteBandwidth, "Write bandwidth limit exceeded")
 			return
 		}
 		
@@ -204,10 +304,21 @@ func (sm *SecurityMiddleware) applySecurityHeaders(w http.ResponseWriter) {
 	w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 	w.Header().Set("Content-Security-Policy", "default-src 'self'")
 	
+	// Only sent when the node terminates TLS itself
+	if sm.hstsMaxAge > 0 {
+		w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int(sm.hstsMaxAge.Seconds())))
+	}
+
 	// REPRAM-specific headers
 	w.Header().Set("X-REPRAM-Node", "1.0.0")
 }
 
+// EnableHSTS adds a Strict-Transport-Security header to every response.
+// Call only when the node serves HTTPS directly.
+func (sm *SecurityMiddleware) EnableHSTS(maxAge time.Duration) {
+	sm.hstsMaxAge = maxAge
+}
+
 func (sm *SecurityMiddleware) getClientIP(r *http.Request) string {
 	// Only trust proxy headers when explicitly configured.
 	// X-Forwarded-For and X-Real-IP are trivially spoofable by clients
@@ -232,34 +343,19 @@ func (sm *SecurityMiddleware) getClientIP(r *http.Request) string {
 	return ip
 }
 
-func (sm *SecurityMiddleware) isSuspiciousRequest(r *http.Request) bool {
-	userAgent := r.Header.Get("User-Agent")
-
-	// Block known vulnerability scanners by user-agent.
-	// Only scanner-specific tools — not general-purpose HTTP libraries.
-	// REPRAM is permissionless by design; python-requests, curl, etc. are legitimate clients.
-	scannerUAs := []string{
-		"sqlmap",
-		"nikto",
-		"nmap",
-		"masscan",
-		"gobuster",
-		"dirbuster",
+// ClientIdentity returns who sent r: its bearer token if it sent one,
+// otherwise its IP address, taken from proxy headers only when they are
+// trusted.
+func (sm *SecurityMiddleware) ClientIdentity(r *http.Request) string {
+	if token := bearerToken(r); token != "" {
+		return token
 	}
+	return sm.getClientIP(r)
+}
 
-	userAgentLower := strings.ToLower(userAgent)
-	for _, scanner := range scannerUAs {
-		if strings.Contains(userAgentLower, scanner) {
-			return true
-		}
-	}
-
-	// No URL pattern matching. REPRAM is a key-value store that treats keys and
-	// values as opaque bytes — there is no SQL layer, no HTML rendering, and no
-	// filesystem access. Substring checks on URLs would false-positive on legitimate
-	// keys like "user_selection", "drop_zone", or "script_output".
-
-	return false
+// SetRateLimit updates the per-IP rate limit without dropping existing buckets.
+func (sm *SecurityMiddleware) SetRateLimit(rate, burst int) {
+	sm.rateLimiter.SetLimits(rate, burst)
 }
 
 // MaxRequestSize returns the configured maximum request body size in bytes.
@@ -267,10 +363,62 @@ func (sm *SecurityMiddleware) MaxRequestSize() int64 {
 	return sm.maxRequestSize
 }
 
+// DefaultMaxGossipSize is the body limit for peer endpoints unless
+// SetMaxGossipSize changes it. Gossip carries values base64-encoded in JSON,
+// so a full-size client value needs about 13.4 MB.
+const DefaultMaxGossipSize = 16 << 20
+
+// SetMaxGossipSize sets the body limit for the gossip and bootstrap
+// endpoints, independently of the client request limit.
+func (sm *SecurityMiddleware) SetMaxGossipSize(n int64) {
+	sm.maxGossipSize = n
+}
+
+// RequestSizeLimit returns the body size limit for r: the gossip limit for
+// peer endpoints, the client limit for everything else.
+func (sm *SecurityMiddleware) RequestSizeLimit(r *http.Request) int64 {
+	if isPeerPath(r.URL.Path) && sm.maxGossipSize > 0 {
+		return sm.maxGossipSize
+	}
+	return sm.maxRequestSize
+}
+
+// RequestSizeMiddleware is MaxRequestSizeMiddleware with the limit chosen
+// per request by RequestSizeLimit. Snapshot imports are not limited here.
+func (sm *SecurityMiddleware) RequestSizeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == SnapshotPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limit := sm.RequestSizeLimit(r)
+		if r.ContentLength > limit {
+			WriteError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request too large")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isPeerPath reports whether path is an endpoint peers call.
+func isPeerPath(path string) bool {
+	return strings.HasPrefix(path, "/v1/gossip/") || path == "/v1/bootstrap"
+}
+
 func (sm *SecurityMiddleware) Close() {
 	if sm.rateLimiter != nil {
 		sm.rateLimiter.Close()
 	}
+	if sm.joinLimiter != nil {
+		sm.joinLimiter.Close()
+	}
+	if sm.writeBytes != nil {
+		sm.writeBytes.Close()
+	}
+	for _, d := range sm.dimensions {
+		d.Limiter.Close()
+	}
 }
 
 // Request size limiting middleware
@@ -278,7 +426,7 @@ func MaxRequestSizeMiddleware(maxSize int64) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.ContentLength > maxSize {
-				http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+				WriteError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request too large")
 				return
 			}
 			
@@ -288,10 +436,3 @@ func MaxRequestSizeMiddleware(maxSize int64) func(http.Handler) http.Handler {
 		})
 	}
 }
-
-// Timeout middleware to prevent slow loris attacks
-func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.TimeoutHandler(next, timeout, "Request timeout")
-	}
-}
\ No newline at end of file
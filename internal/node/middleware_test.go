@@ -1,9 +1,15 @@
 package node
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // newTestMiddleware creates a SecurityMiddleware for testing.
@@ -16,21 +22,47 @@ func newTestMiddleware() *SecurityMiddleware {
 	}
 }
 
-// isSuspicious is a test helper that creates a request with the given user-agent and URL
-// and checks if isSuspiciousRequest flags it.
-func isSuspicious(t *testing.T, sm *SecurityMiddleware, userAgent string, url string) bool {
+// isDenied is a test helper that creates a request with the given user-agent and URL
+// and checks if the installed policy rejects it.
+func isDenied(t *testing.T, sm *SecurityMiddleware, userAgent string, url string) bool {
 	t.Helper()
 	req := httptest.NewRequest("GET", url, nil)
 	if userAgent != "" {
 		req.Header.Set("User-Agent", userAgent)
 	}
-	return sm.isSuspiciousRequest(req)
+	return sm.deniedByPolicy(req, sm.getClientIP(req))
 }
 
-func TestBlocksKnownScanners(t *testing.T) {
+// scannerPolicy is the blocklist REPRAM used to hardcode, as an operator
+// would now configure it.
+const scannerPolicy = "deny ua (?i)sqlmap|nikto|nmap|masscan|gobuster|dirbuster\n"
+
+func newScannerPolicyMiddleware(t *testing.T) *SecurityMiddleware {
+	t.Helper()
+	sm := newTestMiddleware()
+	policy, err := ParsePolicy(strings.NewReader(scannerPolicy))
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	sm.SetPolicy(policy)
+	return sm
+}
+
+func TestNoPolicyAllowsEverything(t *testing.T) {
 	sm := newTestMiddleware()
 	defer sm.Close()
 
+	for _, ua := range []string{"sqlmap/1.5", "Nikto/2.1.6", "curl/7.88.1", ""} {
+		if isDenied(t, sm, ua, "/v1/data/test") {
+			t.Errorf("UA %q should be allowed when no policy is configured", ua)
+		}
+	}
+}
+
+func TestBlocksKnownScanners(t *testing.T) {
+	sm := newScannerPolicyMiddleware(t)
+	defer sm.Close()
+
 	scanners := []string{
 		"sqlmap/1.5",
 		"Nikto/2.1.6",
@@ -41,14 +73,14 @@ func TestBlocksKnownScanners(t *testing.T) {
 	}
 
 	for _, ua := range scanners {
-		if !isSuspicious(t, sm, ua, "/v1/data/test") {
+		if !isDenied(t, sm, ua, "/v1/data/test") {
 			t.Errorf("scanner UA %q should be blocked", ua)
 		}
 	}
 }
 
 func TestAllowsLegitimateClients(t *testing.T) {
-	sm := newTestMiddleware()
+	sm := newScannerPolicyMiddleware(t)
 	defer sm.Close()
 
 	legitimateUAs := []string{
@@ -61,14 +93,14 @@ func TestAllowsLegitimateClients(t *testing.T) {
 	}
 
 	for _, ua := range legitimateUAs {
-		if isSuspicious(t, sm, ua, "/v1/data/test") {
+		if isDenied(t, sm, ua, "/v1/data/test") {
 			t.Errorf("legitimate UA %q should not be blocked", ua)
 		}
 	}
 }
 
 func TestAllowsKeysWithSQLWords(t *testing.T) {
-	sm := newTestMiddleware()
+	sm := newScannerPolicyMiddleware(t)
 	defer sm.Close()
 
 	// These keys contain words that the old URL pattern matcher would have blocked
@@ -84,10 +116,11 @@ func TestAllowsKeysWithSQLWords(t *testing.T) {
 		"/v1/data/select_all",
 		"/v1/data/my../path",
 		"/v1/data/etc/passwd",
+		"/v1/data/sqlmap",
 	}
 
 	for _, url := range legitimateURLs {
-		if isSuspicious(t, sm, "curl/7.88.1", url) {
+		if isDenied(t, sm, "curl/7.88.1", url) {
 			t.Errorf("URL %q should not be blocked — keys are opaque", url)
 		}
 	}
@@ -135,6 +168,239 @@ func TestRateLimiterPerIP(t *testing.T) {
 	}
 }
 
+func TestRateLimiterSetLimits(t *testing.T) {
+	rl := NewRateLimiter(1, 1)
+	defer rl.Close()
+
+	rl.Allow("192.168.1.1")
+	if rl.Allow("192.168.1.1") {
+		t.Fatal("second request should be blocked before reload (burst=1)")
+	}
+
+	rl.SetLimits(10, 5)
+
+	// New clients get the new burst immediately
+	for i := 0; i < 5; i++ {
+		if !rl.Allow("192.168.1.2") {
+			t.Fatalf("request %d should be allowed after raising burst to 5", i)
+		}
+	}
+	if rl.Allow("192.168.1.2") {
+		t.Fatal("sixth request should be blocked (burst=5)")
+	}
+}
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	rl := NewRateLimiter(2, 1)
+	defer rl.Close()
+
+	if wait := rl.RetryAfter("192.168.1.1"); wait != 0 {
+		t.Fatalf("unknown client: RetryAfter = %v, want 0", wait)
+	}
+	rl.Allow("192.168.1.1")
+	if wait := rl.RetryAfter("192.168.1.1"); wait <= 0 || wait > 500*time.Millisecond {
+		t.Fatalf("empty bucket at 2 req/s: RetryAfter = %v, want (0, 500ms]", wait)
+	}
+}
+
+// Requests spaced closer than one token apart must still earn their share:
+// at 1 req/s, a request every 600ms is allowed on average once a second.
+// The burst of 2 leaves room to carry a partial token between requests.
+func TestRateLimiterRefillKeepsFractionalTokens(t *testing.T) {
+	for _, tc := range []struct {
+		rate     int
+		interval time.Duration
+	}{
+		{1, 600 * time.Millisecond},
+		{1, 999 * time.Millisecond},
+		{2, 300 * time.Millisecond},
+		{5, 150 * time.Millisecond},
+		{10, 70 * time.Millisecond},
+	} {
+		rl := NewRateLimiter(tc.rate, 2)
+		start := time.Now()
+		allowed := 0
+		const window = 60 * time.Second
+		for at := time.Duration(0); at <= window; at += tc.interval {
+			if rl.allowAt("192.168.1.1", start.Add(at)) {
+				allowed++
+			}
+		}
+		rl.Close()
+
+		// The burst, plus one per 1/rate of the window
+		want := 2 + int(window.Seconds())*tc.rate
+		if allowed < want-1 || allowed > want {
+			t.Errorf("rate %d, request every %v: %d allowed in %v, want %d", tc.rate, tc.interval, allowed, window, want)
+		}
+	}
+}
+
+func TestRateLimiterRefillCapsAtBurst(t *testing.T) {
+	rl := NewRateLimiter(1, 3)
+	defer rl.Close()
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		rl.allowAt("192.168.1.1", start)
+	}
+	// An hour idle refills the bucket to its burst, no further
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !rl.allowAt("192.168.1.1", later) {
+			t.Fatalf("request %d after idling should be allowed (burst=3)", i)
+		}
+	}
+	if rl.allowAt("192.168.1.1", later) {
+		t.Fatal("fourth request after idling should be blocked (burst=3)")
+	}
+}
+
+func TestRateLimiterRetryAfterCountsPartialTokens(t *testing.T) {
+	rl := NewRateLimiter(1, 1)
+	defer rl.Close()
+	start := time.Now()
+
+	rl.allowAt("192.168.1.1", start)
+	if wait := rl.retryAfterAt("192.168.1.1", start.Add(400*time.Millisecond)); wait != 600*time.Millisecond {
+		t.Fatalf("RetryAfter 400ms into a 1 req/s refill = %v, want 600ms", wait)
+	}
+	if !rl.allowAt("192.168.1.1", start.Add(time.Second)) {
+		t.Fatal("request after a full token refilled should be allowed")
+	}
+}
+
+func TestRateLimitedResponseSetsRetryAfter(t *testing.T) {
+	sm := NewSecurityMiddleware(1, 1, 1024, false)
+	defer sm.Close()
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/data/k", nil))
+		if rec.Code != want {
+			t.Fatalf("request %d returned %d, want %d", i, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After = %q, want \"1\"", rec.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestWriteBandwidthLimited(t *testing.T) {
+	sm := NewSecurityMiddleware(1000, 1000, 1024, false)
+	defer sm.Close()
+	sm.SetWriteByteLimit(100, 200)
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	do := func(method, remote string, size int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/data/k", strings.NewReader(strings.Repeat("x", size)))
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A value over the burst goes through once, then the client is in debt
+	if rec := do("PUT", "192.0.2.1:4000", 550); rec.Code != http.StatusCreated {
+		t.Fatalf("first write returned %d, want 201", rec.Code)
+	}
+	rec := do("PUT", "192.0.2.1:4000", 10)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("write in debt returned %d, want 429", rec.Code)
+	}
+	var body APIError
+	json.NewDecoder(rec.Body).Decode(&body)
+	if body.Code != CodeRateLimited || body.Reason != ReasonWriteBandwidth {
+		t.Errorf("error = %s/%s, want %s/%s", body.Code, body.Reason, CodeRateLimited, ReasonWriteBandwidth)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "4" {
+		t.Errorf("Retry-After = %q, want \"4\"", got)
+	}
+
+	// Reads and other clients are unaffected
+	if rec := do("GET", "192.0.2.1:4000", 0); rec.Code != http.StatusCreated {
+		t.Errorf("read from a client over its write bandwidth returned %d", rec.Code)
+	}
+	if rec := do("PUT", "192.0.2.2:4000", 10); rec.Code != http.StatusCreated {
+		t.Errorf("write from another client returned %d", rec.Code)
+	}
+}
+
+func TestJoinAttemptsLimitedPerIP(t *testing.T) {
+	sm := NewSecurityMiddleware(1000, 1000, 1024, false)
+	defer sm.Close()
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	join := func(remote string) int {
+		req := httptest.NewRequest("POST", "/v1/bootstrap", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < joinBurst; i++ {
+		if code := join("192.0.2.1:4000"); code != http.StatusOK {
+			t.Fatalf("join %d returned %d, want 200", i, code)
+		}
+	}
+	if code := join("192.0.2.1:4000"); code != http.StatusTooManyRequests {
+		t.Errorf("join past the burst returned %d, want 429", code)
+	}
+	if code := join("192.0.2.2:4000"); code != http.StatusOK {
+		t.Errorf("join from another IP returned %d, want 200", code)
+	}
+	// Other requests from the limited IP are unaffected
+	req := httptest.NewRequest("GET", "/v1/data/k", nil)
+	req.RemoteAddr = "192.0.2.1:4000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("data request from a join-limited IP returned %d", rec.Code)
+	}
+}
+
+func TestExemptPeerPathsSkipRateLimit(t *testing.T) {
+	sm := NewSecurityMiddleware(1, 1, 1024, false)
+	defer sm.Close()
+	sm.ExemptPeerPaths(func(r *http.Request) bool {
+		return r.Header.Get("X-Repram-Signature") == "good"
+	})
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(path, sig string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.RemoteAddr = "192.0.2.1:4000"
+		req.Header.Set("X-Repram-Signature", sig)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Use up the IP's only token
+	if code := send("/v1/data/k", ""); code != http.StatusOK {
+		t.Fatalf("first request returned %d, want 200", code)
+	}
+	for i := 0; i < 10; i++ {
+		if code := send("/v1/gossip/message", "good"); code != http.StatusOK {
+			t.Fatalf("signed gossip %d returned %d, want 200", i, code)
+		}
+	}
+	if code := send("/v1/gossip/message", "bad"); code != http.StatusTooManyRequests {
+		t.Errorf("gossip the gate refused returned %d, want 429", code)
+	}
+	if code := send("/v1/data/k", "good"); code != http.StatusTooManyRequests {
+		t.Errorf("client request returned %d, want 429", code)
+	}
+}
+
 func TestGetClientIPFromXForwardedFor(t *testing.T) {
 	sm := newTestMiddleware()
 	sm.trustProxy = true
@@ -213,6 +479,24 @@ func TestSecurityHeaders(t *testing.T) {
 	}
 }
 
+func TestHSTSHeader(t *testing.T) {
+	sm := newTestMiddleware()
+	defer sm.Close()
+
+	rec := httptest.NewRecorder()
+	sm.applySecurityHeaders(rec)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Fatalf("HSTS should be off by default, got %q", got)
+	}
+
+	sm.EnableHSTS(365 * 24 * time.Hour)
+	rec = httptest.NewRecorder()
+	sm.applySecurityHeaders(rec)
+	if got, want := rec.Header().Get("Strict-Transport-Security"), "max-age=31536000; includeSubDomains"; got != want {
+		t.Fatalf("Strict-Transport-Security = %q, want %q", got, want)
+	}
+}
+
 func TestMaxRequestSizeMiddleware(t *testing.T) {
 	handler := MaxRequestSizeMiddleware(100)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -236,3 +520,46 @@ func TestMaxRequestSizeMiddleware(t *testing.T) {
 		t.Fatalf("oversized request returned %d, want 413", rec.Code)
 	}
 }
+
+func TestSecurityMiddlewareRegistersOnProvidedRegistry(t *testing.T) {
+	regA, regB := prometheus.NewRegistry(), prometheus.NewRegistry()
+	smA := NewSecurityMiddlewareWithRegisterer(regA, 1, 1, 1024, false)
+	defer smA.Close()
+	// A second middleware on the same registry shares its counters
+	smA2 := NewSecurityMiddlewareWithRegisterer(regA, 1, 1, 1024, false)
+	defer smA2.Close()
+	smB := NewSecurityMiddlewareWithRegisterer(regB, 1, 1, 1024, false)
+	defer smB.Close()
+
+	handler := smA.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/health", nil))
+	}
+	smA2.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/v1/data/k", strings.NewReader(strings.Repeat("x", 2048))))
+
+	if got := gatheredCounter(t, regA, "repram_rate_limited_requests_total"); got != 1 {
+		t.Errorf("registry A rate-limited count = %v, want 1", got)
+	}
+	if got := gatheredCounter(t, regA, "repram_oversized_requests_total"); got != 1 {
+		t.Errorf("registry A oversized count = %v, want 1", got)
+	}
+	if got := gatheredCounter(t, regB, "repram_rate_limited_requests_total"); got != 0 {
+		t.Errorf("registry B rate-limited count = %v, want 0", got)
+	}
+}
+
+func gatheredCounter(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return mf.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("%s not registered", name)
+	return 0
+}
@@ -0,0 +1,182 @@
+package node
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Policy decides whether a request may reach the API. It replaces the old
+// built-in scanner blocklist: REPRAM is permissionless, so by default no
+// policy is installed and every request is allowed. Operators who want a
+// stricter posture configure one.
+type Policy interface {
+	Allow(r *http.Request, clientIP string) bool
+}
+
+// PolicyRule matches requests by User-Agent regex or client network.
+// A nil matcher matches every request.
+type PolicyRule struct {
+	Allow     bool
+	UserAgent *regexp.Regexp
+	Network   *net.IPNet
+}
+
+func (pr PolicyRule) matches(r *http.Request, clientIP string) bool {
+	if pr.UserAgent != nil && !pr.UserAgent.MatchString(r.Header.Get("User-Agent")) {
+		return false
+	}
+	if pr.Network != nil {
+		ip := net.ParseIP(clientIP)
+		if ip == nil || !pr.Network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// RulePolicy evaluates rules in order; the first matching rule decides.
+// Requests matching no rule are allowed.
+//
+// Rules never look at the URL. Keys are opaque bytes, and URL heuristics
+// false-positive on legitimate keys like "drop_zone" or "user_selection".
+type RulePolicy struct {
+	rules []PolicyRule
+}
+
+func NewRulePolicy(rules []PolicyRule) *RulePolicy {
+	return &RulePolicy{rules: rules}
+}
+
+func (p *RulePolicy) Allow(r *http.Request, clientIP string) bool {
+	for _, rule := range p.rules {
+		if rule.matches(r, clientIP) {
+			return rule.Allow
+		}
+	}
+	return true
+}
+
+// ParsePolicy reads rules, one per line, in the form
+//
+//	<allow|deny> ua <regexp>
+//	<allow|deny> ip <ip-or-cidr>
+//	<allow|deny> any
+//
+// Blank lines and lines starting with '#' are ignored.
+func ParsePolicy(r io.Reader) (*RulePolicy, error) {
+	var rules []PolicyRule
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parsePolicyRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewRulePolicy(rules), nil
+}
+
+func parsePolicyRule(line string) (PolicyRule, error) {
+	var rule PolicyRule
+	action, rest, _ := strings.Cut(line, " ")
+	switch action {
+	case "allow":
+		rule.Allow = true
+	case "deny":
+	default:
+		return rule, fmt.Errorf("unknown action %q (want allow or deny)", action)
+	}
+
+	field, pattern, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	pattern = strings.TrimSpace(pattern)
+	switch field {
+	case "any":
+		if pattern != "" {
+			return rule, fmt.Errorf("'any' takes no pattern")
+		}
+	case "ua":
+		if pattern == "" {
+			return rule, fmt.Errorf("'ua' needs a regular expression")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return rule, fmt.Errorf("invalid user-agent regexp: %w", err)
+		}
+		rule.UserAgent = re
+	case "ip":
+		network, err := parseNetwork(pattern)
+		if err != nil {
+			return rule, err
+		}
+		rule.Network = network
+	default:
+		return rule, fmt.Errorf("unknown field %q (want ua, ip, or any)", field)
+	}
+	return rule, nil
+}
+
+// parseNetwork accepts a CIDR or a single IP address.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		bits := 8 * len(ip.To4())
+		if bits == 0 {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %q: %w", s, err)
+	}
+	return network, nil
+}
+
+// LoadPolicyFile reads a rule policy from path.
+func LoadPolicyFile(path string) (*RulePolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	policy, err := ParsePolicy(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// SetPolicy installs the request policy. nil removes it, allowing all
+// requests. Safe to call while serving, e.g. on SIGHUP.
+func (sm *SecurityMiddleware) SetPolicy(p Policy) {
+	if p == nil {
+		sm.policy.Store(nil)
+		return
+	}
+	sm.policy.Store(&p)
+}
+
+// deniedByPolicy reports whether the installed policy rejects the request.
+func (sm *SecurityMiddleware) deniedByPolicy(r *http.Request, clientIP string) bool {
+	p := sm.policy.Load()
+	return p != nil && !(*p).Allow(r, clientIP)
+}
@@ -0,0 +1,116 @@
+package node
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustParsePolicy(t *testing.T, rules string) *RulePolicy {
+	t.Helper()
+	policy, err := ParsePolicy(strings.NewReader(rules))
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	return policy
+}
+
+func policyAllows(p Policy, userAgent, clientIP string) bool {
+	req := httptest.NewRequest("GET", "/v1/data/k", nil)
+	req.Header.Set("User-Agent", userAgent)
+	return p.Allow(req, clientIP)
+}
+
+func TestRulePolicyFirstMatchWins(t *testing.T) {
+	policy := mustParsePolicy(t, `
+# trusted monitoring can use any agent
+allow ip 10.0.0.0/8
+deny ua (?i)sqlmap
+`)
+
+	tests := []struct {
+		ua, ip string
+		want   bool
+	}{
+		{"sqlmap/1.5", "10.1.2.3", true},     // allow rule matches first
+		{"sqlmap/1.5", "203.0.113.9", false}, // deny rule
+		{"curl/7.88.1", "203.0.113.9", true}, // no match: allowed
+	}
+	for _, tt := range tests {
+		if got := policyAllows(policy, tt.ua, tt.ip); got != tt.want {
+			t.Errorf("Allow(ua=%q, ip=%s) = %v, want %v", tt.ua, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRulePolicyAllowlist(t *testing.T) {
+	policy := mustParsePolicy(t, "allow ip 192.0.2.10\nallow ip 2001:db8::/32\ndeny any\n")
+
+	if !policyAllows(policy, "", "192.0.2.10") {
+		t.Error("listed IPv4 address should be allowed")
+	}
+	if !policyAllows(policy, "", "2001:db8::1") {
+		t.Error("address in listed IPv6 network should be allowed")
+	}
+	if policyAllows(policy, "", "192.0.2.11") {
+		t.Error("unlisted address should be denied")
+	}
+	if policyAllows(policy, "", "not-an-ip") {
+		t.Error("unparseable client IP should fall through to deny")
+	}
+}
+
+func TestParsePolicyRejectsBadRules(t *testing.T) {
+	tests := []struct {
+		rules   string
+		wantErr string
+	}{
+		{"block ua curl", `line 1: unknown action "block"`},
+		{"# comment\ndeny host example.com", `line 2: unknown field "host"`},
+		{"deny ua", "'ua' needs a regular expression"},
+		{"deny ua ([", "invalid user-agent regexp"},
+		{"deny ip 10.0.0.0/33", "invalid network"},
+		{"deny ip nope", `invalid IP address "nope"`},
+		{"deny any curl", "'any' takes no pattern"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePolicy(strings.NewReader(tt.rules))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParsePolicy(%q) error = %v, want %q", tt.rules, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.conf")
+	if err := os.WriteFile(path, []byte("deny ua nikto\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatalf("LoadPolicyFile: %v", err)
+	}
+	if policyAllows(policy, "nikto/2.1", "192.0.2.1") {
+		t.Error("policy from file should deny nikto")
+	}
+
+	if _, err := LoadPolicyFile(filepath.Join(t.TempDir(), "missing.conf")); err == nil {
+		t.Error("expected error for missing policy file")
+	}
+}
+
+func TestSetPolicyNilRemovesPolicy(t *testing.T) {
+	sm := newTestMiddleware()
+	defer sm.Close()
+
+	sm.SetPolicy(mustParsePolicy(t, "deny any\n"))
+	if !isDenied(t, sm, "curl/7.88.1", "/v1/data/k") {
+		t.Fatal("'deny any' policy should deny")
+	}
+	sm.SetPolicy(nil)
+	if isDenied(t, sm, "curl/7.88.1", "/v1/data/k") {
+		t.Fatal("removing the policy should allow all requests")
+	}
+}
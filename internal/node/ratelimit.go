@@ -0,0 +1,203 @@
+package node
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limiter is a rate limiting backend keyed by an arbitrary string. RateLimiter
+// is the in-memory token bucket implementation; other backends (for example
+// cluster-wide limits) can slot in behind the same interface.
+type Limiter interface {
+	Allow(key string) bool
+	Close()
+}
+
+// RetryAdvisor is implemented by Limiters that can tell a rejected client
+// how long to wait before its next request would be allowed. Rejections by
+// limiters that don't implement it advise defaultRetryAfter.
+type RetryAdvisor interface {
+	RetryAfter(key string) time.Duration
+}
+
+// defaultRetryAfter is the wait advised when the rejecting limiter can't
+// estimate one.
+const defaultRetryAfter = time.Second
+
+// RateDimension applies a Limiter along one request dimension (client IP,
+// API token, key namespace, ...). A request must be allowed by every
+// dimension that applies to it.
+type RateDimension struct {
+	Name string
+	// Key extracts the rate limit key from a request. An empty key means
+	// the dimension does not apply to this request.
+	Key     func(r *http.Request, clientIP string) string
+	Limiter Limiter
+}
+
+// TokenLimiter applies a separate rate to each API token issued by the
+// operator. Tokens are not authentication — REPRAM stays permissionless — they
+// only let known clients behind a shared NAT get their own bucket.
+type TokenLimiter struct {
+	limiters map[string]*RateLimiter
+}
+
+// NewTokenLimiter creates a limiter for the given token → requests/second map.
+// Each token gets a burst of twice its rate, matching the per-IP default.
+func NewTokenLimiter(rates map[string]int) *TokenLimiter {
+	tl := &TokenLimiter{limiters: make(map[string]*RateLimiter, len(rates))}
+	for token, rate := range rates {
+		tl.limiters[token] = NewRateLimiter(rate, rate*2)
+	}
+	return tl
+}
+
+// Known reports whether token was configured by the operator.
+func (tl *TokenLimiter) Known(token string) bool {
+	_, ok := tl.limiters[token]
+	return ok
+}
+
+// Allow consumes a token from the bucket for the given API token.
+// Unknown tokens are always allowed; they are limited by IP instead.
+func (tl *TokenLimiter) Allow(token string) bool {
+	rl, ok := tl.limiters[token]
+	if !ok {
+		return true
+	}
+	return rl.Allow(token)
+}
+
+// RetryAfter implements RetryAdvisor.
+func (tl *TokenLimiter) RetryAfter(token string) time.Duration {
+	rl, ok := tl.limiters[token]
+	if !ok {
+		return 0
+	}
+	return rl.RetryAfter(token)
+}
+
+func (tl *TokenLimiter) Close() {
+	for _, rl := range tl.limiters {
+		rl.Close()
+	}
+}
+
+// bearerToken returns the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// keyNamespace returns the namespace of a /v1/data/{key} request: the part
+// of the key before the first ':' (see docs/patterns.md). Keys without a
+// namespace and non-data requests return "".
+func keyNamespace(r *http.Request) string {
+	key, ok := strings.CutPrefix(r.URL.Path, "/v1/data/")
+	if !ok {
+		return ""
+	}
+	ns, _, found := strings.Cut(key, ":")
+	if !found || ns == "" {
+		return ""
+	}
+	return ns
+}
+
+// AddRateDimension adds a rate limit dimension, checked after the per-IP
+// limit and any dimensions added before it.
+func (sm *SecurityMiddleware) AddRateDimension(d RateDimension) {
+	sm.dimensions = append(sm.dimensions, d)
+}
+
+// SetTokenLimits enables per-token rate limits. Requests carrying a known
+// token in "Authorization: Bearer" are limited by token instead of by IP.
+func (sm *SecurityMiddleware) SetTokenLimits(rates map[string]int) {
+	sm.tokens = NewTokenLimiter(rates)
+	sm.AddRateDimension(RateDimension{
+		Name: "token",
+		Key: func(r *http.Request, _ string) string {
+			if token := bearerToken(r); sm.tokens.Known(token) {
+				return token
+			}
+			return ""
+		},
+		Limiter: sm.tokens,
+	})
+}
+
+// SetNamespaceLimit enables a rate limit per key namespace, shared by all
+// clients writing to or reading from that namespace.
+func (sm *SecurityMiddleware) SetNamespaceLimit(rate, burst int) {
+	sm.AddRateDimension(RateDimension{
+		Name: "namespace",
+		Key: func(r *http.Request, _ string) string {
+			return keyNamespace(r)
+		},
+		Limiter: NewRateLimiter(rate, burst),
+	})
+}
+
+// ipRateKey is the key function for the built-in per-IP dimension. Requests
+// with a known API token skip it; the token dimension limits them instead.
+func (sm *SecurityMiddleware) ipRateKey(r *http.Request, clientIP string) string {
+	if sm.tokens != nil && sm.tokens.Known(bearerToken(r)) {
+		return ""
+	}
+	return clientIP
+}
+
+// ExemptPeerPaths lets requests to the gossip and bootstrap endpoints skip
+// the per-IP limit and every rate dimension, so replication between busy
+// peers isn't throttled like client traffic. If gate is non-nil, only the
+// requests it accepts (for example, correctly signed ones) skip them; the
+// rest are limited like any client. Bootstrap requests still count against
+// the join limit.
+func (sm *SecurityMiddleware) ExemptPeerPaths(gate func(*http.Request) bool) {
+	sm.peerExempt = true
+	sm.peerGate = gate
+}
+
+func (sm *SecurityMiddleware) exemptPeer(r *http.Request) bool {
+	if !sm.peerExempt || !isPeerPath(r.URL.Path) {
+		return false
+	}
+	return sm.peerGate == nil || sm.peerGate(r)
+}
+
+// allowRate checks the per-IP limit and every additional rate dimension that
+// applies to the request. Returns the name of the dimension that rejected
+// it and how long the client should wait, or "" if allowed.
+func (sm *SecurityMiddleware) allowRate(r *http.Request, clientIP string) (string, time.Duration) {
+	if sm.exemptPeer(r) {
+		return "", 0
+	}
+	if key := sm.ipRateKey(r, clientIP); key != "" && !sm.rateLimiter.Allow(key) {
+		return "ip", sm.rateLimiter.RetryAfter(key)
+	}
+	for _, d := range sm.dimensions {
+		key := d.Key(r, clientIP)
+		if key == "" {
+			continue
+		}
+		if !d.Limiter.Allow(key) {
+			if advisor, ok := d.Limiter.(RetryAdvisor); ok {
+				return d.Name, advisor.RetryAfter(key)
+			}
+			return d.Name, defaultRetryAfter
+		}
+	}
+	return "", 0
+}
+
+// retryAfterSeconds formats a wait for the Retry-After header, which only
+// carries whole seconds: round up, and never advise retrying immediately.
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,108 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// allowN counts how many of n identical requests pass allowRate.
+func allowN(sm *SecurityMiddleware, n int, path, ip, token string) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if rejected, _ := sm.allowRate(req, ip); rejected == "" {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestKnownTokenReplacesIPLimit(t *testing.T) {
+	sm := &SecurityMiddleware{rateLimiter: NewRateLimiter(1, 2)}
+	defer sm.Close()
+	sm.SetTokenLimits(map[string]int{"team-a": 5}) // burst 10
+
+	// Same NAT IP: the token gets its own, larger bucket
+	if got := allowN(sm, 20, "/v1/data/k", "203.0.113.7", "team-a"); got != 10 {
+		t.Fatalf("token requests allowed = %d, want 10", got)
+	}
+	// Token usage did not drain the shared IP bucket
+	if got := allowN(sm, 5, "/v1/data/k", "203.0.113.7", ""); got != 2 {
+		t.Fatalf("IP requests allowed = %d, want 2", got)
+	}
+}
+
+func TestUnknownTokenFallsBackToIP(t *testing.T) {
+	sm := &SecurityMiddleware{rateLimiter: NewRateLimiter(1, 2)}
+	defer sm.Close()
+	sm.SetTokenLimits(map[string]int{"team-a": 5})
+
+	// Made-up tokens can't be used to escape the per-IP limit
+	allowed := 0
+	for _, token := range []string{"x1", "x2", "x3", "x4"} {
+		allowed += allowN(sm, 1, "/v1/data/k", "198.51.100.1", token)
+	}
+	if allowed != 2 {
+		t.Fatalf("requests with unknown tokens allowed = %d, want 2 (IP burst)", allowed)
+	}
+}
+
+func TestNamespaceLimitSharedAcrossClients(t *testing.T) {
+	sm := &SecurityMiddleware{rateLimiter: NewRateLimiter(1000, 1000)}
+	defer sm.Close()
+	sm.SetNamespaceLimit(1, 3)
+
+	allowed := 0
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+		allowed += allowN(sm, 1, "/v1/data/myapp:session:1", ip, "")
+	}
+	if allowed != 3 {
+		t.Fatalf("namespace requests allowed = %d, want 3", allowed)
+	}
+
+	// Other namespaces and un-namespaced keys are unaffected
+	if got := allowN(sm, 3, "/v1/data/other:k", "10.0.0.1", ""); got != 3 {
+		t.Fatalf("other namespace allowed = %d, want 3", got)
+	}
+	if got := allowN(sm, 5, "/v1/data/plainkey", "10.0.0.1", ""); got != 5 {
+		t.Fatalf("un-namespaced key allowed = %d, want 5", got)
+	}
+}
+
+func TestCustomRateDimension(t *testing.T) {
+	sm := &SecurityMiddleware{rateLimiter: NewRateLimiter(1000, 1000)}
+	defer sm.Close()
+	sm.AddRateDimension(RateDimension{
+		Name:    "method",
+		Key:     func(r *http.Request, _ string) string { return r.Method },
+		Limiter: NewRateLimiter(1, 1),
+	})
+
+	req := httptest.NewRequest("GET", "/v1/health", nil)
+	if got, _ := sm.allowRate(req, "10.0.0.1"); got != "" {
+		t.Fatalf("first request rejected by %q", got)
+	}
+	if got, _ := sm.allowRate(req, "10.0.0.2"); got != "method" {
+		t.Fatalf("second request: rejected by %q, want method", got)
+	}
+}
+
+func TestKeyNamespace(t *testing.T) {
+	tests := map[string]string{
+		"/v1/data/myapp:user:1": "myapp",
+		"/v1/data/lock:job":     "lock",
+		"/v1/data/plainkey":     "",
+		"/v1/data/:leading":     "",
+		"/v1/keys":              "",
+	}
+	for path, want := range tests {
+		req := httptest.NewRequest("GET", path, nil)
+		if got := keyNamespace(req); got != want {
+			t.Errorf("keyNamespace(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
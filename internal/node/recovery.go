@@ -0,0 +1,75 @@
+package node
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"repram/internal/logging"
+)
+
+var (
+	panicsRecovered     prometheus.Counter
+	panicsRecoveredOnce sync.Once
+)
+
+// panicCounter registers repram_http_panics_total on first use.
+func panicCounter() prometheus.Counter {
+	panicsRecoveredOnce.Do(func() {
+		panicsRecovered = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "repram_http_panics_total",
+			Help: "Total number of panics recovered in HTTP handlers",
+		})
+		prometheus.MustRegister(panicsRecovered)
+	})
+	return panicsRecovered
+}
+
+// RecoveryMiddleware turns a panicking handler into a 500 internal_error
+// response, and logs the panic with its stack trace and the request ID, so
+// a bug in one handler costs one request rather than an opaque dropped
+// connection. Install it innermost, inside TimeoutMiddleware, so the stack
+// trace is the handler's own. http.ErrAbortHandler is passed on: it is how
+// a handler deliberately aborts a response.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	counter := panicCounter()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(p)
+			}
+			counter.Inc()
+			logging.Error("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, RequestID(r), p, debug.Stack())
+			// A handler that already started its response can't be given
+			// an error status; the client gets a truncated body instead.
+			if !rw.wroteHeader {
+				WriteError(rw, r, http.StatusInternalServerError, CodeInternal, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recoveryWriter records whether the response has been started.
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoveryWriter) WriteHeader(status int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recoveryWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
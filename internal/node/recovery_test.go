@@ -0,0 +1,72 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRecoveryMiddlewareReturnsJSONError(t *testing.T) {
+	handler := RequestIDMiddleware(TimeoutMiddleware(time.Second)(RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))))
+	before := panicCount(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/data/k", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	var apiErr APIError
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if apiErr.Code != CodeInternal || apiErr.RequestID == "" || apiErr.RequestID != rec.Header().Get("X-Request-ID") {
+		t.Fatalf("error = %+v, want internal_error with the request ID", apiErr)
+	}
+	if n := panicCount(t); n != before+1 {
+		t.Fatalf("panic counter = %v, want %v", n, before+1)
+	}
+}
+
+func TestRecoveryMiddlewareKeepsStartedResponse(t *testing.T) {
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Fatalf("got %d %q, want the handler's partial response untouched", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRecoveryMiddlewarePassesAbortHandler(t *testing.T) {
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, http.ErrAbortHandler) {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler re-panicked", err)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func panicCount(t *testing.T) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := panicCounter().Write(&m); err != nil {
+		t.Fatalf("reading panic counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
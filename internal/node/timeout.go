@@ -0,0 +1,65 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// TimeoutMiddleware bounds handler run time so slow clients and stuck
+// handlers can't hold connections forever (slow loris). A request that times
+// out gets a 503 timeout error.
+func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := json.Marshal(newAPIError(w, r, CodeTimeout, "Request timeout"))
+			http.TimeoutHandler(next, timeout, string(body)).ServeHTTP(&timeoutWriter{ResponseWriter: w}, r)
+		})
+	}
+}
+
+// DefaultTimeouts are the per-class request timeouts ClassTimeoutMiddleware
+// applies to classes it isn't given. Reads and admin requests answer from
+// memory, so anything slow is stuck; writes get long enough for a large
+// body on a slow link plus the longest ?timeout= quorum wait.
+var DefaultTimeouts = map[string]time.Duration{
+	ClassRead:   10 * time.Second,
+	ClassWrite:  90 * time.Second,
+	ClassGossip: 30 * time.Second,
+	ClassAdmin:  10 * time.Second,
+}
+
+// ClassTimeoutMiddleware is TimeoutMiddleware with a timeout per endpoint
+// class (see RequestClass). Classes missing from timeouts use
+// DefaultTimeouts. Snapshot transfers are not timed.
+func ClassTimeoutMiddleware(timeouts map[string]time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		handlers := make(map[string]http.Handler, len(DefaultTimeouts))
+		for class, timeout := range DefaultTimeouts {
+			if t, ok := timeouts[class]; ok {
+				timeout = t
+			}
+			handlers[class] = TimeoutMiddleware(timeout)(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == SnapshotPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+			handlers[RequestClass(r)].ServeHTTP(w, r)
+		})
+	}
+}
+
+// timeoutWriter labels http.TimeoutHandler's timeout body as JSON. Responses
+// from the wrapped handler keep whatever Content-Type they set.
+type timeoutWriter struct {
+	http.ResponseWriter
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && tw.Header().Get("Content-Type") == "" {
+		tw.Header().Set("Content-Type", "application/json")
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddlewareReturnsJSONError(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := RequestIDMiddleware(TimeoutMiddleware(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var apiErr APIError
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if apiErr.Code != CodeTimeout || !apiErr.Retryable || apiErr.RequestID != rec.Header().Get("X-Request-ID") {
+		t.Fatalf("error = %+v, want retryable timeout with the request ID", apiErr)
+	}
+}
+
+func TestTimeoutMiddlewarePassesResponsesThrough(t *testing.T) {
+	handler := TimeoutMiddleware(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("OK"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("PUT", "/", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != "OK" || rec.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("got %d %q (%s), want the handler's response unchanged", rec.Code, rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestClassTimeoutMiddlewareUsesClassTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := ClassTimeoutMiddleware(map[string]time.Duration{ClassRead: 10 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			<-release
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/data/k", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("slow read returned %d, want 503", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("PUT", "/v1/data/k", nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("write returned %d, want 201 under the default write timeout", rec.Code)
+	}
+}
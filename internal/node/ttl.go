@@ -0,0 +1,54 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTTLSeconds is the longest TTL a time.Duration holds. Longer TTLs are
+// cut to it; the node clamps them to its own maximum afterwards anyway.
+const maxTTLSeconds = math.MaxInt64 / int64(time.Second)
+
+// ParseTTL parses a TTL given as whole seconds ("300") or as a Go duration
+// with an optional leading day count ("90s", "15m", "2h", "1d", "1d12h").
+// The TTL must be at least one second; fractions of a second are dropped.
+func ParseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("TTL is empty")
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil || isRangeError(err) {
+		if secs < 1 {
+			return 0, fmt.Errorf("TTL %q must be at least 1 second", s)
+		}
+		return time.Duration(min(secs, maxTTLSeconds)) * time.Second, nil
+	}
+
+	var ttl time.Duration
+	rest := s
+	if days, after, ok := strings.Cut(s, "d"); ok {
+		n, err := strconv.ParseInt(days, 10, 64)
+		if err != nil || n < 0 || strings.HasPrefix(days, "+") {
+			return 0, fmt.Errorf("TTL %q is not a number of seconds or a duration such as 90s, 15m, 2h or 1d", s)
+		}
+		ttl, rest = time.Duration(min(n, maxTTLSeconds/86400))*24*time.Hour, after
+	}
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("TTL %q is not a number of seconds or a duration such as 90s, 15m, 2h or 1d", s)
+		}
+		ttl += min(d, math.MaxInt64-ttl)
+	}
+	if ttl < time.Second {
+		return 0, fmt.Errorf("TTL %q must be at least 1 second", s)
+	}
+	return ttl.Truncate(time.Second), nil
+}
+
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
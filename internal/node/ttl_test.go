@@ -0,0 +1,37 @@
+package node
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"300", 300 * time.Second},
+		{"90s", 90 * time.Second},
+		{"15m", 15 * time.Minute},
+		{"2h", 2 * time.Hour},
+		{"1d", 24 * time.Hour},
+		{"1d12h", 36 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+		{"1500ms", time.Second},
+		{"99999999999999999999", time.Duration(maxTTLSeconds) * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := ParseTTL(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTTL(%q) = (%v, %v), want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseTTLRejectsInvalid(t *testing.T) {
+	for _, in := range []string{"", "0", "-100", "abc", "1.5d", "d", "+1d", "1d-1h", "500ms", "0s", "10 m"} {
+		if got, err := ParseTTL(in); err == nil {
+			t.Errorf("ParseTTL(%q) = %v, want an error", in, got)
+		}
+	}
+}
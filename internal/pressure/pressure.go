@@ -0,0 +1,191 @@
+// Package pressure watches the node's heap and tells the write path when to
+// shed load, so a node under memory pressure turns writes away with 503
+// instead of growing until the OS kills it.
+package pressure
+
+import (
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"repram/internal/logging"
+)
+
+// Level is how close the node is to its memory high-water mark.
+type Level int32
+
+const (
+	Normal   Level = iota // below the high-water mark: accept every write
+	High                  // at or above it: shed low-priority writes
+	Critical              // criticalFactor above it: shed all but high-priority writes
+)
+
+func (l Level) String() string {
+	switch l {
+	case High:
+		return "high"
+	case Critical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+// criticalFactor is how far past the high-water mark the heap must grow
+// before normal-priority writes are shed as well.
+const criticalFactor = 1.2
+
+// sampleInterval is how often the heap is measured.
+const sampleInterval = time.Second
+
+// heapMetric is live heap object bytes. Unlike runtime.ReadMemStats,
+// reading it does not stop the world.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// Write priorities, from the X-Priority request header.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal" // also used when the header is absent
+	PriorityHigh   = "high"
+)
+
+type monitorMetrics struct {
+	level prometheus.Gauge
+	shed  prometheus.Counter
+}
+
+var (
+	sharedMetrics     *monitorMetrics
+	sharedMetricsOnce sync.Once
+)
+
+func newMonitorMetrics() *monitorMetrics {
+	sharedMetricsOnce.Do(func() {
+		sharedMetrics = &monitorMetrics{
+			level: prometheus.NewGauge(prometheus.GaugeOpts{
+				Name: "repram_memory_pressure",
+				Help: "Memory pressure level: 0 normal, 1 high (shedding low-priority writes), 2 critical (shedding all but high-priority writes)",
+			}),
+			shed: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "repram_writes_shed_total",
+				Help: "Total number of writes rejected with 503 because of memory pressure",
+			}),
+		}
+		prometheus.MustRegister(sharedMetrics.level, sharedMetrics.shed)
+	})
+	return sharedMetrics
+}
+
+// Monitor samples heap usage and tracks the current pressure Level.
+type Monitor struct {
+	highWater  uint64
+	heap       func() uint64
+	onPressure func() // called on every sample at High or above
+	metrics    *monitorMetrics
+
+	level    atomic.Int32
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMonitor creates a monitor for the given heap high-water mark in bytes.
+// onPressure, if not nil, is called on every sample taken while the heap is
+// at or above the mark; use it to free memory early (for example by
+// sweeping expired keys). Call Start to begin sampling.
+func NewMonitor(highWaterBytes uint64, onPressure func()) *Monitor {
+	return &Monitor{
+		highWater:  highWaterBytes,
+		heap:       readHeapBytes,
+		onPressure: onPressure,
+		metrics:    newMonitorMetrics(),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start takes a first sample, then samples the heap every second until
+// Close.
+func (m *Monitor) Start() {
+	m.sample()
+	go func() {
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sample()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops sampling.
+func (m *Monitor) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// Level returns the pressure level from the latest sample. A nil monitor
+// is always Normal.
+func (m *Monitor) Level() Level {
+	if m == nil {
+		return Normal
+	}
+	return Level(m.level.Load())
+}
+
+// Shed reports whether a write with the given priority should be rejected
+// at the current level, and counts it if so. Unknown priorities are
+// treated as normal.
+func (m *Monitor) Shed(priority string) bool {
+	var shed bool
+	switch m.Level() {
+	case High:
+		shed = priority == PriorityLow
+	case Critical:
+		shed = priority != PriorityHigh
+	}
+	if shed && m.metrics != nil {
+		m.metrics.shed.Inc()
+	}
+	return shed
+}
+
+// RetryAfter is how long a shed client should wait: the next sample is the
+// earliest the level can drop.
+func (m *Monitor) RetryAfter() time.Duration {
+	return sampleInterval
+}
+
+func (m *Monitor) sample() {
+	heap := m.heap()
+	next := Normal
+	switch {
+	case float64(heap) >= float64(m.highWater)*criticalFactor:
+		next = Critical
+	case heap >= m.highWater:
+		next = High
+	}
+
+	if prev := Level(m.level.Swap(int32(next))); prev != next {
+		logging.Warn("Memory pressure %s → %s (heap %d MB, high-water %d MB)", prev, next, heap>>20, m.highWater>>20)
+	}
+	if m.metrics != nil {
+		m.metrics.level.Set(float64(next))
+	}
+	if next != Normal && m.onPressure != nil {
+		m.onPressure()
+	}
+}
+
+func readHeapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
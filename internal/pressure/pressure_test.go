@@ -0,0 +1,67 @@
+package pressure
+
+import "testing"
+
+func newTestMonitor(heap *uint64, onPressure func()) *Monitor {
+	m := NewMonitor(100, onPressure)
+	m.heap = func() uint64 { return *heap }
+	return m
+}
+
+func TestLevels(t *testing.T) {
+	var heap uint64
+	sweeps := 0
+	m := newTestMonitor(&heap, func() { sweeps++ })
+
+	tests := []struct {
+		heap  uint64
+		level Level
+	}{
+		{50, Normal},
+		{100, High},
+		{119, High},
+		{120, Critical},
+		{99, Normal},
+	}
+	for _, tt := range tests {
+		heap = tt.heap
+		m.sample()
+		if got := m.Level(); got != tt.level {
+			t.Errorf("heap %d: level = %s, want %s", tt.heap, got, tt.level)
+		}
+	}
+	if sweeps != 3 {
+		t.Errorf("onPressure called %d times, want 3 (once per sample at high or above)", sweeps)
+	}
+}
+
+func TestShedByPriority(t *testing.T) {
+	var heap uint64
+	m := newTestMonitor(&heap, nil)
+
+	tests := []struct {
+		heap     uint64
+		priority string
+		shed     bool
+	}{
+		{50, PriorityLow, false},
+		{100, PriorityLow, true},
+		{100, "", false},
+		{100, PriorityHigh, false},
+		{150, "", true},
+		{150, "urgent", true}, // unknown priorities count as normal
+		{150, PriorityHigh, false},
+	}
+	for _, tt := range tests {
+		heap = tt.heap
+		m.sample()
+		if got := m.Shed(tt.priority); got != tt.shed {
+			t.Errorf("heap %d, priority %q: Shed = %v, want %v", tt.heap, tt.priority, got, tt.shed)
+		}
+	}
+
+	var none *Monitor
+	if none.Shed(PriorityLow) {
+		t.Error("nil monitor should never shed")
+	}
+}
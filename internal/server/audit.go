@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"repram/internal/audit"
+)
+
+type auditKey struct{}
+
+// audited records each write next handles in the audit log, with its
+// outcome. next fills in the size and TTL through auditWrite once it knows
+// them. Without an audit log, next is returned as is.
+func (s *Server) audited(next http.HandlerFunc) http.HandlerFunc {
+	if s.audit == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		write := &audit.Write{
+			At:     time.Now(),
+			Key:    mux.Vars(r)["key"],
+			Client: s.securityMW.ClientIdentity(r),
+			Size:   int(max(r.ContentLength, 0)),
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r.WithContext(context.WithValue(r.Context(), auditKey{}, write)))
+		write.Status = sw.status
+		if write.Status == 0 {
+			write.Status = http.StatusOK
+		}
+		s.audit.Log(*write)
+	}
+}
+
+// auditWrite returns the audit entry for r, or a throwaway one when the
+// write isn't being audited, so callers can set fields unconditionally.
+func auditWrite(r *http.Request) *audit.Write {
+	if write, ok := r.Context().Value(auditKey{}).(*audit.Write); ok {
+		return write
+	}
+	return &audit.Write{}
+}
+
+// statusWriter records the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
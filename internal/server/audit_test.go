@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"repram/internal/audit"
+)
+
+func TestPutIsAudited(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.audit = audit.New("test-node", "0123456789abcdef")
+	var records []audit.Record
+	server.audit.ToWebhook(func(body []byte) {
+		var rec audit.Record
+		json.Unmarshal(body, &rec)
+		records = append(records, rec)
+	})
+
+	req := httptest.NewRequest("PUT", "/v1/data/audited", strings.NewReader("hello"))
+	req.Header.Set("X-TTL", "600")
+	req.RemoteAddr = "203.0.113.9:4000"
+	server.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("PUT", "/v1/data/refused", strings.NewReader("hello"))
+	req.Header.Set("X-TTL", "soon")
+	req.Header.Set("Authorization", "Bearer client-token")
+	server.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(records))
+	}
+	stored, refused := records[0], records[1]
+	if stored.Key != server.audit.Hash("audited") || stored.Client != server.audit.Hash("203.0.113.9") ||
+		stored.Size != 5 || stored.TTL != 600 || stored.Status != 201 {
+		t.Errorf("stored write recorded as %+v", stored)
+	}
+	if refused.Key != server.audit.Hash("refused") || refused.Client != server.audit.Hash("client-token") || refused.Status != 400 {
+		t.Errorf("refused write recorded as %+v", refused)
+	}
+}
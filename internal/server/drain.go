@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"repram/internal/logging"
+	"repram/internal/node"
+)
+
+// Drain states, as reported by /v1/health/ready and the drain endpoint.
+const (
+	stateServing  = "serving"  // taking client writes
+	stateDraining = "draining" // refusing client writes, handing data off to peers
+	stateDrained  = "drained"  // hand-off finished; safe to stop
+)
+
+// drainRetryAfter is the Retry-After sent with writes refused while
+// draining. The node is going down, so the client is better off trying
+// another node than waiting on this one.
+const drainRetryAfter = 30 * time.Second
+
+// drainState tracks maintenance drain. gen counts drains so that a hand-off
+// outliving its drain (the operator resumed, then drained again) doesn't
+// mark the newer one drained.
+type drainState struct {
+	mu    sync.Mutex
+	state string // "" = stateServing
+	gen   int
+}
+
+func (d *drainState) get() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state == "" {
+		return stateServing
+	}
+	return d.state
+}
+
+// start moves to draining and returns the drain's generation, or false if
+// the node is already draining or drained.
+func (d *drainState) start() (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state != "" && d.state != stateServing {
+		return 0, false
+	}
+	d.state = stateDraining
+	d.gen++
+	return d.gen, true
+}
+
+// finish marks drain gen as drained, if it is still the current drain.
+func (d *drainState) finish(gen int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.gen == gen && d.state == stateDraining {
+		d.state = stateDrained
+	}
+}
+
+func (d *drainState) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state = stateServing
+}
+
+// refusesWrites reports whether client writes are being turned away, for a
+// drain or in read-only mode, and if so answers the request.
+func (s *Server) refusesWrites(w http.ResponseWriter, r *http.Request) bool {
+	if s.readOnly.Load() {
+		node.WriteError(w, r, http.StatusServiceUnavailable, node.CodeReadOnly, "Node is read-only; write to another node")
+		return true
+	}
+	if s.drain.get() == stateServing {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(drainRetryAfter.Seconds())))
+	node.WriteError(w, r, http.StatusServiceUnavailable, node.CodeDraining, "Node is draining for maintenance; write to another node")
+	return true
+}
+
+// drainHandler starts a drain: client writes are refused from now on,
+// while reads and gossip carry on, and the node's data is handed off to
+// its peers in the background. /v1/health/ready reports "drained" once the
+// hand-off is done.
+func (s *Server) drainHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if gen, ok := s.drain.start(); ok {
+		logging.Info("Draining: refusing client writes and handing data off to peers")
+		go func() {
+			s.clusterNode.HandOff(context.Background())
+			s.drain.finish(gen)
+		}()
+		status = http.StatusAccepted
+	}
+	writeDrainState(w, status, s.drain.get())
+}
+
+// undrainHandler ends a drain and takes client writes again.
+func (s *Server) undrainHandler(w http.ResponseWriter, r *http.Request) {
+	s.drain.stop()
+	logging.Info("Drain ended: taking client writes again")
+	writeDrainState(w, http.StatusOK, stateServing)
+}
+
+func writeDrainState(w http.ResponseWriter, status int, state string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"state": state})
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrainRefusesWritesAndReportsNotReady(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.adminToken = testAdminToken
+	router := server.Router()
+
+	put := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/v1/data/"+key, strings.NewReader("data")))
+		return w
+	}
+	ready := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/health/ready", nil))
+		return w
+	}
+
+	if w := put("before"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT before drain: status = %d", w.Code)
+	}
+	if w := ready(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"serving"`) {
+		t.Fatalf("ready before drain: status = %d, body %s", w.Code, w.Body)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest("POST", "/v1/admin/drain", ""))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST /v1/admin/drain: status = %d, body %s", w.Code, w.Body)
+	}
+
+	w = put("during")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"draining"`) || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("PUT while draining: status = %d, Retry-After %q, body %s", w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+	getW := httptest.NewRecorder()
+	router.ServeHTTP(getW, httptest.NewRequest("GET", "/v1/data/before", nil))
+	if getW.Code != http.StatusOK {
+		t.Fatalf("GET while draining: status = %d, want reads to carry on", getW.Code)
+	}
+
+	// No peers to hand off to, so the drain finishes at once
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(ready().Body.String(), `"drained"`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("never reported drained: %s", ready().Body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if w := ready(); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("ready while drained: status = %d, want 503", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest("DELETE", "/v1/admin/drain", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("DELETE /v1/admin/drain: status = %d", w.Code)
+	}
+	if w := put("after"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT after drain ended: status = %d", w.Code)
+	}
+	if w := ready(); w.Code != http.StatusOK {
+		t.Fatalf("ready after drain ended: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+type openAPIDoc struct {
+	OpenAPI string                                `json:"openapi"`
+	Paths   map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+func loadOpenAPISpec(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+// TestOpenAPIMatchesRouter fails when a route is added, removed, or changes
+// methods without the spec being updated, or vice versa.
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	routed := make(map[string]bool)
+	err := server.Router().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			if method != "OPTIONS" { // CORS preflight, answered by middleware
+				routed[strings.ToLower(method)+" "+path] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking router: %v", err)
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range loadOpenAPISpec(t).Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented[method+" "+path] = true
+			}
+		}
+	}
+
+	var missing, stale []string
+	for op := range routed {
+		if !documented[op] {
+			missing = append(missing, op)
+		}
+	}
+	for op := range documented {
+		if !routed[op] {
+			stale = append(stale, op)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	if len(missing) > 0 {
+		t.Errorf("routes missing from openapi.json: %v", missing)
+	}
+	if len(stale) > 0 {
+		t.Errorf("operations in openapi.json with no route: %v", stale)
+	}
+}
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	rec := httptest.NewRecorder()
+	server.Router().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/openapi.json", nil))
+
+	if rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+	var doc openAPIDoc
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+}
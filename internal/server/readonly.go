@@ -0,0 +1,37 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"repram/internal/logging"
+)
+
+// SetReadOnly turns read-only mode on or off. A read-only node refuses
+// client writes with 503 read_only but still stores writes replicated from
+// its peers, so it keeps up with the enclave while it is quarantined.
+func (s *Server) SetReadOnly(on bool) {
+	if s.readOnly.Swap(on) != on {
+		if on {
+			logging.Info("Read-only: refusing client writes")
+		} else {
+			logging.Info("Read-only mode off: taking client writes again")
+		}
+	}
+}
+
+// readOnlyHandler and writableHandler toggle read-only mode at runtime.
+func (s *Server) readOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	s.SetReadOnly(true)
+	writeReadOnly(w, true)
+}
+
+func (s *Server) writableHandler(w http.ResponseWriter, r *http.Request) {
+	s.SetReadOnly(false)
+	writeReadOnly(w, false)
+}
+
+func writeReadOnly(w http.ResponseWriter, on bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"read_only": on})
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyRefusesClientWritesOnly(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.adminToken = testAdminToken
+	router := server.Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest("POST", "/v1/admin/read-only", ""))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"read_only":true`) {
+		t.Fatalf("POST /v1/admin/read-only: status = %d, body %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/v1/data/client", strings.NewReader("data")))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"read_only"`) {
+		t.Fatalf("client PUT while read-only: status = %d, body %s", w.Code, w.Body)
+	}
+
+	// Replicated writes keep the node in step with its peers
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/gossip/message",
+		strings.NewReader(`{"type":"PUT","from":"peer","key":"replicated","data":"dg==","ttl":300,"message_id":"m1"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("gossip PUT while read-only: status = %d, body %s", w.Code, w.Body)
+	}
+	if _, ok := server.clusterNode.Get("replicated"); !ok {
+		t.Fatal("replicated write was not stored")
+	}
+
+	// Reads go on, so the node stays ready
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/health/ready", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"read_only":true`) {
+		t.Fatalf("ready while read-only: status = %d, body %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest("DELETE", "/v1/admin/read-only", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("DELETE /v1/admin/read-only: status = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/v1/data/client", strings.NewReader("data")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("client PUT after read-only ended: status = %d", w.Code)
+	}
+}
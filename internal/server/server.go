@@ -0,0 +1,1031 @@
+// Package server implements the node's HTTP API: the client data endpoints,
+// node introspection, and the gossip and bootstrap endpoints peers call.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"repram/internal/audit"
+	"repram/internal/cluster"
+	"repram/internal/gossip"
+	"repram/internal/node"
+	"repram/internal/pressure"
+	"repram/internal/storage"
+)
+
+// Options configures a Server.
+type Options struct {
+	ClusterNode   *cluster.ClusterNode
+	NodeID        string
+	Network       string         // "public" or "private", reported by /v1/health
+	MinTTL        int            // seconds; shorter TTLs are raised to this
+	MaxTTL        int            // seconds; longer TTLs are lowered to this
+	DefaultTTL    int            // seconds, for writes that don't set a TTL (0 = 3600)
+	NamespaceTTLs map[string]int // key namespace → default TTL in seconds, overriding DefaultTTL
+	TTLJitterPct  int            // shorten each write's TTL by up to this percent, at random (0 = off)
+	SecurityMW    *node.SecurityMiddleware
+	InternalMW    *node.SecurityMiddleware // for InternalRouter; nil uses SecurityMW
+	CORSOrigins   *node.CORSOrigins        // nil allows no cross-origin requests
+	KeyRules      node.KeyRules
+	Pressure      *pressure.Monitor        // nil disables write shedding
+	Inflight      *node.InflightLimiter    // nil counts and limits no requests in flight
+	Timeouts      map[string]time.Duration // per endpoint class; missing classes use node.DefaultTimeouts
+	CacheMaxAge   int                      // seconds; caps Cache-Control max-age on GET (0 = no-cache)
+	UI            bool                     // serve the operator dashboard at /ui/
+	AdminToken    string                   // bearer token for /v1/admin/ endpoints ("" = no admin endpoints)
+	ReadOnly      bool                     // start refusing client writes; see SetReadOnly
+	Audit         *audit.Logger            // records every client write; nil = no audit log
+}
+
+type Server struct {
+	clusterNode   *cluster.ClusterNode
+	nodeID        string
+	network       string
+	minTTL        int
+	maxTTL        int
+	defaultTTL    int
+	namespaceTTLs map[string]int
+	ttlJitterPct  int
+	startTime     time.Time
+	securityMW    *node.SecurityMiddleware
+	internalMW    *node.SecurityMiddleware
+	corsOrigins   *node.CORSOrigins
+	keyRules      node.KeyRules
+	pressure      *pressure.Monitor
+	inflight      *node.InflightLimiter
+	timeouts      map[string]time.Duration
+	cacheMaxAge   int
+	ui            bool
+	adminToken    string
+	drain         drainState
+	readOnly      atomic.Bool
+	audit         *audit.Logger
+}
+
+// New creates a Server. Uptime in /v1/status counts from this call.
+func New(opts Options) *Server {
+	s := &Server{
+		clusterNode:   opts.ClusterNode,
+		nodeID:        opts.NodeID,
+		network:       opts.Network,
+		minTTL:        opts.MinTTL,
+		maxTTL:        opts.MaxTTL,
+		defaultTTL:    opts.DefaultTTL,
+		namespaceTTLs: opts.NamespaceTTLs,
+		ttlJitterPct:  opts.TTLJitterPct,
+		startTime:     time.Now(),
+		securityMW:    opts.SecurityMW,
+		internalMW:    opts.InternalMW,
+		corsOrigins:   opts.CORSOrigins,
+		keyRules:      opts.KeyRules,
+		pressure:      opts.Pressure,
+		inflight:      opts.Inflight,
+		timeouts:      opts.Timeouts,
+		cacheMaxAge:   opts.CacheMaxAge,
+		ui:            opts.UI,
+		adminToken:    opts.AdminToken,
+		audit:         opts.Audit,
+	}
+	s.readOnly.Store(opts.ReadOnly)
+	return s
+}
+
+// Router serves the whole API, client and peer endpoints alike, on one
+// port.
+func (s *Server) Router() *mux.Router {
+	r := s.ClientRouter()
+	s.routePeerEndpoints(r)
+	return r
+}
+
+// ClientRouter serves the client API without the gossip and bootstrap
+// endpoints, for a node that serves those on InternalRouter's port.
+func (s *Server) ClientRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = node.NotFoundHandler()
+	r.MethodNotAllowedHandler = node.MethodNotAllowedHandler()
+
+	// Apply middleware
+	r.Use(node.RequestIDMiddleware)
+	r.Use(node.CORSMiddleware(s.corsOrigins))
+	r.Use(s.securityMW.Middleware)
+	r.Use(node.KeyValidationMiddleware(s.keyRules))
+	r.Use(s.securityMW.RequestSizeMiddleware)
+	if s.inflight != nil {
+		r.Use(s.inflight.Middleware)
+	}
+	r.Use(node.ClassTimeoutMiddleware(s.timeouts))
+	r.Use(node.RecoveryMiddleware)
+
+	// v1 API endpoints
+	r.HandleFunc("/v1/data/{key}", s.audited(s.putHandler)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/v1/data/{key}", s.getHandler).Methods("GET", "HEAD", "OPTIONS")
+	r.HandleFunc("/v1/keys", s.keysHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/scan", s.scanHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/health", s.healthHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/health/ready", s.readyHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/status", s.statusHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/metrics", promhttp.Handler().ServeHTTP).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/topology", s.topologyHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/debug/writes", s.debugWritesHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/debug/keys/{key}", s.debugKeyHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/cluster/events", s.clusterEventsHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/v1/openapi.json", openAPIHandler).Methods("GET", "OPTIONS")
+
+	// Admin endpoints, behind the admin token
+	r.HandleFunc(node.SnapshotPath, node.RequireAdminToken(s.adminToken, s.snapshotExportHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc(node.SnapshotPath, node.RequireAdminToken(s.adminToken, s.snapshotImportHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/v1/admin/drain", node.RequireAdminToken(s.adminToken, s.drainHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/v1/admin/drain", node.RequireAdminToken(s.adminToken, s.undrainHandler)).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/v1/admin/read-only", node.RequireAdminToken(s.adminToken, s.readOnlyHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/v1/admin/read-only", node.RequireAdminToken(s.adminToken, s.writableHandler)).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/v1/admin/takedown/{key}", node.RequireAdminToken(s.adminToken, s.takedownHandler)).Methods("POST", "OPTIONS")
+
+	// Pre-v1 scan paths, kept for clients such as the Discord bridge
+	r.HandleFunc("/scan", s.scanHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/raw/scan", s.scanHandler).Methods("GET", "OPTIONS")
+
+	if s.ui {
+		r.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently)).Methods("GET", "HEAD")
+		r.PathPrefix("/ui/").Handler(uiHandler()).Methods("GET", "HEAD")
+	}
+
+	return r
+}
+
+// InternalRouter serves only the gossip and bootstrap endpoints, for a
+// listener peers reach but clients don't. Its middleware is the internal
+// SecurityMiddleware (rate limits, size limits) without CORS or client key
+// rules.
+func (s *Server) InternalRouter() *mux.Router {
+	mw := s.internalMW
+	if mw == nil {
+		mw = s.securityMW
+	}
+	r := mux.NewRouter()
+	r.NotFoundHandler = node.NotFoundHandler()
+	r.MethodNotAllowedHandler = node.MethodNotAllowedHandler()
+
+	r.Use(node.RequestIDMiddleware)
+	r.Use(mw.Middleware)
+	r.Use(mw.RequestSizeMiddleware)
+	if s.inflight != nil {
+		r.Use(s.inflight.Middleware)
+	}
+	r.Use(node.ClassTimeoutMiddleware(s.timeouts))
+	r.Use(node.RecoveryMiddleware)
+
+	s.routePeerEndpoints(r)
+	return r
+}
+
+// routePeerEndpoints adds the internal gossip endpoints to r.
+func (s *Server) routePeerEndpoints(r *mux.Router) {
+	r.HandleFunc("/v1/gossip/message", s.gossipHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/v1/bootstrap", s.bootstrapHandler).Methods("POST", "OPTIONS")
+}
+
+// healthHandler reports 200 healthy, or 503 degraded with the problems
+// found, so orchestrators stop routing to a node that is up but can't
+// serve: full, not expiring values, or cut off from its cluster.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
+		"status":  "healthy",
+		"node_id": s.nodeID,
+		"network": s.network,
+		"enclave": s.clusterNode.Enclave(),
+	}
+	status := http.StatusOK
+	if problems := s.clusterNode.HealthProblems(); len(problems) > 0 {
+		resp["status"] = "degraded"
+		resp["problems"] = problems
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readyHandler tells load balancers whether to send this node client
+// traffic: 200 while it takes writes, 503 while draining or drained. A
+// read-only node still serves reads, so it stays ready and says so.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	state := s.drain.get()
+	status := http.StatusOK
+	if state != stateServing {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    state,
+		"node_id":   s.nodeID,
+		"read_only": s.readOnly.Load(),
+	})
+}
+
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "healthy",
+		"node_id":    s.nodeID,
+		"network":    s.network,
+		"enclave":    s.clusterNode.Enclave(),
+		"uptime":     time.Since(s.startTime).String(),
+		"goroutines": runtime.NumGoroutine(),
+		"gossip":     s.clusterNode.GossipStatus(),
+		"storage":    s.clusterNode.StorageStatus(),
+		"memory": map[string]interface{}{
+			"alloc":       m.Alloc,
+			"total_alloc": m.TotalAlloc,
+			"sys":         m.Sys,
+			"num_gc":      m.NumGC,
+		},
+	})
+}
+
+func (s *Server) topologyHandler(w http.ResponseWriter, r *http.Request) {
+	peers := s.clusterNode.Topology()
+
+	// Public networks also report each peer's standing
+	type reputation struct {
+		gossip.PeerStats
+		Score    float64 `json:"score"`
+		Demoted  bool    `json:"demoted"`
+		Verified bool    `json:"verified"`
+	}
+	// Peers that advertise their storage usage also report its headroom
+	type capacity struct {
+		gossip.Capacity
+		Headroom   float64 `json:"headroom"`
+		NearlyFull bool    `json:"nearly_full"`
+	}
+	type peerInfo struct {
+		ID           string      `json:"id"`
+		Address      string      `json:"address"`
+		HTTPPort     int         `json:"http_port"`
+		InternalPort int         `json:"internal_port,omitempty"`
+		Enclave      string      `json:"enclave"`
+		Zone         string      `json:"zone,omitempty"`
+		Reputation   *reputation `json:"reputation,omitempty"`
+		Capacity     *capacity   `json:"capacity,omitempty"`
+		RTTMillis    *float64    `json:"rtt_ms,omitempty"`
+	}
+
+	peerList := make([]peerInfo, 0, len(peers))
+	for _, p := range peers {
+		info := peerInfo{
+			ID:           string(p.ID),
+			Address:      p.Address,
+			HTTPPort:     p.HTTPPort,
+			InternalPort: p.InternalPort,
+			Enclave:      p.Enclave,
+			Zone:         p.Zone,
+		}
+		if stats, verified, ok := s.clusterNode.PeerStanding(p.ID); ok {
+			score := stats.Score()
+			info.Reputation = &reputation{PeerStats: stats, Score: score, Demoted: score < gossip.DemoteScore, Verified: verified}
+		}
+		if c, ok := s.clusterNode.PeerCapacity(p.ID); ok {
+			info.Capacity = &capacity{Capacity: c, Headroom: c.Headroom(), NearlyFull: c.NearlyFull()}
+		}
+		if rtt, ok := s.clusterNode.PeerRTT(p.ID); ok {
+			ms := float64(rtt.Microseconds()) / 1000
+			info.RTTMillis = &ms
+		}
+		peerList = append(peerList, info)
+	}
+
+	resp := map[string]interface{}{
+		"node_id": s.nodeID,
+		"enclave": s.clusterNode.Enclave(),
+		"peers":   peerList,
+	}
+	if zone := s.clusterNode.Zone(); zone != "" {
+		resp["zone"] = zone
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// debugWritesHandler lists the node's recent writes with the ACKs each
+// received, so an operator can see which peer failed to confirm a write
+// without turning on debug logging.
+func (s *Server) debugWritesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node_id": s.nodeID,
+		"writes":  s.clusterNode.RecentWrites(),
+	})
+}
+
+// debugKeyHandler describes the value this node holds for a key without
+// returning it: its size, hash and TTL, and the node a client wrote it to,
+// so an operator can trace which node introduced a key into the enclave.
+func (s *Server) debugKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	data, meta, exists := s.clusterNode.ViewMeta(key)
+	if !exists {
+		node.WriteError(w, r, http.StatusNotFound, node.CodeNotFound, "Key not found")
+		return
+	}
+
+	type keyInfo struct {
+		Key          string `json:"key"`
+		Size         int    `json:"size"`
+		Hash         string `json:"hash"`
+		CreatedAt    string `json:"created_at"`
+		ExpiresAt    string `json:"expires_at"`
+		OriginalTTL  int    `json:"original_ttl"`
+		RemainingTTL int    `json:"remaining_ttl"`
+		Origin       string `json:"origin,omitempty"`
+		WrittenAt    string `json:"written_at,omitempty"`
+	}
+	info := keyInfo{
+		Key:          key,
+		Size:         len(data),
+		Hash:         valueHash(data, meta),
+		CreatedAt:    meta.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ExpiresAt:    meta.ExpiresAt.UTC().Format(time.RFC3339Nano),
+		OriginalTTL:  int(meta.TTL.Seconds()),
+		RemainingTTL: max(0, int(time.Until(meta.ExpiresAt).Seconds())),
+		Origin:       meta.Origin.Node,
+	}
+	if meta.Origin.Node != "" {
+		info.WrittenAt = meta.Origin.WrittenAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node_id": s.nodeID,
+		"entry":   info,
+	})
+}
+
+// clusterEventsHandler lists the node's recent membership events, so an
+// operator can reconstruct which peers joined, left and moved during an
+// incident.
+func (s *Server) clusterEventsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node_id": s.nodeID,
+		"events":  s.clusterNode.MembershipEvents(),
+	})
+}
+
+func (s *Server) putHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	if s.refusesWrites(w, r) {
+		return
+	}
+
+	// Shed load under memory pressure before the body is read into memory
+	if s.pressure.Shed(r.Header.Get("X-Priority")) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.pressure.RetryAfter().Seconds())))
+		node.WriteError(w, r, http.StatusServiceUnavailable, node.CodeOverloaded, "Node is under memory pressure")
+		return
+	}
+
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	auditWrite(r).Size = len(body)
+
+	// A client that sends the body's SHA-256 learns of truncation or
+	// corruption on the way here, instead of having the damaged value
+	// stored and replicated.
+	checksum := r.Header.Get("X-Content-SHA256")
+	if checksum != "" {
+		if !strings.EqualFold(checksum, gossip.ContentHash(body)) {
+			node.WriteError(w, r, http.StatusBadRequest, node.CodeChecksumMismatch, "Body does not match X-Content-SHA256")
+			return
+		}
+		w.Header().Set("X-Content-SHA256", strings.ToLower(checksum))
+	}
+
+	// TTL from query param or header, as seconds or a duration like "15m"
+	ttl := s.defaultTTLFor(key)
+	ttlStr := r.URL.Query().Get("ttl")
+	if ttlStr == "" {
+		ttlStr = r.Header.Get("X-TTL")
+	}
+	if ttlStr != "" {
+		parsed, err := node.ParseTTL(ttlStr)
+		if err != nil {
+			node.WriteError(w, r, http.StatusBadRequest, node.CodeInvalidTTL, err.Error())
+			return
+		}
+		ttl = int(min(parsed/time.Second, time.Duration(s.maxTTL)))
+	}
+
+	// Enforce TTL bounds
+	if ttl < s.minTTL {
+		ttl = s.minTTL
+	}
+	if ttl > s.maxTTL {
+		ttl = s.maxTTL
+	}
+
+	// Opt-in dedup: an identical value that will live at least as long
+	// needs neither a write nor another round of gossip.
+	if strings.EqualFold(r.Header.Get("X-Dedup"), "true") {
+		if remaining, same := s.clusterNode.SameValue(key, body); same && remaining >= time.Duration(ttl)*time.Second {
+			w.Header().Set("X-Dedup", "true")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "OK")
+			return
+		}
+	}
+
+	// Keys written in one batch would otherwise all expire in the same
+	// sweep. The jittered TTL is what gets stored and replicated, so
+	// X-Original-TTL reports it.
+	ttl = s.jitterTTL(ttl)
+	auditWrite(r).TTL = ttl
+
+	// Nodes to store the value on; invalid values fall back to the default,
+	// as ttl does. The cluster node caps it.
+	replication := 0
+	if str := r.Header.Get("X-Replication"); str != "" {
+		if parsed, err := strconv.Atoi(str); err == nil && parsed > 0 {
+			replication = parsed
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.writeTimeout(r))
+	defer cancel()
+
+	result, err := s.clusterNode.PutWithResult(ctx, key, body, time.Duration(ttl)*time.Second, replication)
+	if result.Nodes > 0 && strings.EqualFold(r.Header.Get("X-Replication-Status"), "true") {
+		// Lets clients show degraded replication as it happens
+		w.Header().Set("X-Repram-Peers", strconv.Itoa(result.Nodes))
+		w.Header().Set("X-Repram-Quorum", fmt.Sprintf("%d/%d", result.Confirmed, result.Quorum))
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrStoreFull) {
+			node.WriteError(w, r, http.StatusInsufficientStorage, node.CodeStorageFull, "Node storage capacity exceeded")
+			return
+		}
+		if errors.Is(err, storage.ErrValueTooLarge) {
+			node.WriteError(w, r, http.StatusRequestEntityTooLarge, node.CodePayloadTooLarge, "Value exceeds the node's maximum value size")
+			return
+		}
+		if errors.Is(err, cluster.ErrQuorumTimeout) {
+			// Data is stored locally and will propagate via gossip.
+			// 202 Accepted signals "written, replication in progress."
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, "Accepted (quorum pending)")
+			return
+		}
+		var nackErr *cluster.NackError
+		if errors.As(err, &nackErr) {
+			// Stored locally, but too few replicas could take it
+			w.Header().Set("X-Replication-Warning", nackErr.Summary())
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, "Accepted (quorum unreachable)")
+			return
+		}
+		node.WriteError(w, r, http.StatusInternalServerError, node.CodeInternal, fmt.Sprintf("Write failed: %v", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "OK")
+}
+
+// maxWriteTimeout bounds the ?timeout= override, so a client can't hold a
+// request (and its pending write) open indefinitely.
+const maxWriteTimeout = 60 * time.Second
+
+// writeTimeout is how long a PUT waits for quorum before answering 202: the
+// node's write timeout, or the request's ?timeout= in seconds, clamped to
+// 1-60. Invalid values fall back to the node's timeout, as ttl does.
+func (s *Server) writeTimeout(r *http.Request) time.Duration {
+	timeout := s.clusterNode.WriteTimeout()
+	if str := r.URL.Query().Get("timeout"); str != "" {
+		if parsed, err := strconv.Atoi(str); err == nil && parsed > 0 {
+			timeout = min(time.Duration(parsed)*time.Second, maxWriteTimeout)
+		}
+	}
+	return timeout
+}
+
+func (s *Server) getHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	// Read-only view: the value goes straight to the response
+	data, meta, exists := s.clusterNode.ViewMeta(key)
+	if !exists {
+		node.WriteError(w, r, http.StatusNotFound, node.CodeNotFound, "Key not found")
+		return
+	}
+	createdAt, originalTTL := meta.CreatedAt, meta.TTL
+
+	elapsed := time.Since(createdAt)
+	remainingTTL := originalTTL - elapsed
+	if remainingTTL < 0 {
+		remainingTTL = 0
+	}
+
+	hash := valueHash(data, meta)
+	etag := `"` + hash + `"`
+	w.Header().Set("X-Created-At", createdAt.Format(time.RFC3339))
+	w.Header().Set("X-Original-TTL", strconv.Itoa(int(originalTTL.Seconds())))
+	w.Header().Set("X-Remaining-TTL", strconv.Itoa(int(remainingTTL.Seconds())))
+	w.Header().Set("X-Content-SHA256", hash)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", s.cacheControl(remainingTTL))
+	if meta.Origin.Node != "" {
+		w.Header().Set("X-Repram-Origin", meta.Origin.Node)
+		w.Header().Set("X-Repram-Written-At", meta.Origin.WrittenAt.UTC().Format(time.RFC3339Nano))
+	}
+
+	// Pollers that already hold this value get its headers without the body
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// defaultTTLFor is the TTL in seconds for a write to key that doesn't set
+// one: its namespace's default, else the node's.
+func (s *Server) defaultTTLFor(key string) int {
+	if ns, _, found := strings.Cut(key, ":"); found {
+		if ttl, ok := s.namespaceTTLs[ns]; ok {
+			return ttl
+		}
+	}
+	if s.defaultTTL > 0 {
+		return s.defaultTTL
+	}
+	return 3600
+}
+
+// jitterTTL shortens ttl by a random amount up to the node's jitter
+// percentage, never below the minimum TTL. Jitter only shortens, so no
+// value outlives the TTL its writer asked for.
+func (s *Server) jitterTTL(ttl int) int {
+	spread := ttl * s.ttlJitterPct / 100
+	if spread <= 0 {
+		return ttl
+	}
+	return max(ttl-rand.IntN(spread+1), s.minTTL)
+}
+
+// cacheControl lets caches keep a value for its remaining TTL, capped at
+// the node's cache max-age so an overwrite isn't hidden for long. With the
+// cap at 0, caches must revalidate every time, which the ETag makes cheap.
+func (s *Server) cacheControl(remainingTTL time.Duration) string {
+	maxAge := min(int(remainingTTL.Seconds()), s.cacheMaxAge)
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	return "max-age=" + strconv.Itoa(maxAge)
+}
+
+// valueHash returns the content hash recorded when the value was stored,
+// hashing the value only if none was, so reads and revalidations don't
+// run SHA-256 over every value they serve.
+func valueHash(data []byte, meta storage.EntryMeta) string {
+	if meta.Hash != "" {
+		return meta.Hash
+	}
+	return gossip.ContentHash(data)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag or is "*".
+// Tags are compared weakly, as RFC 9110 requires for If-None-Match, so a
+// W/ prefix added by a proxy doesn't defeat the match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) keysHandler(w http.ResponseWriter, r *http.Request) {
+	entries, nextCursor, ok := s.listPage(w, r)
+	if !ok {
+		return
+	}
+
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	resp := map[string]interface{}{
+		"keys": keys,
+	}
+	if nextCursor != "" {
+		resp["next_cursor"] = nextCursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// scanEntry is one key in a /v1/scan response.
+type scanEntry struct {
+	Key     string `json:"key"`
+	TTL     int    `json:"ttl"`               // remaining seconds
+	Size    *int   `json:"size,omitempty"`    // value bytes, with include=preview
+	Preview []byte `json:"preview,omitempty"` // first preview_bytes of the value
+}
+
+// Value previews in scans: preview_bytes defaults to defaultPreviewBytes,
+// and larger requests are cut to maxPreviewBytes to bound the response of
+// an unlimited scan.
+const (
+	defaultPreviewBytes = 128
+	maxPreviewBytes     = 4096
+)
+
+// scanHandler lists live keys with their remaining TTL. It takes the same
+// prefix, limit, and cursor parameters as /v1/keys. With include=preview
+// each entry also carries the value's size and its first preview_bytes, so
+// a UI can list messages without fetching each one.
+func (s *Server) scanHandler(w http.ResponseWriter, r *http.Request) {
+	previewBytes := 0
+	if include := r.URL.Query().Get("include"); include != "" {
+		if include != "preview" {
+			node.WriteError(w, r, http.StatusBadRequest, node.CodeBadRequest, fmt.Sprintf("Unknown include %q; use \"preview\"", include))
+			return
+		}
+		previewBytes = defaultPreviewBytes
+		if n := r.URL.Query().Get("preview_bytes"); n != "" {
+			parsed, err := strconv.Atoi(n)
+			if err != nil || parsed < 1 {
+				node.WriteError(w, r, http.StatusBadRequest, node.CodeBadRequest, "preview_bytes must be a positive number of bytes")
+				return
+			}
+			previewBytes = min(parsed, maxPreviewBytes)
+		}
+	}
+
+	entries, nextCursor, ok := s.listPage(w, r)
+	if !ok {
+		return
+	}
+	if previewBytes > 0 {
+		entries = s.withPreviews(entries, previewBytes)
+	}
+
+	resp := map[string]interface{}{
+		"entries": append([]scanEntry{}, entries...),
+	}
+	if nextCursor != "" {
+		resp["next_cursor"] = nextCursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// withPreviews adds each entry's size and first n bytes of value. Keys
+// that expired since they were listed are dropped.
+func (s *Server) withPreviews(entries []scanEntry, n int) []scanEntry {
+	kept := entries[:0]
+	for _, e := range entries {
+		data, _, _, ok := s.clusterNode.View(e.Key)
+		if !ok {
+			continue
+		}
+		size := len(data)
+		e.Size = &size
+		e.Preview = data[:min(n, size)]
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+// listPage returns one page of live keys, honouring the prefix, cursor,
+// limit, and order query parameters. order=key (the default) lists keys
+// lexicographically and the cursor is the last key of the previous page;
+// order=expiry lists soonest-to-expire first and the cursor is opaque. If
+// more keys follow, it returns the cursor for the next page. On a bad
+// parameter it writes a 400 and returns ok=false.
+func (s *Server) listPage(w http.ResponseWriter, r *http.Request) (entries []scanEntry, nextCursor string, ok bool) {
+	query := r.URL.Query()
+
+	// Limit: cap the number of returned keys (0 = all)
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	more := false
+	var lastExpiry time.Time
+	collect := func(key string, ttl int) bool {
+		if limit > 0 && len(entries) == limit {
+			more = true
+			return false
+		}
+		entries = append(entries, scanEntry{Key: key, TTL: ttl})
+		return true
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "key":
+		s.clusterNode.RangePrefix(query.Get("prefix"), query.Get("cursor"), collect)
+		if more {
+			nextCursor = entries[len(entries)-1].Key
+		}
+
+	case "expiry":
+		var after storage.ExpiryPosition
+		if cursor := query.Get("cursor"); cursor != "" {
+			var err error
+			if after, err = parseExpiryCursor(cursor); err != nil {
+				node.WriteError(w, r, http.StatusBadRequest, node.CodeBadRequest, "Invalid cursor for order=expiry")
+				return nil, "", false
+			}
+		}
+		now := time.Now()
+		s.clusterNode.RangeByExpiry(query.Get("prefix"), after, func(key string, expiresAt time.Time) bool {
+			if !collect(key, int(expiresAt.Sub(now).Seconds())) {
+				return false
+			}
+			lastExpiry = expiresAt
+			return true
+		})
+		if more {
+			nextCursor = formatExpiryCursor(storage.ExpiryPosition{ExpiresAt: lastExpiry, Key: entries[len(entries)-1].Key})
+		}
+
+	default:
+		node.WriteError(w, r, http.StatusBadRequest, node.CodeBadRequest, fmt.Sprintf("Unknown order %q; use \"key\" or \"expiry\"", order))
+		return nil, "", false
+	}
+	return entries, nextCursor, true
+}
+
+// Expiry-order cursors are "<expiry unix nanoseconds>:<key>". Keys may
+// contain ':', so only the first one separates the fields.
+func formatExpiryCursor(p storage.ExpiryPosition) string {
+	return strconv.FormatInt(p.ExpiresAt.UnixNano(), 10) + ":" + p.Key
+}
+
+func parseExpiryCursor(cursor string) (storage.ExpiryPosition, error) {
+	nanosStr, key, found := strings.Cut(cursor, ":")
+	nanos, err := strconv.ParseInt(nanosStr, 10, 64)
+	if !found || err != nil || nanos <= 0 {
+		return storage.ExpiryPosition{}, errors.New("malformed expiry cursor")
+	}
+	return storage.ExpiryPosition{ExpiresAt: time.Unix(0, nanos), Key: key}, nil
+}
+
+// readBody reads the request body, answering with an error response if it
+// can't: 413 when the body exceeds the size limit, 400 otherwise.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeReadError(w, r, err)
+		return nil, false
+	}
+	return body, true
+}
+
+// readPeerBody is readBody for the peer endpoints, which see a steady
+// stream of small messages: the body is read into a pooled buffer that the
+// caller must release with gossip.ReleaseBody once it has been unmarshaled.
+func readPeerBody(w http.ResponseWriter, r *http.Request) (*bytes.Buffer, bool) {
+	buf, err := gossip.ReadBody(r.Body)
+	if err != nil {
+		writeReadError(w, r, err)
+		return nil, false
+	}
+	return buf, true
+}
+
+func writeReadError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		node.WriteError(w, r, http.StatusRequestEntityTooLarge, node.CodePayloadTooLarge, "Request too large")
+	} else {
+		node.WriteError(w, r, http.StatusBadRequest, node.CodeBadRequest, "Failed to read request body")
+	}
+}
+
+func (s *Server) verifyGossipSignature(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	switch err := s.clusterNode.VerifyPeerRequest(body, r.Header.Get("X-Repram-Signature")); {
+	case errors.Is(err, gossip.ErrMissingSignature):
+		node.WriteError(w, r, http.StatusForbidden, node.CodeInvalidSignature, "Missing signature")
+		return false
+	case err != nil:
+		node.WriteError(w, r, http.StatusForbidden, node.CodeInvalidSignature, "Invalid signature")
+		return false
+	}
+	return true
+}
+
+// PeerSigned reports whether r carries a valid cluster signature over its
+// body. It is the gate for SecurityMiddleware.ExemptPeerPaths on nodes with
+// a cluster secret, so only real peers skip the client rate limits. The body
+// is read, up to the gossip size limit, and put back for the handler.
+func (s *Server) PeerSigned(r *http.Request) bool {
+	sig := r.Header.Get("X-Repram-Signature")
+	limit := s.securityMW.RequestSizeLimit(r)
+	if sig == "" || r.ContentLength < 0 || r.ContentLength > limit {
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return s.clusterNode.VerifyPeerRequest(body, sig) == nil
+}
+
+// admitPeer refuses gossip and bootstrap requests from nodes excluded by the
+// peer filter, matching the claimed node ID and the connection's address.
+// Peers connect directly, so proxy headers are not consulted.
+func (s *Server) admitPeer(w http.ResponseWriter, r *http.Request, nodeID string) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !s.clusterNode.AdmitsPeer(nodeID, net.ParseIP(host)) {
+		node.WriteError(w, r, http.StatusForbidden, node.CodeForbidden, "Peer not allowed")
+		return false
+	}
+	return true
+}
+
+// validateGossipMessage checks the fields of a peer's message before it
+// reaches the cluster, so a buggy or malicious peer can't store what a
+// client could not. Returns a machine-readable reason and a message, or ""
+// if the message is valid. Reserved key prefixes are not checked: they
+// restrict clients, not replication.
+func (s *Server) validateGossipMessage(msg *gossip.SimpleMessage) (reason, message string) {
+	if msg.From == "" || msg.MessageID == "" {
+		return "missing_field", "from and message_id are required"
+	}
+	if msg.Type != string(gossip.MessageTypePut) && msg.Type != string(gossip.MessageTypeTombstone) {
+		return "", ""
+	}
+	if keyErr := (node.KeyRules{MaxLength: s.keyRules.MaxLength}).Validate(msg.Key); keyErr != nil {
+		return "invalid_key", keyErr.Message
+	}
+	if msg.Type == string(gossip.MessageTypeTombstone) {
+		return "", ""
+	}
+	// TTLs above the maximum are clamped by the cluster node, not rejected
+	if msg.TTL < 1 {
+		return "ttl_out_of_range", fmt.Sprintf("ttl %d must be at least 1 second", msg.TTL)
+	}
+	if msg.Hash != "" {
+		if raw, err := hex.DecodeString(msg.Hash); err != nil || len(raw) != sha256.Size {
+			return "invalid_hash", "hash must be a hex SHA-256 digest"
+		}
+		// A client's X-Content-SHA256 was checked against this hash on the
+		// originating node, so the check carries through to every replica.
+		if !strings.EqualFold(msg.Hash, gossip.ContentHash(msg.Data)) {
+			return "hash_mismatch", "data does not match its hash"
+		}
+	}
+	return "", ""
+}
+
+func (s *Server) gossipHandler(w http.ResponseWriter, r *http.Request) {
+	buf, ok := readPeerBody(w, r)
+	if !ok {
+		return
+	}
+	defer gossip.ReleaseBody(buf)
+	body := buf.Bytes()
+
+	if !s.verifyGossipSignature(w, r, body) {
+		return
+	}
+
+	var simpleMsg gossip.SimpleMessage
+	if err := json.Unmarshal(body, &simpleMsg); err != nil {
+		node.WriteError(w, r, http.StatusBadRequest, node.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if !s.admitPeer(w, r, simpleMsg.From) {
+		return
+	}
+	if reason, message := s.validateGossipMessage(&simpleMsg); reason != "" {
+		s.clusterNode.ReportInvalidMessage(simpleMsg.From)
+		if simpleMsg.Type == string(gossip.MessageTypePut) && reason != "missing_field" {
+			s.clusterNode.RejectPut(simpleMsg.From, simpleMsg.Key, simpleMsg.MessageID, reason)
+		}
+		node.WriteErrorReason(w, r, http.StatusBadRequest, node.CodeInvalidMessage, reason, message)
+		return
+	}
+
+	gossipMsg := &gossip.Message{
+		Type:        gossip.MessageType(simpleMsg.Type),
+		From:        gossip.NodeID(simpleMsg.From),
+		To:          gossip.NodeID(simpleMsg.To),
+		Key:         simpleMsg.Key,
+		Data:        simpleMsg.Data,
+		Hash:        simpleMsg.Hash,
+		TTL:         int(simpleMsg.TTL),
+		Replication: simpleMsg.Replication,
+		Reason:      simpleMsg.Reason,
+		Resend:      simpleMsg.Resend,
+		Origin:      gossip.NodeID(simpleMsg.Origin),
+		WrittenAt:   simpleMsg.WrittenAtTime(),
+		Timestamp:   time.Unix(simpleMsg.Timestamp, 0),
+		MessageID:   simpleMsg.MessageID,
+		Updates:     gossip.PeerUpdates(simpleMsg.Updates),
+	}
+
+	if simpleMsg.NodeInfo != nil {
+		enclave := simpleMsg.NodeInfo.Enclave
+		if enclave == "" {
+			enclave = "default"
+		}
+		gossipMsg.NodeInfo = &gossip.Node{
+			ID:           gossip.NodeID(simpleMsg.NodeInfo.ID),
+			Address:      simpleMsg.NodeInfo.Address,
+			Port:         simpleMsg.NodeInfo.Port,
+			HTTPPort:     simpleMsg.NodeInfo.HTTPPort,
+			InternalPort: simpleMsg.NodeInfo.InternalPort,
+			Enclave:      enclave,
+			Zone:         simpleMsg.NodeInfo.Zone,
+			Capacity:     simpleMsg.NodeInfo.Capacity,
+		}
+	}
+
+	if err := s.clusterNode.HandleGossipMessage(gossipMsg); err != nil {
+		if errors.Is(err, storage.ErrValueTooLarge) {
+			node.WriteError(w, r, http.StatusRequestEntityTooLarge, node.CodePayloadTooLarge, "Value exceeds the node's maximum value size")
+			return
+		}
+		node.WriteError(w, r, http.StatusInternalServerError, node.CodeInternal, fmt.Sprintf("Gossip error: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func (s *Server) bootstrapHandler(w http.ResponseWriter, r *http.Request) {
+	buf, ok := readPeerBody(w, r)
+	if !ok {
+		return
+	}
+	defer gossip.ReleaseBody(buf)
+	body := buf.Bytes()
+
+	if !s.verifyGossipSignature(w, r, body) {
+		return
+	}
+
+	var req gossip.BootstrapRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		node.WriteError(w, r, http.StatusBadRequest, node.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if !s.admitPeer(w, r, req.NodeID) {
+		return
+	}
+
+	resp, err := s.clusterNode.HandleBootstrap(&req)
+	if err != nil {
+		s.clusterNode.ReportInvalidMessage(req.NodeID)
+		node.WriteErrorReason(w, r, http.StatusBadRequest, node.CodeInvalidMessage, "invalid_bootstrap", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,1684 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"repram/internal/cluster"
+	"repram/internal/gossip"
+	"repram/internal/node"
+	"repram/internal/pressure"
+	"repram/internal/storage"
+)
+
+// newTestServer creates a Server backed by a single-node cluster
+// suitable for handler-level tests. No gossip, no network.
+func newTestServer(t *testing.T) (*Server, func()) {
+	t.Helper()
+
+	cn := cluster.NewClusterNode(
+		"test-node", "localhost", 0, 0,
+		1, // replicationFactor=1 → quorum=1 (local write sufficient)
+		0, // unlimited storage
+		5*time.Second,
+		"", // no cluster secret
+		"default",
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := cn.Start(ctx, nil); err != nil {
+		t.Fatalf("failed to start cluster node: %v", err)
+	}
+
+	securityMW := node.NewSecurityMiddleware(1000, 2000, 10*1024*1024, false)
+
+	server := &Server{
+		clusterNode: cn,
+		nodeID:      "test-node",
+		network:     "private",
+		minTTL:      300,
+		maxTTL:      86400,
+		startTime:   time.Now(),
+		securityMW:  securityMW,
+	}
+
+	cleanup := func() {
+		securityMW.Close()
+		cn.Stop()
+		cancel()
+	}
+
+	return server, cleanup
+}
+
+// --- PUT handler tests ---
+
+func TestPutReturns201(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("PUT", "/v1/data/mykey", strings.NewReader("hello"))
+	req.Header.Set("X-TTL", "600")
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if peers, quorum := w.Header().Get("X-Repram-Peers"), w.Header().Get("X-Repram-Quorum"); peers != "" || quorum != "" {
+		t.Fatalf("X-Repram-Peers = %q, X-Repram-Quorum = %q; want neither without X-Replication-Status", peers, quorum)
+	}
+}
+
+func TestPutReportsReplicationStatusOnRequest(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("PUT", "/v1/data/mykey", strings.NewReader("hello"))
+	req.Header.Set("X-TTL", "600")
+	req.Header.Set("X-Replication-Status", "true")
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	// A lone node is the whole enclave and its own quorum
+	if peers, quorum := w.Header().Get("X-Repram-Peers"), w.Header().Get("X-Repram-Quorum"); peers != "1" || quorum != "1/1" {
+		t.Fatalf("X-Repram-Peers = %q, X-Repram-Quorum = %q; want 1 and 1/1", peers, quorum)
+	}
+}
+
+func TestPutTTLFromQueryParam(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("PUT", "/v1/data/qkey?ttl=600", strings.NewReader("data"))
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+
+	// Verify it was stored
+	getReq := httptest.NewRequest("GET", "/v1/data/qkey", nil)
+	getW := httptest.NewRecorder()
+	server.Router().ServeHTTP(getW, getReq)
+
+	if getW.Code != http.StatusOK {
+		t.Fatalf("GET after PUT: expected 200, got %d", getW.Code)
+	}
+	if getW.Body.String() != "data" {
+		t.Fatalf("GET body = %q, want %q", getW.Body.String(), "data")
+	}
+}
+
+func TestPutTTLClampedToMin(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	// Request TTL=1 (below minTTL=300) — should be clamped, not rejected
+	req := httptest.NewRequest("PUT", "/v1/data/clampkey", strings.NewReader("data"))
+	req.Header.Set("X-TTL", "1")
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+
+	// Verify the data is stored and TTL was clamped to minTTL (300)
+	getReq := httptest.NewRequest("GET", "/v1/data/clampkey", nil)
+	getW := httptest.NewRecorder()
+	server.Router().ServeHTTP(getW, getReq)
+
+	originalTTL := getW.Header().Get("X-Original-TTL")
+	if originalTTL != "300" {
+		t.Fatalf("X-Original-TTL = %q, want %q (clamped to minTTL)", originalTTL, "300")
+	}
+}
+
+func TestPutDefaultTTLPerNamespace(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.defaultTTL = 1200
+	server.namespaceTTLs = map[string]int{"session": 600}
+
+	for key, want := range map[string]string{"session:abc": "600", "chat:abc": "1200", "plain": "1200"} {
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("PUT", "/v1/data/"+key, strings.NewReader("data")))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s: expected 201, got %d", key, w.Code)
+		}
+		getW := httptest.NewRecorder()
+		server.Router().ServeHTTP(getW, httptest.NewRequest("GET", "/v1/data/"+key, nil))
+		if got := getW.Header().Get("X-Original-TTL"); got != want {
+			t.Errorf("%s: X-Original-TTL = %s, want %s", key, got, want)
+		}
+	}
+
+	// An explicit TTL still wins over the namespace default
+	req := httptest.NewRequest("PUT", "/v1/data/session:explicit", strings.NewReader("data"))
+	req.Header.Set("X-TTL", "900")
+	server.Router().ServeHTTP(httptest.NewRecorder(), req)
+	getW := httptest.NewRecorder()
+	server.Router().ServeHTTP(getW, httptest.NewRequest("GET", "/v1/data/session:explicit", nil))
+	if got := getW.Header().Get("X-Original-TTL"); got != "900" {
+		t.Errorf("explicit TTL: X-Original-TTL = %s, want 900", got)
+	}
+}
+
+func TestPutTTLJitterOnlyShortens(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.ttlJitterPct = 20
+
+	seen := make(map[string]bool)
+	for i := range 20 {
+		key := fmt.Sprintf("jitter-%d", i)
+		req := httptest.NewRequest("PUT", "/v1/data/"+key, strings.NewReader("data"))
+		req.Header.Set("X-TTL", "1000")
+		server.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+		getW := httptest.NewRecorder()
+		server.Router().ServeHTTP(getW, httptest.NewRequest("GET", "/v1/data/"+key, nil))
+		got := getW.Header().Get("X-Original-TTL")
+		if ttl, err := strconv.Atoi(got); err != nil || ttl < 800 || ttl > 1000 {
+			t.Fatalf("X-Original-TTL = %q, want 800-1000", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("20 writes all stored TTL %v; want jitter to spread them", seen)
+	}
+}
+
+func TestPutMalformedTTLRejected(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	for _, ttl := range []string{"not-a-number", "-100", "0", "1.5d"} {
+		req := httptest.NewRequest("PUT", "/v1/data/badttl", strings.NewReader("data"))
+		req.Header.Set("X-TTL", ttl)
+		w := httptest.NewRecorder()
+
+		server.Router().ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), node.CodeInvalidTTL) {
+			t.Errorf("X-TTL %q: got %d %s, want 400 invalid_ttl", ttl, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPutTTLAcceptsDurations(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	for ttl, want := range map[string]string{"15m": "900", "2h": "7200", "1d": "86400", "1d12h": "86400", "600": "600"} {
+		req := httptest.NewRequest("PUT", "/v1/data/durttl?ttl="+ttl, strings.NewReader("data"))
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("ttl=%s: expected 201, got %d: %s", ttl, w.Code, w.Body.String())
+		}
+
+		getW := httptest.NewRecorder()
+		server.Router().ServeHTTP(getW, httptest.NewRequest("GET", "/v1/data/durttl", nil))
+		if got := getW.Header().Get("X-Original-TTL"); got != want {
+			t.Errorf("ttl=%s: X-Original-TTL = %s, want %s", ttl, got, want)
+		}
+	}
+}
+
+func TestPutTimeoutOverride(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		query string
+		want  time.Duration
+	}{
+		{"", 5 * time.Second}, // node's write timeout
+		{"?timeout=20", 20 * time.Second},
+		{"?timeout=600", maxWriteTimeout},
+		{"?timeout=0", 5 * time.Second},
+		{"?timeout=soon", 5 * time.Second},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("PUT", "/v1/data/k"+c.query, nil)
+		if got := srv.writeTimeout(req); got != c.want {
+			t.Errorf("writeTimeout(%q) = %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestDebugWritesListsRecentWrites(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+
+	srv.Router().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/v1/data/traced", strings.NewReader("v")))
+
+	w := httptest.NewRecorder()
+	srv.Router().ServeHTTP(w, httptest.NewRequest("GET", "/v1/debug/writes", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp struct {
+		Writes []cluster.WriteRecord `json:"writes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Writes) != 1 || resp.Writes[0].Key != "traced" || resp.Writes[0].Outcome != cluster.WriteQuorum {
+		t.Fatalf("writes = %+v, want one quorum write of traced", resp.Writes)
+	}
+}
+
+func TestDebugKeyShowsOrigin(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+
+	srv.Router().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/v1/data/traced?ttl=600", strings.NewReader("value")))
+
+	head := httptest.NewRecorder()
+	srv.Router().ServeHTTP(head, httptest.NewRequest("HEAD", "/v1/data/traced", nil))
+	if got := head.Header().Get("X-Repram-Origin"); got != "test-node" {
+		t.Errorf("X-Repram-Origin = %q, want test-node", got)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, head.Header().Get("X-Repram-Written-At")); err != nil {
+		t.Errorf("X-Repram-Written-At: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Router().ServeHTTP(w, httptest.NewRequest("GET", "/v1/debug/keys/traced", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp struct {
+		Entry struct {
+			Size        int    `json:"size"`
+			OriginalTTL int    `json:"original_ttl"`
+			Origin      string `json:"origin"`
+			WrittenAt   string `json:"written_at"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Entry.Size != 5 || resp.Entry.OriginalTTL != 600 || resp.Entry.Origin != "test-node" || resp.Entry.WrittenAt == "" {
+		t.Errorf("entry = %+v", resp.Entry)
+	}
+
+	missing := httptest.NewRecorder()
+	srv.Router().ServeHTTP(missing, httptest.NewRequest("GET", "/v1/debug/keys/absent", nil))
+	if missing.Code != http.StatusNotFound {
+		t.Errorf("missing key: status = %d, want 404", missing.Code)
+	}
+}
+
+func TestClusterEventsListsMembershipChanges(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+
+	join := `{"node_id":"joiner","address":"127.0.0.1","gossip_port":9091,"http_port":8081}`
+	w := httptest.NewRecorder()
+	srv.Router().ServeHTTP(w, httptest.NewRequest("POST", "/v1/bootstrap", strings.NewReader(join)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("bootstrap status = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	srv.Router().ServeHTTP(w, httptest.NewRequest("GET", "/v1/cluster/events", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp struct {
+		Events []gossip.MembershipEvent `json:"events"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Type != gossip.EventJoin || resp.Events[0].Node != "joiner" || resp.Events[0].Address != "127.0.0.1:8081" {
+		t.Fatalf("events = %+v, want joiner joining at 127.0.0.1:8081", resp.Events)
+	}
+}
+
+func TestPutEmptyBody(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("PUT", "/v1/data/emptykey", strings.NewReader(""))
+	req.Header.Set("X-TTL", "600")
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	// Empty body is valid — store empty bytes
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+
+	getReq := httptest.NewRequest("GET", "/v1/data/emptykey", nil)
+	getW := httptest.NewRecorder()
+	server.Router().ServeHTTP(getW, getReq)
+
+	if getW.Code != http.StatusOK {
+		t.Fatalf("GET after PUT empty: expected 200, got %d", getW.Code)
+	}
+	if getW.Body.Len() != 0 {
+		t.Fatalf("expected empty body, got %d bytes", getW.Body.Len())
+	}
+}
+
+// --- GET handler tests ---
+
+func TestGetNonexistentKey(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/v1/data/noexist", nil)
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestGetReturnsMetadataHeaders(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	// Store a key
+	putReq := httptest.NewRequest("PUT", "/v1/data/metakey", strings.NewReader("payload"))
+	putReq.Header.Set("X-TTL", "600")
+	putW := httptest.NewRecorder()
+	server.Router().ServeHTTP(putW, putReq)
+
+	// Retrieve it
+	getReq := httptest.NewRequest("GET", "/v1/data/metakey", nil)
+	getW := httptest.NewRecorder()
+	server.Router().ServeHTTP(getW, getReq)
+
+	if getW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", getW.Code)
+	}
+
+	// Check metadata headers
+	if getW.Header().Get("X-Created-At") == "" {
+		t.Error("missing X-Created-At header")
+	}
+	if getW.Header().Get("X-Original-TTL") != "600" {
+		t.Errorf("X-Original-TTL = %q, want %q", getW.Header().Get("X-Original-TTL"), "600")
+	}
+	if getW.Header().Get("X-Remaining-TTL") == "" {
+		t.Error("missing X-Remaining-TTL header")
+	}
+	if getW.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("Content-Type = %q, want %q", getW.Header().Get("Content-Type"), "application/octet-stream")
+	}
+	if getW.Header().Get("Content-Length") != "7" {
+		t.Errorf("Content-Length = %q, want %q", getW.Header().Get("Content-Length"), "7")
+	}
+}
+
+func TestHeadReturnsHeadersNoBody(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	// Store
+	putReq := httptest.NewRequest("PUT", "/v1/data/headkey", strings.NewReader("payload"))
+	putReq.Header.Set("X-TTL", "600")
+	putW := httptest.NewRecorder()
+	server.Router().ServeHTTP(putW, putReq)
+
+	// HEAD request
+	headReq := httptest.NewRequest("HEAD", "/v1/data/headkey", nil)
+	headW := httptest.NewRecorder()
+	server.Router().ServeHTTP(headW, headReq)
+
+	if headW.Code != http.StatusOK {
+		t.Fatalf("HEAD: expected 200, got %d", headW.Code)
+	}
+	if headW.Header().Get("X-Remaining-TTL") == "" {
+		t.Error("HEAD: missing X-Remaining-TTL header")
+	}
+	// Note: httptest.NewRecorder doesn't strip body for HEAD (real http.Server does).
+	// Verify Content-Length is set correctly — the real server handles body suppression.
+	if headW.Header().Get("Content-Length") != "7" {
+		t.Errorf("HEAD: Content-Length = %q, want %q", headW.Header().Get("Content-Length"), "7")
+	}
+}
+
+func TestGetIfNoneMatchReturns304(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	put := httptest.NewRequest("PUT", "/v1/data/etagkey", strings.NewReader("payload"))
+	server.Router().ServeHTTP(httptest.NewRecorder(), put)
+
+	get := httptest.NewRecorder()
+	server.Router().ServeHTTP(get, httptest.NewRequest("GET", "/v1/data/etagkey", nil))
+	etag := get.Header().Get("ETag")
+	if want := `"` + gossip.ContentHash([]byte("payload")) + `"`; etag != want {
+		t.Fatalf("ETag = %q, want %q", etag, want)
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		want        int
+	}{
+		{etag, http.StatusNotModified},
+		{`"other", W/` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/data/etagkey", nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("If-None-Match %s: status %d, want %d", tt.ifNoneMatch, w.Code, tt.want)
+		}
+		if tt.want == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != etag) {
+			t.Errorf("If-None-Match %s: 304 with body %q and ETag %q, want no body and the ETag", tt.ifNoneMatch, w.Body.String(), w.Header().Get("ETag"))
+		}
+	}
+
+	// A changed value no longer matches the old tag
+	put = httptest.NewRequest("PUT", "/v1/data/etagkey", strings.NewReader("changed"))
+	server.Router().ServeHTTP(httptest.NewRecorder(), put)
+	req := httptest.NewRequest("GET", "/v1/data/etagkey", nil)
+	req.Header.Set("If-None-Match", etag)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "changed" {
+		t.Fatalf("after overwrite: %d %q, want 200 with the new value", w.Code, w.Body.String())
+	}
+}
+
+func TestValueHashUsesRecordedHash(t *testing.T) {
+	data := []byte("payload")
+	if got := valueHash(data, storage.EntryMeta{Hash: "recorded"}); got != "recorded" {
+		t.Errorf("valueHash with a recorded hash = %q, want it unchanged", got)
+	}
+	if got, want := valueHash(data, storage.EntryMeta{}), gossip.ContentHash(data); got != want {
+		t.Errorf("valueHash without one = %q, want %q", got, want)
+	}
+}
+
+func TestGetCacheControlFollowsRemainingTTL(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	put := httptest.NewRequest("PUT", "/v1/data/cachekey", strings.NewReader("payload"))
+	put.Header.Set("X-TTL", "600")
+	server.Router().ServeHTTP(httptest.NewRecorder(), put)
+
+	// The value has just under 600 seconds left, so a larger cap gives way to it
+	for maxAge, want := range map[int][]string{
+		0:    {"no-cache"},
+		60:   {"max-age=60"},
+		3600: {"max-age=599", "max-age=600"},
+	} {
+		server.cacheMaxAge = maxAge
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/v1/data/cachekey", nil))
+		if got := w.Header().Get("Cache-Control"); !slices.Contains(want, got) {
+			t.Errorf("cap %d: Cache-Control = %q, want one of %q", maxAge, got, want)
+		}
+	}
+}
+
+func TestHeadNonexistentKey(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("HEAD", "/v1/data/missing", nil)
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("HEAD missing key: expected 404, got %d", w.Code)
+	}
+}
+
+// --- Keys handler tests ---
+
+func TestKeysEmpty(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/v1/keys", nil)
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var resp map[string][]string
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	if len(resp["keys"]) != 0 {
+		t.Fatalf("expected empty keys list, got %v", resp["keys"])
+	}
+}
+
+func TestKeysPrefixFilter(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	// Store keys with different prefixes (no slashes — mux {key} is one path segment)
+	for _, key := range []string{"app-foo", "app-bar", "other-baz"} {
+		req := httptest.NewRequest("PUT", "/v1/data/"+key, strings.NewReader("data"))
+		req.Header.Set("X-TTL", "600")
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s: expected 201, got %d", key, w.Code)
+		}
+	}
+
+	// Filter by prefix
+	req := httptest.NewRequest("GET", "/v1/keys?prefix=app-", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	var resp map[string][]string
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	if len(resp["keys"]) != 2 {
+		t.Fatalf("expected 2 keys with prefix app-, got %d: %v", len(resp["keys"]), resp["keys"])
+	}
+
+	for _, k := range resp["keys"] {
+		if !strings.HasPrefix(k, "app-") {
+			t.Errorf("key %q does not have prefix app-", k)
+		}
+	}
+}
+
+// --- Health / status handler tests ---
+
+func TestHealthEndpoint(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/v1/health", nil)
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	if resp["status"] != "healthy" {
+		t.Errorf("status = %v, want healthy", resp["status"])
+	}
+	if resp["node_id"] != "test-node" {
+		t.Errorf("node_id = %v, want test-node", resp["node_id"])
+	}
+}
+
+func TestHealthDegradedWhenStorageFull(t *testing.T) {
+	cn := cluster.NewClusterNode("test-node", "localhost", 0, 0, 1, 100, 5*time.Second, "", "default")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := cn.Start(ctx, nil); err != nil {
+		t.Fatalf("failed to start cluster node: %v", err)
+	}
+	defer cn.Stop()
+	securityMW := node.NewSecurityMiddleware(1000, 2000, 10*1024*1024, false)
+	defer securityMW.Close()
+	server := &Server{clusterNode: cn, nodeID: "test-node", network: "private", securityMW: securityMW}
+	router := server.Router()
+
+	health := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/health", nil))
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	if code, resp := health(); code != http.StatusOK || resp["status"] != "healthy" {
+		t.Fatalf("empty store: got %d %v, want 200 healthy", code, resp)
+	}
+
+	if err := cn.Put(ctx, "big", make([]byte, 96), 10*time.Minute); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	code, resp := health()
+	if code != http.StatusServiceUnavailable || resp["status"] != "degraded" {
+		t.Fatalf("96%% full: got %d %v, want 503 degraded", code, resp)
+	}
+	if problems, _ := resp["problems"].([]interface{}); len(problems) != 1 || problems[0] != cluster.HealthStorageFull {
+		t.Errorf("problems = %v, want [%s]", resp["problems"], cluster.HealthStorageFull)
+	}
+}
+func TestStatusEndpoint(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/v1/status", nil)
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	if resp["uptime"] == nil {
+		t.Error("missing uptime field")
+	}
+	if resp["memory"] == nil {
+		t.Error("missing memory field")
+	}
+	gossipState, ok := resp["gossip"].(map[string]interface{})
+	if !ok {
+		t.Fatal("missing gossip field")
+	}
+	for _, field := range []string{"peers", "enclave_peers", "replication_factor", "quorum_size", "seen_messages", "pending_writes", "last_partition_check"} {
+		if _, ok := gossipState[field]; !ok {
+			t.Errorf("gossip status missing %s", field)
+		}
+	}
+	storageState, ok := resp["storage"].(map[string]interface{})
+	if !ok {
+		t.Fatal("missing storage field")
+	}
+	for _, field := range []string{"max_bytes", "used_bytes", "items", "writes"} {
+		if _, ok := storageState[field]; !ok {
+			t.Errorf("storage status missing %s", field)
+		}
+	}
+}
+
+func TestUIServedOnlyWhenEnabled(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/ui/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("disabled dashboard returned %d, want 404", w.Code)
+	}
+
+	server.ui = true
+	for path, want := range map[string]string{"/ui/": "<canvas", "/ui/app.js": "/v1/status", "/ui/style.css": "canvas"} {
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("GET %s = %d, want 200 with %q", path, w.Code, want)
+		}
+	}
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/ui", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/ui/" {
+		t.Fatalf("GET /ui = %d to %q, want a redirect to /ui/", w.Code, w.Header().Get("Location"))
+	}
+}
+
+// --- Overwrite behavior ---
+
+func TestPutOverwriteReplacesData(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	// Write v1
+	req := httptest.NewRequest("PUT", "/v1/data/overkey", strings.NewReader("version1"))
+	req.Header.Set("X-TTL", "600")
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	// Write v2 (overwrite)
+	req2 := httptest.NewRequest("PUT", "/v1/data/overkey", strings.NewReader("version2"))
+	req2.Header.Set("X-TTL", "600")
+	w2 := httptest.NewRecorder()
+	server.Router().ServeHTTP(w2, req2)
+
+	if w2.Code != http.StatusCreated {
+		t.Fatalf("overwrite: expected 201, got %d", w2.Code)
+	}
+
+	// Read — should get v2
+	getReq := httptest.NewRequest("GET", "/v1/data/overkey", nil)
+	getW := httptest.NewRecorder()
+	server.Router().ServeHTTP(getW, getReq)
+
+	if getW.Body.String() != "version2" {
+		t.Fatalf("after overwrite: got %q, want %q", getW.Body.String(), "version2")
+	}
+}
+
+func TestPutDedupSkipsIdenticalValue(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	put := func(body, ttl string, dedup bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/v1/data/dupkey", strings.NewReader(body))
+		req.Header.Set("X-TTL", ttl)
+		if dedup {
+			req.Header.Set("X-Dedup", "true")
+		}
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := put("same", "600", true); w.Code != http.StatusCreated || w.Header().Get("X-Dedup") != "" {
+		t.Fatalf("first write: got %d X-Dedup=%q, want 201 without X-Dedup", w.Code, w.Header().Get("X-Dedup"))
+	}
+	if w := put("same", "300", true); w.Code != http.StatusOK || w.Header().Get("X-Dedup") != "true" {
+		t.Fatalf("identical value, shorter TTL: got %d X-Dedup=%q, want 200 X-Dedup=true", w.Code, w.Header().Get("X-Dedup"))
+	}
+	if w := put("same", "3600", true); w.Code != http.StatusCreated {
+		t.Fatalf("identical value, longer TTL: got %d, want 201", w.Code)
+	}
+	if w := put("different", "300", true); w.Code != http.StatusCreated {
+		t.Fatalf("different value: got %d, want 201", w.Code)
+	}
+	if w := put("different", "300", false); w.Code != http.StatusCreated {
+		t.Fatalf("without X-Dedup: got %d, want 201", w.Code)
+	}
+}
+
+func TestPutVerifiesContentSHA256(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+	// SHA-256 of "payload"
+	const sum = "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5"
+
+	req := httptest.NewRequest("PUT", "/v1/data/damaged", strings.NewReader("payl"))
+	req.Header.Set("X-Content-SHA256", sum)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("truncated body: status = %d, want 400", w.Code)
+	}
+	if apiErr := decodeAPIError(t, w); apiErr.Code != node.CodeChecksumMismatch {
+		t.Fatalf("truncated body: code = %q, want %q", apiErr.Code, node.CodeChecksumMismatch)
+	}
+	if _, _, _, exists := server.clusterNode.View("damaged"); exists {
+		t.Fatal("a body failing its checksum was stored")
+	}
+
+	req = httptest.NewRequest("PUT", "/v1/data/intact", strings.NewReader("payload"))
+	req.Header.Set("X-Content-SHA256", strings.ToUpper(sum))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated || w.Header().Get("X-Content-SHA256") != sum {
+		t.Fatalf("matching body: got %d with X-Content-SHA256 %q, want 201 echoing the checksum", w.Code, w.Header().Get("X-Content-SHA256"))
+	}
+
+	for _, method := range []string{"GET", "HEAD"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/v1/data/intact", nil))
+		if got := w.Header().Get("X-Content-SHA256"); got != sum {
+			t.Errorf("%s: X-Content-SHA256 = %q, want %q", method, got, sum)
+		}
+	}
+}
+
+func TestPeerFilterRejectsGossipAndBootstrap(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	block, err := gossip.ParsePeerList([]string{"rogue", "198.51.100.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.clusterNode.SetPeerFilter(&gossip.PeerFilter{Block: block})
+
+	tests := []struct {
+		name, path, body, remoteAddr string
+		want                         int
+	}{
+		{"blocked ID gossips", "/v1/gossip/message", `{"type":"PING","from":"rogue","message_id":"m1"}`, "192.0.2.1:1234", http.StatusForbidden},
+		{"blocked address bootstraps", "/v1/bootstrap", `{"node_id":"friend","address":"198.51.100.7"}`, "198.51.100.7:5000", http.StatusForbidden},
+		{"admitted node gossips", "/v1/gossip/message", `{"type":"PUT","from":"friend","key":"k","data":"dg==","ttl":300,"message_id":"m2"}`, "192.0.2.1:1234", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+		req.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestInternalRouterSeparatesPeerEndpoints(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.internalMW = node.NewSecurityMiddleware(1000, 2000, 10*1024*1024, false)
+	defer server.internalMW.Close()
+
+	ping := `{"type":"PING","from":"peer","message_id":"m1"}`
+	tests := []struct {
+		name   string
+		router http.Handler
+		method string
+		path   string
+		want   int
+	}{
+		{"gossip on client port", server.ClientRouter(), "POST", "/v1/gossip/message", http.StatusNotFound},
+		{"bootstrap on client port", server.ClientRouter(), "POST", "/v1/bootstrap", http.StatusNotFound},
+		{"data on client port", server.ClientRouter(), "GET", "/v1/health", http.StatusOK},
+		{"gossip on internal port", server.InternalRouter(), "POST", "/v1/gossip/message", http.StatusOK},
+		{"data on internal port", server.InternalRouter(), "GET", "/v1/health", http.StatusNotFound},
+		{"gossip on combined router", server.Router(), "POST", "/v1/gossip/message", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(ping))
+		w := httptest.NewRecorder()
+		tt.router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestPeerSignedChecksSignatureAndKeepsBody(t *testing.T) {
+	const secret = "a-long-enough-cluster-secret"
+	cn := cluster.NewClusterNode("test-node", "localhost", 0, 0, 1, 0, 5*time.Second, secret, "default")
+	defer cn.Stop()
+	securityMW := node.NewSecurityMiddleware(1000, 2000, 10*1024*1024, false)
+	defer securityMW.Close()
+	server := &Server{clusterNode: cn, securityMW: securityMW}
+
+	body := `{"type":"PING","from":"peer","message_id":"m1"}`
+	tests := []struct {
+		name string
+		sig  string
+		want bool
+	}{
+		{"signed", gossip.SignBody(secret, []byte(body)), true},
+		{"wrong signature", gossip.SignBody("some-other-secret-value", []byte(body)), false},
+		{"unsigned", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/gossip/message", strings.NewReader(body))
+		if tt.sig != "" {
+			req.Header.Set("X-Repram-Signature", tt.sig)
+		}
+		if got := server.PeerSigned(req); got != tt.want {
+			t.Errorf("%s: PeerSigned = %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.sig != "" {
+			if rest, _ := io.ReadAll(req.Body); string(rest) != body {
+				t.Errorf("%s: handler would read %q, want the original body", tt.name, rest)
+			}
+		}
+	}
+}
+
+// --- Pagination tests ---
+
+// storeKeys is a helper that creates n keys named key-000, key-001, etc.
+func storeKeys(t *testing.T, server *Server, router http.Handler, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		req := httptest.NewRequest("PUT", "/v1/data/"+key, strings.NewReader("data"))
+		req.Header.Set("X-TTL", "600")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s: expected 201, got %d", key, w.Code)
+		}
+	}
+}
+
+func TestKeysLimit(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	storeKeys(t, server, router, 10)
+
+	req := httptest.NewRequest("GET", "/v1/keys?limit=3", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	keys := resp["keys"].([]interface{})
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(keys))
+	}
+
+	// Should have a next_cursor
+	nextCursor, ok := resp["next_cursor"].(string)
+	if !ok || nextCursor == "" {
+		t.Fatal("expected next_cursor in response")
+	}
+}
+
+func TestKeysCursorPagination(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	storeKeys(t, server, router, 10) // key-000 through key-009
+
+	// Page 1: first 3
+	req := httptest.NewRequest("GET", "/v1/keys?limit=3", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var page1 map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&page1)
+	keys1 := page1["keys"].([]interface{})
+	cursor := page1["next_cursor"].(string)
+
+	if len(keys1) != 3 {
+		t.Fatalf("page 1: expected 3 keys, got %d", len(keys1))
+	}
+	if keys1[0].(string) != "key-000" {
+		t.Fatalf("page 1 first key = %q, want key-000", keys1[0])
+	}
+
+	// Page 2: next 3 using cursor
+	req2 := httptest.NewRequest("GET", "/v1/keys?limit=3&cursor="+cursor, nil)
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, req2)
+
+	var page2 map[string]interface{}
+	json.NewDecoder(w2.Body).Decode(&page2)
+	keys2 := page2["keys"].([]interface{})
+
+	if len(keys2) != 3 {
+		t.Fatalf("page 2: expected 3 keys, got %d", len(keys2))
+	}
+
+	// Page 2 first key should come after page 1 last key
+	if keys2[0].(string) <= keys1[2].(string) {
+		t.Fatalf("page 2 first key %q should be after page 1 last key %q", keys2[0], keys1[2])
+	}
+
+	// Collect all pages to verify we get all 10 keys
+	allKeys := make(map[string]bool)
+	for _, k := range keys1 {
+		allKeys[k.(string)] = true
+	}
+	for _, k := range keys2 {
+		allKeys[k.(string)] = true
+	}
+
+	// Page 3
+	cursor2 := page2["next_cursor"].(string)
+	req3 := httptest.NewRequest("GET", "/v1/keys?limit=3&cursor="+cursor2, nil)
+	w3 := httptest.NewRecorder()
+	router.ServeHTTP(w3, req3)
+
+	var page3 map[string]interface{}
+	json.NewDecoder(w3.Body).Decode(&page3)
+	keys3 := page3["keys"].([]interface{})
+	for _, k := range keys3 {
+		allKeys[k.(string)] = true
+	}
+
+	// Page 4: last key (1 remaining)
+	cursor3 := page3["next_cursor"].(string)
+	req4 := httptest.NewRequest("GET", "/v1/keys?limit=3&cursor="+cursor3, nil)
+	w4 := httptest.NewRecorder()
+	router.ServeHTTP(w4, req4)
+
+	var page4 map[string]interface{}
+	json.NewDecoder(w4.Body).Decode(&page4)
+	keys4 := page4["keys"].([]interface{})
+	for _, k := range keys4 {
+		allKeys[k.(string)] = true
+	}
+
+	if len(keys4) != 1 {
+		t.Fatalf("page 4: expected 1 key, got %d", len(keys4))
+	}
+
+	// No more pages — next_cursor should be absent
+	if _, hasCursor := page4["next_cursor"]; hasCursor {
+		t.Fatal("page 4 should not have next_cursor (last page)")
+	}
+
+	// Verify all 10 keys collected
+	if len(allKeys) != 10 {
+		t.Fatalf("expected 10 unique keys across all pages, got %d", len(allKeys))
+	}
+}
+
+func TestKeysLimitWithoutCursor(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	storeKeys(t, server, router, 5)
+
+	// Limit larger than total keys — should return all, no cursor
+	req := httptest.NewRequest("GET", "/v1/keys?limit=100", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	keys := resp["keys"].([]interface{})
+	if len(keys) != 5 {
+		t.Fatalf("expected 5 keys, got %d", len(keys))
+	}
+	if _, hasCursor := resp["next_cursor"]; hasCursor {
+		t.Fatal("should not have next_cursor when all keys fit in limit")
+	}
+}
+
+func TestKeysNoLimitReturnsAll(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	storeKeys(t, server, router, 10)
+
+	// No limit param — backwards compatible, returns everything
+	req := httptest.NewRequest("GET", "/v1/keys", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	keys := resp["keys"].([]interface{})
+	if len(keys) != 10 {
+		t.Fatalf("expected 10 keys (no limit), got %d", len(keys))
+	}
+	if _, hasCursor := resp["next_cursor"]; hasCursor {
+		t.Fatal("should not have next_cursor when no limit is set")
+	}
+}
+
+func TestKeysSortedOrder(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	// Store in non-alphabetical order
+	for _, key := range []string{"cherry", "apple", "banana"} {
+		req := httptest.NewRequest("PUT", "/v1/data/"+key, strings.NewReader("data"))
+		req.Header.Set("X-TTL", "600")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/keys", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string][]string
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	keys := resp["keys"]
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(keys))
+	}
+	if keys[0] != "apple" || keys[1] != "banana" || keys[2] != "cherry" {
+		t.Fatalf("keys not sorted: %v", keys)
+	}
+}
+
+// --- CORS tests ---
+
+// corsRequest sends a request with the given Origin through a server whose
+// CORS origins are configured from patterns.
+func corsRequest(t *testing.T, patterns []string, method, origin string) *httptest.ResponseRecorder {
+	t.Helper()
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	origins, err := node.ParseCORSOrigins(patterns)
+	if err != nil {
+		t.Fatalf("ParseCORSOrigins: %v", err)
+	}
+	server.corsOrigins = origins
+
+	req := httptest.NewRequest(method, "/v1/health", nil)
+	req.Header.Set("Origin", origin)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSDefaultAllowsAnyOrigin(t *testing.T) {
+	w := corsRequest(t, []string{"*"}, "GET", "https://someone.example")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://someone.example" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	patterns := []string{"https://app.example.com", "https://*.repram.io"}
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"https://fade.repram.io", true},
+		{"https://a.b.repram.io", true},
+		{"http://fade.repram.io", false},        // scheme must match
+		{"https://repram.io", false},            // wildcard needs a subdomain
+		{"https://evilrepram.io", false},        // not a subdomain
+		{"https://app.example.com.evil", false}, // exact means exact
+		{"https://10.0.0.1.evil.com", false},    // no substring matching
+		{"https://app.example.com:8443", false}, // port must match
+	}
+	for _, tt := range tests {
+		w := corsRequest(t, patterns, "GET", tt.origin)
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if tt.allowed && got != tt.origin {
+			t.Errorf("origin %q: Access-Control-Allow-Origin = %q, want it echoed", tt.origin, got)
+		}
+		if !tt.allowed && got != "" {
+			t.Errorf("origin %q should not be allowed, got Access-Control-Allow-Origin = %q", tt.origin, got)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("origin %q: status %d, want 200 (CORS only affects headers)", tt.origin, w.Code)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	w := corsRequest(t, []string{"https://app.example.com"}, "OPTIONS", "https://app.example.com")
+	if w.Code != http.StatusOK {
+		t.Fatalf("preflight returned %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, "PUT") {
+		t.Errorf("Access-Control-Allow-Methods = %q, want PUT included", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "X-TTL") {
+		t.Errorf("Access-Control-Allow-Headers = %q, want X-TTL included", got)
+	}
+
+	w = corsRequest(t, []string{"https://app.example.com"}, "OPTIONS", "https://other.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("disallowed preflight got Access-Control-Allow-Methods = %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+}
+
+// --- Key validation tests ---
+
+func TestInvalidKeyReturns400WithReason(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.keyRules = node.KeyRules{ReservedPrefixes: []string{"_repram:"}}
+	router := server.Router()
+
+	tests := []struct {
+		method, path, reason string
+	}{
+		{"PUT", "/v1/data/bad%00key", "control_character"},
+		{"PUT", "/v1/data/line%0Abreak", "control_character"},
+		{"PUT", "/v1/data/two%20words", "whitespace"},
+		{"GET", "/v1/data/bad%1Bkey", "control_character"},
+		{"GET", "/v1/data/_repram:meta", "reserved_prefix"},
+		{"PUT", "/v1/data/" + strings.Repeat("k", node.DefaultMaxKeyLength+1), "too_long"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("data"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: status %d, want 400", tt.method, tt.path, w.Code)
+			continue
+		}
+		var resp node.APIError
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s %s: body is not JSON: %v", tt.method, tt.path, err)
+		}
+		if resp.Code != node.CodeInvalidKey || resp.Reason != tt.reason || resp.Message == "" {
+			t.Errorf("%s %s: body = %+v, want code=invalid_key reason=%s", tt.method, tt.path, resp, tt.reason)
+		}
+	}
+
+	// Nothing was stored
+	if keys := server.clusterNode.Scan(); len(keys) != 0 {
+		t.Fatalf("invalid keys reached the store: %q", keys)
+	}
+}
+
+func TestValidUnicodeKeyAccepted(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	req := httptest.NewRequest("PUT", "/v1/data/handoff:agent-a%E2%86%92agent-b", strings.NewReader("payload"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT returned %d, want 201", w.Code)
+	}
+	if _, ok := server.clusterNode.Get("handoff:agent-a→agent-b"); !ok {
+		t.Fatal("unicode key not stored")
+	}
+}
+
+// --- Error envelope tests ---
+
+// decodeAPIError checks that a response is a JSON error envelope carrying
+// the response's request ID.
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) node.APIError {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var apiErr node.APIError
+	if err := json.NewDecoder(w.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("error body is not JSON: %v", err)
+	}
+	if apiErr.RequestID == "" || apiErr.RequestID != w.Header().Get("X-Request-ID") {
+		t.Fatalf("request_id = %q, X-Request-ID = %q; want equal and non-empty", apiErr.RequestID, w.Header().Get("X-Request-ID"))
+	}
+	return apiErr
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		status    int
+		code      string
+		retryable bool
+	}{
+		{"missing key", "GET", "/v1/data/missing", "", http.StatusNotFound, node.CodeNotFound, false},
+		{"unknown route", "GET", "/v1/nope", "", http.StatusNotFound, node.CodeNotFound, false},
+		{"wrong method", "DELETE", "/v1/data/k", "", http.StatusMethodNotAllowed, node.CodeMethodNotAllowed, false},
+		{"bad gossip JSON", "POST", "/v1/gossip/message", "{", http.StatusBadRequest, node.CodeInvalidJSON, false},
+		{"bad bootstrap JSON", "POST", "/v1/bootstrap", "not json", http.StatusBadRequest, node.CodeInvalidJSON, false},
+		{"bootstrap without port", "POST", "/v1/bootstrap", `{"node_id":"n","address":"10.0.0.2"}`, http.StatusBadRequest, node.CodeInvalidMessage, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			apiErr := decodeAPIError(t, w)
+			if apiErr.Code != tt.code || apiErr.Retryable != tt.retryable || apiErr.Message == "" {
+				t.Fatalf("error = %+v, want code=%s retryable=%v", apiErr, tt.code, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestRateLimitErrorIsRetryable(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.securityMW.SetRateLimit(1, 1)
+	router := server.Router()
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/health", nil))
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	apiErr := decodeAPIError(t, w)
+	if apiErr.Code != node.CodeRateLimited || !apiErr.Retryable {
+		t.Fatalf("error = %+v, want retryable rate_limited", apiErr)
+	}
+}
+
+func TestOversizedBodyReturns413(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	// No Content-Length, so only the body reader limit catches it
+	body := strings.NewReader(strings.Repeat("x", 11*1024*1024))
+	req := httptest.NewRequest("PUT", "/v1/data/big", io.NopCloser(body))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+	if apiErr := decodeAPIError(t, w); apiErr.Code != node.CodePayloadTooLarge {
+		t.Fatalf("code = %s, want payload_too_large", apiErr.Code)
+	}
+}
+
+func TestGossipHasSeparateSizeLimit(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.securityMW.SetMaxGossipSize(1024)
+	router := server.Router()
+
+	// Above the gossip limit but far below the 10 MB client limit
+	msg := fmt.Sprintf(`{"type":"PUT","from":"peer","key":"k","ttl":300,"message_id":"m","data":"%s"}`, strings.Repeat("A", 2048))
+	req := httptest.NewRequest("POST", "/v1/gossip/message", io.NopCloser(strings.NewReader(msg)))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("gossip over limit: status = %d, want 413", w.Code)
+	}
+
+	// The same size is fine for clients
+	req = httptest.NewRequest("PUT", "/v1/data/k", strings.NewReader(strings.Repeat("x", 2048)))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("client PUT: status = %d, want 201", w.Code)
+	}
+}
+
+func TestGossipMessageValidation(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	tests := []struct {
+		name   string
+		body   string
+		reason string
+	}{
+		{"missing sender", `{"type":"PUT","key":"k","ttl":300,"message_id":"m"}`, "missing_field"},
+		{"key with whitespace", `{"type":"PUT","from":"peer","key":"a b","ttl":300,"message_id":"m"}`, "invalid_key"},
+		{"empty key", `{"type":"PUT","from":"peer","ttl":300,"message_id":"m"}`, "invalid_key"},
+		{"zero TTL", `{"type":"PUT","from":"peer","key":"k","ttl":0,"message_id":"m"}`, "ttl_out_of_range"},
+		{"malformed hash", `{"type":"PUT","from":"peer","key":"k","ttl":300,"message_id":"m","hash":"xyz"}`, "invalid_hash"},
+		{"hash of other data", `{"type":"PUT","from":"peer","key":"k","ttl":300,"message_id":"m","data":"cGF5bG9hZA==","hash":"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}`, "hash_mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/gossip/message", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", w.Code)
+			}
+			apiErr := decodeAPIError(t, w)
+			if apiErr.Code != node.CodeInvalidMessage || apiErr.Reason != tt.reason {
+				t.Fatalf("error = %+v, want invalid_message/%s", apiErr, tt.reason)
+			}
+		})
+	}
+}
+
+func TestValueOverStoreLimitReturns413(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.clusterNode.SetMaxValueBytes(8)
+	router := server.Router()
+
+	req := httptest.NewRequest("PUT", "/v1/data/k", strings.NewReader("way too long"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("client PUT: status = %d, want 413", w.Code)
+	}
+
+	// Replicated values are held to the same limit
+	msg := `{"type":"PUT","from":"peer","key":"k","ttl":300,"message_id":"m","data":"d2F5IHRvbyBsb25n"}`
+	req = httptest.NewRequest("POST", "/v1/gossip/message", strings.NewReader(msg))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("gossip PUT: status = %d, want 413", w.Code)
+	}
+	if apiErr := decodeAPIError(t, w); apiErr.Code != node.CodePayloadTooLarge {
+		t.Fatalf("code = %s, want payload_too_large", apiErr.Code)
+	}
+}
+
+func TestWritesShedUnderMemoryPressure(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	// A 1-byte high-water mark puts the monitor at critical on its first sample
+	server.pressure = pressure.NewMonitor(1, nil)
+	server.pressure.Start()
+	defer server.pressure.Close()
+	router := server.Router()
+
+	req := httptest.NewRequest("PUT", "/v1/data/k", strings.NewReader("v"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("normal priority: status = %d, want 503", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("shed write should carry Retry-After")
+	}
+	if apiErr := decodeAPIError(t, w); apiErr.Code != node.CodeOverloaded || !apiErr.Retryable {
+		t.Fatalf("error = %+v, want retryable overloaded", apiErr)
+	}
+
+	req = httptest.NewRequest("PUT", "/v1/data/k", strings.NewReader("v"))
+	req.Header.Set("X-Priority", "high")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("high priority: status = %d, want 201", w.Code)
+	}
+}
+
+func TestRequestIDEchoed(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	req := httptest.NewRequest("GET", "/v1/data/missing", nil)
+	req.Header.Set("X-Request-ID", "trace-abc.123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if apiErr := decodeAPIError(t, w); apiErr.RequestID != "trace-abc.123" {
+		t.Fatalf("request_id = %q, want client-supplied trace-abc.123", apiErr.RequestID)
+	}
+
+	// Malformed client IDs are replaced, not echoed
+	req = httptest.NewRequest("GET", "/v1/data/missing", nil)
+	req.Header.Set("X-Request-ID", "<script>")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if apiErr := decodeAPIError(t, w); apiErr.RequestID == "<script>" {
+		t.Fatal("malformed X-Request-ID should not be echoed")
+	}
+}
+
+// --- Scan tests ---
+
+type scanPage struct {
+	Entries    []scanEntry `json:"entries"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+func getScan(t *testing.T, router http.Handler, path string) scanPage {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: expected 200, got %d", path, w.Code)
+	}
+	var page scanPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("GET %s: invalid JSON: %v", path, err)
+	}
+	return page
+}
+
+func TestScanReturnsTTLsAndPaginates(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	storeKeys(t, server, router, 5) // key-000 through key-004, TTL 600
+
+	page := getScan(t, router, "/v1/scan?prefix=key-&limit=2")
+	if len(page.Entries) != 2 || page.Entries[0].Key != "key-000" || page.Entries[1].Key != "key-001" {
+		t.Fatalf("page 1 = %+v, want key-000 and key-001", page.Entries)
+	}
+	if ttl := page.Entries[0].TTL; ttl < 598 || ttl > 600 {
+		t.Errorf("ttl = %d, want ~600", ttl)
+	}
+	if page.NextCursor != "key-001" {
+		t.Fatalf("next_cursor = %q, want key-001", page.NextCursor)
+	}
+
+	page = getScan(t, router, "/v1/scan?prefix=key-&limit=10&cursor="+page.NextCursor)
+	if len(page.Entries) != 3 || page.Entries[0].Key != "key-002" || page.NextCursor != "" {
+		t.Fatalf("page 2 = %+v (next %q), want key-002..key-004 and no cursor", page.Entries, page.NextCursor)
+	}
+
+	if page := getScan(t, router, "/v1/scan?prefix=nope"); page.Entries == nil || len(page.Entries) != 0 {
+		t.Errorf("empty scan should return an empty entries array, got %+v", page.Entries)
+	}
+}
+
+func TestScanLegacyPathsMatchV1(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	storeKeys(t, server, router, 3)
+
+	want := getScan(t, router, "/v1/scan")
+	for _, path := range []string{"/scan", "/raw/scan"} {
+		got := getScan(t, router, path)
+		if len(got.Entries) != len(want.Entries) || got.Entries[0].Key != want.Entries[0].Key {
+			t.Errorf("GET %s = %+v, want %+v", path, got.Entries, want.Entries)
+		}
+	}
+}
+
+func TestScanIncludesPreview(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	storeKeys(t, server, router, 2) // value "data"
+
+	page := getScan(t, router, "/raw/scan?include=preview&preview_bytes=2")
+	if len(page.Entries) != 2 {
+		t.Fatalf("entries = %+v, want 2", page.Entries)
+	}
+	for _, e := range page.Entries {
+		if e.Size == nil || *e.Size != 4 || string(e.Preview) != "da" {
+			t.Errorf("entry %s: size %v preview %q, want 4 and \"da\"", e.Key, e.Size, e.Preview)
+		}
+	}
+
+	if page := getScan(t, router, "/raw/scan"); page.Entries[0].Size != nil || page.Entries[0].Preview != nil {
+		t.Errorf("scan without include should leave out previews, got %+v", page.Entries[0])
+	}
+
+	for _, query := range []string{"include=bogus", "include=preview&preview_bytes=0"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/raw/scan?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET /raw/scan?%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestListOrderByExpiry(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	for key, ttl := range map[string]string{"msg:c": "900", "msg:a": "1200", "msg:b": "600"} {
+		req := httptest.NewRequest("PUT", "/v1/data/"+key+"?ttl="+ttl, strings.NewReader("data"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s: expected 201, got %d", key, w.Code)
+		}
+	}
+
+	page := getScan(t, router, "/v1/scan?order=expiry&prefix=msg:&limit=2")
+	if len(page.Entries) != 2 || page.Entries[0].Key != "msg:b" || page.Entries[1].Key != "msg:c" {
+		t.Fatalf("page 1 = %+v, want msg:b then msg:c", page.Entries)
+	}
+	if page.Entries[0].TTL > page.Entries[1].TTL {
+		t.Errorf("TTLs should be ascending, got %+v", page.Entries)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("expected next_cursor")
+	}
+
+	page = getScan(t, router, "/v1/scan?order=expiry&prefix=msg:&limit=2&cursor="+url.QueryEscape(page.NextCursor))
+	if len(page.Entries) != 1 || page.Entries[0].Key != "msg:a" || page.NextCursor != "" {
+		t.Fatalf("page 2 = %+v (next %q), want only msg:a", page.Entries, page.NextCursor)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/keys?order=expiry", nil))
+	var resp map[string][]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if got := fmt.Sprint(resp["keys"]); got != "[msg:b msg:c msg:a]" {
+		t.Errorf("/v1/keys?order=expiry = %s, want [msg:b msg:c msg:a]", got)
+	}
+}
+
+func TestListRejectsBadOrderAndCursor(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	router := server.Router()
+
+	for _, path := range []string{"/v1/keys?order=size", "/v1/scan?order=expiry&cursor=not-a-cursor"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected 400, got %d", path, w.Code)
+		}
+		if apiErr := decodeAPIError(t, w); apiErr.Code != node.CodeBadRequest {
+			t.Errorf("GET %s: code = %q, want %q", path, apiErr.Code, node.CodeBadRequest)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"repram/internal/cluster"
+	"repram/internal/node"
+	"repram/internal/storage"
+)
+
+// snapshotEntry is one line of a snapshot stream: newline-delimited JSON,
+// one live value per line, with the TTL it had left when exported.
+type snapshotEntry struct {
+	Key  string `json:"key"`
+	TTL  int    `json:"ttl"`  // remaining seconds
+	Data []byte `json:"data"` // base64
+}
+
+// maxSnapshotLine bounds one line of an imported snapshot. Values travel
+// base64-encoded as in gossip, so the gossip body limit fits the largest.
+const maxSnapshotLine = node.DefaultMaxGossipSize
+
+// snapshotExportHandler streams every live value in the local store, in
+// key order. Values with under a second left are left out: they would
+// expire before an import could use them.
+func (s *Server) snapshotExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	s.clusterNode.Snapshot(func(e cluster.SnapshotEntry) bool {
+		ttl := int(e.TTL / time.Second)
+		if ttl < 1 {
+			return true
+		}
+		// A failed write means the client went away
+		return enc.Encode(snapshotEntry{Key: e.Key, TTL: ttl, Data: e.Data}) == nil
+	})
+}
+
+// snapshotImportHandler stores each value of a snapshot stream on this node
+// alone, with the TTL it had left when exported. Entries already expired
+// are skipped. The first bad entry stops the import; entries before it
+// stay stored, and the error says how many.
+func (s *Server) snapshotImportHandler(w http.ResponseWriter, r *http.Request) {
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxSnapshotLine)
+
+	imported, skipped, line := 0, 0, 0
+	fail := func(status int, code, msg string) {
+		node.WriteError(w, r, status, code, fmt.Sprintf("Line %d: %s (%d entries imported before it)", line, msg, imported))
+	}
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e snapshotEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			fail(http.StatusBadRequest, node.CodeInvalidJSON, err.Error())
+			return
+		}
+		if keyErr := s.keyRules.Validate(e.Key); keyErr != nil {
+			fail(http.StatusBadRequest, node.CodeInvalidKey, keyErr.Message)
+			return
+		}
+		if e.TTL < 1 {
+			skipped++
+			continue
+		}
+		err := s.clusterNode.Restore(cluster.SnapshotEntry{Key: e.Key, Data: e.Data, TTL: time.Duration(e.TTL) * time.Second})
+		switch {
+		case errors.Is(err, storage.ErrStoreFull):
+			fail(http.StatusInsufficientStorage, node.CodeStorageFull, "node storage capacity exceeded")
+			return
+		case errors.Is(err, storage.ErrValueTooLarge):
+			fail(http.StatusRequestEntityTooLarge, node.CodePayloadTooLarge, "value exceeds the node's maximum value size")
+			return
+		case err != nil:
+			fail(http.StatusInternalServerError, node.CodeInternal, err.Error())
+			return
+		}
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		line++
+		if errors.Is(err, bufio.ErrTooLong) {
+			fail(http.StatusRequestEntityTooLarge, node.CodePayloadTooLarge, "entry too large")
+		} else {
+			fail(http.StatusBadRequest, node.CodeBadRequest, err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"imported": imported,
+		"skipped":  skipped,
+	})
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testAdminToken = "test-admin-token-0123"
+
+func adminRequest(method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func TestSnapshotNeedsAdminToken(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, adminRequest("GET", "/v1/admin/snapshot", ""))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("without an admin token configured: status = %d, want 404", w.Code)
+	}
+
+	server.adminToken = testAdminToken
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/v1/admin/snapshot", nil))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"unauthorized"`) {
+		t.Fatalf("without a bearer token: status = %d, body %s; want 401 unauthorized", w.Code, w.Body)
+	}
+	req := httptest.NewRequest("GET", "/v1/admin/snapshot", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("with the wrong token: status = %d, want 401", w.Code)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	source, cleanupSource := newTestServer(t)
+	defer cleanupSource()
+	source.adminToken = testAdminToken
+
+	for key, ttl := range map[string]string{"a": "600", "b": "3600", "ns:c": "900"} {
+		req := httptest.NewRequest("PUT", "/v1/data/"+key, strings.NewReader("value of "+key))
+		req.Header.Set("X-TTL", ttl)
+		source.Router().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	source.Router().ServeHTTP(w, adminRequest("GET", "/v1/admin/snapshot", ""))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("export: status = %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	snapshot := w.Body.String()
+
+	var keys []string
+	lines := bufio.NewScanner(strings.NewReader(snapshot))
+	for lines.Scan() {
+		var e snapshotEntry
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			t.Fatalf("export line %q: %v", lines.Text(), err)
+		}
+		if string(e.Data) != "value of "+e.Key || e.TTL < 1 {
+			t.Errorf("export entry %+v", e)
+		}
+		keys = append(keys, e.Key)
+	}
+	if strings.Join(keys, ",") != "a,b,ns:c" {
+		t.Fatalf("exported keys %v, want a, b, ns:c in key order", keys)
+	}
+
+	target, cleanupTarget := newTestServer(t)
+	defer cleanupTarget()
+	target.adminToken = testAdminToken
+
+	// An entry that ran out in transit is skipped, not stored
+	w = httptest.NewRecorder()
+	target.Router().ServeHTTP(w, adminRequest("POST", "/v1/admin/snapshot", snapshot+`{"key":"gone","ttl":0,"data":""}`+"\n"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: status = %d, body %s", w.Code, w.Body)
+	}
+	var result map[string]int
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["imported"] != 3 || result["skipped"] != 1 {
+		t.Fatalf("import result %v, want 3 imported, 1 skipped", result)
+	}
+
+	getW := httptest.NewRecorder()
+	target.Router().ServeHTTP(getW, httptest.NewRequest("GET", "/v1/data/ns:c", nil))
+	if getW.Code != http.StatusOK || getW.Body.String() != "value of ns:c" {
+		t.Fatalf("GET imported key: status = %d, body %q", getW.Code, getW.Body)
+	}
+	// Export and GET each round the remaining TTL down
+	if ttl, _ := strconv.Atoi(getW.Header().Get("X-Remaining-TTL")); ttl < 897 || ttl > 900 {
+		t.Errorf("imported key X-Remaining-TTL = %d, want about 900", ttl)
+	}
+}
+
+func TestSnapshotImportStopsAtBadLine(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.adminToken = testAdminToken
+
+	body := `{"key":"ok","ttl":600,"data":"aGk="}` + "\n" + `not json` + "\n" + `{"key":"after","ttl":600,"data":"aGk="}` + "\n"
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, adminRequest("POST", "/v1/admin/snapshot", body))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Line 2") {
+		t.Fatalf("status = %d, body %s; want 400 naming line 2", w.Code, w.Body)
+	}
+	if _, ok := server.clusterNode.Get("ok"); !ok {
+		t.Error("entries before the bad line should stay imported")
+	}
+	if _, ok := server.clusterNode.Get("after"); ok {
+		t.Error("entries after the bad line should not be imported")
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"repram/internal/node"
+)
+
+// takedownHandler removes a key reported for abuse from this node at once,
+// and from its enclave peers when the cluster has a secret to sign the
+// tombstone with.
+func (s *Server) takedownHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if keyErr := (node.KeyRules{MaxLength: s.keyRules.MaxLength}).Validate(key); keyErr != nil {
+		node.WriteErrorReason(w, r, http.StatusBadRequest, node.CodeInvalidKey, keyErr.Reason, keyErr.Message)
+		return
+	}
+
+	removed, gossiped := s.clusterNode.Takedown(r.Context(), key)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":      key,
+		"removed":  removed,
+		"gossiped": gossiped,
+	})
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTakedownRemovesKeyAndRefusesItsReplicas(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+	server.adminToken = testAdminToken
+	router := server.Router()
+
+	gossipPut := func(id, data string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/gossip/message",
+			strings.NewReader(`{"type":"PUT","from":"peer","key":"abuse","data":"`+data+`","ttl":300,"message_id":"`+id+`"}`)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("gossip PUT: status = %d, body %s", w.Code, w.Body)
+		}
+	}
+	gossipPut("m1", "dg==")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest("POST", "/v1/admin/takedown/abuse", ""))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"removed":true`) {
+		t.Fatalf("POST /v1/admin/takedown/abuse: status = %d, body %s", w.Code, w.Body)
+	}
+	// No cluster secret: nothing to sign the tombstone with
+	if !strings.Contains(w.Body.String(), `"gossiped":false`) {
+		t.Fatalf("tombstone gossiped without a cluster secret: %s", w.Body)
+	}
+	if _, ok := server.clusterNode.Get("abuse"); ok {
+		t.Fatal("key still readable after takedown")
+	}
+
+	// A peer pushing the removed value back is refused...
+	gossipPut("m2", "dg==")
+	if _, ok := server.clusterNode.Get("abuse"); ok {
+		t.Fatal("taken-down value was stored again from a replica")
+	}
+	// ...but a different value is a new write
+	gossipPut("m3", "dzI=")
+	if _, ok := server.clusterNode.Get("abuse"); !ok {
+		t.Fatal("new value for a taken-down key was refused")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/admin/takedown/abuse", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("takedown without the admin token: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiAssets is the operator dashboard served at /ui/ when Options.UI is set.
+// It is static: the page polls /v1/status, /v1/topology and
+// /v1/cluster/events from the browser.
+//
+//go:embed ui
+var uiAssets embed.FS
+
+// uiHandler serves the dashboard assets under /ui/.
+func uiHandler() http.Handler {
+	assets, _ := fs.Sub(uiAssets, "ui")
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(assets)))
+}
@@ -0,0 +1,173 @@
+// Node dashboard. Polls the node's own status endpoints and keeps the last
+// few minutes of samples in memory; nothing is stored between page loads.
+"use strict";
+
+const POLL_MS = 2000;
+const SAMPLES = 150; // 5 minutes at POLL_MS
+
+const series = {
+    peers: [],
+    storage: [],
+    writes: [],
+    pending: [],
+};
+let lastWrites = null; // {count, at} from the previous poll
+
+function push(name, value) {
+    const s = series[name];
+    s.push(value);
+    if (s.length > SAMPLES) {
+        s.shift();
+    }
+}
+
+function formatBytes(n) {
+    const units = ["B", "KB", "MB", "GB", "TB"];
+    let i = 0;
+    while (n >= 1024 && i < units.length - 1) {
+        n /= 1024;
+        i++;
+    }
+    return (i === 0 ? n : n.toFixed(1)) + " " + units[i];
+}
+
+// draw renders a series as a line chart scaled to its own maximum, or to
+// max when given (e.g. the storage cap).
+function draw(canvasID, values, max) {
+    const canvas = document.getElementById(canvasID);
+    const ctx = canvas.getContext("2d");
+    const w = canvas.width, h = canvas.height, pad = 4;
+    ctx.clearRect(0, 0, w, h);
+
+    ctx.strokeStyle = "#003300";
+    ctx.beginPath();
+    for (const f of [0.25, 0.5, 0.75]) {
+        ctx.moveTo(0, h * f);
+        ctx.lineTo(w, h * f);
+    }
+    ctx.stroke();
+
+    if (values.length < 2) {
+        return;
+    }
+    const top = max || Math.max(1, ...values);
+    const step = w / (SAMPLES - 1);
+    const x0 = w - step * (values.length - 1);
+    ctx.strokeStyle = "#00ff00";
+    ctx.lineWidth = 2;
+    ctx.beginPath();
+    values.forEach((v, i) => {
+        const x = x0 + step * i;
+        const y = h - pad - (h - 2 * pad) * Math.min(v / top, 1);
+        if (i === 0) {
+            ctx.moveTo(x, y);
+        } else {
+            ctx.lineTo(x, y);
+        }
+    });
+    ctx.stroke();
+}
+
+function setText(id, text) {
+    document.getElementById(id).textContent = text;
+}
+
+function cell(row, text, className) {
+    const td = row.insertCell();
+    td.textContent = text;
+    if (className) {
+        td.className = className;
+    }
+}
+
+async function fetchJSON(path) {
+    const resp = await fetch(path, { cache: "no-store" });
+    if (!resp.ok) {
+        throw new Error(path + ": " + resp.status);
+    }
+    return resp.json();
+}
+
+function renderStatus(status) {
+    setText("node-id", status.node_id);
+    setText("summary", status.network + " network, enclave " + status.enclave + ", up " + status.uptime);
+    document.getElementById("summary").classList.remove("error");
+
+    const gossip = status.gossip;
+    const storage = status.storage;
+    push("peers", gossip.enclave_peers);
+    push("storage", storage.used_bytes);
+    push("pending", gossip.pending_writes);
+
+    const now = Date.now();
+    if (lastWrites !== null && now > lastWrites.at) {
+        const rate = (storage.writes - lastWrites.count) / ((now - lastWrites.at) / 1000);
+        push("writes", Math.max(0, rate));
+        setText("writes-value", rate.toFixed(1));
+    }
+    lastWrites = { count: storage.writes, at: now };
+
+    setText("peers-value", gossip.enclave_peers + " in enclave, " + gossip.peers + " known");
+    setText("storage-value", formatBytes(storage.used_bytes) +
+        (storage.max_bytes > 0 ? " of " + formatBytes(storage.max_bytes) : "") +
+        ", " + storage.items + " keys");
+    setText("pending-value", gossip.pending_writes + " (quorum " + gossip.quorum_size + ")");
+
+    draw("peers-chart", series.peers);
+    draw("storage-chart", series.storage, storage.max_bytes);
+    draw("writes-chart", series.writes);
+    draw("pending-chart", series.pending);
+}
+
+function renderTopology(topology) {
+    const body = document.getElementById("peer-rows");
+    body.replaceChildren();
+    for (const peer of topology.peers) {
+        const row = body.insertRow();
+        cell(row, peer.id);
+        cell(row, peer.address + ":" + peer.http_port);
+        cell(row, peer.enclave);
+        const c = peer.capacity;
+        if (c) {
+            const used = formatBytes(c.used_bytes) + (c.max_bytes > 0 ? " of " + formatBytes(c.max_bytes) : "");
+            cell(row, used, c.nearly_full ? "warn" : "");
+        } else {
+            cell(row, "-");
+        }
+    }
+    if (topology.peers.length === 0) {
+        cell(body.insertRow(), "No peers");
+    }
+}
+
+function renderEvents(events) {
+    const list = document.getElementById("events");
+    list.replaceChildren();
+    for (const e of events.events.slice(0, 20)) {
+        const li = document.createElement("li");
+        const at = document.createElement("time");
+        at.textContent = new Date(e.at).toLocaleTimeString();
+        li.append(at, e.type + " " + e.node + " (" + e.address + ")" + (e.reason ? ": " + e.reason : ""));
+        list.append(li);
+    }
+}
+
+async function poll() {
+    try {
+        const [status, topology, events] = await Promise.all([
+            fetchJSON("../v1/status"),
+            fetchJSON("../v1/topology"),
+            fetchJSON("../v1/cluster/events"),
+        ]);
+        renderStatus(status);
+        renderTopology(topology);
+        renderEvents(events);
+    } catch (err) {
+        const summary = document.getElementById("summary");
+        summary.textContent = "Node unreachable: " + err.message;
+        summary.classList.add("error");
+    }
+}
+
+poll();
+setInterval(poll, POLL_MS);
@@ -1,27 +1,117 @@
 package storage
 
 import (
+	"bytes"
 	"errors"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/google/btree"
 )
 
 // ErrStoreFull is returned when a write would exceed the configured capacity.
 var ErrStoreFull = errors.New("store capacity exceeded")
 
+// ErrValueTooLarge is returned when a single value exceeds the configured
+// maximum value size.
+var ErrValueTooLarge = errors.New("value exceeds maximum size")
+
 type Entry struct {
 	Data      []byte        `json:"data"`
 	CreatedAt time.Time     `json:"created_at"`
 	TTL       time.Duration `json:"ttl"`
 	ExpiresAt time.Time     `json:"expires_at"`
+	Hash      string        `json:"hash,omitempty"` // caller-supplied content hash; see PutHashed
+	Origin    Origin        `json:"origin"`         // see PutOrigin
+}
+
+// Origin records where a value entered the cluster: the node a client
+// wrote it to, and when. Replicas keep the originating node's, not their
+// own. The zero Origin means unknown.
+type Origin struct {
+	Node      string    `json:"node,omitempty"`
+	WrittenAt time.Time `json:"written_at,omitempty"`
+}
+
+// expired reports whether the entry's TTL has elapsed at now. Every read
+// path uses it, so a key is either live everywhere or expired everywhere.
+func (e *Entry) expired(now time.Time) bool {
+	return !now.Before(e.ExpiresAt)
+}
+
+// EventType says what happened to a key.
+type EventType int
+
+const (
+	EventPut    EventType = iota // key written, or overwritten
+	EventExpire                  // key removed by the cleanup worker
+)
+
+// Event describes a change to the store. Expire events are emitted when the
+// entry is removed: by a read that finds it expired, by Expire, or by the
+// cleanup worker up to one cleanup interval after the TTL elapsed.
+type Event struct {
+	Type      EventType
+	Key       string
+	CreatedAt time.Time
+	TTL       time.Duration
+}
+
+// EntryMeta describes an expired entry passed to OnExpire callbacks.
+type EntryMeta struct {
+	CreatedAt time.Time
+	TTL       time.Duration
+	ExpiresAt time.Time
+	Size      int    // bytes
+	Hash      string // as recorded by PutHashed
+	Origin    Origin // as recorded by PutOrigin
+}
+
+// indexDegree is the branching factor of the store's btree indexes.
+const indexDegree = 32
+
+// expireQueueSize bounds expirations waiting for OnExpire callbacks. When
+// callbacks fall this far behind, further expirations are dropped rather
+// than stalling the cleanup worker.
+const expireQueueSize = 1024
+
+// ExpiryPosition is a place in expiry order: entries sort by ExpiresAt,
+// then by Key.
+type ExpiryPosition struct {
+	ExpiresAt time.Time
+	Key       string
+}
+
+func (p ExpiryPosition) before(q ExpiryPosition) bool {
+	if !p.ExpiresAt.Equal(q.ExpiresAt) {
+		return p.ExpiresAt.Before(q.ExpiresAt)
+	}
+	return p.Key < q.Key
+}
+
+type expiration struct {
+	key  string
+	meta EntryMeta
 }
 
 type MemoryStore struct {
 	data         map[string]*Entry
+	keys         *btree.BTreeG[string]         // data's keys in order, for prefix scans
+	byExpiry     *btree.BTreeG[ExpiryPosition] // data's entries by expiry, then key
 	mutex        sync.RWMutex
 	cleanup      chan bool
 	maxBytes     int64 // 0 = unlimited
+	maxValue     int64 // per-value limit in bytes; 0 = unlimited
 	currentBytes int64
+	onEvent      func(Event)  // nil = no listener
+	lastSweep    atomic.Int64 // unix nanos the cleanup worker last finished a pass
+
+	expireMutex     sync.RWMutex
+	expireCallbacks []func(key string, meta EntryMeta)
+	expirations     chan expiration // nil until the first OnExpire
+	expireDropped   atomic.Uint64
 }
 
 // NewMemoryStore creates a new store. maxBytes sets the capacity limit in bytes;
@@ -29,159 +119,476 @@ type MemoryStore struct {
 func NewMemoryStore(maxBytes int64) *MemoryStore {
 	store := &MemoryStore{
 		data:     make(map[string]*Entry),
+		keys:     btree.NewOrderedG[string](indexDegree),
+		byExpiry: btree.NewG(indexDegree, ExpiryPosition.before),
 		cleanup:  make(chan bool),
 		maxBytes: maxBytes,
 	}
+	store.lastSweep.Store(time.Now().UnixNano())
 
 	go store.startCleanupWorker()
 	return store
 }
 
+// SetEventHandler registers fn to be called after each put and expiry. fn
+// runs on the writing or reading goroutine or the cleanup worker, outside
+// the store lock, so it must not block. Must be called before the store is used.
+func (m *MemoryStore) SetEventHandler(fn func(Event)) {
+	m.onEvent = fn
+}
+
+// SetMaxValueBytes rejects values larger than n bytes with
+// ErrValueTooLarge, however they arrive. 0 means unlimited. Must be called
+// before the store is used.
+func (m *MemoryStore) SetMaxValueBytes(n int64) {
+	m.maxValue = n
+}
+
 func (m *MemoryStore) Put(key string, data []byte, ttl time.Duration) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	return m.PutHashed(key, data, ttl, "")
+}
+
+// PutHashed is Put, recording hash as the content hash of data so that a
+// later Holds can recognise the same value without comparing bytes. The
+// store does not compute or check the hash.
+func (m *MemoryStore) PutHashed(key string, data []byte, ttl time.Duration, hash string) error {
+	return m.PutOrigin(key, data, ttl, hash, Origin{})
+}
+
+// PutOrigin is PutHashed, also recording where the value entered the
+// cluster, for operators tracing a key back to its writer.
+func (m *MemoryStore) PutOrigin(key string, data []byte, ttl time.Duration, hash string, origin Origin) error {
+	event, err := m.put(key, data, ttl, hash, origin)
+	if err == nil && m.onEvent != nil {
+		m.onEvent(event)
+	}
+	return err
+}
+
+// Holds reports whether key holds a live value recorded with hash that
+// expires no earlier than expiresAt.
+func (m *MemoryStore) Holds(key, hash string, expiresAt time.Time) bool {
+	if hash == "" {
+		return false
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	entry, exists := m.data[key]
+	return exists && entry.Hash == hash && !entry.expired(time.Now()) && !entry.ExpiresAt.Before(expiresAt)
+}
 
+func (m *MemoryStore) put(key string, data []byte, ttl time.Duration, hash string, origin Origin) (Event, error) {
 	newSize := int64(len(data))
+	if m.maxValue > 0 && newSize > m.maxValue {
+		return Event{}, ErrValueTooLarge
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
 	// Account for overwrites: subtract the old entry's size if the key exists
 	var oldSize int64
-	if existing, exists := m.data[key]; exists {
+	existing, exists := m.data[key]
+	if exists {
 		oldSize = int64(len(existing.Data))
 	}
 
 	if m.maxBytes > 0 && (m.currentBytes-oldSize+newSize) > m.maxBytes {
-		return ErrStoreFull
+		return Event{}, ErrStoreFull
 	}
 
 	stored := make([]byte, len(data))
 	copy(stored, data)
 
 	now := time.Now()
+	if exists {
+		m.removeExpiry(ExpiryPosition{ExpiresAt: existing.ExpiresAt, Key: key})
+	} else {
+		m.insertKey(key)
+	}
 	m.data[key] = &Entry{
 		Data:      stored,
 		CreatedAt: now,
 		TTL:       ttl,
 		ExpiresAt: now.Add(ttl),
+		Hash:      hash,
+		Origin:    origin,
 	}
+	m.insertExpiry(ExpiryPosition{ExpiresAt: now.Add(ttl), Key: key})
 
 	m.currentBytes = m.currentBytes - oldSize + newSize
-	return nil
+	return Event{Type: EventPut, Key: key, CreatedAt: now, TTL: ttl}, nil
 }
 
 func (m *MemoryStore) Get(key string) ([]byte, bool) {
+	data, _, _, ok := m.GetWithMetadata(key)
+	return data, ok
+}
+
+func (m *MemoryStore) GetWithMetadata(key string) ([]byte, time.Time, time.Duration, bool) {
+	data, createdAt, ttl, ok := m.View(key)
+	if !ok {
+		return nil, time.Time{}, 0, false
+	}
+	result := make([]byte, len(data))
+	copy(result, data)
+	return result, createdAt, ttl, true
+}
+
+// View is GetWithMetadata without the copy: the returned slice is the
+// stored value itself and must not be modified. Stored values are never
+// written in place — Put replaces the entry — so a view stays valid and
+// unchanged after the key is overwritten or expires. Use it on read paths
+// that only pass the value on, such as serving it over HTTP.
+//
+// A read that finds the key expired removes it there and then, rather than
+// leaving it to the cleanup worker.
+func (m *MemoryStore) View(key string) ([]byte, time.Time, time.Duration, bool) {
+	data, meta, ok := m.ViewMeta(key)
+	return data, meta.CreatedAt, meta.TTL, ok
+}
+
+// ViewMeta is View returning the entry's full metadata, including its
+// hash and origin.
+func (m *MemoryStore) ViewMeta(key string) ([]byte, EntryMeta, bool) {
 	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+	entry, exists := m.data[key]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, EntryMeta{}, false
+	}
+	if entry.expired(time.Now()) {
+		m.expireKey(key)
+		return nil, EntryMeta{}, false
+	}
+	return entry.Data, entryMeta(entry), true
+}
+
+// expireKey removes key if it is still present and expired, emitting expiry
+// events as the cleanup worker would. Readers hold only the read lock when
+// they find an expired entry, so the removal retakes the write lock and
+// checks again: the key may have been rewritten or swept in between.
+func (m *MemoryStore) expireKey(key string) {
+	m.mutex.Lock()
+	entry, exists := m.data[key]
+	if !exists || !entry.expired(time.Now()) {
+		m.mutex.Unlock()
+		return
+	}
+	m.currentBytes -= int64(len(entry.Data))
+	delete(m.data, key)
+	m.removeKey(key)
+	m.removeExpiry(ExpiryPosition{ExpiresAt: entry.ExpiresAt, Key: key})
+	m.mutex.Unlock()
 
+	m.notifyExpired([]expiration{{key: key, meta: entryMeta(entry)}})
+}
+
+// Expire removes key now, whatever its TTL, and emits expiry events as if
+// it had run out. It reports the removed entry, if there was a live one.
+func (m *MemoryStore) Expire(key string) (EntryMeta, bool) {
+	m.mutex.Lock()
 	entry, exists := m.data[key]
 	if !exists {
-		return nil, false
+		m.mutex.Unlock()
+		return EntryMeta{}, false
 	}
+	m.currentBytes -= int64(len(entry.Data))
+	delete(m.data, key)
+	m.removeKey(key)
+	m.removeExpiry(ExpiryPosition{ExpiresAt: entry.ExpiresAt, Key: key})
+	m.mutex.Unlock()
 
-	if time.Now().After(entry.ExpiresAt) {
-		return nil, false
+	meta := entryMeta(entry)
+	m.notifyExpired([]expiration{{key: key, meta: meta}})
+	return meta, !entry.expired(time.Now())
+}
+
+func entryMeta(entry *Entry) EntryMeta {
+	return EntryMeta{
+		CreatedAt: entry.CreatedAt,
+		TTL:       entry.TTL,
+		ExpiresAt: entry.ExpiresAt,
+		Size:      len(entry.Data),
+		Hash:      entry.Hash,
+		Origin:    entry.Origin,
 	}
+}
+
+// OnExpire registers fn to be called for each entry the cleanup worker
+// removes, up to one cleanup interval after its TTL elapsed. Callbacks run in
+// registration order on a single goroutine, separate from the cleanup
+// worker; if they fall behind by more than expireQueueSize entries, further
+// expirations are dropped and counted in ExpireDropped.
+func (m *MemoryStore) OnExpire(fn func(key string, meta EntryMeta)) {
+	m.expireMutex.Lock()
+	defer m.expireMutex.Unlock()
 
-	result := make([]byte, len(entry.Data))
-	copy(result, entry.Data)
-	return result, true
+	m.expireCallbacks = append(m.expireCallbacks, fn)
+	if m.expirations == nil {
+		m.expirations = make(chan expiration, expireQueueSize)
+		go m.deliverExpirations(m.expirations)
+	}
 }
 
-func (m *MemoryStore) GetWithMetadata(key string) ([]byte, time.Time, time.Duration, bool) {
+// ExpireDropped returns how many expirations were not delivered to OnExpire
+// callbacks because the queue was full.
+func (m *MemoryStore) ExpireDropped() uint64 {
+	return m.expireDropped.Load()
+}
+
+func (m *MemoryStore) deliverExpirations(expirations <-chan expiration) {
+	for {
+		select {
+		case exp := <-expirations:
+			m.expireMutex.RLock()
+			callbacks := m.expireCallbacks
+			m.expireMutex.RUnlock()
+			for _, fn := range callbacks {
+				fn(exp.key, exp.meta)
+			}
+		case <-m.cleanup:
+			return
+		}
+	}
+}
+
+// SameValue reports whether key holds a live value byte-for-byte equal to
+// data, and if so how long until it expires. Unlike Get it does not copy
+// the value.
+func (m *MemoryStore) SameValue(key string, data []byte) (time.Duration, bool) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	entry, exists := m.data[key]
-	if !exists {
-		return nil, time.Time{}, 0, false
+	if !exists || !bytes.Equal(entry.Data, data) {
+		return 0, false
 	}
-
-	if time.Now().After(entry.ExpiresAt) {
-		return nil, time.Time{}, 0, false
+	now := time.Now()
+	if entry.expired(now) {
+		return 0, false
 	}
-
-	result := make([]byte, len(entry.Data))
-	copy(result, entry.Data)
-	return result, entry.CreatedAt, entry.TTL, true
+	return entry.ExpiresAt.Sub(now), true
 }
 
+// CleanupInterval is how often the cleanup worker removes expired entries.
+const CleanupInterval = 30 * time.Second
+
 func (m *MemoryStore) startCleanupWorker() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(CleanupInterval)
 	defer ticker.Stop()
 	
 	for {
 		select {
 		case <-ticker.C:
 			m.cleanupExpired()
+			m.lastSweep.Store(time.Now().UnixNano())
 		case <-m.cleanup:
 			return
 		}
 	}
 }
 
+// Sweep removes expired entries now rather than at the next cleanup tick,
+// releasing their memory. Expiry events fire as usual.
+func (m *MemoryStore) Sweep() {
+	m.cleanupExpired()
+}
+
+// LastSweep returns when the cleanup worker last finished a pass, or when
+// the store was created if it hasn't yet. Sweep doesn't count: it runs on
+// the caller's goroutine and says nothing about the worker.
+func (m *MemoryStore) LastSweep() time.Time {
+	return time.Unix(0, m.lastSweep.Load())
+}
+
 func (m *MemoryStore) cleanupExpired() {
+	m.expireMutex.RLock()
+	listening := m.expirations != nil
+	m.expireMutex.RUnlock()
+
+	m.notifyExpired(m.removeExpired(m.onEvent != nil || listening))
+}
+
+// notifyExpired emits expiry events and queues OnExpire callbacks for
+// removed entries. Caller must not hold the store lock.
+func (m *MemoryStore) notifyExpired(removed []expiration) {
+	m.expireMutex.RLock()
+	expirations := m.expirations
+	m.expireMutex.RUnlock()
+
+	for _, exp := range removed {
+		if m.onEvent != nil {
+			m.onEvent(Event{Type: EventExpire, Key: exp.key, CreatedAt: exp.meta.CreatedAt, TTL: exp.meta.TTL})
+		}
+		if expirations != nil {
+			select {
+			case expirations <- exp:
+			default:
+				m.expireDropped.Add(1)
+			}
+		}
+	}
+}
+
+// removeExpired deletes expired entries. If collect is set, it returns them
+// for expiry notifications. Expired entries are always at the front of the
+// expiry index, so this costs O(expired) plus O(log n) per removed key.
+func (m *MemoryStore) removeExpired(collect bool) []expiration {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	var removed []expiration
 	now := time.Now()
-	for key, entry := range m.data {
-		if now.After(entry.ExpiresAt) {
-			m.currentBytes -= int64(len(entry.Data))
-			delete(m.data, key)
+	for {
+		p, ok := m.byExpiry.Min()
+		if !ok || !m.data[p.Key].expired(now) {
+			return removed
+		}
+		m.byExpiry.DeleteMin()
+		entry := m.data[p.Key]
+		m.currentBytes -= int64(len(entry.Data))
+		delete(m.data, p.Key)
+		m.keys.Delete(p.Key)
+		if collect {
+			removed = append(removed, expiration{key: p.Key, meta: entryMeta(entry)})
 		}
 	}
 }
 
+// insertKey adds a new key to the key index in O(log n). Caller holds the
+// write lock.
+func (m *MemoryStore) insertKey(key string) {
+	m.keys.ReplaceOrInsert(key)
+}
+
+// removeKey drops key from the key index in O(log n). Caller holds the
+// write lock.
+func (m *MemoryStore) removeKey(key string) {
+	m.keys.Delete(key)
+}
+
+// insertExpiry and removeExpiry maintain the expiry index in O(log n).
+// Caller holds the write lock. Positions drop the monotonic clock reading
+// so they order the same way as positions decoded from cursors.
+func (m *MemoryStore) insertExpiry(p ExpiryPosition) {
+	p.ExpiresAt = p.ExpiresAt.Round(0)
+	m.byExpiry.ReplaceOrInsert(p)
+}
+
+func (m *MemoryStore) removeExpiry(p ExpiryPosition) {
+	p.ExpiresAt = p.ExpiresAt.Round(0)
+	m.byExpiry.Delete(p)
+}
+
 func (m *MemoryStore) Close() {
 	close(m.cleanup)
 }
 
-// GetStats returns storage statistics
+// GetStats returns the number and total size of non-expired entries.
 func (m *MemoryStore) GetStats() (int, int64) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
-	count := len(m.data)
+
+	count := 0
 	var totalSize int64
-	
+	now := time.Now()
 	for _, entry := range m.data {
+		if entry.expired(now) {
+			continue
+		}
+		count++
 		totalSize += int64(len(entry.Data))
 	}
-	
+
 	return count, totalSize
 }
 
-// Range iterates over all non-expired keys
+// Usage returns the storage limit (0 = unlimited), the bytes in use and
+// the number of entries. Unlike GetStats it doesn't walk the store, and
+// entries awaiting cleanup still count.
+func (m *MemoryStore) Usage() (maxBytes, usedBytes int64, items int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.maxBytes, m.currentBytes, len(m.data)
+}
+
+// Range iterates over all non-expired keys in key order
 // The callback function receives the key and remaining TTL in seconds
 // If the callback returns false, iteration stops
 func (m *MemoryStore) Range(fn func(key string, ttl int) bool) {
+	m.RangePrefix("", "", fn)
+}
+
+// RangePrefix calls fn, in key order, for each non-expired key that starts
+// with prefix and sorts after the key "after" ("" = from the start), with its
+// remaining TTL in seconds. Iteration stops when fn returns false. Cost is
+// O(log n) to find the first key plus one step per key visited.
+func (m *MemoryStore) RangePrefix(prefix, after string, fn func(key string, ttl int) bool) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
+
+	start := prefix
+	if after > start {
+		start = after
+	}
 	now := time.Now()
-	for key, entry := range m.data {
-		if now.After(entry.ExpiresAt) {
-			continue // Skip expired entries
+	m.keys.AscendGreaterOrEqual(start, func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
 		}
-		
-		remainingTTL := int(entry.ExpiresAt.Sub(now).Seconds())
-		if !fn(key, remainingTTL) {
-			break
+		if key == after {
+			return true
 		}
-	}
+		entry := m.data[key]
+		if entry.expired(now) {
+			return true
+		}
+		return fn(key, int(entry.ExpiresAt.Sub(now).Seconds()))
+	})
 }
 
-// Scan returns all non-expired keys
-func (m *MemoryStore) Scan() []string {
+// RangeByExpiry calls fn for each non-expired key starting with prefix, in
+// order of expiry (soonest first, ties broken by key), beginning after the
+// position "after" (zero value = from the start). Iteration stops when fn
+// returns false. Finding the start is O(log n); a non-empty prefix costs one
+// step for every key visited, matching or not.
+func (m *MemoryStore) RangeByExpiry(prefix string, after ExpiryPosition, fn func(key string, expiresAt time.Time) bool) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
-	var keys []string
+
 	now := time.Now()
-	for key, entry := range m.data {
-		if !now.After(entry.ExpiresAt) { // Not expired
-			keys = append(keys, key)
+	visit := func(p ExpiryPosition) bool {
+		if !after.before(p) || m.data[p.Key].expired(now) || !strings.HasPrefix(p.Key, prefix) {
+			return true
 		}
+		return fn(p.Key, p.ExpiresAt)
 	}
-	
+	if after.ExpiresAt.IsZero() {
+		m.byExpiry.Ascend(visit)
+	} else {
+		m.byExpiry.AscendGreaterOrEqual(after, visit)
+	}
+}
+
+// CountPrefix returns the number of non-expired keys starting with prefix.
+func (m *MemoryStore) CountPrefix(prefix string) int {
+	count := 0
+	m.RangePrefix(prefix, "", func(string, int) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// Scan returns all non-expired keys in key order
+func (m *MemoryStore) Scan() []string {
+	var keys []string
+	m.Range(func(key string, _ int) bool {
+		keys = append(keys, key)
+		return true
+	})
 	return keys
-}
\ No newline at end of file
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -167,27 +169,64 @@ func TestPutCopiesInput(t *testing.T) {
 	}
 }
 
+// View shares the stored slice, and an overwrite must not disturb a view
+// already handed out
+func TestViewSurvivesOverwrite(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	store.Put("key", []byte("original"), 5*time.Second)
+	view, _, _, ok := store.View("key")
+	if !ok {
+		t.Fatal("View missed a stored key")
+	}
+
+	store.Put("key", []byte("replaced"), 5*time.Second)
+	if string(view) != "original" {
+		t.Fatalf("view changed after overwrite: got %q", view)
+	}
+	if _, _, _, ok := store.View("missing"); ok {
+		t.Fatal("View found a key that was never stored")
+	}
+}
+
+func TestSameValue(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	store.Put("key", []byte("data"), time.Minute)
+
+	remaining, same := store.SameValue("key", []byte("data"))
+	if !same || remaining <= 50*time.Second || remaining > time.Minute {
+		t.Fatalf("SameValue = %v, %v; want about 1m, true", remaining, same)
+	}
+	if _, same := store.SameValue("key", []byte("other")); same {
+		t.Error("SameValue reported a different value as equal")
+	}
+	if _, same := store.SameValue("missing", []byte("data")); same {
+		t.Error("SameValue reported a missing key as equal")
+	}
+
+	store.Put("short", []byte("data"), 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	if _, same := store.SameValue("short", []byte("data")); same {
+		t.Error("SameValue reported an expired value as equal")
+	}
+}
+
 func TestScan(t *testing.T) {
 	store := newTestStore(0)
 	defer store.Close()
 
-	store.Put("a", []byte("1"), 5*time.Second)
 	store.Put("b", []byte("2"), 5*time.Second)
+	store.Put("a", []byte("1"), 5*time.Second)
 	store.Put("expired", []byte("3"), 50*time.Millisecond)
 
 	time.Sleep(100 * time.Millisecond)
 
 	keys := store.Scan()
-	if len(keys) != 2 {
-		t.Fatalf("Scan returned %d keys, want 2", len(keys))
-	}
-
-	found := map[string]bool{}
-	for _, k := range keys {
-		found[k] = true
-	}
-	if !found["a"] || !found["b"] {
-		t.Fatalf("Scan returned %v, want [a, b]", keys)
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Fatalf("Scan returned %v, want [a b]", keys)
 	}
 }
 
@@ -247,6 +286,79 @@ func TestGetStats(t *testing.T) {
 	}
 }
 
+func TestGetStatsSkipsExpired(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	store.Put("live", []byte("hello"), 5*time.Second)
+	store.Put("expired", []byte("world!"), 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	count, size := store.GetStats()
+	if count != 1 || size != 5 {
+		t.Fatalf("GetStats = %d, %d; want 1, 5 (expired entries excluded)", count, size)
+	}
+}
+
+func TestExpireRemovesLiveKey(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	var events []Event
+	store.SetEventHandler(func(e Event) { events = append(events, e) })
+
+	store.Put("a", []byte("abc"), time.Minute)
+	store.Put("b", []byte("d"), time.Minute)
+
+	meta, ok := store.Expire("a")
+	if !ok || meta.Size != 3 {
+		t.Fatalf("Expire(a) = %+v, %v; want the 3-byte live entry", meta, ok)
+	}
+	if _, ok := store.Get("a"); ok {
+		t.Fatal("expired key should not be returned")
+	}
+	if _, used, items := store.Usage(); used != 1 || items != 1 {
+		t.Fatalf("Usage after Expire = %d bytes, %d items; want 1, 1", used, items)
+	}
+	if len(events) != 3 || events[2].Type != EventExpire || events[2].Key != "a" {
+		t.Fatalf("events = %+v, want put, put, expire of a", events)
+	}
+	if _, ok := store.Expire("a"); ok {
+		t.Fatal("Expire of a missing key reported a removal")
+	}
+}
+
+func TestGetRemovesExpiredEntry(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	var events []Event
+	store.SetEventHandler(func(e Event) { events = append(events, e) })
+
+	store.Put("short", []byte("abc"), 50*time.Millisecond)
+	store.Put("long", []byte("d"), 5*time.Second)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, ok := store.Get("short"); ok {
+		t.Fatal("expired key should not be returned")
+	}
+	if _, used, items := store.Usage(); used != 1 || items != 1 {
+		t.Fatalf("Usage after expired read = %d bytes, %d items; want 1, 1", used, items)
+	}
+	if len(events) != 3 || events[2].Type != EventExpire || events[2].Key != "short" {
+		t.Fatalf("events = %+v, want put, put, expire of short", events)
+	}
+
+	// The cleanup worker must not report the key a second time.
+	store.cleanupExpired()
+	if len(events) != 3 {
+		t.Fatalf("cleanup re-reported a lazily expired key: %+v", events)
+	}
+	if keys := store.Scan(); len(keys) != 1 || keys[0] != "long" {
+		t.Fatalf("Scan = %v, want [long]", keys)
+	}
+}
+
 // --- Capacity limit tests ---
 
 func TestCapacityLimitRejectsWrite(t *testing.T) {
@@ -307,6 +419,22 @@ func TestCapacityLimitOverwriteTooLarge(t *testing.T) {
 	}
 }
 
+func TestMaxValueBytes(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+	store.SetMaxValueBytes(4)
+
+	if err := store.Put("small", []byte("1234"), time.Minute); err != nil {
+		t.Fatalf("value at the limit: %v", err)
+	}
+	if err := store.Put("big", []byte("12345"), time.Minute); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("value over the limit: got %v, want ErrValueTooLarge", err)
+	}
+	if _, ok := store.Get("big"); ok {
+		t.Error("rejected value should not be stored")
+	}
+}
+
 func TestCapacityUnlimited(t *testing.T) {
 	store := newTestStore(0) // 0 = unlimited
 	defer store.Close()
@@ -414,3 +542,243 @@ func TestConcurrentReadWithExpiration(t *testing.T) {
 	wg.Wait()
 	// If we get here without a race detector panic, the fix for #8 is working
 }
+
+func TestEventHandler(t *testing.T) {
+	store := newTestStore(5)
+	defer store.Close()
+
+	var events []Event
+	store.SetEventHandler(func(e Event) { events = append(events, e) })
+
+	store.Put("short", []byte("a"), 50*time.Millisecond)
+	store.Put("long", []byte("b"), 5*time.Second)
+	store.Put("rejected", []byte("too big"), 5*time.Second) // over capacity: no event
+	time.Sleep(100 * time.Millisecond)
+	store.cleanupExpired()
+
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %+v", len(events), events)
+	}
+	if events[0].Type != EventPut || events[0].Key != "short" || events[0].TTL != 50*time.Millisecond {
+		t.Errorf("events[0] = %+v, want put of short", events[0])
+	}
+	if events[1].Type != EventPut || events[1].Key != "long" {
+		t.Errorf("events[1] = %+v, want put of long", events[1])
+	}
+	if events[2].Type != EventExpire || events[2].Key != "short" || events[2].CreatedAt.IsZero() {
+		t.Errorf("events[2] = %+v, want expire of short with its creation time", events[2])
+	}
+}
+
+func TestOnExpire(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	type expired struct {
+		key  string
+		meta EntryMeta
+	}
+	got := make(chan expired, 2)
+	store.OnExpire(func(key string, meta EntryMeta) { got <- expired{key, meta} })
+
+	store.Put("short", []byte("abc"), 50*time.Millisecond)
+	store.Put("long", []byte("d"), 5*time.Second)
+	time.Sleep(100 * time.Millisecond)
+	store.cleanupExpired()
+
+	select {
+	case e := <-got:
+		if e.key != "short" || e.meta.Size != 3 || e.meta.TTL != 50*time.Millisecond || !e.meta.ExpiresAt.Equal(e.meta.CreatedAt.Add(e.meta.TTL)) {
+			t.Errorf("unexpected expiration %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnExpire callback not called")
+	}
+	select {
+	case e := <-got:
+		t.Errorf("only the expired key should be reported, got %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestOnExpireDropsWhenCallbacksFallBehind(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	store.OnExpire(func(string, EntryMeta) { <-release })
+
+	n := expireQueueSize + 10
+	for i := 0; i < n; i++ {
+		store.Put(fmt.Sprintf("k%d", i), []byte("x"), time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		store.cleanupExpired()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup blocked on a slow OnExpire callback")
+	}
+
+	// One expiration is held by the blocked callback, expireQueueSize wait in the queue
+	if dropped := store.ExpireDropped(); dropped < uint64(n-expireQueueSize-1) {
+		t.Errorf("ExpireDropped = %d, want at least %d", dropped, n-expireQueueSize-1)
+	}
+	if count, _ := store.GetStats(); count != 0 {
+		t.Errorf("expired entries should be removed even when callbacks lag, %d left", count)
+	}
+}
+
+func collectPrefix(store *MemoryStore, prefix, after string, limit int) []string {
+	var keys []string
+	store.RangePrefix(prefix, after, func(key string, ttl int) bool {
+		keys = append(keys, key)
+		return limit == 0 || len(keys) < limit
+	})
+	return keys
+}
+
+func TestRangePrefixOrderAndCursor(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	for _, key := range []string{"b:2", "a:1", "b:1", "c:1", "b:3", "b"} {
+		store.Put(key, []byte("x"), 5*time.Second)
+	}
+	store.Put("b:1", []byte("overwrite"), 5*time.Second) // must not duplicate in the index
+
+	if got := fmt.Sprint(collectPrefix(store, "b:", "", 0)); got != "[b:1 b:2 b:3]" {
+		t.Errorf("prefix b: = %s, want [b:1 b:2 b:3]", got)
+	}
+	if got := fmt.Sprint(collectPrefix(store, "b:", "b:1", 0)); got != "[b:2 b:3]" {
+		t.Errorf("prefix b: after b:1 = %s, want [b:2 b:3]", got)
+	}
+	if got := fmt.Sprint(collectPrefix(store, "", "b:3", 0)); got != "[c:1]" {
+		t.Errorf("all keys after b:3 = %s, want [c:1]", got)
+	}
+	if got := fmt.Sprint(collectPrefix(store, "", "", 2)); got != "[a:1 b]" {
+		t.Errorf("first two keys = %s, want [a:1 b]", got)
+	}
+	if n := store.CountPrefix("b"); n != 4 {
+		t.Errorf("CountPrefix(b) = %d, want 4", n)
+	}
+}
+
+func TestRangePrefixSkipsAndDropsExpired(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	store.Put("k:1", []byte("x"), 50*time.Millisecond)
+	store.Put("k:2", []byte("x"), 5*time.Second)
+	time.Sleep(100 * time.Millisecond)
+
+	// Expired but not yet cleaned up: skipped
+	if got := fmt.Sprint(collectPrefix(store, "k:", "", 0)); got != "[k:2]" {
+		t.Errorf("before cleanup = %s, want [k:2]", got)
+	}
+
+	store.cleanupExpired()
+	if first, _ := store.keys.Min(); store.keys.Len() != 1 || first != "k:2" {
+		t.Errorf("index after cleanup has %d keys from %q, want [k:2]", store.keys.Len(), first)
+	}
+	store.Put("k:0", []byte("x"), 5*time.Second)
+	if got := fmt.Sprint(collectPrefix(store, "k:", "", 0)); got != "[k:0 k:2]" {
+		t.Errorf("after re-insert = %s, want [k:0 k:2]", got)
+	}
+}
+
+func TestRangeByExpiry(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	store.Put("m:late", []byte("x"), 30*time.Second)
+	store.Put("m:soon", []byte("x"), 10*time.Second)
+	store.Put("other", []byte("x"), 5*time.Second)
+	store.Put("m:mid", []byte("x"), 40*time.Second)
+	store.Put("m:mid", []byte("x"), 20*time.Second) // overwrite moves it earlier
+	store.Put("m:gone", []byte("x"), 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	var keys []string
+	var positions []ExpiryPosition
+	store.RangeByExpiry("m:", ExpiryPosition{}, func(key string, expiresAt time.Time) bool {
+		keys = append(keys, key)
+		positions = append(positions, ExpiryPosition{ExpiresAt: expiresAt, Key: key})
+		return true
+	})
+	if got := fmt.Sprint(keys); got != "[m:soon m:mid m:late]" {
+		t.Fatalf("expiry order = %s, want [m:soon m:mid m:late]", got)
+	}
+
+	// Resume after the first entry, as a cursor would
+	keys = nil
+	store.RangeByExpiry("m:", positions[0], func(key string, _ time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if got := fmt.Sprint(keys); got != "[m:mid m:late]" {
+		t.Errorf("after m:soon = %s, want [m:mid m:late]", got)
+	}
+
+	store.cleanupExpired()
+	if first, _ := store.byExpiry.Min(); store.byExpiry.Len() != 4 || first.Key != "other" {
+		t.Errorf("expiry index after cleanup has %d entries from %q, want 4 starting with other", store.byExpiry.Len(), first.Key)
+	}
+}
+
+func TestHolds(t *testing.T) {
+	store := newTestStore(0)
+	defer store.Close()
+
+	store.PutHashed("hashed", []byte("v"), time.Minute, "abc")
+	store.Put("plain", []byte("v"), time.Minute)
+
+	soon := time.Now().Add(30 * time.Second)
+	if !store.Holds("hashed", "abc", soon) {
+		t.Error("Holds should match the recorded hash when the entry outlives expiresAt")
+	}
+	if store.Holds("hashed", "abc", time.Now().Add(2*time.Minute)) {
+		t.Error("Holds should not match when the entry expires before expiresAt")
+	}
+	if store.Holds("hashed", "def", soon) {
+		t.Error("Holds should not match a different hash")
+	}
+	if store.Holds("plain", "", soon) {
+		t.Error("Holds should not match entries stored without a hash")
+	}
+}
+
+func benchmarkRead(b *testing.B, read func(*MemoryStore, string) []byte) {
+	store := newTestStore(0)
+	defer store.Close()
+	store.Put("key", make([]byte, 1<<20), time.Hour)
+
+	b.ReportAllocs()
+	b.SetBytes(1 << 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if read(store, "key") == nil {
+			b.Fatal("key missing")
+		}
+	}
+}
+
+func BenchmarkGetWithMetadata(b *testing.B) {
+	benchmarkRead(b, func(s *MemoryStore, key string) []byte {
+		data, _, _, _ := s.GetWithMetadata(key)
+		return data
+	})
+}
+
+func BenchmarkView(b *testing.B) {
+	benchmarkRead(b, func(s *MemoryStore, key string) []byte {
+		data, _, _, _ := s.View(key)
+		return data
+	})
+}
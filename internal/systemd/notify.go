@@ -0,0 +1,90 @@
+// Package systemd implements the sd_notify protocol so the node can run as a
+// Type=notify service with WatchdogSec. Everything is a no-op unless systemd
+// sets NOTIFY_SOCKET, so container and foreground deployments are unaffected.
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"repram/internal/logging"
+)
+
+// Notification states understood by systemd.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends a state string to the systemd notification socket.
+// It returns false (and no error) when not running under systemd.
+func Notify(state string) (bool, error) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return false, nil
+	}
+
+	// A leading @ denotes a Linux abstract socket
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the watchdog timeout configured by systemd
+// (WatchdogSec), or 0 if the watchdog is not enabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	// WATCHDOG_PID, when set, restricts the watchdog to one process
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog pings the systemd watchdog at half the configured interval for
+// as long as healthy reports true. When healthy returns false the pings stop,
+// and systemd restarts the service once WatchdogSec elapses. It returns
+// immediately if the watchdog is not enabled, otherwise when ctx is cancelled.
+func RunWatchdog(ctx context.Context, healthy func() bool) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !healthy() {
+				logging.Error("Watchdog: health check failed, withholding systemd watchdog ping")
+				continue
+			}
+			if _, err := Notify(Watchdog); err != nil {
+				logging.Warn("Watchdog: failed to notify systemd: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotifySocket creates a unixgram socket and points NOTIFY_SOCKET at it.
+func listenNotifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", path, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+// readState reads one notification from the socket.
+func readState(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("no notification received: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotifyNoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	ok, err := Notify(Ready)
+	if ok || err != nil {
+		t.Fatalf("Notify without NOTIFY_SOCKET = (%v, %v), want (false, nil)", ok, err)
+	}
+}
+
+func TestNotifySendsState(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	ok, err := Notify(Ready)
+	if !ok || err != nil {
+		t.Fatalf("Notify = (%v, %v), want (true, nil)", ok, err)
+	}
+	if got := readState(t, conn); got != Ready {
+		t.Fatalf("received %q, want %q", got, Ready)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	if got := WatchdogInterval(); got != 0 {
+		t.Errorf("unset WATCHDOG_USEC: got %v, want 0", got)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if got := WatchdogInterval(); got != 30*time.Second {
+		t.Errorf("got %v, want 30s", got)
+	}
+
+	// Watchdog addressed to a different process
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if got := WatchdogInterval(); got != 0 {
+		t.Errorf("foreign WATCHDOG_PID: got %v, want 0", got)
+	}
+}
+
+func TestRunWatchdogPingsWhileHealthy(t *testing.T) {
+	conn := listenNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "100000") // 100ms → ping every 50ms
+	t.Setenv("WATCHDOG_PID", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go RunWatchdog(ctx, func() bool { return true })
+
+	if got := readState(t, conn); got != Watchdog {
+		t.Fatalf("received %q, want %q", got, Watchdog)
+	}
+}
+
+func TestRunWatchdogWithheldWhenUnhealthy(t *testing.T) {
+	conn := listenNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go RunWatchdog(ctx, func() bool { return false })
+
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	buf := make([]byte, 256)
+	if n, err := conn.Read(buf); err == nil {
+		t.Fatalf("unexpected notification %q while unhealthy", buf[:n])
+	}
+}
@@ -0,0 +1,323 @@
+// Package webhook delivers signed JSON callbacks when keys are created or
+// expire, so downstream systems can react to TTL expiry without polling.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"repram/internal/logging"
+	"repram/internal/storage"
+)
+
+// Event names sent in the "event" field of a callback.
+const (
+	EventCreated = "created"
+	EventExpired = "expired"
+)
+
+const (
+	queueSize       = 1024            // pending deliveries; further events are dropped
+	workers         = 4               // concurrent deliveries
+	maxAttempts     = 3               // per delivery, including the first
+	retryBackoff    = time.Second     // doubled after each failed attempt
+	deliveryTimeout = 5 * time.Second // per attempt
+)
+
+// Hook sends callbacks for keys starting with Prefix to URL. An empty
+// prefix matches every key.
+type Hook struct {
+	Prefix string
+	URL    string
+}
+
+// ParseHooks parses "prefix=url" entries. The prefix may be empty
+// ("=https://...") to match every key.
+func ParseHooks(entries []string) ([]Hook, error) {
+	hooks := make([]Hook, 0, len(entries))
+	for _, entry := range entries {
+		prefix, rawURL, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: expected prefix=url", entry)
+		}
+		if err := CheckURL(rawURL); err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+		hooks = append(hooks, Hook{Prefix: prefix, URL: rawURL})
+	}
+	return hooks, nil
+}
+
+// CheckURL reports whether rawURL can receive callbacks: an absolute http
+// or https URL.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", rawURL)
+	}
+	return nil
+}
+
+// Payload is the JSON body of a callback. Every node storing a matching key
+// sends its own callbacks, so with replication a receiver sees each event
+// once per replica; Key plus CreatedAt identifies a write.
+type Payload struct {
+	Event     string    `json:"event"`
+	Key       string    `json:"key"`
+	NodeID    string    `json:"node_id"`
+	CreatedAt time.Time `json:"created_at"`
+	TTL       int       `json:"ttl"` // seconds, as written
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type delivery struct {
+	url  string
+	body []byte
+}
+
+type webhookMetrics struct {
+	delivered prometheus.Counter
+	failed    prometheus.Counter
+	dropped   prometheus.Counter
+}
+
+var (
+	sharedMetrics     *webhookMetrics
+	sharedMetricsOnce sync.Once
+)
+
+func newWebhookMetrics() *webhookMetrics {
+	sharedMetricsOnce.Do(func() {
+		sharedMetrics = &webhookMetrics{
+			delivered: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "repram_webhooks_delivered_total",
+				Help: "Total number of webhook callbacks acknowledged with a 2xx response",
+			}),
+			failed: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "repram_webhooks_failed_total",
+				Help: "Total number of webhook callbacks abandoned after all retries",
+			}),
+			dropped: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "repram_webhooks_dropped_total",
+				Help: "Total number of webhook callbacks dropped because the delivery queue was full",
+			}),
+		}
+		prometheus.MustRegister(sharedMetrics.delivered, sharedMetrics.failed, sharedMetrics.dropped)
+	})
+	return sharedMetrics
+}
+
+// Dispatcher turns store events into callbacks and delivers them in the
+// background. Delivery is best effort: a receiver that stays down through
+// every retry misses the event.
+type Dispatcher struct {
+	nodeID  string
+	secret  string
+	hooks   []Hook
+	client  *http.Client
+	metrics *webhookMetrics
+
+	mutex  sync.RWMutex // guards queue against send-after-close
+	queue  chan delivery
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher starts delivery workers. If secret is non-empty, each
+// callback carries an X-Repram-Signature header: the hex HMAC-SHA256 of the
+// body, the same scheme used for gossip.
+func NewDispatcher(nodeID, secret string, hooks []Hook) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		nodeID:  nodeID,
+		secret:  secret,
+		hooks:   hooks,
+		client:  &http.Client{Timeout: deliveryTimeout},
+		metrics: newWebhookMetrics(),
+		queue:   make(chan delivery, queueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	return d
+}
+
+// Notify queues callbacks for every hook matching the event's key. It never
+// blocks; events are dropped when the queue is full. Suitable as a store
+// event handler.
+func (d *Dispatcher) Notify(event storage.Event) {
+	name := EventCreated
+	if event.Type == storage.EventExpire {
+		name = EventExpired
+	}
+
+	var body []byte
+	for _, hook := range d.hooks {
+		if !strings.HasPrefix(event.Key, hook.Prefix) {
+			continue
+		}
+		if body == nil {
+			body, _ = json.Marshal(Payload{
+				Event:     name,
+				Key:       event.Key,
+				NodeID:    d.nodeID,
+				CreatedAt: event.CreatedAt,
+				TTL:       int(event.TTL.Seconds()),
+				Timestamp: time.Now(),
+			})
+		}
+		d.enqueue(delivery{url: hook.URL, body: body})
+	}
+}
+
+// Post queues body for delivery to url with the same signing, retries and
+// drop policy as key callbacks. It never blocks.
+func (d *Dispatcher) Post(url string, body []byte) {
+	d.enqueue(delivery{url: url, body: body})
+}
+
+func (d *Dispatcher) enqueue(dl delivery) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.queue <- dl:
+	default:
+		if d.metrics != nil {
+			d.metrics.dropped.Inc()
+		}
+		logging.Warn("[webhook] Queue full, dropping callback to %s", dl.url)
+	}
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+	for dl := range d.queue {
+		if d.ctx.Err() == nil {
+			d.deliver(dl)
+		}
+	}
+}
+
+// deliver sends dl, retrying network errors, 429s, and 5xx responses with
+// exponential backoff.
+func (d *Dispatcher) deliver(dl delivery) {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(dl)
+		if err == nil {
+			if d.metrics != nil {
+				d.metrics.delivered.Inc()
+			}
+			return
+		}
+		if attempt == maxAttempts || !retryable(err) {
+			if d.metrics != nil {
+				d.metrics.failed.Inc()
+			}
+			logging.Warn("[webhook] Callback to %s failed after %d attempt(s): %v", dl.url, attempt, err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// statusError is a non-2xx response from a receiver.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("receiver returned %d", int(e))
+}
+
+func retryable(err error) bool {
+	status, isStatus := err.(statusError)
+	return !isStatus || status == http.StatusTooManyRequests || status >= 500
+}
+
+func (d *Dispatcher) post(dl delivery) error {
+	req, err := http.NewRequestWithContext(d.ctx, "POST", dl.url, bytes.NewReader(dl.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "repram-webhook")
+	if d.secret != "" {
+		req.Header.Set("X-Repram-Signature", Sign(d.secret, dl.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body, as sent in X-Repram-Signature.
+// Receivers recompute it over the raw request body to verify a callback.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Close stops delivery: queued callbacks are discarded and in-flight
+// requests are cancelled. Events notified after Close are ignored.
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.Shutdown(context.Background())
+}
+
+// Shutdown stops taking events and delivers those already queued, with
+// their usual retries, until ctx is done; then it cancels what's left as
+// Close does. Events notified after Shutdown are ignored.
+func (d *Dispatcher) Shutdown(ctx context.Context) {
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.queue)
+	d.mutex.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		d.cancel()
+		<-drained
+	}
+	d.cancel()
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"repram/internal/storage"
+)
+
+// receiver records callbacks; the first failFirst requests get a 500.
+type receiver struct {
+	server    *httptest.Server
+	payloads  chan Payload
+	failFirst int32
+	requests  atomic.Int32
+}
+
+func newReceiver(t *testing.T, secret string, failFirst int32) *receiver {
+	t.Helper()
+	rc := &receiver{payloads: make(chan Payload, 10), failFirst: failFirst}
+	rc.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rc.requests.Add(1) <= rc.failFirst {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if secret != "" && r.Header.Get("X-Repram-Signature") != Sign(secret, body) {
+			t.Errorf("bad signature %q", r.Header.Get("X-Repram-Signature"))
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		rc.payloads <- p
+	}))
+	t.Cleanup(rc.server.Close)
+	return rc
+}
+
+func (rc *receiver) next(t *testing.T) Payload {
+	t.Helper()
+	select {
+	case p := <-rc.payloads:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for callback")
+		return Payload{}
+	}
+}
+
+func TestParseHooks(t *testing.T) {
+	hooks, err := ParseHooks([]string{"jobs:=https://example.com/hook?a=b", "=http://localhost:9000/all"})
+	if err != nil {
+		t.Fatalf("ParseHooks: %v", err)
+	}
+	if hooks[0] != (Hook{Prefix: "jobs:", URL: "https://example.com/hook?a=b"}) {
+		t.Errorf("hooks[0] = %+v", hooks[0])
+	}
+	if hooks[1] != (Hook{Prefix: "", URL: "http://localhost:9000/all"}) {
+		t.Errorf("hooks[1] = %+v", hooks[1])
+	}
+
+	for _, bad := range []string{"https://example.com", "jobs:=ftp://example.com", "jobs:=not a url", "jobs:="} {
+		if _, err := ParseHooks([]string{bad}); err == nil {
+			t.Errorf("ParseHooks(%q) should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherSignsAndFiltersByPrefix(t *testing.T) {
+	rc := newReceiver(t, "webhook-secret", 0)
+	d := NewDispatcher("node-1", "webhook-secret", []Hook{{Prefix: "jobs:", URL: rc.server.URL}})
+	defer d.Close()
+
+	createdAt := time.Now().Truncate(time.Second)
+	d.Notify(storage.Event{Type: storage.EventPut, Key: "other:1", CreatedAt: createdAt, TTL: time.Minute})
+	d.Notify(storage.Event{Type: storage.EventExpire, Key: "jobs:42", CreatedAt: createdAt, TTL: time.Minute})
+
+	p := rc.next(t)
+	if p.Event != EventExpired || p.Key != "jobs:42" || p.NodeID != "node-1" || p.TTL != 60 || !p.CreatedAt.Equal(createdAt) {
+		t.Errorf("unexpected payload %+v", p)
+	}
+	select {
+	case p := <-rc.payloads:
+		t.Errorf("key outside the prefix should not be delivered, got %+v", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDispatcherRetriesServerErrors(t *testing.T) {
+	rc := newReceiver(t, "", 1)
+	d := NewDispatcher("node-1", "", []Hook{{URL: rc.server.URL}})
+	defer d.Close()
+
+	d.Notify(storage.Event{Type: storage.EventPut, Key: "k", CreatedAt: time.Now(), TTL: time.Minute})
+
+	if p := rc.next(t); p.Event != EventCreated || p.Key != "k" {
+		t.Errorf("unexpected payload %+v", p)
+	}
+	if n := rc.requests.Load(); n != 2 {
+		t.Errorf("expected 2 requests (one failure, one retry), got %d", n)
+	}
+}
+
+func TestShutdownDeliversQueuedCallbacks(t *testing.T) {
+	rc := newReceiver(t, "", 0)
+	d := NewDispatcher("node-1", "", []Hook{{URL: rc.server.URL}})
+
+	for _, key := range []string{"a", "b", "c"} {
+		d.Notify(storage.Event{Type: storage.EventPut, Key: key, CreatedAt: time.Now(), TTL: time.Minute})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d.Shutdown(ctx)
+
+	if n := len(rc.payloads); n != 3 {
+		t.Errorf("delivered %d callbacks before Shutdown returned, want 3", n)
+	}
+	d.Notify(storage.Event{Type: storage.EventPut, Key: "late"}) // ignored, must not panic
+}
+
+func TestNotifyAfterCloseIsIgnored(t *testing.T) {
+	d := NewDispatcher("node-1", "", []Hook{{URL: "http://127.0.0.1:1/"}})
+	d.Close()
+	d.Close() // idempotent
+
+	d.Notify(storage.Event{Type: storage.EventPut, Key: "k"}) // must not panic
+}
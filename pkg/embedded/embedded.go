@@ -0,0 +1,322 @@
+// Package embedded runs a REPRAM node inside another Go program. The node
+// stores data in memory, replicates it to peers over the same wire protocol
+// as the repram binary, and can serve the standard HTTP API:
+//
+//	n := embedded.New(embedded.Config{HTTPPort: 8080, Peers: []string{"node2:8080"}})
+//	if err := n.Start(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer n.Stop()
+//	n.Put(ctx, "greeting", []byte("hello"), 10*time.Minute)
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"repram/internal/cluster"
+	"repram/internal/node"
+	"repram/internal/server"
+	"repram/internal/storage"
+)
+
+// Errors returned by Put.
+var (
+	// ErrNotStarted means Put was called before Start or after Stop.
+	ErrNotStarted = errors.New("embedded node is not running")
+	// ErrQuorumTimeout means the value was stored locally but not enough
+	// peers confirmed it within the write timeout. It will still propagate
+	// via gossip; this is not a write failure.
+	ErrQuorumTimeout = cluster.ErrQuorumTimeout
+	// ErrStoreFull means the node is at MaxStorageBytes.
+	ErrStoreFull = storage.ErrStoreFull
+	// ErrValueTooLarge means the value is over MaxValueBytes.
+	ErrValueTooLarge = storage.ErrValueTooLarge
+)
+
+// watchBuffer is how many events a Watch channel holds. Events for a
+// watcher that falls further behind are dropped.
+const watchBuffer = 256
+
+// Config configures an embedded node. Zero values select the same defaults
+// as the repram binary.
+type Config struct {
+	NodeID            string                // default: generated
+	Address           string                // address peers use to reach this node (default "localhost")
+	HTTPPort          int                   // port for the HTTP API and gossip, advertised to peers; 0 = standalone
+	NoListen          bool                  // don't bind HTTPPort; the application serves Handler() on it
+	Peers             []string              // bootstrap peers as host:httpPort
+	Enclave           string                // replication boundary (default "default")
+	Zone              string                // failure domain replicas spread across (default none)
+	Network           string                // "public" or "private" (default "private"); reported by /v1/health only
+	ReplicationFactor int                   // default 3
+	MinTTL            time.Duration         // default 5m
+	MaxTTL            time.Duration         // default 24h
+	WriteTimeout      time.Duration         // quorum wait (default 5s)
+	MaxStorageBytes   int64                 // 0 = unlimited
+	MaxValueBytes     int64                 // largest single value, local or replicated; 0 = unlimited
+	ClusterSecret     string                // gossip HMAC secret (empty = open mode)
+	RateLimit         int                   // HTTP requests per second per IP (default 100)
+	Registerer        prometheus.Registerer // HTTP security and partition merge metrics; nil = the default registry
+}
+
+func (c *Config) setDefaults() {
+	if c.NodeID == "" {
+		c.NodeID = fmt.Sprintf("node-%d", time.Now().UnixNano())
+	}
+	if c.Address == "" {
+		c.Address = "localhost"
+	}
+	if c.Network == "" {
+		c.Network = "private"
+	}
+	if c.ReplicationFactor == 0 {
+		c.ReplicationFactor = 3
+	}
+	if c.MinTTL == 0 {
+		c.MinTTL = 300 * time.Second
+	}
+	if c.MaxTTL == 0 {
+		c.MaxTTL = 86400 * time.Second
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = 5 * time.Second
+	}
+	if c.RateLimit == 0 {
+		c.RateLimit = 100
+	}
+}
+
+func (c *Config) validate() error {
+	var errs []error
+	if c.HTTPPort < 0 || c.HTTPPort > 65535 {
+		errs = append(errs, fmt.Errorf("HTTPPort=%d is out of range (0-65535)", c.HTTPPort))
+	}
+	if c.ReplicationFactor < 1 {
+		errs = append(errs, fmt.Errorf("ReplicationFactor=%d must be at least 1", c.ReplicationFactor))
+	}
+	if c.MinTTL < time.Second || c.MinTTL > c.MaxTTL {
+		errs = append(errs, fmt.Errorf("MinTTL=%v must be at least 1s and no more than MaxTTL=%v", c.MinTTL, c.MaxTTL))
+	}
+	if c.WriteTimeout < 0 || c.MaxStorageBytes < 0 || c.MaxValueBytes < 0 || c.RateLimit < 0 {
+		errs = append(errs, errors.New("WriteTimeout, MaxStorageBytes, MaxValueBytes, and RateLimit must not be negative"))
+	}
+	if c.Network != "public" && c.Network != "private" {
+		errs = append(errs, fmt.Errorf("Network=%q must be \"public\" or \"private\"", c.Network))
+	}
+	return errors.Join(errs...)
+}
+
+// EventType says what happened to a key.
+type EventType int
+
+const (
+	Created EventType = iota // written locally or replicated from a peer
+	Expired                  // removed by the cleanup worker after its TTL elapsed
+)
+
+// Event is delivered to Watch channels.
+type Event struct {
+	Type      EventType
+	Key       string
+	CreatedAt time.Time
+	TTL       time.Duration
+}
+
+type watcher struct {
+	prefix string
+	events chan Event
+}
+
+// Node is an in-process REPRAM participant.
+type Node struct {
+	cfg       Config
+	configErr error
+
+	cluster    *cluster.ClusterNode
+	securityMW *node.SecurityMiddleware
+	handler    http.Handler
+	httpServer *http.Server
+	keyRules   node.KeyRules
+
+	watchMutex sync.Mutex
+	watchers   map[*watcher]struct{}
+
+	running  atomic.Bool
+	stopOnce sync.Once
+}
+
+// New creates a node from cfg. Configuration errors are reported by Start.
+func New(cfg Config) *Node {
+	cfg.setDefaults()
+	n := &Node{cfg: cfg, watchers: make(map[*watcher]struct{})}
+	if n.configErr = cfg.validate(); n.configErr != nil {
+		return n
+	}
+
+	n.cluster = cluster.NewClusterNode(cfg.NodeID, cfg.Address, cfg.HTTPPort, cfg.HTTPPort, cfg.ReplicationFactor, cfg.MaxStorageBytes, cfg.WriteTimeout, cfg.ClusterSecret, cfg.Enclave)
+	n.cluster.SetZone(cfg.Zone)
+	n.cluster.SetStoreEventHandler(n.notify)
+	n.cluster.SetMaxValueBytes(cfg.MaxValueBytes)
+	n.cluster.SetMetricsRegisterer(cfg.Registerer)
+
+	n.securityMW = node.NewSecurityMiddlewareWithRegisterer(cfg.Registerer, cfg.RateLimit, cfg.RateLimit*2, 10*1024*1024, false)
+	corsOrigins, _ := node.ParseCORSOrigins([]string{"*"})
+	n.handler = server.New(server.Options{
+		ClusterNode: n.cluster,
+		NodeID:      cfg.NodeID,
+		Network:     cfg.Network,
+		MinTTL:      int(cfg.MinTTL.Seconds()),
+		MaxTTL:      int(cfg.MaxTTL.Seconds()),
+		SecurityMW:  n.securityMW,
+		CORSOrigins: corsOrigins,
+		KeyRules:    n.keyRules,
+	}).Router()
+	return n
+}
+
+// Start binds the HTTP port (if configured), joins the cluster through
+// cfg.Peers, and returns. The node runs until Stop is called or ctx is
+// cancelled.
+func (n *Node) Start(ctx context.Context) error {
+	if n.configErr != nil {
+		return fmt.Errorf("invalid embedded node configuration: %w", n.configErr)
+	}
+
+	// Listen before bootstrapping so peers can reach us as soon as they
+	// learn our address.
+	if n.cfg.HTTPPort != 0 && !n.cfg.NoListen {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", n.cfg.HTTPPort))
+		if err != nil {
+			return err
+		}
+		n.httpServer = &http.Server{Handler: n.handler}
+		go n.httpServer.Serve(listener)
+	}
+
+	if err := n.cluster.Start(ctx, n.cfg.Peers); err != nil {
+		if n.httpServer != nil {
+			n.httpServer.Close()
+		}
+		return err
+	}
+	n.running.Store(true)
+
+	go func() {
+		<-ctx.Done()
+		n.Stop()
+	}()
+	return nil
+}
+
+// Stop shuts down the HTTP listener and gossip, and closes all Watch
+// channels. Data held by the node is lost.
+func (n *Node) Stop() error {
+	var err error
+	n.stopOnce.Do(func() {
+		if n.running.Swap(false) {
+			if n.httpServer != nil {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				n.httpServer.Shutdown(shutdownCtx)
+			}
+			err = n.cluster.Stop()
+		}
+		if n.securityMW != nil {
+			n.securityMW.Close()
+		}
+
+		n.watchMutex.Lock()
+		for w := range n.watchers {
+			close(w.events)
+		}
+		n.watchers = nil
+		n.watchMutex.Unlock()
+	})
+	return err
+}
+
+// Handler returns the node's HTTP API, for mounting in an existing server
+// with NoListen. Peers gossip to /v1/gossip/message and /v1/bootstrap, so a
+// node in a cluster must serve it at Address:HTTPPort.
+func (n *Node) Handler() http.Handler {
+	return n.handler
+}
+
+// Put stores data under key and replicates it. TTL is clamped to
+// [MinTTL, MaxTTL]. A nil error means a quorum confirmed the write;
+// ErrQuorumTimeout means it is stored locally and still propagating. Put
+// waits for quorum until ctx's deadline, or WriteTimeout if it has none.
+func (n *Node) Put(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if !n.running.Load() {
+		return ErrNotStarted
+	}
+	if keyErr := n.keyRules.Validate(key); keyErr != nil {
+		return keyErr
+	}
+	ttl = max(n.cfg.MinTTL, min(ttl, n.cfg.MaxTTL))
+	return n.cluster.Put(ctx, key, data, ttl)
+}
+
+// Get returns the value stored under key, if it exists and has not expired.
+func (n *Node) Get(key string) ([]byte, bool) {
+	if !n.running.Load() {
+		return nil, false
+	}
+	return n.cluster.Get(key)
+}
+
+// Watch returns a channel of events for keys starting with prefix ("" for
+// all keys) and a function that stops the watch. Events arrive for writes
+// made through this node and for writes replicated from peers. The channel
+// is buffered; if the reader falls behind, events are dropped. It is closed
+// when the watch is stopped or the node stops.
+func (n *Node) Watch(prefix string) (<-chan Event, func()) {
+	w := &watcher{prefix: prefix, events: make(chan Event, watchBuffer)}
+
+	n.watchMutex.Lock()
+	defer n.watchMutex.Unlock()
+	if n.watchers == nil { // stopped
+		close(w.events)
+		return w.events, func() {}
+	}
+	n.watchers[w] = struct{}{}
+
+	return w.events, func() {
+		n.watchMutex.Lock()
+		defer n.watchMutex.Unlock()
+		if _, ok := n.watchers[w]; ok {
+			delete(n.watchers, w)
+			close(w.events)
+		}
+	}
+}
+
+// notify is the store event handler; it must not block.
+func (n *Node) notify(se storage.Event) {
+	event := Event{Type: Created, Key: se.Key, CreatedAt: se.CreatedAt, TTL: se.TTL}
+	if se.Type == storage.EventExpire {
+		event.Type = Expired
+	}
+
+	n.watchMutex.Lock()
+	defer n.watchMutex.Unlock()
+	for w := range n.watchers {
+		if !strings.HasPrefix(se.Key, w.prefix) {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+		}
+	}
+}
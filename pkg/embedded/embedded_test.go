@@ -0,0 +1,153 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestStandalonePutGetWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := New(Config{NodeID: "solo", ReplicationFactor: 1})
+	if err := n.Put(ctx, "k", []byte("v"), time.Minute); !errors.Is(err, ErrNotStarted) {
+		t.Fatalf("Put before Start: got %v, want ErrNotStarted", err)
+	}
+	if err := n.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer n.Stop()
+
+	events, stop := n.Watch("jobs:")
+	defer stop()
+
+	if err := n.Put(ctx, "other", []byte("x"), time.Minute); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := n.Put(ctx, "jobs:1", []byte("queued"), time.Second); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	data, ok := n.Get("jobs:1")
+	if !ok || string(data) != "queued" {
+		t.Fatalf("Get = %q, %v; want \"queued\", true", data, ok)
+	}
+
+	e := nextEvent(t, events)
+	if e.Type != Created || e.Key != "jobs:1" {
+		t.Errorf("event = %+v, want Created jobs:1", e)
+	}
+	if e.TTL != 300*time.Second {
+		t.Errorf("TTL = %v, want it raised to the default MinTTL of 5m", e.TTL)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("key outside the watched prefix produced %+v", e)
+	default:
+	}
+
+	if err := n.Put(ctx, "bad key", []byte("x"), time.Minute); err == nil {
+		t.Error("Put should reject keys containing whitespace")
+	}
+}
+
+func TestStopClosesWatches(t *testing.T) {
+	n := New(Config{ReplicationFactor: 1})
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	events, _ := n.Watch("")
+	n.Stop()
+
+	if _, open := <-events; open {
+		t.Fatal("Watch channel should be closed after Stop")
+	}
+	if _, ok := n.Get("anything"); ok {
+		t.Error("Get after Stop should report not found")
+	}
+}
+
+func TestStartReportsConfigErrors(t *testing.T) {
+	n := New(Config{HTTPPort: 70000, MinTTL: time.Hour, MaxTTL: time.Minute})
+	err := n.Start(context.Background())
+	if err == nil {
+		t.Fatal("expected configuration error")
+	}
+	for _, want := range []string{"HTTPPort=70000", "MinTTL=1h0m0s"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	n.Stop() // must not panic
+}
+
+// startServed starts a node whose Handler is served by the test on a
+// loopback listener, as an application embedding REPRAM in its own HTTP
+// server would.
+func startServed(t *testing.T, ctx context.Context, id string, peers []string) (*Node, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	n := New(Config{
+		NodeID:            id,
+		Address:           "127.0.0.1",
+		HTTPPort:          port,
+		NoListen:          true,
+		Peers:             peers,
+		ReplicationFactor: 2,
+		WriteTimeout:      2 * time.Second,
+	})
+	srv := &httptest.Server{Listener: listener, Config: &http.Server{Handler: n.Handler()}}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	if err := n.Start(ctx); err != nil {
+		t.Fatalf("Start %s: %v", id, err)
+	}
+	t.Cleanup(func() { n.Stop() })
+	return n, fmt.Sprintf("127.0.0.1:%d", port)
+}
+
+func TestReplicationBetweenEmbeddedNodes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first, firstAddr := startServed(t, ctx, "embedded-1", nil)
+	second, _ := startServed(t, ctx, "embedded-2", []string{firstAddr})
+
+	events, stop := second.Watch("")
+	defer stop()
+
+	if err := first.Put(ctx, "shared", []byte("hello"), time.Minute); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if e := nextEvent(t, events); e.Type != Created || e.Key != "shared" {
+		t.Errorf("event on peer = %+v, want Created shared", e)
+	}
+	if data, ok := second.Get("shared"); !ok || string(data) != "hello" {
+		t.Errorf("peer Get = %q, %v; want \"hello\", true", data, ok)
+	}
+}
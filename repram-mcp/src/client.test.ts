@@ -84,6 +84,8 @@ describe("store", () => {
         headers: {
           "X-TTL": "600",
           "Content-Type": "application/octet-stream",
+          // SHA-256 of "my-data"
+          "X-Content-SHA256": "c0b8114a809d94b548e3f098b4b76b1589e8ea6297dc795b1377df2c99055385",
         },
         body: "my-data",
       }
@@ -136,6 +138,34 @@ describe("retrieve", () => {
     });
   });
 
+  it("accepts a value matching its X-Content-SHA256", async () => {
+    mockFetch({
+      status: 200,
+      headers: {
+        // SHA-256 of "stored payload"
+        "X-Content-SHA256": "14be817553264c4c1fb599964dc7ad063d9498dce264ac5e34d1993e455e98ae",
+      },
+      body: "stored payload",
+    });
+    const client = new RepramClient("http://localhost:8080");
+
+    const result = await client.retrieve("test-key");
+    expect(result?.data).toBe("stored payload");
+  });
+
+  it("throws when the value does not match its X-Content-SHA256", async () => {
+    mockFetch({
+      status: 200,
+      headers: {
+        "X-Content-SHA256": "14be817553264c4c1fb599964dc7ad063d9498dce264ac5e34d1993e455e98ae",
+      },
+      body: "stored pay",
+    });
+    const client = new RepramClient("http://localhost:8080");
+
+    await expect(client.retrieve("test-key")).rejects.toThrow("X-Content-SHA256");
+  });
+
   it("returns null on 404", async () => {
     mockFetch({ status: 404, ok: false });
     const client = new RepramClient("http://localhost:8080");
@@ -2,6 +2,7 @@
  * REPRAM client — HTTP and in-process implementations.
  */
 
+import { createHash } from "node:crypto";
 import type { ClusterNode } from "./node/cluster.js";
 
 export interface StoreResult {
@@ -92,6 +93,7 @@ export class RepramClient implements RepramClientInterface {
       headers: {
         "X-TTL": String(ttlSeconds),
         "Content-Type": "application/octet-stream",
+        "X-Content-SHA256": sha256(data),
       },
       body: data,
     });
@@ -114,6 +116,11 @@ export class RepramClient implements RepramClientInterface {
     }
 
     const data = await response.text();
+    // Nodes that predate the header don't send it
+    const checksum = response.headers.get("X-Content-SHA256");
+    if (checksum !== null && checksum.toLowerCase() !== sha256(data)) {
+      throw new Error("REPRAM retrieve failed: value does not match its X-Content-SHA256");
+    }
     const createdAt = response.headers.get("X-Created-At") ?? "";
     const remainingTtlSeconds = parseInt(response.headers.get("X-Remaining-TTL") ?? "0", 10);
     const originalTtlSeconds = parseInt(response.headers.get("X-Original-TTL") ?? "0", 10);
@@ -159,3 +166,8 @@ export class RepramClient implements RepramClientInterface {
     return { keys: body.keys ?? [] };
   }
 }
+
+/** Hex SHA-256 of a value's UTF-8 bytes, as sent in X-Content-SHA256. */
+function sha256(data: string): string {
+  return createHash("sha256").update(data, "utf8").digest("hex");
+}